@@ -0,0 +1,77 @@
+package valast
+
+import (
+	"reflect"
+)
+
+// emptyInterfaceType is the type interface{}.
+var emptyInterfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
+
+// interfaceFieldsAST computes the AST for the value v held by an interface, which is an anonymous
+// struct (or a pointer to one) with fields whose types are unexported types of other packages, see
+// Options.UnexportedFieldTypesAsInterface. Such fields are written with the type interface{}
+// instead, and their values converted to the predeclared type of their kind where possible, e.g.
+// `struct{ Level interface{} }{Level: 3}` for a value of type `struct{ Level foo.level }`.
+//
+// It reports false if v is not such a value, or if its fields cannot be written this way, e.g.
+// because their names are unexported, in which case v requires unexported access as before.
+func interfaceFieldsAST(v reflect.Value, opt *Options, path string, s *state) (Result, bool, error) {
+	ptr := v.Kind() == reflect.Ptr
+	if ptr {
+		if v.IsNil() {
+			return Result{}, false, nil
+		}
+		v = unexported(v.Elem())
+	}
+	t := v.Type()
+	if t.Kind() != reflect.Struct || t.Name() != "" {
+		return Result{}, false, nil
+	}
+
+	fields := make([]reflect.StructField, t.NumField())
+	rewritten := make([]bool, t.NumField())
+	for i := range fields {
+		field := t.Field(i)
+		if field.Anonymous || (field.PkgPath != "" && field.PkgPath != opt.PackagePath) {
+			return Result{}, false, nil
+		}
+		fieldType, err := typeExpr(field.Type, opt.withUnqualify(), s.typeExprCache)
+		if err != nil {
+			return Result{}, false, err
+		}
+		if fieldType.RequiresUnexported {
+			field.Type, rewritten[i] = emptyInterfaceType, true
+		}
+		fields[i] = field
+	}
+
+	erased := reflect.New(reflect.StructOf(fields))
+	for i, rewrite := range rewritten {
+		value, field := unexported(v.Field(i)), unexported(erased.Elem().Field(i))
+		if !value.CanInterface() || !field.CanSet() {
+			return Result{}, false, nil
+		}
+		if rewrite {
+			if value.IsZero() {
+				continue // omitted, rather than a non-nil interface holding a zero value
+			}
+			if basic, ok := builtinTypes[value.Kind().String()]; ok {
+				value = value.Convert(basic)
+			}
+		}
+		field.Set(value)
+	}
+	if !ptr {
+		erased = erased.Elem()
+	}
+	mark := len(s.omissions)
+	result, err := computeASTProfiled(erased, opt, path, s)
+	if err != nil {
+		return Result{}, false, err
+	}
+	if result.RequiresUnexported {
+		s.omissions = s.omissions[:mark]
+		return Result{}, false, nil
+	}
+	return result, true, nil
+}
@@ -0,0 +1,195 @@
+package valast
+
+import (
+	"go/ast"
+	"reflect"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Builder describes how values of a struct type are constructed via a chain of builder method
+// calls instead of a composite literal, for APIs which forbid direct struct construction, e.g.:
+//
+//	foo.NewRequest("GET").WithHeader("Accept", "text/plain").WithTimeout(5 * time.Second).Build()
+//
+// Each method of the chain is called with the value of a single non-zero struct field. See
+// HandleBuilder.
+type Builder struct {
+	// New is the name of the function which starts the chain, declared in the package of the
+	// struct type, e.g. "NewRequest".
+	New string
+
+	// Args are the names of the struct fields passed as arguments to New, in order. They are
+	// passed even if they are the zero value.
+	Args []string
+
+	// Methods maps the names of struct fields to the names of the methods setting them, e.g.
+	// "Timeout": "WithTimeout". Fields not in Args or Methods are set using the method named by
+	// Prefix followed by the field name, with its first letter upper-cased.
+	Methods map[string]string
+
+	// Prefix is the prefix of the method names of fields not in Methods. The default is "With".
+	Prefix string
+
+	// Build, if non-empty, is the name of the method which ends the chain, e.g. "Build".
+	Build string
+
+	// Ptr indicates that the chain produces a pointer to the struct (e.g. *Request) rather than
+	// the struct itself.
+	Ptr bool
+}
+
+// HandleBuilder adds b to the preset p to write values of the struct type T, and pointers to
+// them, as builder call chains, and returns p. It replaces any builder p already has for T.
+func HandleBuilder[T any](p *Preset, b Builder) *Preset {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() != reflect.Struct {
+		panic("valast: HandleBuilder requires a struct type, found " + t.String())
+	}
+	for _, name := range b.Args {
+		if field, ok := t.FieldByName(name); !ok || len(field.Index) != 1 {
+			panic("valast: HandleBuilder argument " + name + " is not a field of " + t.String())
+		}
+	}
+	if p.builders == nil {
+		p.builders = map[reflect.Type]*Builder{}
+	}
+	p.builders[t] = &b
+	return p
+}
+
+// builder returns the builder for the struct type t from Options.Presets, if any.
+func (o *Options) builder(t reflect.Type) *Builder {
+	for i := len(o.Presets) - 1; i >= 0; i-- {
+		if b := o.Presets[i].builders[t]; b != nil {
+			return b
+		}
+	}
+	return nil
+}
+
+// method returns the name of the builder method setting the named field.
+func (b *Builder) method(field string) string {
+	if name, ok := b.Methods[field]; ok {
+		return name
+	}
+	prefix := b.Prefix
+	if prefix == "" {
+		prefix = "With"
+	}
+	r, size := utf8.DecodeRuneInString(field)
+	return prefix + string(unicode.ToUpper(r)) + field[size:]
+}
+
+// builderAST computes the AST for the struct value v (or a pointer to it, if ptr is true) as the
+// call chain described by b.
+func builderAST(v reflect.Value, ptr bool, b *Builder, opt *Options, path string, s *state) (Result, error) {
+	t := v.Type()
+	structType, err := typeExpr(t, opt, s.typeExprCache)
+	if err != nil {
+		return Result{}, err
+	}
+	if opt.ExportedOnly && structType.RequiresUnexported {
+		return Result{RequiresUnexported: true}, nil
+	}
+	result := Result{RequiresUnexported: structType.RequiresUnexported}
+
+	var fun ast.Expr = ast.NewIdent(b.New)
+	if sel, ok := structType.AST.(*ast.SelectorExpr); ok {
+		fun = &ast.SelectorExpr{X: sel.X, Sel: ast.NewIdent(b.New)}
+	}
+	isArg := map[string]bool{}
+	call := &ast.CallExpr{Fun: fun}
+	for _, name := range b.Args {
+		isArg[name] = true
+		field, _ := t.FieldByName(name)
+		value, ok, err := structFieldAST(v, field.Index[0], opt, path, s)
+		if err != nil {
+			return Result{}, err
+		}
+		if !ok {
+			value, err = computeASTProfiled(reflect.Zero(field.Type), opt.withUnqualify(), path+"."+name, s)
+			if err != nil {
+				return Result{}, err
+			}
+		}
+		if value.RequiresUnexported {
+			if opt.ExportedOnly {
+				return Result{RequiresUnexported: true}, nil
+			}
+			result.RequiresUnexported = true
+		}
+		result.OmittedUnexported = result.OmittedUnexported || value.OmittedUnexported
+		call.Args = append(call.Args, value.AST)
+	}
+
+	var (
+		chain   ast.Expr = call
+		methods []*ast.Ident
+	)
+	for i := 0; i < t.NumField(); i++ {
+		field, mark := t.Field(i), len(s.omissions)
+		if isArg[field.Name] {
+			continue
+		}
+		if !accessible(field, opt) {
+			if !v.Field(i).IsZero() {
+				result.OmittedUnexported = true
+				s.omit(mark, path+"."+field.Name, v.Field(i), OmissionUnexported)
+			}
+			continue
+		}
+		if excludeField(t, field, opt) {
+			if !unexported(v.Field(i)).IsZero() {
+				s.omit(mark, path+"."+field.Name, v.Field(i), OmissionExcluded)
+			}
+			continue
+		}
+		value, ok, err := structFieldAST(v, i, opt, path, s)
+		if err != nil {
+			return Result{}, err
+		}
+		if !ok {
+			if !unexported(v.Field(i)).IsZero() {
+				s.omit(mark, path+"."+field.Name, v.Field(i), OmissionRedacted)
+			}
+			continue
+		}
+		if value.RequiresUnexported {
+			if opt.ExportedOnly {
+				result.OmittedUnexported = true
+				s.omit(mark, path+"."+field.Name, v.Field(i), OmissionUnexported)
+				continue
+			}
+			result.RequiresUnexported = true
+			s.omit(mark, path+"."+field.Name, v.Field(i), OmissionRequiresUnexported)
+		}
+		result.OmittedUnexported = result.OmittedUnexported || value.OmittedUnexported
+		method := ast.NewIdent(b.method(field.Name))
+		methods = append(methods, method)
+		chain = &ast.CallExpr{
+			Fun:  &ast.SelectorExpr{X: chain, Sel: method},
+			Args: []ast.Expr{value.AST},
+		}
+	}
+	if b.Build != "" {
+		method := ast.NewIdent(b.Build)
+		methods = append(methods, method)
+		chain = &ast.CallExpr{Fun: &ast.SelectorExpr{X: chain, Sel: method}}
+	}
+	if opt.lineMarkers && len(methods) > 1 {
+		// Write each method call of the chain on its own line.
+		for _, method := range methods {
+			method.Name = newlineMarker + method.Name
+		}
+	}
+
+	switch {
+	case b.Ptr && !ptr:
+		chain = &ast.StarExpr{X: chain}
+	case !b.Ptr && ptr:
+		chain = &ast.CallExpr{Fun: opt.helperFunc("Ptr", s.packagesFound), Args: []ast.Expr{chain}}
+	}
+	result.AST = chain
+	return result, nil
+}
@@ -0,0 +1,36 @@
+package valast
+
+import (
+	"strings"
+
+	"github.com/hexops/valast/internal/highlight"
+)
+
+// ansiColors maps each kind of token to the ANSI escape sequence selecting its color, see
+// Options.Colorize.
+var ansiColors = map[highlight.Kind]string{
+	highlight.Keyword: "\x1b[35m", // magenta
+	highlight.Builtin: "\x1b[36m", // cyan
+	highlight.String:  "\x1b[32m", // green
+	highlight.Number:  "\x1b[33m", // yellow
+	highlight.Comment: "\x1b[90m", // bright black
+}
+
+const ansiReset = "\x1b[0m"
+
+// colorize highlights the Go syntax src with ANSI escape sequences.
+func colorize(src string) string {
+	var b strings.Builder
+	b.Grow(len(src) * 2)
+	for _, tok := range highlight.Tokens(src) {
+		color, ok := ansiColors[tok.Kind]
+		if !ok {
+			b.WriteString(tok.Text)
+			continue
+		}
+		b.WriteString(color)
+		b.WriteString(tok.Text)
+		b.WriteString(ansiReset)
+	}
+	return b.String()
+}
@@ -0,0 +1,29 @@
+// Package config converts configuration files (YAML and TOML) into Go literal syntax via valast,
+// e.g. for embedding defaults as typed config-struct literals.
+//
+// It is a separate module so that users of valast do not depend on YAML and TOML parsers.
+package config
+
+import (
+	"github.com/BurntSushi/toml"
+	"github.com/hexops/valast"
+	"gopkg.in/yaml.v3"
+)
+
+// FromYAML unmarshals the YAML data into target and converts the result into the equivalent Go
+// literal syntax.
+//
+// target must be a non-nil pointer to the desired type, e.g. &Config{}. If target is nil, the data
+// is unmarshaled into an interface{} value, producing generic maps and slices.
+func FromYAML(data []byte, target interface{}, opt *valast.Options) (string, error) {
+	return valast.FromUnmarshal(yaml.Unmarshal, data, target, opt)
+}
+
+// FromTOML unmarshals the TOML data into target and converts the result into the equivalent Go
+// literal syntax.
+//
+// target must be a non-nil pointer to the desired type, e.g. &Config{}. If target is nil, the data
+// is unmarshaled into an interface{} value, producing generic maps and slices.
+func FromTOML(data []byte, target interface{}, opt *valast.Options) (string, error) {
+	return valast.FromUnmarshal(toml.Unmarshal, data, target, opt)
+}
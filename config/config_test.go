@@ -0,0 +1,52 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/hexops/autogold"
+)
+
+type server struct {
+	Host    string   `yaml:"host" toml:"host"`
+	Port    int      `yaml:"port" toml:"port"`
+	Origins []string `yaml:"origins" toml:"origins"`
+}
+
+type settings struct {
+	Name   string `yaml:"name" toml:"name"`
+	Debug  bool   `yaml:"debug" toml:"debug"`
+	Server server `yaml:"server" toml:"server"`
+}
+
+func TestFromYAML(t *testing.T) {
+	data := []byte(`
+name: example
+debug: true
+server:
+  host: localhost
+  port: 8080
+  origins: [a.example, b.example]
+`)
+	got, err := FromYAML(data, &settings{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	autogold.Equal(t, got)
+}
+
+func TestFromTOML(t *testing.T) {
+	data := []byte(`
+name = "example"
+debug = true
+
+[server]
+host = "localhost"
+port = 8080
+origins = ["a.example", "b.example"]
+`)
+	got, err := FromTOML(data, &settings{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	autogold.Equal(t, got)
+}
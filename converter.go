@@ -0,0 +1,116 @@
+package valast
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"sync"
+)
+
+// Converter converts values into Go syntax using the same options, caching package names, type
+// expressions and struct constructors across conversions. It is useful when repeatedly
+// converting values of the same types, e.g. when logging.
+//
+// Conversions using the same Converter are serialized; use multiple Converters to convert values
+// concurrently.
+type Converter struct {
+	opt, formatOpt *Options // prepared, see Options.prepare
+
+	mu               sync.Mutex
+	typeExprCache    typeExprCache
+	constructorCache map[reflect.Type]*construction
+
+	namesMu      sync.Mutex // guards names, which may be accessed by parallel conversions
+	names        map[string]string
+	packageNames PackageResolver
+}
+
+// NewConverter returns a new Converter using the specified options, which must not be modified
+// afterwards.
+func NewConverter(opt *Options) *Converter {
+	if opt == nil {
+		opt = defaultOptions()
+	}
+	o := *opt
+	c := &Converter{
+		typeExprCache:    typeExprCache{},
+		constructorCache: map[reflect.Type]*construction{},
+		names:            map[string]string{},
+		packageNames:     o.packageResolver(),
+	}
+	o.PackagePathToName = c.packagePathToName
+	c.opt = o.prepare()
+	formatOpt := o
+	formatOpt.lineMarkers = true
+	c.formatOpt = formatOpt.prepare()
+	return c
+}
+
+// packagePathToName returns the name of the package with the given path, caching the result.
+func (c *Converter) packagePathToName(path string) (string, error) {
+	c.namesMu.Lock()
+	name, ok := c.names[path]
+	c.namesMu.Unlock()
+	if ok {
+		return name, nil
+	}
+	name, err := c.packageNames.PackageName(path)
+	if err != nil {
+		return "", err
+	}
+	c.namesMu.Lock()
+	c.names[path] = name
+	c.namesMu.Unlock()
+	return name, nil
+}
+
+func (c *Converter) convert(ctx context.Context, v reflect.Value, opt *Options) (Result, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return convert(ctx, v, opt, c.typeExprCache, c.constructorCache)
+}
+
+// AST is like the AST function, using the Converter's options and caches.
+//
+// The returned AST may share type expression nodes with ASTs returned by other calls, and thus
+// must not be modified.
+func (c *Converter) AST(v reflect.Value) (Result, error) {
+	return c.ASTContext(context.Background(), v)
+}
+
+// ASTContext is like the ASTContext function, using the Converter's options and caches.
+func (c *Converter) ASTContext(ctx context.Context, v reflect.Value) (Result, error) {
+	return c.convert(ctx, v, c.opt)
+}
+
+// String is like StringWithOptions, using the Converter's options and caches.
+func (c *Converter) String(v interface{}) string {
+	str, _, err := c.format(v)
+	if err != nil && str == "" {
+		return err.Error()
+	}
+	if c.opt.Colorize {
+		return colorize(str)
+	}
+	return str
+}
+
+// Fprint writes the Go syntax of the value v to w, followed by a newline.
+func (c *Converter) Fprint(w io.Writer, v interface{}) error {
+	str, _, err := c.format(v)
+	if str == "" {
+		return err
+	}
+	if c.opt.Colorize {
+		str = colorize(str)
+	}
+	if _, werr := io.WriteString(w, str+"\n"); werr != nil {
+		return werr
+	}
+	return err
+}
+
+func (c *Converter) format(v interface{}) (string, Result, error) {
+	result, err := c.convert(context.Background(), reflect.ValueOf(v), c.formatOpt)
+	return formatResult(v, result, err, c.opt)
+}
@@ -1,26 +1,193 @@
 package valast
 
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"strings"
+)
+
+// CyclePolicy describes how values which (directly or indirectly) contain themselves are written
+// where they recur, see Options.OnCycle.
+type CyclePolicy int
+
+const (
+	// CyclePolicyNil indicates the recurring value is written as nil.
+	CyclePolicyNil CyclePolicy = iota
+
+	// CyclePolicyComment indicates the recurring value is written as nil followed by a comment,
+	// i.e. `nil /* cycle */`, such that readers know data was dropped.
+	CyclePolicyComment
+
+	// CyclePolicyError indicates an *ErrCycle error is returned.
+	CyclePolicyError
+
+	// CyclePolicyVariables indicates that if the value contains cycles, it is written as
+	// statements declaring it as the variable v and then assigning the recurring values, within a
+	// function literal which is immediately called, e.g.:
+	//
+	// 	func() *Node {
+	// 		v := &Node{Name: "root", Children: []*Node{{Name: "child"}}}
+	// 		v.Children[0].Parent = v
+	// 		return v
+	// 	}()
+	//
+	// The output is then equivalent to the input. An *ErrCycle error is returned if a recurring
+	// value cannot be assigned this way, e.g. because it is found within an interface value.
+	CyclePolicyVariables
+)
+
+// ErrCycle describes that a value contains itself, which is not permitted by Options.OnCycle.
+type ErrCycle struct {
+	// Value is the actual value that was being converted.
+	Value interface{}
+}
+
+// Error implements the error interface.
+func (e *ErrCycle) Error() string {
+	return fmt.Sprintf("valast: cyclic value of type %T", e.Value)
+}
+
+// cycleDetector detects cyclic data structures, i.e. pointers, maps and slices which (directly or
+// indirectly) contain themselves, by tracking those currently being converted.
 type cycleDetector struct {
-	seen map[interface{}]int
+	seen map[cycleKey]string // the paths of the values being converted
 }
 
-func (c *cycleDetector) push(ptr interface{}) bool {
+// cycleKey identifies a pointer, map or slice value by its type and the address it refers to.
+// Slices also have their length, as slices of different lengths sharing an array are different
+// values.
+type cycleKey struct {
+	t   reflect.Type
+	ptr uintptr
+	len int
+}
+
+func newCycleKey(v reflect.Value) cycleKey {
+	k := cycleKey{t: v.Type(), ptr: v.Pointer()}
+	if v.Kind() == reflect.Slice {
+		k.len = v.Len()
+	}
+	return k
+}
+
+// push records that v, found at path, is being converted. If it already was, i.e. v contains
+// itself, cyclic is true and target is the path at which it was first found.
+func (c *cycleDetector) push(v reflect.Value, path string) (target string, cyclic bool) {
 	if c.seen == nil {
-		c.seen = map[interface{}]int{}
+		c.seen = map[cycleKey]string{}
 	}
-	cycles, seen := c.seen[ptr]
-	if seen && cycles > 1 {
+	k := newCycleKey(v)
+	if target, ok := c.seen[k]; ok {
+		return target, true
+	}
+	c.seen[k] = path
+	return "", false
+}
+
+// pop records that v is no longer being converted.
+func (c *cycleDetector) pop(v reflect.Value) {
+	delete(c.seen, newCycleKey(v))
+}
+
+// mayContainCycle reports if values of the map or slice type t may contain themselves, i.e. if
+// their elements (or keys) are not of a basic type.
+func mayContainCycle(t reflect.Type) bool {
+	if t.Kind() == reflect.Map && !isBasicKind(t.Key().Kind()) {
 		return true
 	}
-	c.seen[ptr] = cycles + 1
-	return false
+	return !isBasicKind(t.Elem().Kind())
+}
+
+// isBasicKind reports if values of kind k are booleans, numbers or strings.
+func isBasicKind(k reflect.Kind) bool {
+	return (k >= reflect.Bool && k <= reflect.Complex128) || k == reflect.String
+}
+
+// cycleRef is a recurring value found at path, which is the value found at target.
+type cycleRef struct {
+	path, target string
+}
+
+// opaquePath describes that the elements of the value found at path (and if self is set, the
+// value itself) cannot be assigned via `v` followed by their path, e.g. the fields of a struct
+// within an interface value. See CyclePolicyVariables.
+type opaquePath struct {
+	path string
+	self bool
+}
+
+// cycle returns the result written in place of the value v found at path, which recurs as it is
+// the value found at target, according to Options.OnCycle.
+func (s *state) cycle(v reflect.Value, opt *Options, path, target string) (Result, error) {
+	switch opt.OnCycle {
+	case CyclePolicyComment:
+		return Result{AST: ast.NewIdent("nil /* cycle */")}, nil
+	case CyclePolicyError:
+		return Result{}, &ErrCycle{Value: v.Interface()}
+	case CyclePolicyVariables:
+		if !s.assignable(path) || !s.assignable(target) {
+			return Result{}, &ErrCycle{Value: v.Interface()}
+		}
+		s.cycles = append(s.cycles, cycleRef{path: path, target: target})
+	}
+	return Result{AST: ast.NewIdent("nil")}, nil
+}
+
+// pushOpaque records that the elements of the value found at path (and if self is set, the value
+// itself) cannot be assigned, until the matching popOpaque. See CyclePolicyVariables.
+func (s *state) pushOpaque(opt *Options, path string, self bool) {
+	if opt.OnCycle == CyclePolicyVariables {
+		s.opaque = append(s.opaque, opaquePath{path: path, self: self})
+	}
+}
+
+func (s *state) popOpaque(opt *Options) {
+	if opt.OnCycle == CyclePolicyVariables {
+		s.opaque = s.opaque[:len(s.opaque)-1]
+	}
+}
+
+// assignable reports if the value found at path can be assigned via `v` followed by its path.
+func (s *state) assignable(path string) bool {
+	for _, o := range s.opaque {
+		if !strings.HasPrefix(path, o.path) {
+			continue
+		}
+		if len(path) == len(o.path) && o.self {
+			return false
+		}
+		if len(path) > len(o.path) && (path[len(o.path)] == '.' || path[len(o.path)] == '[') {
+			return false
+		}
+	}
+	return true
 }
 
-func (c *cycleDetector) pop(ptr interface{}) {
-	cycles := c.seen[ptr]
-	cycles--
-	if cycles < 0 {
-		cycles = 0
+// cycleStatements returns a call of a function literal declaring the variable v of type t as the
+// expression x, assigning the recurring values found within it and returning it, see
+// CyclePolicyVariables.
+func cycleStatements(t ast.Expr, x ast.Expr, cycles []cycleRef) (ast.Expr, error) {
+	body := []ast.Stmt{&ast.AssignStmt{Lhs: []ast.Expr{ast.NewIdent("v")}, Tok: token.DEFINE, Rhs: []ast.Expr{x}}}
+	for _, c := range cycles {
+		lhs, err := parser.ParseExpr("v" + c.path)
+		if err != nil {
+			return nil, err
+		}
+		rhs, err := parser.ParseExpr("v" + c.target)
+		if err != nil {
+			return nil, err
+		}
+		body = append(body, &ast.AssignStmt{Lhs: []ast.Expr{lhs}, Tok: token.ASSIGN, Rhs: []ast.Expr{rhs}})
 	}
-	c.seen[ptr] = cycles
+	body = append(body, &ast.ReturnStmt{Results: []ast.Expr{ast.NewIdent("v")}})
+	return &ast.CallExpr{Fun: &ast.FuncLit{
+		Type: &ast.FuncType{
+			Params:  &ast.FieldList{},
+			Results: &ast.FieldList{List: []*ast.Field{{Type: t}}},
+		},
+		Body: &ast.BlockStmt{List: body},
+	}}, nil
 }
@@ -0,0 +1,195 @@
+package valast
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// DeclOptions describes options for producing declarations via Decl.
+type DeclOptions struct {
+	// Const, if true, indicates a const declaration should be produced instead of a var
+	// declaration. All values must then be booleans, numbers, or strings.
+	Const bool
+
+	// ExplicitTypes, if true, indicates the type of each value should be written in its spec,
+	// e.g. `Foo int8 = 1` instead of `Foo = int8(1)`.
+	//
+	// Otherwise, types are inferred: values of type int, string, bool and float64 are written as
+	// untyped constants (e.g. `Foo = 1`), and all others are written with a conversion.
+	ExplicitTypes bool
+}
+
+// DeclResult is a result from converting a set of named Go values into a declaration.
+type DeclResult struct {
+	// Decl is the const or var declaration, with one spec per value sorted by name.
+	Decl *ast.GenDecl
+
+	// RequiresUnexported indicates if the declaration requires access to unexported types/values
+	// outside of the package specified in the Options, and is thus invalid code.
+	RequiresUnexported bool
+
+	// Packages is the list of packages that are used in the declaration.
+	Packages []string
+}
+
+// Decl converts the named values into a grouped var (or const) declaration, e.g.:
+//
+//	var (
+//		Bar = "hello"
+//		Foo = int8(1)
+//	)
+func Decl(values map[string]interface{}, declOpt *DeclOptions, opt *Options) (DeclResult, error) {
+	if declOpt == nil {
+		declOpt = &DeclOptions{}
+	}
+	if opt == nil {
+		opt = defaultOptions()
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	decl := &ast.GenDecl{Tok: token.VAR, Lparen: 1}
+	if declOpt.Const {
+		decl.Tok = token.CONST
+	}
+	var (
+		result   DeclResult
+		packages = map[string]bool{}
+		cache    = typeExprCache{}
+	)
+	for _, name := range names {
+		v := reflect.ValueOf(values[name])
+		if declOpt.Const && !isConstant(v) {
+			return DeclResult{}, fmt.Errorf("valast: %s: cannot declare constant of type %T", name, values[name])
+		}
+		if !v.IsValid() {
+			// nil interface, e.g. `var Foo = nil` is invalid.
+			return DeclResult{}, fmt.Errorf("valast: %s: cannot declare untyped nil", name)
+		}
+
+		r, err := AST(v, opt)
+		if err != nil {
+			return DeclResult{}, fmt.Errorf("valast: %s: %w", name, err)
+		}
+		result.RequiresUnexported = result.RequiresUnexported || r.RequiresUnexported
+		for _, p := range r.Packages {
+			packages[p] = true
+		}
+
+		spec := &ast.ValueSpec{Names: []*ast.Ident{ast.NewIdent(name)}, Values: []ast.Expr{r.AST}}
+		if declOpt.ExplicitTypes {
+			t, err := typeExpr(v.Type(), opt, cache)
+			if err != nil {
+				return DeclResult{}, fmt.Errorf("valast: %s: %w", name, err)
+			}
+			result.RequiresUnexported = result.RequiresUnexported || t.RequiresUnexported
+			spec.Type = t.AST
+			if call, ok := r.AST.(*ast.CallExpr); ok && isConstant(v) && len(call.Args) == 1 {
+				// The conversion is redundant, e.g. `Foo int8 = int8(1)`.
+				spec.Values[0] = call.Args[0]
+			}
+		}
+		decl.Specs = append(decl.Specs, spec)
+	}
+	for p := range packages {
+		if p != "" {
+			result.Packages = append(result.Packages, p)
+		}
+	}
+	sort.Strings(result.Packages)
+	result.Decl = decl
+	return result, nil
+}
+
+// DeclString converts the named values into formatted Go syntax for a grouped var (or const)
+// declaration, see Decl.
+//
+// If any error occurs, it will be returned as the string value. If handling errors is desired then
+// consider using the Decl function directly.
+func DeclString(values map[string]interface{}, declOpt *DeclOptions, opt *Options) string {
+	if opt == nil {
+		opt = defaultOptions()
+	}
+	result, err := Decl(values, declOpt, opt)
+	if err != nil {
+		return err.Error()
+	}
+	if opt.ExportedOnly && result.RequiresUnexported {
+		return "valast: cannot declare unexported values"
+	}
+
+	fset := token.NewFileSet()
+	var src bytes.Buffer
+	fmt.Fprintf(&src, "package p\n\n%s (\n", result.Decl.Tok)
+	for _, spec := range result.Decl.Specs {
+		spec := spec.(*ast.ValueSpec)
+		fmt.Fprintf(&src, "%s", spec.Names[0].Name)
+		if spec.Type != nil {
+			src.WriteString(" ")
+			if err := format.Node(&src, fset, spec.Type); err != nil {
+				return (&ErrFormat{Err: err}).Error()
+			}
+		}
+		src.WriteString(" = ")
+		if err := gofumptFormatExpr(&src, fset, spec.Values[0], opt.lineWidth()); err != nil {
+			return (&ErrFormat{Err: err}).Error()
+		}
+		src.WriteString("\n")
+	}
+	src.WriteString(")\n")
+
+	formatted, err := formatSource(src.Bytes())
+	if err != nil {
+		return (&ErrFormat{Err: err}).Error()
+	}
+	formatted = bytes.TrimPrefix(formatted, []byte("package p\n\n"))
+	return strings.TrimSuffix(string(formatted), "\n")
+}
+
+// isConstant reports if v may be declared as a Go constant.
+func isConstant(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		return !math.IsNaN(f) && !math.IsInf(f, 0)
+	case reflect.Complex64, reflect.Complex128:
+		c := v.Complex()
+		return !math.IsNaN(real(c)) && !math.IsInf(real(c), 0) && !math.IsNaN(imag(c)) && !math.IsInf(imag(c), 0)
+	default:
+		return false
+	}
+}
+
+// isUntypedDefault reports if v is of the default type of its untyped constant literal, such that
+// the literal alone declares a value of the same type.
+func isUntypedDefault(v reflect.Value, opt *Options) bool {
+	if v.Type().PkgPath() != "" || !isConstant(v) {
+		return false
+	}
+	switch v.Type().Name() {
+	case "int", "string", "bool", "complex128":
+		return true
+	case "int32":
+		// Untyped rune constants such as 'a' default to the rune (int32) type.
+		return opt.Runes && isRuneLiteral(rune(v.Int()))
+	case "float64":
+		// A float literal such as `1` would instead declare an int.
+		return strings.ContainsAny(floatLiteral(v, opt), ".eEpP")
+	default:
+		return false
+	}
+}
@@ -0,0 +1,212 @@
+package valast
+
+import (
+	"go/ast"
+	"go/token"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// Duplicate describes a subtree of an AST which appears more than once, see
+// Options.MinDuplicateLen.
+type Duplicate struct {
+	// Source is the Go syntax of the subtree, on a single line.
+	Source string
+
+	// Count is the number of times the subtree appears.
+	Count int
+}
+
+// duplicates describes the duplicated subtrees of a set of ASTs, see findDuplicates.
+type duplicates struct {
+	list  []Duplicate
+	exprs []ast.Expr          // the first occurrence of each duplicate, parallel to list
+	index map[string]int      // the index of each duplicate in list, by key
+	keys  map[ast.Expr]string // the key of every candidate subtree
+}
+
+// duplicateCandidate reports if the subtree n may be reported as a duplicate: a composite literal
+// of an explicit type (possibly with its address taken), or a string literal.
+func duplicateCandidate(n ast.Node) (ast.Expr, bool) {
+	switch n := n.(type) {
+	case *ast.CompositeLit:
+		return n, n.Type != nil
+	case *ast.UnaryExpr:
+		lit, ok := n.X.(*ast.CompositeLit)
+		return n, n.Op == token.AND && ok && lit.Type != nil
+	case *ast.BasicLit, *ast.Ident:
+		return n.(ast.Expr), isStringLiteral(n.(ast.Expr))
+	}
+	return nil, false
+}
+
+// isStringLiteral reports if expr is a string literal, which are written as identifiers (see
+// stringLiteral) as well as basic literals.
+func isStringLiteral(expr ast.Expr) bool {
+	switch expr := expr.(type) {
+	case *ast.BasicLit:
+		return expr.Kind == token.STRING
+	case *ast.Ident:
+		return strings.HasPrefix(expr.Name, `"`) || strings.HasPrefix(expr.Name, "`")
+	}
+	return false
+}
+
+// findDuplicates returns the candidate subtrees (see duplicateCandidate) which appear more than
+// once in exprs, and whose Go syntax is at least minLen bytes on a single line, in the order they
+// first appear. Subtrees which only appear within a larger duplicate are not reported.
+func findDuplicates(exprs []ast.Expr, minLen int) *duplicates {
+	type occurrence struct {
+		key, parent string // parent is the key of the enclosing candidate, if any
+	}
+	var (
+		d = &duplicates{index: map[string]int{}, keys: map[ast.Expr]string{}}
+
+		order       []string
+		first       = map[string]ast.Expr{}
+		counts      = map[string]int{}
+		occurrences []occurrence
+	)
+	for _, expr := range exprs {
+		if expr == nil {
+			continue
+		}
+		var (
+			stack   []ast.Node // all nodes enclosing the current one
+			parents []string   // keys of the candidates in stack
+		)
+		ast.Inspect(expr, func(n ast.Node) bool {
+			if n == nil {
+				if _, ok := duplicateCandidate(stack[len(stack)-1]); ok {
+					parents = parents[:len(parents)-1]
+				}
+				stack = stack[:len(stack)-1]
+				return true
+			}
+			switch n.(type) {
+			case *ast.FuncLit, *ast.StructType, *ast.InterfaceType, *ast.FuncType:
+				// Function bodies may modify their values, and struct tags must remain literals.
+				return false
+			}
+			stack = append(stack, n)
+			candidate, ok := duplicateCandidate(n)
+			if !ok {
+				return true
+			}
+			key, ok := d.keys[candidate]
+			if !ok {
+				var err error
+				if key, err = printExpr(candidate); err != nil {
+					key = ""
+				}
+				d.keys[candidate] = key
+			}
+			o := occurrence{key: key}
+			if len(parents) > 0 {
+				o.parent = parents[len(parents)-1]
+			}
+			parents = append(parents, key)
+			if key == "" {
+				return true
+			}
+			if counts[key] == 0 {
+				order = append(order, key)
+				first[key] = candidate
+			}
+			counts[key]++
+			occurrences = append(occurrences, o)
+			return true
+		})
+	}
+
+	// A duplicate is reported if at least one of its occurrences is not within another duplicate.
+	outside := map[string]bool{}
+	for _, o := range occurrences {
+		if o.parent == "" || counts[o.parent] < 2 {
+			outside[o.key] = true
+		}
+	}
+	for _, key := range order {
+		if counts[key] < 2 || !outside[key] {
+			continue
+		}
+		source, err := formatSingleLine(first[key])
+		if err != nil || len(source) < minLen {
+			continue
+		}
+		d.index[key] = len(d.list)
+		d.list = append(d.list, Duplicate{Source: source, Count: counts[key]})
+		d.exprs = append(d.exprs, first[key])
+	}
+	return d
+}
+
+// hoistDuplicates replaces the duplicates reported due to Options.MinDuplicateLen in the ASTs of
+// the results with the names of variables (or constants, for strings), see
+// Options.HoistDuplicates, and returns their declarations. They are named dup1, dup2, etc. in the
+// order they first appear, skipping the names of vars.
+func hoistDuplicates(results []Result, vars map[string]interface{}, minLen int) []*ast.GenDecl {
+	exprs := make([]ast.Expr, len(results))
+	for i, r := range results {
+		exprs[i] = r.AST
+	}
+	d := findDuplicates(exprs, minLen)
+
+	var (
+		decls = make([]*ast.GenDecl, len(d.list))
+		names = make([]string, len(d.list))
+		n     int
+	)
+	for i, expr := range d.exprs {
+		for {
+			n++
+			names[i] = "dup" + strconv.Itoa(n)
+			if _, exists := vars[names[i]]; !exists {
+				break
+			}
+		}
+		tok := token.VAR
+		if isStringLiteral(expr) {
+			tok = token.CONST
+		}
+		decls[i] = &ast.GenDecl{Tok: tok, Specs: []ast.Spec{&ast.ValueSpec{
+			Names: []*ast.Ident{ast.NewIdent(names[i])},
+		}}}
+	}
+	replace := func(root ast.Expr) ast.Expr {
+		return astutil.Apply(root, func(c *astutil.Cursor) bool {
+			expr, ok := c.Node().(ast.Expr)
+			if !ok || expr == root {
+				return true
+			}
+			if i, ok := d.index[d.keys[expr]]; ok && d.keys[expr] != "" {
+				c.Replace(ast.NewIdent(names[i]))
+				return false
+			}
+			return true
+		}, nil).(ast.Expr)
+	}
+
+	// Duplicates nested within others are replaced by their own names, too. The replacement
+	// happens before any results are modified, as nodes may be shared between them.
+	values := make([]ast.Expr, len(d.exprs))
+	for i, expr := range d.exprs {
+		values[i] = replace(expr)
+	}
+	for i, value := range values {
+		decls[i].Specs[0].(*ast.ValueSpec).Values = []ast.Expr{value}
+	}
+	for i := range results {
+		if results[i].AST == nil {
+			continue
+		}
+		if j, ok := d.index[d.keys[results[i].AST]]; ok && d.keys[results[i].AST] != "" {
+			results[i].AST = ast.NewIdent(names[j])
+			continue
+		}
+		results[i].AST = replace(results[i].AST)
+	}
+	return decls
+}
@@ -0,0 +1,103 @@
+package valast
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// durationTypes caches whether named types are declared as time.Duration, see isDurationType.
+var durationTypes sync.Map // reflect.Type -> bool
+
+// isDurationType reports if values of type t are durations written by Options.Durations:
+// time.Duration itself, or a named type declared as it, e.g. `type Timeout time.Duration`.
+//
+// The underlying type of the latter is int64, like that of any other named integer type, so its
+// declaration is read from the source of its package instead. If the source cannot be loaded, e.g.
+// on js/wasm, only time.Duration is a duration.
+func isDurationType(t reflect.Type) bool {
+	if t == durationType {
+		return true
+	}
+	if t.Kind() != reflect.Int64 || t.Name() == "" || t.PkgPath() == "" {
+		return false
+	}
+	if cached, ok := durationTypes.Load(t); ok {
+		return cached.(bool)
+	}
+	declared := declaredAsDuration(t)
+	durationTypes.Store(t, declared)
+	return declared
+}
+
+// declaredAsDuration reports if the named type t is declared as time.Duration in the source of its
+// package.
+func declaredAsDuration(t reflect.Type) bool {
+	files, err := loadPackageFiles(t.PkgPath())
+	if err != nil {
+		return false
+	}
+	fset := token.NewFileSet()
+	for _, file := range files {
+		f, err := parser.ParseFile(fset, file, nil, parser.SkipObjectResolution)
+		if err != nil {
+			continue
+		}
+		timeName := ""
+		for _, imp := range f.Imports {
+			if path, err := strconv.Unquote(imp.Path.Value); err == nil && path == "time" {
+				timeName = "time"
+				if imp.Name != nil {
+					timeName = imp.Name.Name
+				}
+			}
+		}
+		if timeName == "" {
+			continue
+		}
+		for _, decl := range f.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				spec := spec.(*ast.TypeSpec)
+				if spec.Name.Name != t.Name() || spec.Assign.IsValid() {
+					continue
+				}
+				sel, ok := spec.Type.(*ast.SelectorExpr)
+				if !ok || sel.Sel.Name != "Duration" {
+					return false
+				}
+				pkg, ok := sel.X.(*ast.Ident)
+				return ok && pkg.Name == timeName
+			}
+		}
+	}
+	return false
+}
+
+// durationAST returns the AST for the non-zero duration v, see Options.Durations, e.g.
+// `2*time.Hour + 30*time.Minute`, converted to its type unless that is time.Duration, e.g.
+// `Timeout(2*time.Hour + 30*time.Minute)`.
+func durationAST(v reflect.Value, opt *Options, s *state) (Result, error) {
+	expr := durationASTExpr(time.Duration(v.Int()))
+	if v.Type() == durationType {
+		return Result{AST: expr}, nil
+	}
+	s.packagesFound["time"] = true
+	typ, err := typeExpr(v.Type(), opt, s.typeExprCache)
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{
+		AST:                &ast.CallExpr{Fun: typ.AST, Args: []ast.Expr{expr}},
+		RequiresUnexported: typ.RequiresUnexported,
+	}, nil
+}
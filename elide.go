@@ -0,0 +1,85 @@
+package valast
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"reflect"
+	"strconv"
+)
+
+// ElideRepeatedBytes is an Options.ElideBytes policy which writes byte slices consisting of a
+// single repeated byte value as e.g.:
+//
+//	bytes.Repeat([]byte{0}, 1048576)
+//
+// Other byte slices are not elided.
+func ElideRepeatedBytes(b []byte) (Result, bool) {
+	if len(b) == 0 {
+		return Result{}, false
+	}
+	for _, c := range b[1:] {
+		if c != b[0] {
+			return Result{}, false
+		}
+	}
+	return Result{
+		AST: &ast.CallExpr{
+			Fun: &ast.SelectorExpr{X: ast.NewIdent("bytes"), Sel: ast.NewIdent("Repeat")},
+			Args: []ast.Expr{
+				&ast.CompositeLit{
+					Type: &ast.ArrayType{Elt: ast.NewIdent("byte")},
+					Elts: []ast.Expr{&ast.BasicLit{Kind: token.INT, Value: strconv.Itoa(int(b[0]))}},
+				},
+				&ast.BasicLit{Kind: token.INT, Value: strconv.Itoa(len(b))},
+			},
+		},
+		Packages: []string{"bytes"},
+	}, true
+}
+
+// ElideBytesWithHash is an Options.ElideBytes policy which replaces byte slices with a zeroed
+// slice of the same length, annotated with the SHA-256 hash of the original contents, e.g.:
+//
+//	make([]byte, 1048576) /* elided: sha256:9f86d0... */
+//
+// The output is valid Go, but does not reproduce the original contents.
+func ElideBytesWithHash(b []byte) (Result, bool) {
+	// Note: the comment cannot be expressed as an ast.Expr, so it is written as part of the
+	// identifier. The printer writes it verbatim.
+	return Result{
+		AST: ast.NewIdent(fmt.Sprintf("make([]byte, %d) /* elided: sha256:%x */", len(b), sha256.Sum256(b))),
+	}, true
+}
+
+// elideBytes applies the Options.ElideBytes policy to the byte slice v, reporting whether or not
+// it was elided.
+func elideBytes(v reflect.Value, opt *Options, cache typeExprCache, packagesFound map[string]bool) (Result, bool, error) {
+	elided, ok := opt.ElideBytes(v.Bytes())
+	if !ok || elided.AST == nil {
+		return Result{}, false, nil
+	}
+	for _, pkg := range elided.Packages {
+		packagesFound[pkg] = true
+	}
+	if v.Type() == reflect.TypeOf([]byte(nil)) {
+		return Result{AST: elided.AST}, true, nil
+	}
+
+	// Named byte slice types require a conversion.
+	sliceType, err := typeExpr(v.Type(), opt, cache)
+	if err != nil {
+		return Result{}, false, err
+	}
+	if opt.ExportedOnly && sliceType.RequiresUnexported {
+		return Result{RequiresUnexported: true}, true, nil
+	}
+	return Result{
+		AST: &ast.CallExpr{
+			Fun:  sliceType.AST,
+			Args: []ast.Expr{elided.AST},
+		},
+		RequiresUnexported: sliceType.RequiresUnexported,
+	}, true, nil
+}
@@ -0,0 +1,318 @@
+package valast
+
+import (
+	"bytes"
+	"context"
+	"go/ast"
+	"go/token"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// emitValue converts the value v into Go syntax on a single line, see Options.SingleLine. If
+// neither the options nor v require an AST, the syntax is written directly while traversing v.
+func emitValue(v interface{}, opt *Options) (string, error) {
+	if !canEmit(opt) {
+		str, _, err := formatValue(v, opt)
+		return str, err
+	}
+	e := &emitter{
+		s: &state{
+			ctx:           context.Background(),
+			cycleDetector: &cycleDetector{},
+			typeExprCache: typeExprCache{},
+			packagesFound: map[string]bool{},
+		},
+		types: map[reflect.Type]string{},
+	}
+	if err := e.emit(reflect.ValueOf(v), opt.prepare(), "", false); err != nil {
+		return "", err
+	}
+	return string(e.buf), nil
+}
+
+// canEmit reports if values may be written by an emitter with the options, i.e. none of the
+// options require an AST, describe the value in comments, or depend on the path of values.
+func canEmit(opt *Options) bool {
+	return !opt.SourceMap && opt.ExtractFiles == nil && !opt.Partial && opt.Redact == nil &&
+		opt.Pseudonymize == nil && opt.CommentField == nil && !opt.DescribeOmitted &&
+		opt.MaxOutputBytes <= 0 && opt.MaxDepth <= 0 && opt.MaxElements <= 0 && !opt.ExportedOnly &&
+		!opt.Setters && opt.Qualify == nil && opt.OnCycle != CyclePolicyVariables &&
+		!opt.UnexportedFieldTypesAsInterface && !opt.UnexportedAsAny && !opt.PruneEmpty &&
+		!opt.IncludeZeroFields
+}
+
+// emitter writes the Go syntax of values on a single line directly to a buffer while traversing
+// them. It handles the composite values and literals which make up most inputs, and otherwise
+// falls back to converting values via computeAST and printing their AST, such that the syntax is
+// identical to that produced by StringWithOptions joined onto a single line.
+type emitter struct {
+	buf   []byte
+	s     *state
+	types map[reflect.Type]string // the Go syntax of types, see typeString
+}
+
+// emit writes the Go syntax of the value v, found at the given path in the input value. If elide
+// is true, v is an element of an array, slice or map literal, whose type is elided from composite
+// literals (e.g. `[]T{{...}}` rather than `[]T{T{...}}`) as gofumpt simplifies them.
+func (e *emitter) emit(v reflect.Value, opt *Options, path string, elide bool) error {
+	if v == (reflect.Value{}) {
+		e.buf = append(e.buf, "nil"...)
+		return nil
+	}
+	vv := unexported(v)
+	t := vv.Type()
+	if e.s.nesting >= opt.maxNesting() || hasCustomRendering(t, opt) || isErrorType(t) {
+		return e.fallback(v, opt, path, elide)
+	}
+	e.s.nesting++
+	defer func() { e.s.nesting-- }()
+
+	switch vv.Kind() {
+	case reflect.Bool:
+		if t.PkgPath() != "" || t.Name() != "bool" {
+			return e.fallback(v, opt, path, elide)
+		}
+		e.buf = strconv.AppendBool(e.buf, vv.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if !opt.Unqualify || t.PkgPath() != "" || t.Name() != vv.Kind().String() || (opt.Runes && vv.Kind() == reflect.Int32) {
+			return e.fallback(v, opt, path, elide)
+		}
+		e.buf = append(e.buf, intLiteral(vv, opt)...)
+	case reflect.Float32, reflect.Float64:
+		if f := vv.Float(); !opt.Unqualify || t.PkgPath() != "" || t.Name() != vv.Kind().String() || math.IsNaN(f) || math.IsInf(f, 0) {
+			return e.fallback(v, opt, path, elide)
+		}
+		e.buf = append(e.buf, floatLiteral(vv, opt)...)
+	case reflect.String:
+		if _, ok := stringBytesLiteral(vv.String(), opt); ok || t.PkgPath() != "" || t.Name() != "string" {
+			return e.fallback(v, opt, path, elide)
+		}
+		e.buf = append(e.buf, stringLiteral(vv.String(), opt)...)
+	case reflect.Array, reflect.Slice:
+		isBytes := t.Elem() == reflect.TypeOf(byte(0))
+		if (vv.Kind() == reflect.Array && opt.SparseArrays && isSparseArray(vv)) ||
+			(vv.Kind() == reflect.Slice && opt.ElideBytes != nil && isBytes && vv.Len() >= opt.elideBytesThreshold()) ||
+			(opt.Runes && t.Elem().Kind() == reflect.Int32) || isRepeated(vv, opt) {
+			return e.fallback(v, opt, path, elide)
+		}
+		if vv.Kind() == reflect.Slice && vv.Len() > 0 && mayContainCycle(t) {
+			if _, cyclic := e.s.cycleDetector.push(vv, path); cyclic {
+				return e.fallback(v, opt, path, elide)
+			}
+			defer e.s.cycleDetector.pop(vv)
+		}
+		if err := e.typeString(t, opt, elide); err != nil {
+			return err
+		}
+		e.buf = append(e.buf, '{')
+		for i := 0; i < vv.Len(); i++ {
+			if i > 0 {
+				e.buf = append(e.buf, ", "...)
+			}
+			if err := e.emit(vv.Index(i), opt.withUnqualify(), path, true); err != nil {
+				return err
+			}
+		}
+		e.buf = append(e.buf, '}')
+	case reflect.Map:
+		if opt.SortMapKeys != nil || opt.Deterministic {
+			return e.fallback(v, opt, path, elide)
+		}
+		if vv.Len() > 0 && mayContainCycle(t) {
+			if _, cyclic := e.s.cycleDetector.push(vv, path); cyclic {
+				return e.fallback(v, opt, path, elide)
+			}
+			defer e.s.cycleDetector.pop(vv)
+		}
+		keys := vv.MapKeys()
+		for _, key := range keys {
+			if invalidMapKey(key) != "" {
+				return e.fallback(v, opt, path, elide)
+			}
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return valueLess(keys[i], keys[j])
+		})
+		if err := e.typeString(t, opt, elide); err != nil {
+			return err
+		}
+		e.buf = append(e.buf, '{')
+		for i, key := range keys {
+			if i > 0 {
+				e.buf = append(e.buf, ", "...)
+			}
+			if err := e.emit(key, opt.withUnqualify(), path, true); err != nil {
+				return err
+			}
+			e.buf = append(e.buf, ": "...)
+			if err := e.emit(vv.MapIndex(key), opt.withUnqualify(), path, true); err != nil {
+				return err
+			}
+		}
+		e.buf = append(e.buf, '}')
+	case reflect.Struct:
+		if t == reflect.TypeOf(time.Time{}) {
+			return e.fallback(v, opt, path, elide)
+		}
+		for i := 0; i < t.NumField(); i++ {
+			if shouldRedact(path, t.Field(i), opt) || excludeField(t, t.Field(i), opt) || !accessible(t.Field(i), opt) {
+				return e.fallback(v, opt, path, elide)
+			}
+		}
+		if err := e.typeString(t, opt, elide); err != nil {
+			return err
+		}
+		e.buf = append(e.buf, '{')
+		first := true
+		for i := 0; i < t.NumField(); i++ {
+			field := unexported(vv.Field(i))
+			if field.IsZero() {
+				continue
+			}
+			if !first {
+				e.buf = append(e.buf, ", "...)
+			}
+			first = false
+			e.buf = append(e.buf, t.Field(i).Name...)
+			e.buf = append(e.buf, ": "...)
+			if err := e.emit(field, opt.withUnqualify(), path, false); err != nil {
+				return err
+			}
+		}
+		e.buf = append(e.buf, '}')
+	case reflect.Ptr:
+		// Only pointers to composite literals are written as `&T{...}`, see computeAST.
+		elem := t.Elem()
+		switch {
+		case vv.IsNil() && opt.Unqualify && elem.Kind() != reflect.Interface:
+			e.buf = append(e.buf, "nil"...)
+			return nil
+		case vv.IsNil(), hasCustomRendering(elem, opt), elem == reflect.TypeOf(time.Time{}):
+			return e.fallback(v, opt, path, elide)
+		}
+		switch elem.Kind() {
+		case reflect.Struct, reflect.Array, reflect.Slice, reflect.Map:
+		default:
+			return e.fallback(v, opt, path, elide)
+		}
+		if _, cyclic := e.s.cycleDetector.push(vv, path); cyclic {
+			return e.fallback(v, opt, path, elide)
+		}
+		defer e.s.cycleDetector.pop(vv)
+		if !elide {
+			e.buf = append(e.buf, '&')
+		}
+		return e.emit(vv.Elem(), opt, path, elide)
+	case reflect.Interface:
+		elem := unexported(vv.Elem())
+		if !elem.IsValid() {
+			e.buf = append(e.buf, "nil"...)
+			return nil
+		}
+		elemOpt := opt.withDynamicType(elem)
+		if opt.Unqualify {
+			return e.emit(elem, elemOpt, path, false)
+		}
+		if err := e.typeString(t, opt, false); err != nil {
+			return err
+		}
+		e.buf = append(e.buf, '(')
+		if err := e.emit(elem, elemOpt, path, false); err != nil {
+			return err
+		}
+		e.buf = append(e.buf, ')')
+	default:
+		return e.fallback(v, opt, path, elide)
+	}
+	return nil
+}
+
+// typeString writes the Go syntax of the type t, unless elide is true.
+func (e *emitter) typeString(t reflect.Type, opt *Options, elide bool) error {
+	if elide {
+		return nil
+	}
+	str, err := e.typeSyntax(t, opt)
+	if err != nil {
+		return err
+	}
+	e.buf = append(e.buf, str...)
+	return nil
+}
+
+// typeSyntax returns the Go syntax of the type t.
+func (e *emitter) typeSyntax(t reflect.Type, opt *Options) (string, error) {
+	if str, ok := e.types[t]; ok {
+		return str, nil
+	}
+	r, err := typeExpr(t, opt, e.s.typeExprCache)
+	if err != nil {
+		return "", err
+	}
+	str, err := formatSingleLine(r.AST)
+	if err != nil {
+		return "", err
+	}
+	e.types[t] = str
+	return str, nil
+}
+
+// fallback writes the Go syntax of the value v by converting it via computeAST and formatting the
+// AST. If elide is true, the type of a composite literal is elided, see emit.
+func (e *emitter) fallback(v reflect.Value, opt *Options, path string, elide bool) error {
+	r, err := computeASTProfiled(v, opt, path, e.s)
+	if err != nil {
+		return err
+	}
+	expr := r.AST
+	if elide {
+		if expr, err = e.elideType(expr, v.Type(), opt); err != nil {
+			return err
+		}
+	}
+	str, err := formatSingleLine(expr)
+	if err != nil {
+		return err
+	}
+	e.buf = append(e.buf, str...)
+	return nil
+}
+
+// elideType returns expr, the element of an array, slice or map literal of values of type t,
+// with the type of its composite literal elided as gofumpt simplifies them, e.g. `{X: 1}` instead
+// of `&T{X: 1}` for a value of type *T.
+func (e *emitter) elideType(expr ast.Expr, t reflect.Type, opt *Options) (ast.Expr, error) {
+	lit, ok := expr.(*ast.CompositeLit)
+	if unary, isAddr := expr.(*ast.UnaryExpr); isAddr && unary.Op == token.AND && t.Kind() == reflect.Ptr {
+		lit, ok = unary.X.(*ast.CompositeLit)
+		t = t.Elem()
+	}
+	if !ok || lit.Type == nil {
+		return expr, nil
+	}
+	litType, err := formatSingleLine(lit.Type)
+	if err != nil {
+		return nil, err
+	}
+	want, err := e.typeSyntax(t, opt)
+	if err != nil || litType != want {
+		return expr, err
+	}
+	tmp := *lit
+	tmp.Type = nil
+	return &tmp, nil
+}
+
+// formatSingleLine returns the Go syntax of expr as formatted by gofumpt, on a single line.
+func formatSingleLine(expr ast.Expr) (string, error) {
+	var buf bytes.Buffer
+	if err := gofumptFormatExpr(&buf, token.NewFileSet(), expr, math.MaxInt32); err != nil {
+		return "", &ErrFormat{Err: err}
+	}
+	return singleLine(buf.String()), nil
+}
@@ -0,0 +1,105 @@
+package valast
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	errorStringType = reflect.TypeOf(errors.New(""))
+	wrapErrorType   = reflect.TypeOf(fmt.Errorf("%w", errors.New("")))
+	wrapErrorsType  = reflect.TypeOf(fmt.Errorf("%w%w", errors.New(""), errors.New("")))
+	joinErrorType   = reflect.TypeOf(errors.Join(errors.New("")))
+)
+
+// errorAST converts v if it is an error created by errors.New, errors.Join, or one wrapping other
+// errors created by fmt.Errorf, reporting if so. Their types are unexported, so they are instead
+// written as calls which create an equivalent error, e.g.:
+//
+//	fmt.Errorf("loading config: %w", errors.Join(errors.New("not found"), errors.New("denied")))
+//
+// Wrapped errors are only converted if the messages of the wrapped errors can be found in order
+// within their own message, such that the format string can be recovered.
+func errorAST(v reflect.Value, opt *Options, path string, s *state) (Result, bool, error) {
+	t := v.Type()
+	if !isErrorType(t) || v.IsNil() {
+		return Result{}, false, nil
+	}
+	err := v.Interface().(error)
+	if t == errorStringType {
+		s.packagesFound["errors"] = true
+		return Result{AST: &ast.CallExpr{
+			Fun:  &ast.SelectorExpr{X: ast.NewIdent("errors"), Sel: ast.NewIdent("New")},
+			Args: []ast.Expr{stringExpr(err.Error(), opt)},
+		}}, true, nil
+	}
+
+	var wrapped []error
+	switch err := err.(type) {
+	case interface{ Unwrap() error }:
+		wrapped = []error{err.Unwrap()}
+	case interface{ Unwrap() []error }:
+		wrapped = err.Unwrap()
+	}
+	var (
+		args   []ast.Expr
+		result Result
+		fun    = &ast.SelectorExpr{X: ast.NewIdent("errors"), Sel: ast.NewIdent("Join")}
+	)
+	if t != joinErrorType {
+		// Recover the format string, e.g. `open %q: %w` from `open "foo": not found`.
+		var (
+			format strings.Builder
+			msg    = err.Error()
+		)
+		for _, e := range wrapped {
+			if e == nil {
+				return Result{}, false, nil
+			}
+			i := strings.Index(msg, e.Error())
+			if i < 0 {
+				return Result{}, false, nil
+			}
+			format.WriteString(strings.ReplaceAll(msg[:i], "%", "%%") + "%w")
+			msg = msg[i+len(e.Error()):]
+		}
+		format.WriteString(strings.ReplaceAll(msg, "%", "%%"))
+		fun = &ast.SelectorExpr{X: ast.NewIdent("fmt"), Sel: ast.NewIdent("Errorf")}
+		args = append(args, stringExpr(format.String(), opt))
+	}
+	for i, e := range wrapped {
+		elemPath := s.fieldPath(path, "Unwrap()")
+		if len(wrapped) > 1 {
+			elemPath = s.indexPath(elemPath, i)
+		}
+		mark := len(s.omissions)
+		s.pushOpaque(opt, path, false)
+		r, err := computeASTProfiled(reflect.ValueOf(e), opt.withQualify(), elemPath, s)
+		s.popOpaque(opt)
+		if err != nil {
+			return Result{}, true, err
+		}
+		if len(s.omissions) > mark {
+			child := ".Unwrap()"
+			if len(wrapped) > 1 {
+				child += "[" + strconv.Itoa(i) + "]"
+			}
+			s.prefixOmissions(mark, child)
+		}
+		args = append(args, r.AST)
+		result.RequiresUnexported = result.RequiresUnexported || r.RequiresUnexported
+		result.OmittedUnexported = result.OmittedUnexported || r.OmittedUnexported
+	}
+	s.packagesFound[fun.X.(*ast.Ident).Name] = true
+	result.AST = &ast.CallExpr{Fun: fun, Args: args}
+	return result, true, nil
+}
+
+// isErrorType reports if values of type t are errors converted by errorAST.
+func isErrorType(t reflect.Type) bool {
+	return t == errorStringType || t == wrapErrorType || t == wrapErrorsType || t == joinErrorType
+}
@@ -0,0 +1,789 @@
+package valast
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/parser"
+	"go/token"
+	"math"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// Eval parses the Go literal expression expr, e.g. as produced by String, and evaluates it into a
+// new value of type t. It is the inverse of String, e.g. for round-trip testing or for editing
+// fixtures programmatically.
+//
+// Only the subset of Go syntax which valast produces is supported: basic literals, constant
+// expressions, composite literals, conversions, calls to the helpers valast uses (such as
+// valast.Ptr, time.Date and math.Inf), and the statements of Options.InterfacePointerStatements
+// and Options.RepeatedElements. Named types in the expression are not resolved, instead
+// values are evaluated into the corresponding part of t. As a result, interface values within t
+// may only hold values of builtin types (and the time package's Time and Duration types).
+func Eval(expr string, t reflect.Type) (reflect.Value, error) {
+	e, err := parser.ParseExpr(expr)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	v := reflect.New(t).Elem()
+	if err := evalInto(e, v); err != nil {
+		return reflect.Value{}, err
+	}
+	return v, nil
+}
+
+// evalErrorf returns an error describing why the expression e could not be evaluated.
+func evalErrorf(e ast.Expr, format string, args ...interface{}) error {
+	src, err := printExpr(e)
+	if err != nil {
+		src = fmt.Sprintf("%T", e)
+	}
+	return fmt.Errorf("valast: eval %s: %s", src, fmt.Sprintf(format, args...))
+}
+
+// evalInto evaluates the expression e into the settable value v.
+func evalInto(e ast.Expr, v reflect.Value) error {
+	if !v.CanSet() {
+		v = unexported(v)
+		if !v.CanSet() {
+			return evalErrorf(e, "cannot set unexported %s without package unsafe", v.Type())
+		}
+	}
+	if paren, ok := e.(*ast.ParenExpr); ok {
+		return evalInto(paren.X, v)
+	}
+	if ident, ok := e.(*ast.Ident); ok && ident.Name == "nil" {
+		switch v.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map, reflect.Func, reflect.Chan, reflect.UnsafePointer:
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		return evalErrorf(e, "cannot use nil as %s", v.Type())
+	}
+	if v.Kind() == reflect.Interface {
+		t, err := evalExprType(e)
+		if err != nil {
+			return err
+		}
+		if !t.Implements(v.Type()) {
+			return evalErrorf(e, "%s does not implement %s", t, v.Type())
+		}
+		value := reflect.New(t).Elem()
+		if err := evalInto(e, value); err != nil {
+			return err
+		}
+		v.Set(value)
+		return nil
+	}
+
+	switch e := e.(type) {
+	case *ast.CompositeLit:
+		return evalCompositeLit(e, v)
+	case *ast.UnaryExpr:
+		if e.Op == token.AND {
+			if v.Kind() != reflect.Ptr {
+				return evalErrorf(e, "cannot use pointer as %s", v.Type())
+			}
+			return evalPtr(e.X, v)
+		}
+	case *ast.TypeAssertExpr:
+		// e.g. valast.Addr(1).(*int)
+		return evalInto(e.X, v)
+	case *ast.CallExpr:
+		return evalCall(e, v)
+	}
+	c, err := evalConst(e)
+	if err != nil {
+		return err
+	}
+	return setConst(e, v, c)
+}
+
+// evalPtr evaluates the expression e into a newly allocated value, and sets the pointer v to it.
+func evalPtr(e ast.Expr, v reflect.Value) error {
+	elem := reflect.New(v.Type().Elem())
+	if err := evalInto(e, elem.Elem()); err != nil {
+		return err
+	}
+	v.Set(elem)
+	return nil
+}
+
+// maxEvalLen is the maximum length of slices, and size in bytes of arrays, allocated by Eval,
+// whose length is taken from the source text, e.g. `[]int{100000000000: 1}` or
+// `[99999999999]byte{}`, such that it cannot exhaust memory.
+const maxEvalLen = 1 << 24
+
+// evalCompositeLit evaluates the composite literal e into v.
+func evalCompositeLit(e *ast.CompositeLit, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		// Elided pointer type, e.g. the elements of []*T{{...}}
+		return evalPtr(e, v)
+	case reflect.Struct:
+		seen := map[string]bool{}
+		for i, elt := range e.Elts {
+			if kv, ok := elt.(*ast.KeyValueExpr); ok {
+				key, ok := kv.Key.(*ast.Ident)
+				if !ok {
+					return evalErrorf(kv.Key, "invalid field name")
+				}
+				field, ok := v.Type().FieldByName(key.Name)
+				if !ok || len(field.Index) != 1 {
+					return evalErrorf(kv.Key, "unknown field %s in %s", key.Name, v.Type())
+				}
+				if seen[key.Name] {
+					return evalErrorf(kv.Key, "duplicate field %s in %s", key.Name, v.Type())
+				}
+				seen[key.Name] = true
+				if err := evalInto(kv.Value, v.Field(field.Index[0])); err != nil {
+					return err
+				}
+				continue
+			}
+			if i >= v.NumField() {
+				return evalErrorf(e, "too many values for %s", v.Type())
+			}
+			if err := evalInto(elt, v.Field(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Array, reflect.Slice:
+		// Determine the index of each element, accounting for keyed elements e.g. [3]int{2: 1}.
+		var (
+			indices = make([]int, len(e.Elts))
+			seen    = make(map[int]bool, len(e.Elts))
+			index   int
+			length  int
+		)
+		for i, elt := range e.Elts {
+			if kv, ok := elt.(*ast.KeyValueExpr); ok {
+				c, err := evalConst(kv.Key)
+				if err != nil {
+					return err
+				}
+				n, ok := constant.Int64Val(constant.ToInt(c))
+				if !ok || n < 0 || (v.Kind() == reflect.Slice && n >= maxEvalLen) {
+					return evalErrorf(kv.Key, "invalid index")
+				}
+				index = int(n)
+			}
+			if seen[index] {
+				return evalErrorf(elt, "duplicate index %d in %s", index, v.Type())
+			}
+			seen[index] = true
+			indices[i] = index
+			index++
+			if index > length {
+				length = index
+			}
+		}
+		if v.Kind() == reflect.Array {
+			if length > v.Len() {
+				return evalErrorf(e, "index out of bounds for %s", v.Type())
+			}
+		} else {
+			v.Set(reflect.MakeSlice(v.Type(), length, length))
+		}
+		for i, elt := range e.Elts {
+			if kv, ok := elt.(*ast.KeyValueExpr); ok {
+				elt = kv.Value
+			}
+			if err := evalInto(elt, v.Index(indices[i])); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		v.Set(reflect.MakeMapWithSize(v.Type(), len(e.Elts)))
+		for _, elt := range e.Elts {
+			kv, ok := elt.(*ast.KeyValueExpr)
+			if !ok {
+				return evalErrorf(elt, "missing key in map literal")
+			}
+			key := reflect.New(v.Type().Key()).Elem()
+			if err := evalInto(kv.Key, key); err != nil {
+				return err
+			}
+			if !key.Comparable() {
+				return evalErrorf(kv.Key, "unhashable map key")
+			}
+			if v.MapIndex(key).IsValid() {
+				return evalErrorf(kv.Key, "duplicate key in map literal")
+			}
+			value := reflect.New(v.Type().Elem()).Elem()
+			if err := evalInto(kv.Value, value); err != nil {
+				return err
+			}
+			v.SetMapIndex(key, value)
+		}
+		return nil
+	default:
+		return evalErrorf(e, "cannot use composite literal as %s", v.Type())
+	}
+}
+
+// evalInterfacePointer evaluates the function literal fn, which must declare a variable and return
+// its address (see Options.InterfacePointerStatements), into the pointer v.
+func evalInterfacePointer(fn *ast.FuncLit, v reflect.Value) error {
+	if v.Kind() != reflect.Ptr {
+		return evalErrorf(fn, "cannot use pointer as %s", v.Type())
+	}
+	unsupported := evalErrorf(fn, "unsupported function literal")
+	if len(fn.Body.List) != 2 {
+		return unsupported
+	}
+	decl, ok := fn.Body.List[0].(*ast.DeclStmt)
+	if !ok || len(decl.Decl.(*ast.GenDecl).Specs) != 1 {
+		return unsupported
+	}
+	spec, ok := decl.Decl.(*ast.GenDecl).Specs[0].(*ast.ValueSpec)
+	if !ok || len(spec.Names) != 1 || len(spec.Values) > 1 {
+		return unsupported
+	}
+	ret, ok := fn.Body.List[1].(*ast.ReturnStmt)
+	if !ok || len(ret.Results) != 1 {
+		return unsupported
+	}
+	addr, ok := ret.Results[0].(*ast.UnaryExpr)
+	if !ok || addr.Op != token.AND {
+		return unsupported
+	}
+	if ident, ok := addr.X.(*ast.Ident); !ok || ident.Name != spec.Names[0].Name {
+		return unsupported
+	}
+	if len(spec.Values) == 0 {
+		v.Set(reflect.New(v.Type().Elem()))
+		return nil
+	}
+	return evalPtr(spec.Values[0], v)
+}
+
+// evalRepeatedElements evaluates the function literal fn, which must declare an array or slice and
+// assign its elements in a loop (see Options.RepeatedElements), into v.
+func evalRepeatedElements(fn *ast.FuncLit, v reflect.Value) error {
+	if v.Kind() != reflect.Array && v.Kind() != reflect.Slice {
+		return evalErrorf(fn, "cannot use repeated elements as %s", v.Type())
+	}
+	unsupported := evalErrorf(fn, "unsupported function literal")
+	switch decl := fn.Body.List[0].(type) {
+	case *ast.DeclStmt:
+		v.Set(reflect.Zero(v.Type()))
+	case *ast.AssignStmt:
+		call, ok := decl.Rhs[0].(*ast.CallExpr)
+		if !ok || len(decl.Rhs) != 1 {
+			return unsupported
+		}
+		if err := evalCall(call, v); err != nil {
+			return err
+		}
+	default:
+		return unsupported
+	}
+	loop, ok := fn.Body.List[1].(*ast.RangeStmt)
+	if !ok || len(loop.Body.List) != 1 {
+		return unsupported
+	}
+	assign, ok := loop.Body.List[0].(*ast.AssignStmt)
+	if !ok || len(assign.Rhs) != 1 {
+		return unsupported
+	}
+	for i := 0; i < v.Len(); i++ {
+		if err := evalInto(assign.Rhs[0], v.Index(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// evalMake evaluates the call make(T, n) of a slice type T into v.
+func evalMake(e *ast.CallExpr, v reflect.Value) error {
+	if v.Kind() != reflect.Slice || !conversionMatches(e.Args[0], v.Type()) {
+		return evalErrorf(e, "cannot use slice as %s", v.Type())
+	}
+	c, err := evalConst(e.Args[1])
+	if err != nil {
+		return err
+	}
+	n, ok := constant.Int64Val(constant.ToInt(c))
+	if !ok || n < 0 || n > maxEvalLen {
+		return evalErrorf(e.Args[1], "invalid length")
+	}
+	v.Set(reflect.MakeSlice(v.Type(), int(n), int(n)))
+	return nil
+}
+
+// evalCall evaluates the call or conversion expression e into v.
+func evalCall(e *ast.CallExpr, v reflect.Value) error {
+	if fn, ok := e.Fun.(*ast.FuncLit); ok && len(e.Args) == 0 {
+		if len(fn.Body.List) == 3 {
+			return evalRepeatedElements(fn, v)
+		}
+		return evalInterfacePointer(fn, v)
+	}
+	if ident, ok := e.Fun.(*ast.Ident); ok && ident.Name == "make" && len(e.Args) == 2 {
+		return evalMake(e, v)
+	}
+	if sel, ok := e.Fun.(*ast.SelectorExpr); ok {
+		pkg, _ := sel.X.(*ast.Ident)
+		switch {
+		case (sel.Sel.Name == "Ptr" || sel.Sel.Name == "Addr") && len(e.Args) == 1,
+			sel.Sel.Name == "AddrInterface" && len(e.Args) == 2:
+			if v.Kind() != reflect.Ptr {
+				return evalErrorf(e, "cannot use pointer as %s", v.Type())
+			}
+			return evalPtr(e.Args[0], v)
+		case pkg != nil && pkg.Name == "time" && sel.Sel.Name == "Date" && len(e.Args) == 8:
+			return evalTimeDate(e, v)
+		case pkg != nil && pkg.Name == "math" && sel.Sel.Name == "NaN" && len(e.Args) == 0:
+			return setFloat(e, v, math.NaN())
+		case pkg != nil && pkg.Name == "math" && sel.Sel.Name == "Inf" && len(e.Args) == 1:
+			c, err := evalConst(e.Args[0])
+			if err != nil {
+				return err
+			}
+			sign, _ := constant.Int64Val(constant.ToInt(c))
+			return setFloat(e, v, math.Inf(int(sign)))
+		}
+	}
+
+	// Otherwise, the call must be a conversion e.g. int8(1), []byte("foo") or (*T)(nil).
+	if len(e.Args) != 1 || !conversionMatches(e.Fun, v.Type()) {
+		return evalErrorf(e, "unsupported function call for %s", v.Type())
+	}
+	if ident, ok := e.Args[0].(*ast.Ident); ok && ident.Name == "nil" {
+		return evalInto(ident, v)
+	}
+	if v.Kind() == reflect.Slice {
+		// e.g. []byte("foo") or []rune("foo")
+		if c, err := evalConst(e.Args[0]); err == nil && c.Kind() == constant.String {
+			str := reflect.ValueOf(constant.StringVal(c))
+			if !str.Type().ConvertibleTo(v.Type()) {
+				return evalErrorf(e, "cannot convert string to %s", v.Type())
+			}
+			v.Set(str.Convert(v.Type()))
+			return nil
+		}
+	}
+	if lit, ok := e.Args[0].(*ast.CompositeLit); ok && v.Kind() == reflect.String {
+		// e.g. string([]byte{0x00, 0xff}), see StringStyleBytes
+		b := reflect.New(reflect.TypeOf([]byte(nil))).Elem()
+		if err := evalInto(lit, b); err != nil {
+			return err
+		}
+		v.SetString(string(b.Bytes()))
+		return nil
+	}
+	return evalInto(e.Args[0], v)
+}
+
+// conversionMatches reports if the type expression fun of a conversion may be the type t. Named
+// types are matched only by name, as they cannot be resolved.
+func conversionMatches(fun ast.Expr, t reflect.Type) bool {
+	switch fun := fun.(type) {
+	case *ast.Ident:
+		if bt, ok := builtinTypes[fun.Name]; ok {
+			return bt == t
+		}
+		return fun.Name == t.Name()
+	case *ast.SelectorExpr:
+		return fun.Sel.Name == t.Name()
+	case *ast.ParenExpr:
+		return conversionMatches(fun.X, t)
+	}
+	ft, err := evalTypeExpr(fun)
+	return err != nil || ft == t
+}
+
+// evalTimeDate evaluates the time.Date call expression e into v.
+func evalTimeDate(e *ast.CallExpr, v reflect.Value) error {
+	if v.Type() != reflect.TypeOf(time.Time{}) {
+		return evalErrorf(e, "cannot use time.Time as %s", v.Type())
+	}
+	var args [7]int
+	for i := range args {
+		c, err := evalConst(e.Args[i])
+		if err != nil {
+			return err
+		}
+		n, ok := constant.Int64Val(constant.ToInt(c))
+		if !ok {
+			return evalErrorf(e.Args[i], "invalid integer")
+		}
+		args[i] = int(n)
+	}
+	var loc *time.Location
+	if sel, ok := e.Args[7].(*ast.SelectorExpr); ok {
+		switch sel.Sel.Name {
+		case "UTC":
+			loc = time.UTC
+		case "Local":
+			loc = time.Local
+		}
+	}
+	if loc == nil {
+		return evalErrorf(e.Args[7], "unsupported location")
+	}
+	v.Set(reflect.ValueOf(time.Date(args[0], time.Month(args[1]), args[2], args[3], args[4], args[5], args[6], loc)))
+	return nil
+}
+
+// timeConstants are the constants of the time package which valast produces.
+var timeConstants = map[string]int64{
+	"Nanosecond":  int64(time.Nanosecond),
+	"Microsecond": int64(time.Microsecond),
+	"Millisecond": int64(time.Millisecond),
+	"Second":      int64(time.Second),
+	"Minute":      int64(time.Minute),
+	"Hour":        int64(time.Hour),
+}
+
+// evalConst evaluates the constant expression e.
+func evalConst(e ast.Expr) (constant.Value, error) {
+	switch e := e.(type) {
+	case *ast.BasicLit:
+		c := constant.MakeFromLiteral(e.Value, e.Kind, 0)
+		if c.Kind() == constant.Unknown {
+			return nil, evalErrorf(e, "invalid literal")
+		}
+		return c, nil
+	case *ast.Ident:
+		switch e.Name {
+		case "true", "false":
+			return constant.MakeBool(e.Name == "true"), nil
+		}
+	case *ast.ParenExpr:
+		return evalConst(e.X)
+	case *ast.SelectorExpr:
+		if pkg, ok := e.X.(*ast.Ident); ok && pkg.Name == "time" {
+			if d, ok := timeConstants[e.Sel.Name]; ok {
+				return constant.MakeInt64(d), nil
+			}
+		}
+	case *ast.UnaryExpr:
+		switch e.Op {
+		case token.ADD, token.SUB, token.XOR, token.NOT:
+			x, err := evalConst(e.X)
+			if err != nil {
+				return nil, err
+			}
+			if !validUnaryOp(e.Op, x.Kind()) {
+				return nil, evalErrorf(e, "invalid constant operation")
+			}
+			return constant.UnaryOp(e.Op, x, 0), nil
+		}
+	case *ast.BinaryExpr:
+		switch e.Op {
+		case token.ADD, token.SUB, token.MUL, token.QUO, token.REM, token.AND, token.OR, token.XOR:
+			x, err := evalConst(e.X)
+			if err != nil {
+				return nil, err
+			}
+			y, err := evalConst(e.Y)
+			if err != nil {
+				return nil, err
+			}
+			if !validBinaryOp(e.Op, x.Kind(), y.Kind()) {
+				return nil, evalErrorf(e, "invalid constant operation")
+			}
+			op := e.Op
+			if op == token.QUO && x.Kind() == constant.Int && y.Kind() == constant.Int {
+				op = token.QUO_ASSIGN // integer division
+			}
+			if (op == token.QUO || op == token.QUO_ASSIGN || op == token.REM) && constant.Sign(y) == 0 {
+				return nil, evalErrorf(e, "division by zero")
+			}
+			return constant.BinaryOp(x, op, y), nil
+		}
+	case *ast.CallExpr:
+		// Conversion of a constant, e.g. int8(1)
+		if len(e.Args) == 1 {
+			if _, err := evalTypeExpr(e.Fun); err == nil {
+				return evalConst(e.Args[0])
+			}
+			if _, ok := e.Fun.(*ast.Ident); ok {
+				return evalConst(e.Args[0]) // conversion to a named type
+			}
+			if sel, ok := e.Fun.(*ast.SelectorExpr); ok && sel.Sel.IsExported() {
+				if _, ok := sel.X.(*ast.Ident); ok {
+					return evalConst(e.Args[0]) // conversion to a qualified named type
+				}
+			}
+		}
+	}
+	return nil, evalErrorf(e, "unsupported expression")
+}
+
+// validUnaryOp reports if the unary operator op is defined for constants of kind x, which
+// constant.UnaryOp otherwise panics on, e.g. -"a" or !1.
+func validUnaryOp(op token.Token, x constant.Kind) bool {
+	switch op {
+	case token.NOT:
+		return x == constant.Bool
+	case token.XOR:
+		return x == constant.Int
+	}
+	return isNumericConst(x)
+}
+
+// validBinaryOp reports if the binary operator op is defined for constants of kinds x and y, which
+// constant.BinaryOp otherwise panics on, e.g. "a" * "b" or 1 % 2.5. Untyped numeric constants of
+// different kinds may be combined, e.g. (1.5 + 2i).
+func validBinaryOp(op token.Token, x, y constant.Kind) bool {
+	switch {
+	case x == constant.String && y == constant.String:
+		return op == token.ADD
+	case isNumericConst(x) && isNumericConst(y):
+		switch op {
+		case token.REM, token.AND, token.OR, token.XOR:
+			return x == constant.Int && y == constant.Int
+		}
+		return true
+	}
+	return false
+}
+
+// isNumericConst reports if constants of kind k are numeric.
+func isNumericConst(k constant.Kind) bool {
+	return k == constant.Int || k == constant.Float || k == constant.Complex
+}
+
+// setConst sets v to the constant c, which the expression e evaluated to.
+func setConst(e ast.Expr, v reflect.Value, c constant.Value) error {
+	switch v.Kind() {
+	case reflect.Bool:
+		if c.Kind() == constant.Bool {
+			v.SetBool(constant.BoolVal(c))
+			return nil
+		}
+	case reflect.String:
+		if c.Kind() == constant.String {
+			v.SetString(constant.StringVal(c))
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n, ok := constant.Int64Val(constant.ToInt(c)); ok && !v.OverflowInt(n) {
+			v.SetInt(n)
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if n, ok := constant.Uint64Val(constant.ToInt(c)); ok && !v.OverflowUint(n) {
+			v.SetUint(n)
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		if f := constant.ToFloat(c); f.Kind() == constant.Float {
+			n, _ := constant.Float64Val(f)
+			return setFloat(e, v, n)
+		}
+	case reflect.Complex64, reflect.Complex128:
+		if x := constant.ToComplex(c); x.Kind() == constant.Complex {
+			re, _ := constant.Float64Val(constant.Real(x))
+			im, _ := constant.Float64Val(constant.Imag(x))
+			v.SetComplex(complex(re, im))
+			return nil
+		}
+	}
+	return evalErrorf(e, "cannot use %s as %s", c, v.Type())
+}
+
+// setFloat sets the float value v to f, which the expression e evaluated to.
+func setFloat(e ast.Expr, v reflect.Value, f float64) error {
+	if v.Kind() != reflect.Float32 && v.Kind() != reflect.Float64 {
+		return evalErrorf(e, "cannot use float as %s", v.Type())
+	}
+	v.SetFloat(f)
+	return nil
+}
+
+// builtinTypes are the predeclared types which may be written in expressions.
+var builtinTypes = map[string]reflect.Type{
+	"bool":       reflect.TypeOf(false),
+	"string":     reflect.TypeOf(""),
+	"int":        reflect.TypeOf(int(0)),
+	"int8":       reflect.TypeOf(int8(0)),
+	"int16":      reflect.TypeOf(int16(0)),
+	"int32":      reflect.TypeOf(int32(0)),
+	"rune":       reflect.TypeOf(rune(0)),
+	"int64":      reflect.TypeOf(int64(0)),
+	"uint":       reflect.TypeOf(uint(0)),
+	"uint8":      reflect.TypeOf(uint8(0)),
+	"byte":       reflect.TypeOf(byte(0)),
+	"uint16":     reflect.TypeOf(uint16(0)),
+	"uint32":     reflect.TypeOf(uint32(0)),
+	"uint64":     reflect.TypeOf(uint64(0)),
+	"uintptr":    reflect.TypeOf(uintptr(0)),
+	"float32":    reflect.TypeOf(float32(0)),
+	"float64":    reflect.TypeOf(float64(0)),
+	"complex64":  reflect.TypeOf(complex64(0)),
+	"complex128": reflect.TypeOf(complex128(0)),
+	"any":        reflect.TypeOf((*interface{})(nil)).Elem(),
+}
+
+// evalTypeExpr evaluates the type expression e, which may only refer to builtin types and the
+// time package's Time and Duration types.
+func evalTypeExpr(e ast.Expr) (reflect.Type, error) {
+	switch e := e.(type) {
+	case *ast.Ident:
+		if t, ok := builtinTypes[e.Name]; ok {
+			return t, nil
+		}
+	case *ast.SelectorExpr:
+		if pkg, ok := e.X.(*ast.Ident); ok && pkg.Name == "time" {
+			switch e.Sel.Name {
+			case "Time":
+				return reflect.TypeOf(time.Time{}), nil
+			case "Duration":
+				return reflect.TypeOf(time.Duration(0)), nil
+			}
+		}
+	case *ast.ParenExpr:
+		return evalTypeExpr(e.X)
+	case *ast.StarExpr:
+		elem, err := evalTypeExpr(e.X)
+		if err != nil {
+			return nil, err
+		}
+		return reflect.PointerTo(elem), nil
+	case *ast.ArrayType:
+		elem, err := evalTypeExpr(e.Elt)
+		if err != nil {
+			return nil, err
+		}
+		if e.Len == nil {
+			return reflect.SliceOf(elem), nil
+		}
+		lit, ok := e.Len.(*ast.BasicLit)
+		if !ok || lit.Kind != token.INT {
+			break
+		}
+		n, err := strconv.ParseInt(lit.Value, 0, 64)
+		if err != nil || (elem.Size() > 0 && uint64(n) > maxEvalLen/uint64(elem.Size())) || n > maxEvalLen {
+			return nil, evalErrorf(e, "invalid array length")
+		}
+		return reflect.ArrayOf(int(n), elem), nil
+	case *ast.MapType:
+		key, err := evalTypeExpr(e.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := evalTypeExpr(e.Value)
+		if err != nil {
+			return nil, err
+		}
+		if !key.Comparable() {
+			return nil, evalErrorf(e.Key, "invalid map key type %s", key)
+		}
+		return reflect.MapOf(key, value), nil
+	case *ast.InterfaceType:
+		if len(e.Methods.List) == 0 {
+			return builtinTypes["any"], nil
+		}
+	case *ast.StructType:
+		var fields []reflect.StructField
+		seen := map[string]bool{}
+		for _, f := range e.Fields.List {
+			t, err := evalTypeExpr(f.Type)
+			if err != nil {
+				return nil, err
+			}
+			for _, name := range f.Names {
+				if !name.IsExported() {
+					return nil, evalErrorf(e, "unexported field %s in anonymous struct", name.Name)
+				}
+				if seen[name.Name] {
+					return nil, evalErrorf(name, "duplicate field %s in anonymous struct", name.Name)
+				}
+				seen[name.Name] = true
+				fields = append(fields, reflect.StructField{Name: name.Name, Type: t})
+			}
+			if len(f.Names) == 0 {
+				return nil, evalErrorf(e, "embedded field in anonymous struct")
+			}
+		}
+		return reflect.StructOf(fields), nil
+	}
+	return nil, evalErrorf(e, "unsupported type")
+}
+
+// evalExprType determines the type of the expression e, for evaluating it into an interface value.
+func evalExprType(e ast.Expr) (reflect.Type, error) {
+	switch e := e.(type) {
+	case *ast.ParenExpr:
+		return evalExprType(e.X)
+	case *ast.BasicLit:
+		switch e.Kind {
+		case token.INT:
+			return builtinTypes["int"], nil
+		case token.FLOAT:
+			return builtinTypes["float64"], nil
+		case token.IMAG:
+			return builtinTypes["complex128"], nil
+		case token.CHAR:
+			return builtinTypes["rune"], nil
+		case token.STRING:
+			return builtinTypes["string"], nil
+		}
+	case *ast.Ident:
+		if e.Name == "true" || e.Name == "false" {
+			return builtinTypes["bool"], nil
+		}
+	case *ast.SelectorExpr:
+		if pkg, ok := e.X.(*ast.Ident); ok && pkg.Name == "time" {
+			if _, ok := timeConstants[e.Sel.Name]; ok {
+				return reflect.TypeOf(time.Duration(0)), nil
+			}
+		}
+	case *ast.UnaryExpr:
+		if e.Op == token.AND {
+			elem, err := evalExprType(e.X)
+			if err != nil {
+				return nil, err
+			}
+			return reflect.PointerTo(elem), nil
+		}
+		return evalExprType(e.X)
+	case *ast.BinaryExpr:
+		x, err := evalExprType(e.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := evalExprType(e.Y)
+		if err != nil {
+			return nil, err
+		}
+		if y.PkgPath() != "" {
+			return y, nil // e.g. 3*time.Second
+		}
+		return x, nil
+	case *ast.CompositeLit:
+		if e.Type != nil {
+			return evalTypeExpr(e.Type)
+		}
+	case *ast.TypeAssertExpr:
+		if e.Type != nil {
+			return evalTypeExpr(e.Type)
+		}
+	case *ast.CallExpr:
+		if sel, ok := e.Fun.(*ast.SelectorExpr); ok {
+			pkg, _ := sel.X.(*ast.Ident)
+			switch {
+			case sel.Sel.Name == "Ptr" && len(e.Args) == 1:
+				elem, err := evalExprType(e.Args[0])
+				if err != nil {
+					return nil, err
+				}
+				return reflect.PointerTo(elem), nil
+			case pkg != nil && pkg.Name == "time" && sel.Sel.Name == "Date":
+				return reflect.TypeOf(time.Time{}), nil
+			case pkg != nil && pkg.Name == "math" && (sel.Sel.Name == "NaN" || sel.Sel.Name == "Inf"):
+				return builtinTypes["float64"], nil
+			}
+		}
+		return evalTypeExpr(e.Fun)
+	}
+	return nil, evalErrorf(e, "cannot determine type")
+}
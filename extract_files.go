@@ -0,0 +1,97 @@
+package valast
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+)
+
+// ExtractFiles describes how large string and []byte values are extracted into separate files,
+// e.g. for golden tests with embedded assets. Each extracted value is written as a call to a
+// function which reads the file at runtime:
+//
+//	mustReadFile("testdata/blob_01.bin")
+//
+// The function is not provided by valast, it must be defined by the user with the signature:
+//
+//	func(path string) []byte
+type ExtractFiles struct {
+	// Dir is the directory in which files are written, e.g. "testdata". It is created if it does
+	// not exist.
+	Dir string
+
+	// Threshold is the minimum length in bytes of values to extract. The default is 4096.
+	Threshold int
+
+	// FuncName is the name of the function (or selector, e.g. "testutil.MustReadFile") which reads
+	// the file. The default is "mustReadFile".
+	FuncName string
+
+	// NamePrefix is the prefix of the names of written files, which are numbered sequentially,
+	// e.g. blob_01.bin, blob_02.bin, etc. The default is "blob".
+	NamePrefix string
+}
+
+func (e *ExtractFiles) threshold() int {
+	if e.Threshold > 0 {
+		return e.Threshold
+	}
+	return 4096
+}
+
+func (e *ExtractFiles) funcName() string {
+	if e.FuncName != "" {
+		return e.FuncName
+	}
+	return "mustReadFile"
+}
+
+func (e *ExtractFiles) namePrefix() string {
+	if e.NamePrefix != "" {
+		return e.NamePrefix
+	}
+	return "blob"
+}
+
+// extractFile writes data (the contents of the string or []byte value v) to a new file, and
+// returns an expression which reads it.
+func extractFile(v reflect.Value, data []byte, opt *Options, cache typeExprCache, extractedFiles *[]string) (Result, error) {
+	name := fmt.Sprintf("%s_%02d.bin", opt.ExtractFiles.namePrefix(), len(*extractedFiles)+1)
+	path := filepath.Join(opt.ExtractFiles.Dir, name)
+	if opt.ExtractFiles.Dir != "" {
+		if err := os.MkdirAll(opt.ExtractFiles.Dir, 0o755); err != nil {
+			return Result{}, err
+		}
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return Result{}, err
+	}
+	*extractedFiles = append(*extractedFiles, path)
+
+	var read ast.Expr = &ast.CallExpr{
+		Fun:  ast.NewIdent(opt.ExtractFiles.funcName()),
+		Args: []ast.Expr{&ast.BasicLit{Kind: token.STRING, Value: quote(filepath.ToSlash(path), opt)}},
+	}
+	if v.Type() == reflect.TypeOf([]byte(nil)) {
+		return Result{AST: read}, nil
+	}
+
+	// Strings and named types require a conversion.
+	valueType, err := typeExpr(v.Type(), opt, cache)
+	if err != nil {
+		return Result{}, err
+	}
+	if opt.ExportedOnly && valueType.RequiresUnexported {
+		return Result{RequiresUnexported: true}, nil
+	}
+	return Result{
+		AST: &ast.CallExpr{
+			Fun:  valueType.AST,
+			Args: []ast.Expr{read},
+		},
+		RequiresUnexported: valueType.RequiresUnexported,
+	}, nil
+}
@@ -1,82 +1,259 @@
 package valast
 
-func formatCompositeLiterals(input []rune) []rune {
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"sort"
+	"unicode/utf8"
+)
+
+// formatCompositeLiterals splits composite literals in the Go syntax of an expression onto
+// multiple lines, writing each of their elements on its own line. A composite literal is split if
+// it contains another non-empty composite literal, or has more than one element and is nested in a
+// split composite literal (other than as a map key) or its line would exceed maxLineWidth
+// characters. Quoted string concatenations ("abc" + "def") are split onto one line per string.
+//
+// Composite literals already written one element per line, e.g. by layoutMapEntries, are left as
+// they are, and are not considered split: their elements are only split by their own contents.
+//
+// The expression is parsed, such that line breaks are inserted at the positions of the braces and
+// commas of composite literals, and never within strings or comments. Line breaks already present,
+// e.g. due to line markers or raw strings, are kept. The source is returned unchanged if it cannot
+// be parsed.
+func formatCompositeLiterals(src []byte, maxLineWidth int) []byte {
+	fset := token.NewFileSet()
+	expr, err := parser.ParseExprFrom(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return src
+	}
+	var file *token.File
+	fset.Iterate(func(f *token.File) bool {
+		file = f
+		return false
+	})
+	s := &literalSplitter{src: src, file: file, maxLineWidth: maxLineWidth}
+	s.scanTokens()
+	s.walk(expr, false)
+	return s.apply()
+}
+
+// literalSplitter decides where formatCompositeLiterals inserts line breaks.
+type literalSplitter struct {
+	src          []byte
+	file         *token.File
+	maxLineWidth int
+
+	// tokens are the offsets of the tokens in src other than comments and automatic semicolons,
+	// and their kinds.
+	tokens []scannedToken
+
+	// lineStart is the offset in src at which the current line starts once edits are applied,
+	// unless src has a line break after it.
+	lineStart int
+
+	// edits are the line breaks to insert, in the order they were decided.
+	edits []sourceEdit
+}
+
+// scannedToken is a token of the Go syntax being split.
+type scannedToken struct {
+	offset int
+	tok    token.Token
+}
+
+// sourceEdit replaces n bytes at an offset in the Go syntax being split with text.
+type sourceEdit struct {
+	offset, n int
+	text      string
+}
+
+// scanTokens records the tokens of the source, such that the commas following the elements of
+// composite literals can be found regardless of comments.
+func (s *literalSplitter) scanTokens() {
+	var sc scanner.Scanner
+	file := token.NewFileSet().AddFile("", -1, len(s.src))
+	sc.Init(file, s.src, nil, 0)
+	for {
+		pos, tok, lit := sc.Scan()
+		if tok == token.EOF {
+			return
+		}
+		if tok == token.SEMICOLON && lit == "\n" {
+			continue
+		}
+		s.tokens = append(s.tokens, scannedToken{offset: file.Offset(pos), tok: tok})
+	}
+}
+
+// walk decides the line breaks within the node n, in source order. nested reports if n is within
+// a composite literal which is split.
+func (s *literalSplitter) walk(n ast.Node, nested bool) {
+	ast.Inspect(n, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.CompositeLit:
+			s.literal(n, nested)
+			return false
+		case *ast.BinaryExpr:
+			if !isStringConcat(n) {
+				return true
+			}
+			// e.g. "abc" +\n"def", dropping the space following the operator.
+			s.walk(n.X, nested)
+			op := s.offset(n.OpPos)
+			s.edits = append(s.edits, sourceEdit{offset: op + 1, n: 1, text: "\n"})
+			s.lineStart = s.offset(n.Y.Pos())
+			s.walk(n.Y, nested)
+			return false
+		}
+		return true
+	})
+}
+
+// literal decides the line breaks within the composite literal lit. nested reports if lit is
+// within a composite literal which is split.
+func (s *literalSplitter) literal(lit *ast.CompositeLit, nested bool) {
+	lbrace, rbrace := s.offset(lit.Lbrace), s.offset(lit.Rbrace)
+	split := len(lit.Elts) > 0 && (containsCompositeLit(lit.Elts) ||
+		(len(lit.Elts) > 1 && (nested || s.exceedsLineWidth(lbrace))))
+	if !split || s.lineBreakFollows(lbrace+1) {
+		for _, elt := range lit.Elts {
+			s.walk(elt, false)
+		}
+		return
+	}
+
+	s.lineBreak(lbrace + 1)
+	for i, elt := range lit.Elts {
+		s.lineStart = s.offset(elt.Pos())
+		if kv, ok := elt.(*ast.KeyValueExpr); ok {
+			// Map keys are only split by their own contents, e.g. struct keys.
+			s.walk(kv.Key, false)
+			s.walk(kv.Value, true)
+		} else {
+			s.walk(elt, true)
+		}
+		end := s.offset(elt.End())
+		if comma, ok := s.commaAfter(end); ok {
+			s.lineBreak(comma + 1)
+		} else if i == len(lit.Elts)-1 {
+			// The trailing comma required before a line break, e.g. `{1, 2}` written without one.
+			s.edits = append(s.edits, sourceEdit{offset: end, text: ","})
+		}
+	}
+	if !s.lineBreakPrecedes(rbrace) {
+		s.edits = append(s.edits, sourceEdit{offset: rbrace, text: "\n"})
+	}
+	s.lineStart = rbrace
+}
+
+// exceedsLineWidth reports if the line of the composite literal with its opening brace at offset
+// lbrace would exceed the maximum line width, were the composite literal not split.
+func (s *literalSplitter) exceedsLineWidth(lbrace int) bool {
+	end := len(s.src)
+	if i := bytes.IndexByte(s.src[lbrace:], '\n'); i >= 0 {
+		end = lbrace + i
+	}
+	lineStart := s.lineStart
+	if i := bytes.LastIndexByte(s.src[:lbrace], '\n'); i+1 > lineStart {
+		lineStart = i + 1
+	}
+	return utf8.RuneCount(s.src[lineStart:end]) > s.maxLineWidth
+}
+
+// commaAfter returns the offset of the comma following the element ending at offset end, if any.
+func (s *literalSplitter) commaAfter(end int) (int, bool) {
+	i := sort.Search(len(s.tokens), func(i int) bool { return s.tokens[i].offset >= end })
+	if i < len(s.tokens) && s.tokens[i].tok == token.COMMA {
+		return s.tokens[i].offset, true
+	}
+	return 0, false
+}
+
+// lineBreak inserts a line break at offset, unless one already follows.
+func (s *literalSplitter) lineBreak(offset int) {
+	if !s.lineBreakFollows(offset) {
+		s.edits = append(s.edits, sourceEdit{offset: offset, text: "\n"})
+	}
+}
+
+// lineBreakFollows reports if only spaces separate the offset from the following line break, or
+// a line comment which ends with one, e.g. due to line markers or Options.CommentField.
+func (s *literalSplitter) lineBreakFollows(offset int) bool {
+	i := offset
+	for i < len(s.src) && s.src[i] == ' ' {
+		i++
+	}
+	return i < len(s.src) && (s.src[i] == '\n' || bytes.HasPrefix(s.src[i:], []byte("//")))
+}
+
+// lineBreakPrecedes reports if only spaces separate the offset from the preceding line break.
+func (s *literalSplitter) lineBreakPrecedes(offset int) bool {
+	i := offset
+	for i > 0 && s.src[i-1] == ' ' {
+		i--
+	}
+	return i > 0 && s.src[i-1] == '\n'
+}
+
+// offset returns the offset in the source of the position pos.
+func (s *literalSplitter) offset(pos token.Pos) int {
+	return s.file.Offset(pos)
+}
+
+// apply returns the source with the edits applied.
+func (s *literalSplitter) apply() []byte {
+	if len(s.edits) == 0 {
+		return s.src
+	}
+	sort.SliceStable(s.edits, func(i, j int) bool { return s.edits[i].offset < s.edits[j].offset })
 	var (
-		inStringLiteral, inRawStringLiteral bool
-		depth                               int
-		breakFields                         bool
-		lineWidth                           int
-		result                              []rune
+		out  bytes.Buffer
+		last int
 	)
-	for i, r := range input {
-		switch {
-		case inStringLiteral || inRawStringLiteral:
-			// Reading a string literal.
-			switch {
-			case inStringLiteral:
-				if r == '"' && (i == 0 || input[i-1] != '\\') {
-					inStringLiteral = false
-				}
-			case inRawStringLiteral:
-				if r == '`' {
-					inRawStringLiteral = false
-				}
-			}
-			if r == '\n' {
-				depth = 0
-				lineWidth = 0
-			} else {
-				lineWidth++
-			}
-			result = append(result, r)
-		default:
-			if r == '"' {
-				inStringLiteral = true
-				result = append(result, r)
-				break
-			}
-			if r == '`' {
-				inRawStringLiteral = true
-				result = append(result, r)
-				break
-			}
-			if r == '\n' {
-				depth = 0
-				lineWidth = 0
-			} else {
-				lineWidth++
-			}
-			if lineWidth >= 50 {
-				breakFields = true
-			}
-			if r == ',' && breakFields {
-				result = append(result, r)
-				result = append(result, '\n')
-				break
-			}
-			if r == '{' {
-				depth++
-				if depth >= 2 {
-					depth = 0
-					breakFields = true
-					result = append(result, r)
-					result = append(result, '\n')
-					break
-				}
-			}
-			if r == '}' {
-				depth--
-				if depth >= 2 {
-					depth = 0
-					breakFields = false
-					result = append(result, r)
-					result = append(result, ',')
-					result = append(result, '\n')
-					break
-				}
+	for _, e := range s.edits {
+		out.Write(s.src[last:e.offset])
+		out.WriteString(e.text)
+		last = e.offset + e.n
+	}
+	out.Write(s.src[last:])
+	return out.Bytes()
+}
+
+// containsCompositeLit reports if any of the expressions contains a non-empty composite literal.
+func containsCompositeLit(exprs []ast.Expr) bool {
+	for _, expr := range exprs {
+		found := false
+		ast.Inspect(expr, func(n ast.Node) bool {
+			if lit, ok := n.(*ast.CompositeLit); ok && len(lit.Elts) > 0 {
+				found = true
 			}
-			result = append(result, r)
+			return !found
+		})
+		if found {
+			return true
 		}
 	}
-	return result
+	return false
+}
+
+// isStringConcat reports if the binary expression e is a concatenation of two quoted strings, i.e.
+// `"abc" + "def"`, the left one of which may itself be a concatenation.
+func isStringConcat(e *ast.BinaryExpr) bool {
+	if e.Op != token.ADD {
+		return false
+	}
+	x := e.X
+	if b, ok := x.(*ast.BinaryExpr); ok && b.Op == token.ADD {
+		x = b.Y
+	}
+	return isQuotedString(x) && isQuotedString(e.Y)
+}
+
+// isQuotedString reports if e is a quoted "string" literal.
+func isQuotedString(e ast.Expr) bool {
+	lit, ok := e.(*ast.BasicLit)
+	return ok && lit.Kind == token.STRING && lit.Value[0] == '"'
 }
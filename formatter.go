@@ -0,0 +1,237 @@
+package valast
+
+import (
+	"bytes"
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"io"
+	"strings"
+
+	"github.com/hexops/valast/internal/highlight"
+)
+
+// Formatter returns a fmt.Formatter which renders v as Go syntax, such that it may be printed
+// through the standard fmt machinery (e.g. by existing logging code):
+//
+//	log.Printf("loaded config: %v", valast.Formatter(cfg))
+//
+// The verbs are:
+//
+//	%v, %s  Go syntax on a single line
+//	%+v     Go syntax formatted across multiple lines, as String produces
+//	%q      Go syntax on a single line, as a double-quoted Go string
+//
+// The value is only converted when it is formatted, and thus costs nothing if e.g. the log level
+// would discard it.
+func Formatter(v interface{}) fmt.Formatter {
+	return FormatterWithOptions(v, nil)
+}
+
+// FormatterWithOptions is like Formatter, but renders v with the specified options.
+func FormatterWithOptions(v interface{}, opt *Options) fmt.Formatter {
+	return formatter{v: v, opt: opt}
+}
+
+type formatter struct {
+	v   interface{}
+	opt *Options
+}
+
+// Format implements the fmt.Formatter interface.
+func (f formatter) Format(s fmt.State, verb rune) {
+	switch verb {
+	case 'v', 's', 'q':
+	default:
+		fmt.Fprintf(s, "%%!%c(valast.Formatter)", verb)
+		return
+	}
+	if verb == 'v' && s.Flag('+') {
+		io.WriteString(s, StringWithOptions(f.v, f.opt))
+		return
+	}
+	fOpt := f.opt
+	if fOpt == nil {
+		fOpt = defaultOptions()
+	}
+	opt := *fOpt
+	opt.SingleLine, opt.Colorize = true, false
+	str := StringWithOptions(f.v, &opt)
+	switch {
+	case verb == 'q':
+		str = quote(str, &opt)
+	case fOpt.Colorize:
+		str = colorize(str)
+	}
+	io.WriteString(s, str)
+}
+
+// singleLine joins the lines of the formatted Go syntax src into a single line, except for line
+// breaks within raw string literals. e.g. composite literal elements become separated by ", " and
+// struct type fields by "; ", and struct types are written as gofmt writes them on one line, i.e.
+// `struct{ A int; B string }`.
+func singleLine(src string) string {
+	if !strings.Contains(src, "\n") {
+		return src
+	}
+	var (
+		inRawString      = rawStringOffsets([]byte(src))
+		out              = make([]byte, 0, len(src))
+		offset           int
+		afterLineComment bool
+	)
+	for i, line := range strings.Split(src, "\n") {
+		lineStart := offset
+		offset += len(line) + 1
+		if i > 0 && inRawString(lineStart) {
+			out = append(out, '\n')
+			out = append(out, line...)
+			continue
+		}
+		line, lineComment := blockComment(line)
+		if i == 0 {
+			out = append(out, line...)
+			afterLineComment = lineComment
+			continue
+		}
+		line = strings.TrimLeft(line, "\t")
+		if line == "" {
+			continue
+		}
+		last := out[len(out)-1]
+		switch {
+		case afterLineComment:
+			out = append(out, ' ')
+		case strings.HasPrefix(line, "/*") && last == ',':
+			// A comment following the last element, e.g. `{1, 2 /* 3 more */}` as gofumpt writes it.
+			out[len(out)-1] = ' '
+		case strings.HasPrefix(line, "/*") && last == '{', line[0] == '}' && bytes.HasSuffix(out, []byte("*/")) && commentOnly(out):
+			out = append(out, ' ')
+		case line[0] == '}' || line[0] == ')':
+			if last == ',' {
+				out = out[:len(out)-1]
+			}
+		case last == '{' || last == '(':
+		case last == ',' || last == '+':
+			out = append(out, ' ')
+		default:
+			out = append(out, "; "...)
+		}
+		out = append(out, line...)
+		afterLineComment = lineComment
+	}
+
+	return string(spaceTypeBraces(collapseSpace(out)))
+}
+
+// blockComment converts a line comment at the end of the Go syntax line, e.g. one written by
+// Options.CommentField, into a block comment such that it can be followed by further syntax. It
+// reports whether the line ended with a line comment.
+func blockComment(line string) (string, bool) {
+	if !strings.Contains(line, "//") {
+		return line, false
+	}
+	tokens := highlight.Tokens(line)
+	last := tokens[len(tokens)-1]
+	if last.Kind != highlight.Comment || !strings.HasPrefix(last.Text, "//") {
+		return line, false
+	}
+	text := strings.TrimSpace(strings.ReplaceAll(last.Text[2:], "*/", "* /"))
+	return line[:len(line)-len(last.Text)] + "/* " + text + " */", true
+}
+
+// commentOnly reports if the Go syntax src ends with a composite literal containing only a
+// comment, e.g. `Foo{ /* ... */`.
+func commentOnly(src []byte) bool {
+	i := bytes.LastIndex(src, []byte("/*"))
+	return i >= 2 && string(src[i-2:i]) == "{ "
+}
+
+// collapseSpace replaces runs of whitespace between the tokens of the Go syntax src, such as the
+// alignment padding of map values, with a single space.
+func collapseSpace(src []byte) []byte {
+	var (
+		s    scanner.Scanner
+		fset = token.NewFileSet()
+		file = fset.AddFile("", fset.Base(), len(src))
+		out  = make([]byte, 0, len(src))
+		end  int
+	)
+	s.Init(file, src, nil, 0)
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok == token.SEMICOLON && lit == "\n" {
+			continue // automatically inserted
+		}
+		if lit == "" {
+			lit = tok.String()
+		}
+		start := file.Offset(pos)
+		gap := src[end:start]
+		if len(gap) > 1 && len(bytes.Trim(gap, " \t")) == 0 {
+			gap = []byte{' '}
+		}
+		out = append(out, gap...)
+		out = append(out, lit...)
+		end = start + len(lit)
+	}
+	return append(out, src[end:]...)
+}
+
+// spaceTypeBraces writes the braces of the struct and interface types in the single line Go syntax
+// src as gofmt does, i.e. `struct{ A int }` and `interface{ M() }` rather than `struct {A int}`.
+func spaceTypeBraces(src []byte) []byte {
+	var (
+		s          scanner.Scanner
+		fset       = token.NewFileSet()
+		file       = fset.AddFile("", fset.Base(), len(src))
+		out        = make([]byte, 0, len(src))
+		end        int
+		prev       token.Token
+		braces     []bool // for each open brace, whether it is that of a struct or interface type
+		afterBrace bool   // whether the previous token opened a struct or interface type
+	)
+	s.Init(file, src, nil, 0)
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok == token.SEMICOLON && lit == "\n" {
+			continue // automatically inserted
+		}
+		if lit == "" {
+			lit = tok.String()
+		}
+		start := file.Offset(pos)
+		gap := src[end:start]
+		whitespace := len(bytes.Trim(gap, " \t")) == 0
+		switch {
+		case tok == token.LBRACE && (prev == token.STRUCT || prev == token.INTERFACE) && whitespace:
+			gap = nil
+		case tok == token.RBRACE && len(braces) > 0 && braces[len(braces)-1] && !afterBrace && whitespace:
+			gap = []byte{' '}
+		case afterBrace && tok != token.RBRACE && whitespace:
+			gap = []byte{' '}
+		}
+		afterBrace = false
+		switch tok {
+		case token.LBRACE:
+			typ := prev == token.STRUCT || prev == token.INTERFACE
+			braces = append(braces, typ)
+			afterBrace = typ
+		case token.RBRACE:
+			if len(braces) > 0 {
+				braces = braces[:len(braces)-1]
+			}
+		}
+		out = append(out, gap...)
+		out = append(out, lit...)
+		end = start + len(lit)
+		prev = tok
+	}
+	return append(out, src[end:]...)
+}
@@ -0,0 +1,140 @@
+package valast
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// FuncPolicy describes how function values which cannot be referenced by name, such as closures
+// and method values, are written.
+type FuncPolicy int
+
+const (
+	// FuncPolicyError indicates an *ErrInvalidType error is returned.
+	FuncPolicyError FuncPolicy = iota
+
+	// FuncPolicyNil indicates the function is written as nil.
+	FuncPolicyNil
+
+	// FuncPolicyStub indicates the function is written as a function literal which panics, e.g.:
+	//
+	// 	func(int) string { panic("valast: cannot reference function main.main.func1") }
+	FuncPolicyStub
+)
+
+// funcName returns the package path and name of the top-level function identified by the
+// program counter pc. If pc does not identify a top-level function (e.g. it is a closure or method
+// value), ok is false.
+func funcName(pc uintptr) (pkgPath, name string, ok bool) {
+	f := runtime.FuncForPC(pc)
+	if f == nil {
+		return "", "", false
+	}
+	// e.g. "github.com/foo/bar.Baz", "github.com/foo/bar.Baz.func1", "github.com/foo/bar.(*T).M-fm"
+	fullName := f.Name()
+	lastSlash := strings.LastIndex(fullName, "/")
+	dot := strings.Index(fullName[lastSlash+1:], ".")
+	if dot < 0 {
+		return "", "", false
+	}
+	dot += lastSlash + 1
+	pkgPath, name = fullName[:dot], fullName[dot+1:]
+	if !token.IsIdentifier(name) {
+		return "", "", false
+	}
+	return pkgPath, name, true
+}
+
+// funcAST returns the AST expression for the function value v.
+func funcAST(v reflect.Value, opt *Options, cache typeExprCache, packagesFound map[string]bool) (Result, error) {
+	funcType, err := typeExpr(v.Type(), opt, cache)
+	if err != nil {
+		return Result{}, err
+	}
+	if opt.ExportedOnly && funcType.RequiresUnexported {
+		return Result{RequiresUnexported: true}, nil
+	}
+	if v.IsNil() {
+		if opt.Unqualify {
+			return Result{AST: ast.NewIdent("nil")}, nil
+		}
+		return Result{
+			AST: &ast.CallExpr{
+				Fun:  &ast.ParenExpr{X: funcType.AST},
+				Args: []ast.Expr{ast.NewIdent("nil")},
+			},
+			RequiresUnexported: funcType.RequiresUnexported,
+		}, nil
+	}
+
+	var (
+		expr               ast.Expr
+		requiresUnexported = funcType.RequiresUnexported
+	)
+	pkgPath, name, ok := funcName(v.Pointer())
+	switch {
+	case ok && pkgPath == opt.PackagePath:
+		expr = ast.NewIdent(name)
+	case ok:
+		pkgName, err := opt.packagePathToName(pkgPath)
+		if err != nil {
+			return Result{}, err
+		}
+		packagesFound[pkgPath] = true
+		if pkgName == opt.PackageName {
+			expr = ast.NewIdent(name)
+		} else {
+			expr = &ast.SelectorExpr{X: ast.NewIdent(pkgName), Sel: ast.NewIdent(name)}
+			if !ast.IsExported(name) {
+				if opt.ExportedOnly {
+					return Result{RequiresUnexported: true}, nil
+				}
+				requiresUnexported = true
+			}
+		}
+	default:
+		switch opt.FuncPolicy {
+		case FuncPolicyNil:
+			return funcAST(reflect.Zero(v.Type()), opt, cache, packagesFound)
+		case FuncPolicyStub:
+			// Named function types cannot be used in a function literal, so use the underlying
+			// signature.
+			t := v.Type()
+			var in, out []reflect.Type
+			for i := 0; i < t.NumIn(); i++ {
+				in = append(in, t.In(i))
+			}
+			for i := 0; i < t.NumOut(); i++ {
+				out = append(out, t.Out(i))
+			}
+			signature, err := typeExpr(reflect.FuncOf(in, out, t.IsVariadic()), opt, cache)
+			if err != nil {
+				return Result{}, err
+			}
+			msg := "valast: cannot reference function"
+			if f := runtime.FuncForPC(v.Pointer()); f != nil {
+				msg = fmt.Sprintf("%s %s", msg, f.Name())
+			}
+			expr = &ast.FuncLit{
+				Type: signature.AST.(*ast.FuncType),
+				Body: &ast.BlockStmt{List: []ast.Stmt{
+					&ast.ExprStmt{X: &ast.CallExpr{
+						Fun:  ast.NewIdent("panic"),
+						Args: []ast.Expr{&ast.BasicLit{Kind: token.STRING, Value: quote(msg, opt)}},
+					}},
+				}},
+			}
+		default:
+			return Result{}, &ErrInvalidType{Value: v.Interface()}
+		}
+	}
+	if !opt.Unqualify && v.Type().Name() != "" {
+		// Named function types require a conversion to retain their type.
+		expr = &ast.CallExpr{Fun: funcType.AST, Args: []ast.Expr{expr}}
+	}
+	return Result{AST: expr, RequiresUnexported: requiresUnexported}, nil
+}
@@ -0,0 +1,230 @@
+package valast
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// WriteGoFile writes a formatted Go file to the given file path, declaring package pkg with one
+// top-level variable per entry in vars (sorted by name). The file begins with the standard
+// "Code generated" header, and is written atomically, making WriteGoFile suitable for direct use
+// in //go:generate programs:
+//
+//	err := valast.WriteGoFile("tables_gen.go", "tables", map[string]interface{}{
+//		"Colors": colors,
+//		"Sizes":  sizes,
+//	}, &valast.Options{PackagePath: "github.com/foo/bar/tables"})
+//
+// Options.PackagePath should usually be set to the import path of pkg, such that types declared
+// within it are not qualified. Imports are grouped as by goimports: standard library packages,
+// then other packages, then local packages matching Options.LocalPrefix.
+func WriteGoFile(filePath, pkg string, vars map[string]interface{}, opt *Options) error {
+	src, err := goFile(pkg, vars, opt)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filePath, src)
+}
+
+// goFile returns the formatted source of the Go file written by WriteGoFile.
+func goFile(pkg string, vars map[string]interface{}, opt *Options) ([]byte, error) {
+	if opt == nil {
+		opt = defaultOptions()
+	}
+	fileOpt := *opt
+	fileOpt.Indent, fileOpt.Prefix = "", ""
+
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	astOpt := fileOpt
+	astOpt.lineMarkers = true
+	results := make([]Result, len(names))
+	errs := make([]error, len(names))
+	for i, name := range names {
+		results[i], errs[i] = AST(reflect.ValueOf(vars[name]), &astOpt)
+	}
+
+	var (
+		decls    bytes.Buffer
+		packages = map[string]bool{}
+	)
+	if fileOpt.AnonymousTypeAliases {
+		for _, spec := range anonymousTypeAliases(results, vars) {
+			var typ bytes.Buffer
+			if err := FormatExpr(&typ, spec.Type, &fileOpt); err != nil {
+				return nil, err
+			}
+			fmt.Fprintf(&decls, "\ntype %s = %s\n", spec.Name.Name, typ.String())
+		}
+	}
+	if fileOpt.HoistDuplicates && fileOpt.MinDuplicateLen > 0 {
+		for _, decl := range hoistDuplicates(results, vars, fileOpt.MinDuplicateLen) {
+			spec := decl.Specs[0].(*ast.ValueSpec)
+			var value bytes.Buffer
+			if err := FormatExpr(&value, spec.Values[0], &fileOpt); err != nil {
+				return nil, err
+			}
+			fmt.Fprintf(&decls, "\n%s %s = %s\n", decl.Tok, spec.Names[0].Name, value.String())
+		}
+	}
+	for i, name := range names {
+		expr, result, err := formatResult(vars[name], results[i], errs[i], &fileOpt)
+		if err != nil {
+			return nil, fmt.Errorf("valast: %s: %w", name, err)
+		}
+		for _, p := range result.Packages {
+			packages[p] = true
+		}
+		fmt.Fprintf(&decls, "\nvar %s = %s\n", name, expr)
+	}
+
+	var src bytes.Buffer
+	fmt.Fprintf(&src, "// Code generated by valast. DO NOT EDIT.\n\npackage %s\n", pkg)
+	paths := make([]string, 0, len(packages))
+	for p := range packages {
+		paths = append(paths, p)
+	}
+	if imports := fileOpt.imports(paths); len(imports) > 0 {
+		// Imports are grouped as by goimports, see Options.LocalPrefix.
+		src.WriteString("\nimport (\n")
+		for i, imp := range imports {
+			if i > 0 && imports[i-1].Group != imp.Group {
+				src.WriteString("\n")
+			}
+			name, err := fileOpt.packagePathToName(imp.Path)
+			if err != nil {
+				return nil, err
+			}
+			if name != path.Base(imp.Path) {
+				fmt.Fprintf(&src, "\t%s %s\n", name, strconv.Quote(imp.Path))
+			} else {
+				fmt.Fprintf(&src, "\t%s\n", strconv.Quote(imp.Path))
+			}
+		}
+		src.WriteString(")\n")
+	}
+	src.Write(decls.Bytes())
+
+	formatted, err := formatSource(src.Bytes())
+	if err != nil {
+		return nil, &ErrFormat{Err: err}
+	}
+	return formatted, nil
+}
+
+// anonymousTypeAliases replaces the anonymous struct types written more than once in the ASTs of
+// the results with the names of type aliases, see Options.AnonymousTypeAliases, and returns their
+// declarations. Aliases are named anon1, anon2, etc. in the order the types first appear, skipping
+// the names of vars.
+func anonymousTypeAliases(results []Result, vars map[string]interface{}) []*ast.TypeSpec {
+	var (
+		order  []string
+		counts = map[string]int{}
+		types  = map[string]*ast.StructType{}
+		// The keys of types are computed before any are replaced, as nodes may be shared between
+		// types, e.g. a field type and the type of its composite literal.
+		keys = map[*ast.StructType]string{}
+	)
+	for _, r := range results {
+		if r.AST == nil {
+			continue
+		}
+		ast.Inspect(r.AST, func(n ast.Node) bool {
+			st, ok := n.(*ast.StructType)
+			if !ok || len(st.Fields.List) == 0 {
+				return true
+			}
+			key, ok := keys[st]
+			if !ok {
+				var err error
+				if key, err = formatSingleLine(st); err != nil {
+					return true
+				}
+				keys[st] = key
+			}
+			if counts[key] == 0 {
+				order = append(order, key)
+				types[key] = st
+			}
+			counts[key]++
+			return true
+		})
+	}
+
+	var (
+		specs   []*ast.TypeSpec
+		aliases = map[string]*ast.Ident{}
+		n       int
+	)
+	for _, key := range order {
+		if counts[key] < 2 {
+			continue
+		}
+		var name string
+		for {
+			n++
+			name = "anon" + strconv.Itoa(n)
+			if _, exists := vars[name]; !exists {
+				break
+			}
+		}
+		aliases[key] = ast.NewIdent(name)
+		specs = append(specs, &ast.TypeSpec{Name: aliases[key], Assign: 1, Type: types[key]})
+	}
+	replace := func(c *astutil.Cursor) bool {
+		st, ok := c.Node().(*ast.StructType)
+		if !ok {
+			return true
+		}
+		if alias, ok := aliases[keys[st]]; ok {
+			c.Replace(ast.NewIdent(alias.Name))
+			return false
+		}
+		return true
+	}
+	for i := range results {
+		if results[i].AST != nil {
+			results[i].AST = astutil.Apply(results[i].AST, replace, nil).(ast.Expr)
+		}
+	}
+	for _, spec := range specs {
+		// Repeated types nested within the alias are replaced by their own aliases.
+		astutil.Apply(spec.Type.(*ast.StructType).Fields, replace, nil)
+	}
+	return specs
+}
+
+// writeFileAtomic writes data to the named file by writing a temporary file in the same directory
+// and renaming it, such that readers never observe a partially written file.
+func writeFileAtomic(name string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
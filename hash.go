@@ -0,0 +1,39 @@
+package valast
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+)
+
+// Hash returns the hex-encoded SHA-256 hash of the Go syntax of v as written by StringWithOptions
+// with the given options, including any redactions, truncations and omissions they cause, e.g.
+// for use as a cache key or to detect changes to what would be written:
+//
+//	key, err := valast.Hash(config, &valast.Options{ExcludeFields: []string{"*.UpdatedAt"}})
+//
+// Values hash equally if and only if their Go syntax is identical. Hash behaves as if
+// Options.Deterministic were set, such that equal values always hash equally, and ignores
+// Options.Colorize. If Options.Partial is set, both the hash and an *ErrPartial may be returned.
+func Hash(v interface{}, opt *Options) (string, error) {
+	if opt == nil {
+		opt = defaultOptions()
+	}
+	hashOpt := *opt
+	hashOpt.Deterministic = true
+	var (
+		str string
+		err error
+	)
+	if hashOpt.SingleLine {
+		str, err = emitValue(v, &hashOpt)
+	} else {
+		str, _, err = formatValue(v, &hashOpt)
+	}
+	var partial *ErrPartial
+	if err != nil && !errors.As(err, &partial) {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(str))
+	return hex.EncodeToString(sum[:]), err
+}
@@ -0,0 +1,42 @@
+package valast
+
+import (
+	"go/ast"
+	"strconv"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// helperDecls replaces the function literals in expr which are immediately called with calls of
+// functions declared in their place, see Options.HelperFuncPrefix, and returns the expression
+// along with the declarations. Function literals nested within others are declared first, and
+// identical ones are declared once.
+func helperDecls(expr ast.Expr, prefix string) (ast.Expr, []ast.Decl) {
+	var (
+		decls []ast.Decl
+		names = map[string]string{} // function names by the syntax of their literals
+	)
+	expr = astutil.Apply(expr, nil, func(c *astutil.Cursor) bool {
+		call, ok := c.Node().(*ast.CallExpr)
+		if !ok || len(call.Args) > 0 {
+			return true
+		}
+		lit, ok := call.Fun.(*ast.FuncLit)
+		if !ok {
+			return true
+		}
+		key, err := printExpr(lit)
+		if err != nil {
+			return true
+		}
+		name, ok := names[key]
+		if !ok {
+			name = prefix + strconv.Itoa(len(decls)+1)
+			names[key] = name
+			decls = append(decls, &ast.FuncDecl{Name: ast.NewIdent(name), Type: lit.Type, Body: lit.Body})
+		}
+		c.Replace(&ast.CallExpr{Fun: ast.NewIdent(name)})
+		return true
+	}).(ast.Expr)
+	return expr, decls
+}
@@ -0,0 +1,65 @@
+package valast
+
+import (
+	"html"
+	"strings"
+
+	"github.com/hexops/valast/internal/highlight"
+)
+
+// HTML converts the value v into the equivalent Go literal syntax as StringWithOptions does,
+// returning it as syntax-highlighted HTML (see HighlightHTML), e.g. for embedding value dumps
+// into reference documentation.
+func HTML(v interface{}, opt *Options) (string, error) {
+	src, _, err := formatValue(v, opt)
+	if err != nil && src == "" {
+		return "", err
+	}
+	return HighlightHTML(src), err
+}
+
+// HighlightHTML returns the Go syntax src as an HTML fragment, a <pre class="valast"> element
+// in which each token is wrapped in a span describing its kind:
+//
+//	<span class="keyword">map</span>[<span class="builtin">string</span>]...
+//
+// The classes are keyword, builtin (predeclared identifiers, e.g. int or nil), string, number and
+// comment. Identifiers, operators and punctuation are not wrapped. HTMLStyle provides a default
+// stylesheet.
+func HighlightHTML(src string) string {
+	var b strings.Builder
+	b.Grow(len(src) * 2)
+	b.WriteString(`<pre class="valast"><code>`)
+	for _, tok := range highlight.Tokens(src) {
+		class, ok := htmlClasses[tok.Kind]
+		if !ok {
+			b.WriteString(html.EscapeString(tok.Text))
+			continue
+		}
+		b.WriteString(`<span class="`)
+		b.WriteString(class)
+		b.WriteString(`">`)
+		b.WriteString(html.EscapeString(tok.Text))
+		b.WriteString(`</span>`)
+	}
+	b.WriteString(`</code></pre>`)
+	return b.String()
+}
+
+// HTMLStyle is a CSS stylesheet for the HTML produced by HighlightHTML.
+const HTMLStyle = `pre.valast { tab-size: 4; }
+pre.valast .keyword { color: #a626a4; }
+pre.valast .builtin { color: #0184bc; }
+pre.valast .string { color: #50a14f; }
+pre.valast .number { color: #986801; }
+pre.valast .comment { color: #a0a1a7; font-style: italic; }
+`
+
+// htmlClasses maps each kind of token to the class of its span, see HighlightHTML.
+var htmlClasses = map[highlight.Kind]string{
+	highlight.Keyword: "keyword",
+	highlight.Builtin: "builtin",
+	highlight.String:  "string",
+	highlight.Number:  "number",
+	highlight.Comment: "comment",
+}
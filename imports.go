@@ -0,0 +1,81 @@
+package valast
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ImportGroup classifies imports into the groups written by goimports, separated by blank lines
+// in import declarations, see Options.ImportGroup.
+type ImportGroup int
+
+const (
+	// ImportGroupStd indicates a standard library package, e.g. "net/http".
+	ImportGroupStd ImportGroup = iota
+
+	// ImportGroupExternal indicates a package which is neither in the standard library nor local,
+	// e.g. "github.com/hexops/valast".
+	ImportGroupExternal
+
+	// ImportGroupLocal indicates a package matching Options.LocalPrefix.
+	ImportGroupLocal
+)
+
+// String returns the name of the group, e.g. "std".
+func (g ImportGroup) String() string {
+	switch g {
+	case ImportGroupStd:
+		return "std"
+	case ImportGroupExternal:
+		return "external"
+	case ImportGroupLocal:
+		return "local"
+	}
+	return "ImportGroup(" + strconv.Itoa(int(g)) + ")"
+}
+
+// Import describes a package imported by Go syntax, see Result.Imports.
+type Import struct {
+	// Path is the import path of the package.
+	Path string
+
+	// Group is the group of the import, see Options.ImportGroup.
+	Group ImportGroup
+}
+
+// ImportGroup returns the group of the import with the given path: local if it matches
+// Options.LocalPrefix, standard library if its first element has no dot (as goimports assumes),
+// and external otherwise. o may be nil.
+func (o *Options) ImportGroup(path string) ImportGroup {
+	if o != nil && o.LocalPrefix != "" {
+		for _, prefix := range strings.Split(o.LocalPrefix, ",") {
+			prefix = strings.TrimSpace(prefix)
+			if prefix != "" && (strings.HasPrefix(path, prefix) || path == strings.TrimSuffix(prefix, "/")) {
+				return ImportGroupLocal
+			}
+		}
+	}
+	if !strings.Contains(strings.Split(path, "/")[0], ".") {
+		return ImportGroupStd
+	}
+	return ImportGroupExternal
+}
+
+// imports returns the imports of the packages with the given paths, other than
+// Options.PackagePath, in the order they are written in import declarations: by group, then path.
+func (o *Options) imports(paths []string) []Import {
+	var imports []Import
+	for _, p := range paths {
+		if p != "" && p != o.PackagePath {
+			imports = append(imports, Import{Path: p, Group: o.ImportGroup(p)})
+		}
+	}
+	sort.Slice(imports, func(i, j int) bool {
+		if imports[i].Group != imports[j].Group {
+			return imports[i].Group < imports[j].Group
+		}
+		return imports[i].Path < imports[j].Path
+	})
+	return imports
+}
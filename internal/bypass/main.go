@@ -1,5 +1,5 @@
-//go:build !js
-// +build !js
+//go:build !js && !appengine && !safe && !purego && !tinygo
+// +build !js,!appengine,!safe,!purego,!tinygo
 
 package bypass
 
@@ -11,6 +11,10 @@ import (
 // This code used to match unexported code in https://github.com/davecgh/go-spew/blob/master/spew/common.go
 // in 2014 or so.
 
+// Supported reports if UnsafeReflectValue can access values obtained via unexported struct
+// fields, see main_safe.go.
+const Supported = true
+
 const (
 	// ptrSize is the size of a pointer on the current arch.
 	ptrSize = unsafe.Sizeof((*byte)(nil))
@@ -86,7 +90,22 @@ func init() {
 	}
 }
 
-// UnsafeReflectValue converts the passed reflect.Value into a one that bypasses
+// UnsafeReflectValue returns a value equivalent to v which may be used with Interface, Set, etc.
+// even if it was obtained via unexported struct fields.
+//
+// Addressable values are accessed in place via their address. Other values, e.g. those obtained
+// via MapIndex or the fields of such values, are copied into an addressable temporary, such that
+// their own fields are addressable in turn.
+func UnsafeReflectValue(v reflect.Value) reflect.Value {
+	if v.CanAddr() {
+		return reflect.NewAt(v.Type(), unsafe.Pointer(v.UnsafeAddr())).Elem()
+	}
+	tmp := reflect.New(v.Type()).Elem()
+	tmp.Set(unsafeReflectValue(v))
+	return tmp
+}
+
+// unsafeReflectValue converts the passed reflect.Value into a one that bypasses
 // the typical safety restrictions preventing access to unaddressable and
 // unexported data.  It works by digging the raw pointer to the underlying
 // value out of the protected value and generating a new unprotected (unsafe)
@@ -95,7 +114,7 @@ func init() {
 // This allows us to check for implementations of the Stringer and error
 // interfaces to be used for pretty printing ordinarily unaddressable and
 // inaccessible values such as unexported struct fields.
-func UnsafeReflectValue(v reflect.Value) (rv reflect.Value) {
+func unsafeReflectValue(v reflect.Value) (rv reflect.Value) {
 	indirects := 1
 	vt := v.Type()
 	upv := unsafe.Pointer(uintptr(unsafe.Pointer(&v)) + offsetPtr)
@@ -0,0 +1,18 @@
+//go:build js || appengine || safe || purego || tinygo
+// +build js appengine safe purego tinygo
+
+package bypass
+
+import "reflect"
+
+// Supported reports if UnsafeReflectValue can access values obtained via unexported struct
+// fields. It is false on platforms where package unsafe is unavailable or the layout of
+// reflect.Value is not known (appengine, js/wasm and TinyGo), or if the "safe" or "purego" build
+// tags are set.
+const Supported = false
+
+// UnsafeReflectValue returns v unchanged, as values obtained via unexported struct fields cannot
+// be accessed, see Supported.
+func UnsafeReflectValue(v reflect.Value) reflect.Value {
+	return v
+}
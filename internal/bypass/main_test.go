@@ -0,0 +1,114 @@
+//go:build !js && !appengine && !safe && !purego && !tinygo
+// +build !js,!appengine,!safe,!purego,!tinygo
+
+package bypass
+
+import (
+	"reflect"
+	"testing"
+)
+
+type inner struct {
+	n int
+}
+
+type fields struct {
+	b   bool
+	i   int
+	f   float64
+	c   complex128
+	s   string
+	arr [3]int
+	sl  []int
+	m   map[string]int
+	p   *int
+	fn  func() int
+	ifc interface{}
+	st  inner
+}
+
+func newFields() fields {
+	x := 7
+	return fields{
+		b:   true,
+		i:   -1,
+		f:   1.5,
+		c:   2 + 3i,
+		s:   "foo",
+		arr: [3]int{1, 2, 3},
+		sl:  []int{4, 5},
+		m:   map[string]int{"a": 1},
+		p:   &x,
+		fn:  func() int { return 42 },
+		ifc: inner{n: 9},
+		st:  inner{n: 10},
+	}
+}
+
+// check reports an error if the unexported fields of v, a fields value, cannot be accessed or
+// differ from want.
+func check(t *testing.T, v reflect.Value, want fields) {
+	t.Helper()
+	wantValue := reflect.ValueOf(want)
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if field.CanInterface() {
+			t.Fatalf("field %s: expected a read-only value", v.Type().Field(i).Name)
+		}
+		got := UnsafeReflectValue(field)
+		if !got.CanInterface() || !got.CanAddr() {
+			t.Fatalf("field %s: CanInterface=%v CanAddr=%v", v.Type().Field(i).Name, got.CanInterface(), got.CanAddr())
+		}
+		if got.Kind() == reflect.Func {
+			if got := got.Interface().(func() int)(); got != 42 {
+				t.Fatalf("field fn: got %v, want 42", got)
+			}
+			continue
+		}
+		if w := UnsafeReflectValue(wantValue.Field(i)).Interface(); !reflect.DeepEqual(got.Interface(), w) {
+			t.Fatalf("field %s: got %#v, want %#v", v.Type().Field(i).Name, got.Interface(), w)
+		}
+	}
+}
+
+func TestUnsafeReflectValue(t *testing.T) {
+	want := newFields()
+	t.Run("unaddressable", func(t *testing.T) {
+		check(t, reflect.ValueOf(newFields()), want)
+	})
+	t.Run("addressable", func(t *testing.T) {
+		v := newFields()
+		rv := reflect.ValueOf(&v).Elem()
+		check(t, rv, want)
+
+		// Addressable values are accessed in place.
+		UnsafeReflectValue(rv.Field(1)).SetInt(2)
+		if v.i != 2 {
+			t.Fatalf("got %d, want 2", v.i)
+		}
+	})
+	t.Run("map_index", func(t *testing.T) {
+		m := struct{ m map[string]fields }{m: map[string]fields{"a": newFields()}}
+		check(t, reflect.ValueOf(m).Field(0).MapIndex(reflect.ValueOf("a")), want)
+	})
+	t.Run("map_keys", func(t *testing.T) {
+		m := struct{ m map[inner]bool }{m: map[inner]bool{{n: 3}: true}}
+		key := reflect.ValueOf(m).Field(0).MapKeys()[0]
+		if got := UnsafeReflectValue(key).Interface(); got != (inner{n: 3}) {
+			t.Fatalf("got %#v", got)
+		}
+		if got := UnsafeReflectValue(key.Field(0)).Interface(); got != 3 {
+			t.Fatalf("got %#v", got)
+		}
+	})
+	t.Run("call_result", func(t *testing.T) {
+		results := reflect.ValueOf(newFields).Call(nil)
+		check(t, results[0], want)
+	})
+	t.Run("interface_elem", func(t *testing.T) {
+		v := reflect.ValueOf(newFields()).FieldByName("ifc").Elem()
+		if got := UnsafeReflectValue(v).Interface(); got != (inner{n: 9}) {
+			t.Fatalf("got %#v", got)
+		}
+	})
+}
@@ -0,0 +1,109 @@
+// Package highlight classifies the tokens of Go syntax for syntax highlighting.
+package highlight
+
+import (
+	"go/scanner"
+	"go/token"
+)
+
+// Kind is the kind of a token, which determines how it is highlighted.
+type Kind int
+
+const (
+	// Plain tokens, e.g. whitespace, operators and punctuation, are not highlighted.
+	Plain Kind = iota
+
+	// Keyword tokens are Go keywords, e.g. func or struct.
+	Keyword
+
+	// Builtin tokens are predeclared identifiers, e.g. nil, true or int.
+	Builtin
+
+	// Ident tokens are all other identifiers, e.g. type, field and package names.
+	Ident
+
+	// String tokens are string and character literals.
+	String
+
+	// Number tokens are integer, floating-point and imaginary literals.
+	Number
+
+	// Comment tokens are comments, e.g. those describing elided values.
+	Comment
+)
+
+// Token is a token of Go syntax.
+type Token struct {
+	Kind Kind
+	Text string
+}
+
+// Tokens splits the Go syntax src into tokens, such that concatenating their Text yields src.
+// Invalid syntax is returned as Plain tokens.
+func Tokens(src string) []Token {
+	var (
+		s      scanner.Scanner
+		fset   = token.NewFileSet()
+		file   = fset.AddFile("", fset.Base(), len(src))
+		tokens []Token
+		end    int
+	)
+	s.Init(file, []byte(src), func(token.Position, string) {}, scanner.ScanComments)
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok == token.SEMICOLON && lit == "\n" {
+			continue // automatically inserted
+		}
+		if lit == "" {
+			lit = tok.String()
+		}
+		start := file.Offset(pos)
+		if start < end || start+len(lit) > len(src) || src[start:start+len(lit)] != lit {
+			continue // e.g. a comment with its carriage returns removed
+		}
+		if start > end {
+			tokens = append(tokens, Token{Kind: Plain, Text: src[end:start]})
+		}
+		tokens = append(tokens, Token{Kind: kind(tok, lit), Text: lit})
+		end = start + len(lit)
+	}
+	if end < len(src) {
+		tokens = append(tokens, Token{Kind: Plain, Text: src[end:]})
+	}
+	return tokens
+}
+
+func kind(tok token.Token, lit string) Kind {
+	switch {
+	case tok.IsKeyword():
+		return Keyword
+	case tok == token.IDENT:
+		if predeclared[lit] {
+			return Builtin
+		}
+		return Ident
+	case tok == token.STRING || tok == token.CHAR:
+		return String
+	case tok == token.INT || tok == token.FLOAT || tok == token.IMAG:
+		return Number
+	case tok == token.COMMENT:
+		return Comment
+	}
+	return Plain
+}
+
+// predeclared is the set of predeclared identifiers which may appear in values, see
+// https://go.dev/ref/spec#Predeclared_identifiers
+var predeclared = map[string]bool{
+	"any": true, "bool": true, "byte": true, "comparable": true, "complex64": true,
+	"complex128": true, "error": true, "float32": true, "float64": true, "int": true,
+	"int8": true, "int16": true, "int32": true, "int64": true, "rune": true, "string": true,
+	"uint": true, "uint8": true, "uint16": true, "uint32": true, "uint64": true, "uintptr": true,
+	"true": true, "false": true, "iota": true, "nil": true,
+	"append": true, "cap": true, "clear": true, "close": true, "complex": true, "copy": true,
+	"delete": true, "imag": true, "len": true, "make": true, "max": true, "min": true,
+	"new": true, "panic": true, "print": true, "println": true, "real": true, "recover": true,
+}
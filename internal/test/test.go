@@ -1,5 +1,7 @@
 package test
 
+import "time"
+
 type foo struct {
 	bar string
 }
@@ -40,3 +42,114 @@ func NewBaz() *Baz {
 		},
 	}
 }
+
+// Account has unexported state which is set via a constructor and setter method.
+type Account struct {
+	Label string
+	id    int
+	owner string
+	tags  []string
+}
+
+func NewAccount(id int, owner string) *Account {
+	return &Account{id: id, owner: owner}
+}
+
+func (a *Account) SetTags(tags []string) {
+	a.tags = tags
+}
+
+// Settings has unexported state which is only set via setter methods.
+type Settings struct {
+	Name    string
+	verbose bool
+}
+
+func (s *Settings) SetVerbose(verbose bool) {
+	s.verbose = verbose
+}
+
+// Span has setter methods which are not all named after the fields they set: SetStart also moves
+// the end of the span, and so cannot be used to reproduce it.
+type Span struct {
+	end, start int
+}
+
+func (s *Span) SetStart(start int) {
+	s.end += start - s.start
+	s.start = start
+}
+
+func (s *Span) SetFrom(start int) {
+	s.start = start
+}
+
+func (s *Span) SetEnd(end int) {
+	s.end = end
+}
+
+// Opaque has unexported state which is set via a constructor returning a value.
+type Opaque struct {
+	secret string
+}
+
+func NewOpaque(secret string) Opaque {
+	return Opaque{secret: secret}
+}
+
+// Greeter is implemented by greeter, which is unexported and so only created via NewGreeter.
+type Greeter interface {
+	Greet() string
+}
+
+type greeter struct {
+	name    string
+	excited bool
+}
+
+func NewGreeter(name string, excited bool) *greeter {
+	return &greeter{name: name, excited: excited}
+}
+
+func (g *greeter) Greet() string {
+	if g.excited {
+		return "Hello, " + g.name + "!"
+	}
+	return "Hello, " + g.name
+}
+
+// level is unexported, and so cannot be written outside of this package.
+type level int
+
+// Anonymous returns a value of an anonymous struct type, whose fields have unexported types.
+func Anonymous() interface{} {
+	return struct {
+		Name   string
+		Level  level
+		Max    level
+		Nested struct{ Level level }
+	}{Name: "a", Level: 3, Nested: struct{ Level level }{Level: 4}}
+}
+
+// AnonymousSlice returns a value of an anonymous struct type, with a slice of an unexported type.
+func AnonymousSlice() interface{} {
+	return &struct{ Levels []level }{Levels: []level{1, 2}}
+}
+
+// AnonymousUnexported returns a value of an anonymous struct type with an unexported field.
+func AnonymousUnexported() interface{} {
+	return struct{ name string }{name: "a"}
+}
+
+// Leveled has an exported field of an unexported type.
+type Leveled struct {
+	Name  string
+	Level level
+}
+
+func NewLeveled(name string, l int) Leveled {
+	return Leveled{Name: name, Level: level(l)}
+}
+
+// Timeout is declared as time.Duration, but its underlying type is int64.
+type Timeout time.Duration
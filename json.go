@@ -0,0 +1,34 @@
+package valast
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// FromJSON unmarshals the JSON data into target and converts the result into the equivalent Go
+// literal syntax, e.g. for converting captured API payloads into typed test fixtures.
+//
+// target must be a non-nil pointer to the desired type, e.g. &[]User{}. If target is nil, the data
+// is unmarshaled into an interface{} value, producing generic maps and slices.
+func FromJSON(data []byte, target interface{}, opt *Options) (string, error) {
+	return FromUnmarshal(json.Unmarshal, data, target, opt)
+}
+
+// FromUnmarshal is like FromJSON, but unmarshals the data using the given function, e.g.
+// yaml.Unmarshal, to support other data formats.
+func FromUnmarshal(unmarshal func(data []byte, v interface{}) error, data []byte, target interface{}, opt *Options) (string, error) {
+	if target == nil {
+		var v interface{}
+		target = &v
+	}
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return "", fmt.Errorf("valast: target must be a non-nil pointer, got %T", target)
+	}
+	if err := unmarshal(data, target); err != nil {
+		return "", err
+	}
+	str, _, err := formatValue(v.Elem().Interface(), opt)
+	return str, err
+}
@@ -0,0 +1,101 @@
+package valast
+
+import (
+	"fmt"
+	"go/ast"
+	"math"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// LogOptions returns the options used by LogValue and other logging integrations. Composite
+// values nested more than 5 levels deep and elements beyond the first 20 of each slice or map are
+// elided, values which cannot be converted are replaced with placeholders, and the output is
+// limited to 16 KiB.
+func LogOptions() *Options {
+	return &Options{
+		MaxDepth:       5,
+		MaxElements:    20,
+		MaxOutputBytes: 16 << 10,
+		Partial:        true,
+	}
+}
+
+// isNested reports if the value v counts towards Options.MaxDepth, i.e. it is a composite value
+// whose elements are written within its literal.
+func isNested(v reflect.Value, opt *Options) bool {
+	vv := unexported(v)
+	switch vv.Kind() {
+	case reflect.Struct:
+		if vv.Type() == reflect.TypeOf(time.Time{}) {
+			return false
+		}
+	case reflect.Array, reflect.Slice, reflect.Map:
+	default:
+		return false
+	}
+	return !hasCustomRendering(vv.Type(), opt)
+}
+
+// depthElided returns the literal written in place of the composite value v, which is nested
+// deeper than Options.MaxDepth: a literal of its type containing only a comment, e.g.
+// `Foo{ /* ... */ }`, see depthComment.
+func depthElided(v reflect.Value, opt *Options, cache typeExprCache) (Result, error) {
+	vv := unexported(v)
+	if vv.Kind() != reflect.Struct && vv.Kind() != reflect.Array && vv.IsNil() {
+		return Result{AST: ast.NewIdent("nil")}, nil
+	}
+	t, err := typeExpr(vv.Type(), opt, cache)
+	if err != nil {
+		return Result{}, err
+	}
+	if opt.ExportedOnly && t.RequiresUnexported {
+		return Result{RequiresUnexported: true}, nil
+	}
+	return Result{
+		AST: &ast.CompositeLit{
+			Type: t.AST,
+			Elts: []ast.Expr{ast.NewIdent(depthComment(vv, opt))},
+		},
+		RequiresUnexported: t.RequiresUnexported,
+	}, nil
+}
+
+// maxElements returns the number of the n elements of an array, slice or map which should be
+// written according to Options.MaxElements.
+func (o *Options) maxElements(n int) int {
+	if o.MaxElements > 0 && n > o.MaxElements {
+		return o.MaxElements
+	}
+	return n
+}
+
+// elementsElided returns the comment written as the last element of a composite literal in place
+// of the elided elements, e.g. `/* 42 more */`.
+func elementsElided(n int) ast.Expr {
+	return ast.NewIdent("/* " + strconv.Itoa(n) + " more */")
+}
+
+// ErrTooDeep describes that values are nested deeper than Options.MaxNesting, e.g. because the
+// input is a very long linked list.
+type ErrTooDeep struct {
+	// Limit is the maximum nesting depth, see Options.MaxNesting.
+	Limit int
+}
+
+// Error implements the error interface.
+func (e *ErrTooDeep) Error() string {
+	return fmt.Sprintf("valast: values nested more than %d deep", e.Limit)
+}
+
+// maxNesting returns the maximum nesting depth according to Options.MaxNesting.
+func (o *Options) maxNesting() int {
+	switch {
+	case o.MaxNesting < 0:
+		return math.MaxInt
+	case o.MaxNesting == 0:
+		return 10000
+	}
+	return o.MaxNesting
+}
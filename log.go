@@ -0,0 +1,38 @@
+//go:build go1.21
+
+package valast
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// LogValue returns a slog.LogValuer which renders v as Go syntax on a single line (see Formatter)
+// when it is logged, e.g. for debug-level diagnostics of config and request objects:
+//
+//	logger.Debug("handling request", "req", valast.LogValue(req))
+//
+// The value is only converted if the record is actually handled. It is rendered with
+// LogOptions, which limit the depth and size of the output.
+func LogValue(v interface{}) slog.LogValuer {
+	return LogValueWithOptions(v, nil)
+}
+
+// LogValueWithOptions is like LogValue, but renders v with the specified options instead of
+// LogOptions.
+func LogValueWithOptions(v interface{}, opt *Options) slog.LogValuer {
+	if opt == nil {
+		opt = LogOptions()
+	}
+	return logValuer{v: v, opt: opt}
+}
+
+type logValuer struct {
+	v   interface{}
+	opt *Options
+}
+
+// LogValue implements the slog.LogValuer interface.
+func (l logValuer) LogValue() slog.Value {
+	return slog.StringValue(fmt.Sprint(FormatterWithOptions(l.v, l.opt)))
+}
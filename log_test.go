@@ -0,0 +1,43 @@
+//go:build go1.21
+
+package valast
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/hexops/autogold"
+)
+
+func TestLogValue(t *testing.T) {
+	type request struct {
+		Method string
+		Path   string
+		Query  map[string][]string
+	}
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey && len(groups) == 0 {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+	logger.Info("handling request", "req", LogValue(request{
+		Method: "GET",
+		Path:   "/search",
+		Query:  map[string][]string{"q": {"valast"}},
+	}))
+	autogold.Equal(t, buf.String())
+
+	t.Run("discarded", func(t *testing.T) {
+		logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+		logger.Debug("discarded", "value", LogValue(make(chan int)))
+		if strings.Contains(buf.String(), "discarded") {
+			t.Fatal("expected debug record to be discarded")
+		}
+	})
+}
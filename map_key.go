@@ -0,0 +1,133 @@
+package valast
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+)
+
+// MapKeyPolicy describes how map keys which cannot be written faithfully, such as NaN keys, are
+// handled, see Options.OnInvalidMapKey.
+type MapKeyPolicy int
+
+const (
+	// MapKeyPolicyWrite indicates that invalid keys are written like any other value. NaN keys are
+	// written as math.NaN(), each of which adds a separate entry when the composite literal is
+	// evaluated, such that the output remains equivalent. Keys which cannot be written at all,
+	// such as channels, fail the conversion with an *ErrInvalidType error.
+	MapKeyPolicyWrite MapKeyPolicy = iota
+
+	// MapKeyPolicyOmit indicates that entries with invalid keys are omitted, and described in
+	// Result.Omissions with the reason OmissionInvalidMapKey.
+	MapKeyPolicyOmit
+
+	// MapKeyPolicyError indicates an *ErrInvalidMapKey error is returned, before any entries of
+	// the map are converted.
+	MapKeyPolicyError
+)
+
+// ErrInvalidMapKey describes a map key which cannot be written faithfully, e.g. because it is or
+// contains NaN, which is not permitted by Options.OnInvalidMapKey.
+type ErrInvalidMapKey struct {
+	// Path is the path of the map entry, see Result.SourceMap, or of the map if the key cannot be
+	// written at all.
+	Path string
+
+	// Key is the key, or nil if it was obtained via unexported fields and cannot be accessed.
+	Key interface{}
+
+	// Reason describes why the key is invalid, e.g. "contains NaN".
+	Reason string
+}
+
+// Error implements the error interface.
+func (e *ErrInvalidMapKey) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("valast: invalid map key: %s", e.Reason)
+	}
+	return fmt.Sprintf("valast: invalid map key at %s: %s", e.Path, e.Reason)
+}
+
+// invalidMapKey returns the reason the map key v cannot be written faithfully, or "" if it can:
+// it is or contains NaN, and so cannot be looked up, or a channel, which cannot be written.
+func invalidMapKey(v reflect.Value) string {
+	v = unexported(v)
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		if math.IsNaN(v.Float()) {
+			return "contains NaN"
+		}
+	case reflect.Complex64, reflect.Complex128:
+		if c := v.Complex(); math.IsNaN(real(c)) || math.IsNaN(imag(c)) {
+			return "contains NaN"
+		}
+	case reflect.Chan:
+		if !v.IsNil() {
+			return "contains a channel"
+		}
+	case reflect.Interface:
+		if !v.IsNil() {
+			return invalidMapKey(v.Elem())
+		}
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if reason := invalidMapKey(v.Index(i)); reason != "" {
+				return reason
+			}
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if reason := invalidMapKey(v.Field(i)); reason != "" {
+				return reason
+			}
+		}
+	}
+	return ""
+}
+
+// mapValues returns the values of the entries of the map m with the given keys.
+//
+// Keys containing NaN are not equal to themselves and cannot be looked up, so their values are
+// found by iterating the map instead, and matched to the keys by their Go syntax (see renderKey).
+// Values of keys with identical syntax, e.g. several math.NaN() keys, are ordered by valueLess.
+func mapValues(m reflect.Value, keys []reflect.Value, renderKey func(reflect.Value) (string, error)) ([]reflect.Value, error) {
+	values := make([]reflect.Value, len(keys))
+	var missing []int
+	for i, key := range keys {
+		if values[i] = m.MapIndex(key); !values[i].IsValid() {
+			missing = append(missing, i)
+		}
+	}
+	if len(missing) == 0 {
+		return values, nil
+	}
+	byKey := map[string][]reflect.Value{}
+	iter := m.MapRange()
+	for iter.Next() {
+		key := iter.Key()
+		if m.MapIndex(key).IsValid() {
+			continue
+		}
+		syntax, err := renderKey(key)
+		if err != nil {
+			return nil, err
+		}
+		byKey[syntax] = append(byKey[syntax], iter.Value())
+	}
+	for _, vs := range byKey {
+		sort.SliceStable(vs, func(i, j int) bool { return valueLess(vs[i], vs[j]) })
+	}
+	for _, i := range missing {
+		syntax, err := renderKey(keys[i])
+		if err != nil {
+			return nil, err
+		}
+		vs := byKey[syntax]
+		if len(vs) == 0 {
+			return nil, fmt.Errorf("valast: cannot find map value for key %s", syntax)
+		}
+		values[i], byKey[syntax] = vs[0], vs[1:]
+	}
+	return values, nil
+}
@@ -0,0 +1,154 @@
+package valast
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/scanner"
+	"go/token"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Line markers are comments placed in the printed Go syntax by layoutMapEntries, which are
+// replaced by line breaks prior to formatting. They are needed because the AST produced by valast
+// does not have positions, and thus cannot otherwise describe line breaks.
+const (
+	newlineMarker   = "/*valast:newline*/"
+	blankLineMarker = "/*valast:blankline*/"
+
+	// lineCommentMarker prefixes the text of a line comment, which is followed by a line break,
+	// see layoutCommentedFields.
+	lineCommentMarker = "/*valast:comment "
+)
+
+// layoutMapEntries places line markers in the map key/value expressions such that each entry is
+// written on its own line, with blank lines between entries of different groups (according to
+// Options.GroupMapEntries.)
+//
+// The keys and values are replaced by identifiers holding their printed Go syntax, so this must
+// only be used when producing a string.
+func layoutMapEntries(entries []ast.Expr, keys []reflect.Value, opt *Options) error {
+	var prevGroup string
+	for i, entry := range entries {
+		kv := entry.(*ast.KeyValueExpr)
+		marker := newlineMarker
+		if opt.GroupMapEntries != nil {
+			group := opt.GroupMapEntries(keys[i])
+			if i > 0 && group != prevGroup {
+				marker = blankLineMarker
+			}
+			prevGroup = group
+		}
+		key, err := printExpr(kv.Key)
+		if err != nil {
+			return err
+		}
+		kv.Key = ast.NewIdent(marker + key)
+		if i == len(entries)-1 {
+			// Force the trailing comma multi-line form.
+			value, err := printExpr(kv.Value)
+			if err != nil {
+				return err
+			}
+			kv.Value = ast.NewIdent(value + "," + newlineMarker)
+		}
+	}
+	return nil
+}
+
+// layoutCommentedFields places line markers in the struct field key/value expressions such that
+// each field is written on its own line, followed by its line comment if non-empty (see
+// Options.CommentField.) The fields may be followed by a comment describing omitted fields, see
+// Options.DescribeOmitted.
+//
+// Like layoutMapEntries, this must only be used when producing a string.
+func layoutCommentedFields(fields []ast.Expr, comments []string) error {
+	for i, field := range fields {
+		marker := newlineMarker
+		if i > 0 && comments[i-1] != "" {
+			marker = lineCommentMarkerFor(comments[i-1])
+		}
+		kv, ok := field.(*ast.KeyValueExpr)
+		if !ok {
+			fields[i] = ast.NewIdent(marker + field.(*ast.Ident).Name + newlineMarker)
+			return nil
+		}
+		kv.Key = ast.NewIdent(marker + kv.Key.(*ast.Ident).Name)
+		if i == len(comments)-1 && i < len(fields)-1 {
+			continue // followed by the comment describing omitted fields
+		}
+		if i == len(fields)-1 {
+			value, err := printExpr(kv.Value)
+			if err != nil {
+				return err
+			}
+			marker = newlineMarker
+			if comments[i] != "" {
+				marker = lineCommentMarkerFor(comments[i])
+			}
+			kv.Value = ast.NewIdent(value + "," + marker)
+		}
+	}
+	return nil
+}
+
+// lineCommentMarkerFor returns the line marker for a line comment with the given text, which is
+// reduced to a single line.
+func lineCommentMarkerFor(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	return lineCommentMarker + strings.ReplaceAll(text, "*/", "* /") + "*/"
+}
+
+// printExpr returns the Go syntax for the expression.
+// bufferPool holds buffers used to print expressions, which happens once per map key.
+var bufferPool = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+func printExpr(expr ast.Expr) (string, error) {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	defer bufferPool.Put(buf)
+	buf.Reset()
+	if err := format.Node(buf, token.NewFileSet(), expr); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// replaceLineMarkers replaces the line markers in the Go syntax src with line breaks.
+func replaceLineMarkers(src []byte) []byte {
+	if !bytes.Contains(src, []byte("/*valast:")) {
+		return src
+	}
+	var (
+		s    scanner.Scanner
+		fset = token.NewFileSet()
+		file = fset.AddFile("", fset.Base(), len(src))
+		out  bytes.Buffer
+		last int
+	)
+	s.Init(file, src, nil, scanner.ScanComments)
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		isComment := tok == token.COMMENT && strings.HasPrefix(lit, lineCommentMarker)
+		if tok != token.COMMENT || (lit != newlineMarker && lit != blankLineMarker && !isComment) {
+			continue
+		}
+		offset := file.Offset(pos)
+		out.Write(src[last:offset])
+		if isComment {
+			out.WriteString("// ")
+			out.WriteString(strings.TrimSuffix(strings.TrimPrefix(lit, lineCommentMarker), "*/"))
+		}
+		out.WriteByte('\n')
+		if lit == blankLineMarker {
+			out.WriteByte('\n')
+		}
+		last = offset + len(lit)
+	}
+	out.Write(src[last:])
+	return out.Bytes()
+}
@@ -0,0 +1,178 @@
+package valast
+
+import (
+	"errors"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+)
+
+// ModuleResolver is a PackageResolver which resolves package names by consulting the go.mod file
+// of a module, typically that of the caller, rather than running the go command. It is thus
+// unaffected by the working directory of the process, e.g. when run outside of the module.
+//
+// Package paths are first stripped of any vendor directory, e.g. "example.com/app/vendor/foo"
+// is resolved as "foo". The name is then read from the package clause of the Go source files of
+// the package, found in the module itself, its vendor directory, the replacement or module cache
+// directory of the required module providing the package, in that order. If none is found, the
+// name is guessed from the path, ignoring major version suffixes such as "/v3".
+type ModuleResolver struct {
+	dir      string // the directory containing go.mod
+	mod      *modfile.File
+	modCache string
+}
+
+// NewModuleResolver returns a ModuleResolver for the module containing the directory dir, i.e.
+// whose go.mod file is found in dir or its closest parent.
+func NewModuleResolver(dir string) (*ModuleResolver, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		data, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+		if err == nil {
+			mod, err := modfile.Parse(filepath.Join(dir, "go.mod"), data, nil)
+			if err != nil {
+				return nil, err
+			}
+			if mod.Module == nil {
+				return nil, errors.New("valast: go.mod has no module directive")
+			}
+			return &ModuleResolver{dir: dir, mod: mod, modCache: moduleCacheDir()}, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, errors.New("valast: go.mod not found")
+		}
+		dir = parent
+	}
+}
+
+// moduleCacheDir returns the directory of the module cache, i.e. $GOMODCACHE or $GOPATH/pkg/mod.
+func moduleCacheDir() string {
+	if dir := os.Getenv("GOMODCACHE"); dir != "" {
+		return dir
+	}
+	gopath := build.Default.GOPATH
+	if i := strings.IndexRune(gopath, filepath.ListSeparator); i >= 0 {
+		gopath = gopath[:i]
+	}
+	return filepath.Join(gopath, "pkg", "mod")
+}
+
+// PackageName returns the name of the package with the given path, which never fails as the name
+// is guessed if the package cannot be found.
+func (r *ModuleResolver) PackageName(path string) (string, error) {
+	path = unvendoredPath(path)
+	for _, dir := range r.packageDirs(path) {
+		if name, ok := packageClause(dir); ok {
+			return name, nil
+		}
+	}
+	return guessPackageName(path), nil
+}
+
+// unvendoredPath returns the import path of the package with the given path, which may be
+// within a vendor directory, e.g. "foo" for "example.com/app/vendor/foo".
+func unvendoredPath(path string) string {
+	if i := strings.LastIndex(path, "/vendor/"); i >= 0 {
+		return path[i+len("/vendor/"):]
+	}
+	return strings.TrimPrefix(path, "vendor/")
+}
+
+// packageDirs returns the directories which may contain the source of the package with the given
+// path, in order of precedence.
+func (r *ModuleResolver) packageDirs(path string) []string {
+	var dirs []string
+	if rel, ok := within(path, r.mod.Module.Mod.Path); ok {
+		dirs = append(dirs, filepath.Join(r.dir, filepath.FromSlash(rel)))
+	}
+	dirs = append(dirs, filepath.Join(r.dir, "vendor", filepath.FromSlash(path)))
+
+	// The required module providing the package is the one with the longest matching path.
+	var (
+		provider *modfile.Require
+		rel      string
+	)
+	for _, req := range r.mod.Require {
+		if p, ok := within(path, req.Mod.Path); ok && (provider == nil || len(req.Mod.Path) > len(provider.Mod.Path)) {
+			provider, rel = req, p
+		}
+	}
+	if provider == nil {
+		return dirs
+	}
+	mod := provider.Mod
+	for _, rep := range r.mod.Replace {
+		if rep.Old.Path != mod.Path || (rep.Old.Version != "" && rep.Old.Version != mod.Version) {
+			continue
+		}
+		if rep.New.Version == "" {
+			// A local directory, relative to the module.
+			dir := filepath.FromSlash(rep.New.Path)
+			if !filepath.IsAbs(dir) {
+				dir = filepath.Join(r.dir, dir)
+			}
+			return append(dirs, filepath.Join(dir, filepath.FromSlash(rel)))
+		}
+		mod = rep.New
+	}
+	escapedPath, err := module.EscapePath(mod.Path)
+	if err != nil {
+		return dirs
+	}
+	escapedVersion, err := module.EscapeVersion(mod.Version)
+	if err != nil {
+		return dirs
+	}
+	return append(dirs, filepath.Join(r.modCache, filepath.FromSlash(escapedPath)+"@"+escapedVersion, filepath.FromSlash(rel)))
+}
+
+// within reports if the package path is within the module with the given path, and if so returns
+// the path of the package relative to the module.
+func within(path, modPath string) (string, bool) {
+	if path == modPath {
+		return "", true
+	}
+	if strings.HasPrefix(path, modPath+"/") {
+		return path[len(modPath)+1:], true
+	}
+	return "", false
+}
+
+// packageClause returns the package name declared by the non-test Go source files in dir, if any.
+// Files excluded by build constraints for the default build context, e.g. `//go:build ignore` or a
+// _windows.go suffix on other platforms, are skipped, as they may declare another package.
+func packageClause(dir string) (string, bool) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", false
+	}
+	fset := token.NewFileSet()
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		if match, err := build.Default.MatchFile(dir, name); err != nil || !match {
+			continue
+		}
+		f, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, parser.PackageClauseOnly)
+		if err != nil || f.Name.Name == "documentation" {
+			continue
+		}
+		return f.Name.Name, true
+	}
+	return "", false
+}
@@ -0,0 +1,169 @@
+package valast
+
+import (
+	"go/ast"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// omissions counts the fields or entries omitted from a composite literal, see
+// Options.DescribeOmitted.
+type omissions struct {
+	zero, unexported, redacted, excluded, invalidKey int
+}
+
+// comment returns the comment describing the omissions, written as the last element of the
+// composite literal, e.g. `/* 2 zero fields, 1 unexported field omitted */`. It returns nil if
+// nothing was omitted.
+func (o omissions) comment(noun string) ast.Expr {
+	var parts []string
+	for _, p := range []struct {
+		n    int
+		kind string
+	}{{o.zero, "zero"}, {o.unexported, "unexported"}, {o.redacted, "redacted"}, {o.excluded, "excluded"}, {o.invalidKey, "invalid key"}} {
+		if p.n > 0 {
+			parts = append(parts, strconv.Itoa(p.n)+" "+p.kind+" "+plural(p.n, noun))
+		}
+	}
+	if len(parts) == 0 {
+		return nil
+	}
+	return ast.NewIdent("/* " + strings.Join(parts, ", ") + " omitted */")
+}
+
+// depthComment returns the comment written in place of the contents of the composite value v,
+// which is nested deeper than Options.MaxDepth, e.g. `/* 3 fields omitted: max depth */`.
+func depthComment(v reflect.Value, opt *Options) string {
+	if !opt.DescribeOmitted {
+		return "/* ... */"
+	}
+	var (
+		n    int
+		noun string
+	)
+	switch v.Kind() {
+	case reflect.Struct:
+		n, noun = nonZeroFields(v), "field"
+	case reflect.Map:
+		n, noun = v.Len(), "entry"
+	default:
+		n, noun = v.Len(), "element"
+	}
+	return "/* " + strconv.Itoa(n) + " " + plural(n, noun) + " omitted: max depth */"
+}
+
+// nonZeroFields returns the number of non-zero fields of the struct value v.
+func nonZeroFields(v reflect.Value) int {
+	n := 0
+	for i := 0; i < v.NumField(); i++ {
+		if !v.Field(i).IsZero() {
+			n++
+		}
+	}
+	return n
+}
+
+// plural returns the plural form of noun if n is not 1.
+func plural(n int, noun string) string {
+	switch {
+	case n == 1:
+		return noun
+	case strings.HasSuffix(noun, "y"):
+		return strings.TrimSuffix(noun, "y") + "ies"
+	}
+	return noun + "s"
+}
+
+// Omission describes a value which was omitted from the AST, or which requires access to
+// unexported types or values, see Result.Omissions.
+type Omission struct {
+	// Path is the path at which the value was found in the input, see Result.SourceMap.
+	Path string
+
+	// Type is the type of the value, or its dynamic type if it is a non-nil interface.
+	Type reflect.Type
+
+	// Reason describes why the value was omitted, or requires unexported access.
+	Reason OmissionReason
+}
+
+// OmissionReason describes why a value was omitted, see Omission.
+type OmissionReason int
+
+const (
+	// OmissionUnexported indicates the value was omitted (or written as nil) because it requires
+	// access to unexported types or values, and Options.ExportedOnly or Options.UnexportedAsAny is
+	// set.
+	OmissionUnexported OmissionReason = iota
+
+	// OmissionRequiresUnexported indicates the value was written, but requires access to
+	// unexported types or values outside of the package specified in the Options, and is thus
+	// invalid code. See Result.RequiresUnexported.
+	OmissionRequiresUnexported
+
+	// OmissionRedacted indicates the struct field was omitted due to Options.Redact.
+	OmissionRedacted
+
+	// OmissionExcluded indicates the struct field was omitted due to Options.IncludeFields or
+	// Options.ExcludeFields.
+	OmissionExcluded
+
+	// OmissionInvalidMapKey indicates the map entry was omitted because its key cannot be written
+	// faithfully, and Options.OnInvalidMapKey is MapKeyPolicyOmit.
+	OmissionInvalidMapKey
+)
+
+// String returns the name of the reason, e.g. "unexported".
+func (r OmissionReason) String() string {
+	switch r {
+	case OmissionUnexported:
+		return "unexported"
+	case OmissionRequiresUnexported:
+		return "requires unexported"
+	case OmissionRedacted:
+		return "redacted"
+	case OmissionExcluded:
+		return "excluded"
+	case OmissionInvalidMapKey:
+		return "invalid map key"
+	}
+	return "OmissionReason(" + strconv.Itoa(int(r)) + ")"
+}
+
+// omit records the omission of the value v found at path, see Result.Omissions. mark is the
+// number of omissions recorded before converting v.
+//
+// An omitted value replaces the omissions recorded within it, while a value which requires
+// unexported access is only recorded if nothing within it was, such that the innermost value
+// requiring access is described.
+func (s *state) omit(mark int, path string, v reflect.Value, reason OmissionReason) {
+	if reason == OmissionRequiresUnexported {
+		if len(s.omissions) > mark {
+			return
+		}
+	} else {
+		s.omissions = s.omissions[:mark]
+	}
+	t := v.Type()
+	if v.Kind() == reflect.Interface && !v.IsNil() {
+		t = v.Elem().Type()
+	}
+	s.omissions = append(s.omissions, Omission{Path: path, Type: t, Reason: reason})
+}
+
+// prefixOmissions prepends child, the path of a child value relative to its parent (e.g. ".Name"
+// or "[3]"), to the paths of the omissions recorded since mark within the child value.
+//
+// This is only needed if paths are not tracked (see state.fieldPath), in which case the paths of
+// omissions are recorded relative to the value being converted, and are made absolute as the
+// conversion returns to the input value. Omissions are rare, so this is cheaper than tracking
+// paths.
+func (s *state) prefixOmissions(mark int, child string) {
+	if s.paths {
+		return
+	}
+	for i := mark; i < len(s.omissions); i++ {
+		s.omissions[i].Path = child + s.omissions[i].Path
+	}
+}
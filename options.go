@@ -0,0 +1,125 @@
+package valast
+
+import (
+	"reflect"
+	"sync/atomic"
+)
+
+// Option configures Options, see NewOptions and Options.With.
+type Option func(o *Options)
+
+// NewOptions returns new options configured by opts, e.g.:
+//
+//	opt := valast.NewOptions(valast.WithPackage("foo", "example.com/foo"), valast.WithMaxDepth(3))
+func NewOptions(opts ...Option) *Options {
+	return (&Options{}).With(opts...)
+}
+
+// With returns a copy of the options, see Clone, configured by opts. o may be nil.
+func (o *Options) With(opts ...Option) *Options {
+	c := o.Clone()
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// WithPackage sets Options.PackageName and Options.PackagePath, such that types in the package are
+// written without a package selector.
+func WithPackage(name, path string) Option {
+	return func(o *Options) {
+		o.PackageName, o.PackagePath = name, path
+	}
+}
+
+// WithExportedOnly sets Options.ExportedOnly.
+func WithExportedOnly() Option {
+	return func(o *Options) {
+		o.ExportedOnly = true
+	}
+}
+
+// WithMaxDepth sets Options.MaxDepth.
+func WithMaxDepth(n int) Option {
+	return func(o *Options) {
+		o.MaxDepth = n
+	}
+}
+
+// defaults are the options set by SetDefaultOptions, or nil.
+var defaults atomic.Pointer[Options]
+
+// SetDefaultOptions sets the options used in place of nil options throughout the package, e.g. by
+// String without any Option, StringWithOptions(v, nil) and AST(v, nil). This allows applications
+// to set their policy, such as presets and redaction, once at startup:
+//
+//	func main() {
+//		valast.SetDefaultOptions((&valast.Options{Redact: redactSecrets}).Use(presets.Stdlib()))
+//		...
+//	}
+//
+// The options passed to String are applied on top of the defaults, while non-nil options passed to
+// other functions replace them; use DefaultOptions().Merge(opt) to combine the two. A copy of opt
+// is stored, see Clone. A nil opt resets the defaults to the zero options.
+//
+// SetDefaultOptions is safe for concurrent use, including with conversions in progress, which use
+// the defaults at the time they started.
+func SetDefaultOptions(opt *Options) {
+	if opt == nil {
+		defaults.Store(nil)
+		return
+	}
+	defaults.Store(opt.Clone())
+}
+
+// DefaultOptions returns a copy of the options set by SetDefaultOptions, see Clone, or the zero
+// options if none were set.
+func DefaultOptions() *Options {
+	return defaults.Load().Clone()
+}
+
+// defaultOptions returns the options set by SetDefaultOptions, or the zero options. Unlike
+// DefaultOptions, the result is shared and must not be modified.
+func defaultOptions() *Options {
+	if o := defaults.Load(); o != nil {
+		return o
+	}
+	return &Options{}
+}
+
+// Clone returns a copy of the options which may be modified without affecting o, e.g. appending to
+// its Presets. o may be nil, in which case the zero options are returned.
+func (o *Options) Clone() *Options {
+	if o == nil {
+		return &Options{}
+	}
+	c := *o
+	c.qualified, c.unqualified = nil, nil
+	c.Presets = append([]*Preset(nil), o.Presets...)
+	return &c
+}
+
+// Merge returns a copy of the options, see Clone, with the fields of other which are not the zero
+// value taking precedence, and the Presets of other appended after those of o. This allows a
+// library to apply the options of its caller on top of its own defaults, e.g.:
+//
+//	opt := defaults.Merge(callerOptions)
+//
+// Because only non-zero fields are merged, other cannot reset a field of o to its zero value,
+// e.g. disable ExportedOnly. Either of o and other may be nil.
+func (o *Options) Merge(other *Options) *Options {
+	c := o.Clone()
+	if other == nil {
+		return c
+	}
+	dst, src := reflect.ValueOf(c).Elem(), reflect.ValueOf(other).Elem()
+	for i := 0; i < dst.NumField(); i++ {
+		field := dst.Type().Field(i)
+		if !field.IsExported() || field.Name == "Presets" || src.Field(i).IsZero() {
+			continue
+		}
+		dst.Field(i).Set(src.Field(i))
+	}
+	c.Presets = append(c.Presets, other.Presets...)
+	return c
+}
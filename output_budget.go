@@ -0,0 +1,76 @@
+package valast
+
+import (
+	"fmt"
+	"go/ast"
+	"reflect"
+	"sync/atomic"
+)
+
+// ErrOutputTooLarge describes that the Go syntax produced for a value would exceed
+// Options.MaxOutputBytes.
+type ErrOutputTooLarge struct {
+	// Limit is the value of Options.MaxOutputBytes.
+	Limit int
+}
+
+// Error implements the error interface.
+func (e *ErrOutputTooLarge) Error() string {
+	return fmt.Sprintf("valast: output exceeds %d bytes", e.Limit)
+}
+
+// addOutput accounts for the approximate size of the Go syntax produced for the value v (excluding
+// that of its elements, which are accounted for separately), returning an error if
+// Options.MaxOutputBytes is exceeded.
+func (s *state) addOutput(v reflect.Value, r Result, opt *Options) error {
+	if s.outputBytes == nil || r.AST == nil {
+		return nil
+	}
+	n := 1
+	switch v.Kind() {
+	case reflect.Array, reflect.Slice, reflect.Map, reflect.Struct, reflect.Ptr, reflect.Interface:
+		if lit, ok := r.AST.(*ast.CompositeLit); ok {
+			n += 2 + exprSize(lit.Type)
+			for _, elt := range lit.Elts {
+				n += 2
+				if kv, ok := elt.(*ast.KeyValueExpr); ok {
+					if key, ok := kv.Key.(*ast.Ident); ok {
+						n += len(key.Name) + 2 // struct field name
+					}
+				}
+			}
+		}
+	default:
+		n += exprSize(r.AST)
+	}
+	if atomic.AddInt64(s.outputBytes, int64(n)) > int64(opt.MaxOutputBytes) {
+		return &ErrOutputTooLarge{Limit: opt.MaxOutputBytes}
+	}
+	return nil
+}
+
+// outputExceeded reports if Options.MaxOutputBytes has been exceeded.
+func (s *state) outputExceeded(opt *Options) bool {
+	return s.outputBytes != nil && atomic.LoadInt64(s.outputBytes) > int64(opt.MaxOutputBytes)
+}
+
+// exprSize returns the approximate size of the Go syntax of the expression e.
+func exprSize(e ast.Expr) int {
+	if e == nil {
+		return 0
+	}
+	n := 0
+	ast.Inspect(e, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.Ident:
+			n += len(node.Name)
+		case *ast.BasicLit:
+			n += len(node.Value)
+		case nil:
+		default:
+			n++
+		}
+		return true
+	})
+	return n
+}
@@ -0,0 +1,132 @@
+package valast
+
+import (
+	"go/ast"
+	"sync"
+)
+
+// parallelThreshold is the minimum number of elements of a slice or map which are converted
+// concurrently, see Options.Parallelism.
+const parallelThreshold = 1024
+
+// forEach calls fn for each index in [0, n), stopping at the first error.
+//
+// If Options.Parallelism permits and n is large enough, the indices are split into contiguous
+// chunks which are processed concurrently, each with a forked state that is joined back into s in
+// order afterwards. fn must thus only use the state it is given, and must be safe to call
+// concurrently for different indices.
+func (s *state) forEach(n int, opt *Options, fn func(i int, s *state) error) error {
+	if s.workers == nil || n < parallelThreshold || opt.ExtractFiles != nil || s.profiler != nil {
+		for i := 0; i < n; i++ {
+			if err := fn(i, s); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Acquire as many workers as are available, in addition to the current goroutine. Workers are
+	// shared by nested calls, bounding the total number of goroutines.
+	workers := 1
+acquire:
+	for workers < opt.Parallelism {
+		select {
+		case s.workers <- struct{}{}:
+			workers++
+		default:
+			break acquire
+		}
+	}
+
+	var (
+		wg    sync.WaitGroup
+		chunk = (n + workers - 1) / workers
+		forks = make([]*state, workers)
+		errs  = make([]error, workers)
+	)
+	for w := range forks {
+		forks[w] = s.fork()
+		start, end := w*chunk, (w+1)*chunk
+		if end > n {
+			end = n
+		}
+		run := func(w, start, end int) {
+			for i := start; i < end; i++ {
+				if err := fn(i, forks[w]); err != nil {
+					errs[w] = err
+					return
+				}
+			}
+		}
+		if w == workers-1 {
+			run(w, start, end)
+			continue
+		}
+		wg.Add(1)
+		go func(w, start, end int) {
+			defer func() {
+				<-s.workers
+				wg.Done()
+			}()
+			run(w, start, end)
+		}(w, start, end)
+	}
+	wg.Wait()
+	for w, fork := range forks {
+		if errs[w] != nil {
+			return errs[w]
+		}
+		s.join(fork)
+	}
+	return nil
+}
+
+// fork returns a copy of the state for use by another goroutine, see forEach.
+func (s *state) fork() *state {
+	f := &state{
+		ctx:           s.ctx,
+		workers:       s.workers,
+		outputBytes:   s.outputBytes,
+		depth:         s.depth,
+		nesting:       s.nesting,
+		paths:         s.paths,
+		cycleDetector: &cycleDetector{seen: make(map[cycleKey]string, len(s.cycleDetector.seen))},
+		typeExprCache: make(typeExprCache, len(s.typeExprCache)),
+		packagesFound: map[string]bool{},
+		opaque:        s.opaque[:len(s.opaque):len(s.opaque)], // appending must not modify s.opaque
+	}
+	for k, v := range s.cycleDetector.seen {
+		f.cycleDetector.seen[k] = v
+	}
+	for k, v := range s.typeExprCache {
+		f.typeExprCache[k] = v
+	}
+	if s.sourceMap != nil {
+		f.sourceMap = map[ast.Expr]string{}
+	}
+	return f
+}
+
+// join merges the results recorded in the forked state f back into s.
+func (s *state) join(f *state) {
+	for k := range f.packagesFound {
+		s.packagesFound[k] = true
+	}
+	for k, v := range f.typeExprCache {
+		if _, ok := s.typeExprCache[k]; !ok {
+			s.typeExprCache[k] = v
+		}
+	}
+	for k, v := range f.sourceMap {
+		s.sourceMap[k] = v
+	}
+	for k, v := range f.pseudonyms {
+		if s.pseudonyms == nil {
+			s.pseudonyms = map[string]string{}
+		}
+		s.pseudonyms[k] = v
+	}
+	s.errors = append(s.errors, f.errors...)
+	s.omissions = append(s.omissions, f.omissions...)
+	s.cycles = append(s.cycles, f.cycles...)
+}
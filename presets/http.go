@@ -0,0 +1,137 @@
+package presets
+
+import (
+	"bytes"
+	"go/ast"
+	"io"
+	"net/http"
+	"reflect"
+
+	"github.com/hexops/valast"
+)
+
+// HTTP returns a preset which writes *http.Request and *http.Response values as composite
+// literals suitable for test fixtures, e.g. of recorded traffic:
+//
+//	&http.Request{
+//		Method: "POST",
+//		URL:    &url.URL{Scheme: "https", Host: "example.com", Path: "/users"},
+//		Header: http.Header{"Content-Type": {"application/json"}},
+//		Body:   io.NopCloser(strings.NewReader(`{"name":"alice"}`)),
+//	}
+//
+// Bodies are read in full, and replaced with a reader of the same contents such that they may
+// still be read after conversion. Unexported fields (such as the context of a request), and the
+// fields GetBody, Cancel and TLS, are omitted. The Response of a request is omitted, while the
+// Request of a response is written. Other fields are written as by the Stdlib preset.
+func HTTP() *valast.Preset {
+	p := &valast.Preset{}
+	valast.Handle(p, requestAST)
+	valast.Handle(p, responseAST)
+	return p
+}
+
+func requestAST(r *http.Request) (ast.Expr, []string, error) {
+	if r == nil {
+		return nilPtr("http", "Request"), []string{"net/http"}, nil
+	}
+	body, err := readBody(&r.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	c := *r
+	c.Body, c.GetBody, c.Cancel, c.TLS, c.Response = nil, nil, nil, nil, nil
+	expr, packages, err := httpAST(&c)
+	if err != nil {
+		return nil, nil, err
+	}
+	if body != nil {
+		insertField(expr, "Body", bodyAST(body))
+		packages = append(packages, "io", "strings")
+	}
+	return expr, packages, nil
+}
+
+func responseAST(r *http.Response) (ast.Expr, []string, error) {
+	if r == nil {
+		return nilPtr("http", "Response"), []string{"net/http"}, nil
+	}
+	body, err := readBody(&r.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	c := *r
+	c.Body, c.TLS, c.Request = nil, nil, nil
+	expr, packages, err := httpAST(&c)
+	if err != nil {
+		return nil, nil, err
+	}
+	if body != nil {
+		insertField(expr, "Body", bodyAST(body))
+		packages = append(packages, "io", "strings")
+	}
+	if r.Request != nil {
+		req, reqPackages, err := requestAST(r.Request)
+		if err != nil {
+			return nil, nil, err
+		}
+		insertField(expr, "Request", req)
+		packages = append(packages, reqPackages...)
+	}
+	return expr, packages, nil
+}
+
+// readBody reads the body of a request or response in full, replacing it with a reader of the same
+// contents. It returns nil if there is no body.
+func readBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil || *body == http.NoBody {
+		return nil, nil
+	}
+	data, err := io.ReadAll(*body)
+	(*body).Close()
+	*body = io.NopCloser(bytes.NewReader(data))
+	if data == nil {
+		data = []byte{}
+	}
+	return data, err
+}
+
+// bodyAST returns a reader of the body contents, e.g. `io.NopCloser(strings.NewReader("..."))`.
+func bodyAST(body []byte) ast.Expr {
+	return call(sel("io", "NopCloser"), call(sel("strings", "NewReader"), strLit(string(body))))
+}
+
+// httpAST returns the composite literal `&T{...}` of the request or response v, a pointer to a
+// struct, writing only its exported fields.
+func httpAST(v interface{}) (ast.Expr, []string, error) {
+	opt := (&valast.Options{
+		ExportedOnly: true,
+		// Unexported fields, e.g. the context of a request, are omitted as if redacted.
+		Redact: func(path string, field reflect.StructField) bool { return !field.IsExported() },
+	}).Use(Stdlib())
+	r, err := valast.AST(reflect.ValueOf(v), opt)
+	if err != nil {
+		return nil, nil, err
+	}
+	return r.AST, append(r.Packages, "net/http"), nil
+}
+
+// insertField inserts the named field into the composite literal `&T{...}` of an http.Request or
+// http.Response, after the fields declared before it.
+func insertField(expr ast.Expr, name string, value ast.Expr) {
+	lit := expr.(*ast.UnaryExpr).X.(*ast.CompositeLit)
+	t := reflect.TypeOf(http.Request{})
+	if sel := lit.Type.(*ast.SelectorExpr); sel.Sel.Name == "Response" {
+		t = reflect.TypeOf(http.Response{})
+	}
+	field, _ := t.FieldByName(name)
+	i := 0
+	for ; i < len(lit.Elts); i++ {
+		key, _ := t.FieldByName(lit.Elts[i].(*ast.KeyValueExpr).Key.(*ast.Ident).Name)
+		if key.Index[0] > field.Index[0] {
+			break
+		}
+	}
+	elt := &ast.KeyValueExpr{Key: ast.NewIdent(name), Value: value}
+	lit.Elts = append(lit.Elts[:i], append([]ast.Expr{elt}, lit.Elts[i:]...)...)
+}
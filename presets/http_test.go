@@ -0,0 +1,80 @@
+package presets
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hexops/autogold"
+	"github.com/hexops/valast"
+)
+
+func TestHTTP(t *testing.T) {
+	newRequest := func() *http.Request {
+		r := httptest.NewRequest("POST", "https://example.com/users?page=2", strings.NewReader(`{"name":"alice"}`))
+		r.Header.Set("Content-Type", "application/json")
+		return r
+	}
+	tests := []struct {
+		name  string
+		input func() interface{}
+	}{
+		{
+			name:  "request",
+			input: func() interface{} { return newRequest() },
+		},
+		{
+			name: "request_no_body",
+			input: func() interface{} {
+				r, _ := http.NewRequest("GET", "http://example.com", nil)
+				return r
+			},
+		},
+		{
+			name: "response",
+			input: func() interface{} {
+				return &http.Response{
+					Status:        "404 Not Found",
+					StatusCode:    404,
+					Proto:         "HTTP/1.1",
+					ProtoMajor:    1,
+					ProtoMinor:    1,
+					Header:        http.Header{"Content-Type": {"text/plain"}},
+					Body:          io.NopCloser(strings.NewReader("not found\n")),
+					ContentLength: 10,
+					Request:       newRequest(),
+				}
+			},
+		},
+		{
+			name: "nil",
+			input: func() interface{} {
+				return struct {
+					Request  *http.Request
+					Response *http.Response
+				}{}
+			},
+		},
+	}
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.name, func(t *testing.T) {
+			got := valast.StringWithOptions(tst.input(), (&valast.Options{}).Use(HTTP()))
+			autogold.Equal(t, got)
+		})
+	}
+
+	t.Run("body_preserved", func(t *testing.T) {
+		r := newRequest()
+		valast.StringWithOptions(r, (&valast.Options{}).Use(HTTP()))
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := string(body), `{"name":"alice"}`; got != want {
+			t.Fatalf("got body %q, want %q", got, want)
+		}
+	})
+}
@@ -0,0 +1,480 @@
+// Package presets provides sets of valast handlers (see valast.Preset) for commonly used types,
+// e.g.:
+//
+//	opt := (&valast.Options{}).Use(presets.Stdlib())
+package presets
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io/fs"
+	"math/big"
+	"net"
+	"net/netip"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing/fstest"
+	"time"
+
+	"github.com/hexops/valast"
+)
+
+// Stdlib returns a preset which writes values of standard library types using the functions and
+// constants of their packages, instead of their (often unexported) fields:
+//
+//	time.Time                     time.Date(2020, time.January, 2, 3, 4, 5, 0, time.UTC)
+//	time.Duration                 2*time.Hour + 30*time.Minute
+//	time.Month, time.Weekday      time.January, time.Monday
+//	net.IP                        net.ParseIP("2001:db8::1"), net.IPv4(10, 0, 0, 1).To4()
+//	net.IPMask                    net.CIDRMask(24, 32)
+//	netip.Addr                    netip.MustParseAddr("10.0.0.1")
+//	netip.Prefix                  netip.MustParsePrefix("10.0.0.0/8")
+//	netip.AddrPort                netip.MustParseAddrPort("10.0.0.1:80")
+//	*url.Userinfo                 url.UserPassword("alice", "secret")
+//	*regexp.Regexp                regexp.MustCompile("^a+$")
+//	*big.Int, *big.Rat            big.NewInt(42), big.NewRat(1, 3)
+//	*big.Float                    big.NewFloat(1.5)
+//	sync.Mutex, sync.WaitGroup    sync.Mutex{}
+//	reflect.Type                  reflect.TypeOf((*foo.Bar)(nil)).Elem()
+//	reflect.Kind                  reflect.Int
+//	context.Context               context.Background(), context.TODO()
+//	fstest.MapFS, embed.FS        fstest.MapFS{"a.txt": {Data: []byte("hello")}}
+//
+// Times in locations other than time.UTC and time.Local are written using time.FixedZone, and
+// the values of sync types (e.g. a locked mutex) are written as their zero value. Regular
+// expressions are assumed to be compiled with regexp.MustCompile. Embedded file systems cannot be
+// constructed, so their files are read and written as an fstest.MapFS, which may be used in
+// place of an embed.FS wherever an fs.FS is expected.
+func Stdlib() *valast.Preset {
+	p := &valast.Preset{}
+	valast.Handle(p, timeAST)
+	valast.Handle(p, durationAST)
+	valast.Handle(p, func(m time.Month) (ast.Expr, []string, error) {
+		if m < time.January || m > time.December {
+			return conversion("time", "Month", intLit(int64(m))), []string{"time"}, nil
+		}
+		return sel("time", m.String()), []string{"time"}, nil
+	})
+	valast.Handle(p, func(d time.Weekday) (ast.Expr, []string, error) {
+		if d < time.Sunday || d > time.Saturday {
+			return conversion("time", "Weekday", intLit(int64(d))), []string{"time"}, nil
+		}
+		return sel("time", d.String()), []string{"time"}, nil
+	})
+
+	valast.Handle(p, ipAST)
+	valast.Handle(p, ipMaskAST)
+	valast.Handle(p, func(a netip.Addr) (ast.Expr, []string, error) {
+		if !a.IsValid() {
+			return composite("netip", "Addr"), []string{"net/netip"}, nil
+		}
+		return call(sel("netip", "MustParseAddr"), strLit(a.String())), []string{"net/netip"}, nil
+	})
+	valast.Handle(p, func(prefix netip.Prefix) (ast.Expr, []string, error) {
+		if !prefix.IsValid() {
+			return composite("netip", "Prefix"), []string{"net/netip"}, nil
+		}
+		return call(sel("netip", "MustParsePrefix"), strLit(prefix.String())), []string{"net/netip"}, nil
+	})
+	valast.Handle(p, func(ap netip.AddrPort) (ast.Expr, []string, error) {
+		if !ap.IsValid() {
+			return composite("netip", "AddrPort"), []string{"net/netip"}, nil
+		}
+		return call(sel("netip", "MustParseAddrPort"), strLit(ap.String())), []string{"net/netip"}, nil
+	})
+	valast.Handle(p, func(u *url.Userinfo) (ast.Expr, []string, error) {
+		if u == nil {
+			return nilPtr("url", "Userinfo"), []string{"net/url"}, nil
+		}
+		if password, ok := u.Password(); ok {
+			return call(sel("url", "UserPassword"), strLit(u.Username()), strLit(password)), []string{"net/url"}, nil
+		}
+		return call(sel("url", "User"), strLit(u.Username())), []string{"net/url"}, nil
+	})
+	valast.Handle(p, func(re *regexp.Regexp) (ast.Expr, []string, error) {
+		if re == nil {
+			return nilPtr("regexp", "Regexp"), []string{"regexp"}, nil
+		}
+		return call(sel("regexp", "MustCompile"), strLit(re.String())), []string{"regexp"}, nil
+	})
+
+	valast.Handle(p, func(i *big.Int) (ast.Expr, []string, error) {
+		if i == nil {
+			return nilPtr("big", "Int"), []string{"math/big"}, nil
+		}
+		return bigIntAST(i), []string{"math/big"}, nil
+	})
+	valast.Handle(p, bigRatAST)
+	valast.Handle(p, bigFloatAST)
+
+	for name, t := range map[string]reflect.Type{
+		"Mutex":     reflect.TypeOf(sync.Mutex{}),
+		"RWMutex":   reflect.TypeOf(sync.RWMutex{}),
+		"WaitGroup": reflect.TypeOf(sync.WaitGroup{}),
+		"Once":      reflect.TypeOf(sync.Once{}),
+	} {
+		name := name
+		p.HandleType(t, func(reflect.Value) (ast.Expr, []string, error) {
+			return composite("sync", name), []string{"sync"}, nil
+		})
+	}
+
+	p.HandleType(reflect.TypeOf(reflect.TypeOf(0)), func(v reflect.Value) (ast.Expr, []string, error) {
+		return reflectTypeAST(v.Interface().(reflect.Type))
+	})
+	valast.Handle(p, reflectTypeAST)
+	valast.Handle(p, func(k reflect.Kind) (ast.Expr, []string, error) {
+		name, ok := kindNames[k]
+		if !ok {
+			return conversion("reflect", "Kind", intLit(int64(k))), []string{"reflect"}, nil
+		}
+		return sel("reflect", name), []string{"reflect"}, nil
+	})
+
+	contextAST := func(v reflect.Value) (ast.Expr, []string, error) {
+		name := "Background"
+		if v.Interface() == context.TODO() {
+			name = "TODO"
+		}
+		return call(sel("context", name)), []string{"context"}, nil
+	}
+	p.HandleType(reflect.TypeOf(context.Background()), contextAST)
+	p.HandleType(reflect.TypeOf(context.TODO()), contextAST)
+
+	valast.Handle(p, mapFSAST)
+	valast.Handle(p, embedFSAST)
+	return p
+}
+
+func timeAST(t time.Time) (ast.Expr, []string, error) {
+	if t.IsZero() {
+		return composite("time", "Time"), []string{"time"}, nil
+	}
+	var loc ast.Expr
+	switch t.Location() {
+	case time.UTC:
+		loc = sel("time", "UTC")
+	case time.Local:
+		loc = sel("time", "Local")
+	default:
+		name, offset := t.Zone()
+		loc = call(sel("time", "FixedZone"), strLit(name), intLit(int64(offset)))
+	}
+	return call(sel("time", "Date"),
+		intLit(int64(t.Year())),
+		sel("time", t.Month().String()),
+		intLit(int64(t.Day())),
+		intLit(int64(t.Hour())),
+		intLit(int64(t.Minute())),
+		intLit(int64(t.Second())),
+		intLit(int64(t.Nanosecond())),
+		loc,
+	), []string{"time"}, nil
+}
+
+func durationAST(d time.Duration) (ast.Expr, []string, error) {
+	r, err := valast.AST(reflect.ValueOf(d), &valast.Options{Durations: true})
+	return r.AST, []string{"time"}, err
+}
+
+func ipAST(ip net.IP) (ast.Expr, []string, error) {
+	switch len(ip) {
+	case 0:
+		if ip == nil {
+			return conversion("net", "IP", ast.NewIdent("nil")), []string{"net"}, nil
+		}
+	case net.IPv4len:
+		// net.IPv4 returns the 16-byte form.
+		return call(&ast.SelectorExpr{
+			X:   call(sel("net", "IPv4"), intLit(int64(ip[0])), intLit(int64(ip[1])), intLit(int64(ip[2])), intLit(int64(ip[3]))),
+			Sel: ast.NewIdent("To4"),
+		}), []string{"net"}, nil
+	case net.IPv6len:
+		return call(sel("net", "ParseIP"), strLit(ip.String())), []string{"net"}, nil
+	}
+	return bytesLit(sel("net", "IP"), ip), []string{"net"}, nil
+}
+
+func ipMaskAST(m net.IPMask) (ast.Expr, []string, error) {
+	if m == nil {
+		return conversion("net", "IPMask", ast.NewIdent("nil")), []string{"net"}, nil
+	}
+	if ones, bits := m.Size(); bits != 0 {
+		return call(sel("net", "CIDRMask"), intLit(int64(ones)), intLit(int64(bits))), []string{"net"}, nil
+	}
+	return bytesLit(sel("net", "IPMask"), m), []string{"net"}, nil
+}
+
+// bigIntAST returns the Go syntax for i, e.g. `big.NewInt(42)`, or an expression setting its
+// bytes if it does not fit in an int64.
+func bigIntAST(i *big.Int) ast.Expr {
+	if i.IsInt64() {
+		return call(sel("big", "NewInt"), intLit(i.Int64()))
+	}
+	expr := call(&ast.SelectorExpr{X: call(ast.NewIdent("new"), sel("big", "Int")), Sel: ast.NewIdent("SetBytes")},
+		bytesLit(&ast.ArrayType{Elt: ast.NewIdent("byte")}, i.Bytes()))
+	if i.Sign() < 0 {
+		expr = call(&ast.SelectorExpr{X: call(ast.NewIdent("new"), sel("big", "Int")), Sel: ast.NewIdent("Neg")}, expr)
+	}
+	return expr
+}
+
+func bigRatAST(r *big.Rat) (ast.Expr, []string, error) {
+	if r == nil {
+		return nilPtr("big", "Rat"), []string{"math/big"}, nil
+	}
+	if r.Num().IsInt64() && r.Denom().IsInt64() {
+		return call(sel("big", "NewRat"), intLit(r.Num().Int64()), intLit(r.Denom().Int64())), []string{"math/big"}, nil
+	}
+	return call(&ast.SelectorExpr{X: call(ast.NewIdent("new"), sel("big", "Rat")), Sel: ast.NewIdent("SetFrac")},
+		bigIntAST(r.Num()), bigIntAST(r.Denom())), []string{"math/big"}, nil
+}
+
+// bigFloatAST returns the Go syntax for f, e.g. `big.NewFloat(1.5)`. Values which cannot be
+// expressed as a float64 are written as their integer mantissa and exponent at their precision.
+// The rounding mode and accuracy of f are not preserved.
+func bigFloatAST(f *big.Float) (ast.Expr, []string, error) {
+	if f == nil {
+		return nilPtr("big", "Float"), []string{"math/big"}, nil
+	}
+	newFloat := call(ast.NewIdent("new"), sel("big", "Float"))
+	method := func(x ast.Expr, name string, args ...ast.Expr) ast.Expr {
+		return call(&ast.SelectorExpr{X: x, Sel: ast.NewIdent(name)}, args...)
+	}
+	if f.IsInf() {
+		return method(newFloat, "SetInf", ast.NewIdent(strconv.FormatBool(f.Signbit()))), []string{"math/big"}, nil
+	}
+	if x, acc := f.Float64(); acc == big.Exact {
+		if f.Prec() == 53 {
+			return call(sel("big", "NewFloat"), floatLit(x)), []string{"math/big"}, nil
+		}
+		return method(method(newFloat, "SetPrec", intLit(int64(f.Prec()))), "SetFloat64", floatLit(x)), []string{"math/big"}, nil
+	}
+	// f = mant × 2**(exp-prec), where mant is an integer.
+	exp := f.MantExp(nil)
+	mant, _ := new(big.Float).SetMantExp(f, int(f.Prec())-exp).Int(nil)
+	return method(method(newFloat, "SetPrec", intLit(int64(f.Prec()))), "SetMantExp",
+		method(newFloat, "SetInt", bigIntAST(mant)),
+		intLit(int64(exp)-int64(f.Prec())),
+	), []string{"math/big"}, nil
+}
+
+func reflectTypeAST(t reflect.Type) (ast.Expr, []string, error) {
+	if t == nil {
+		return ast.NewIdent("nil"), nil, nil
+	}
+	// e.g. reflect.TypeOf((*foo.Bar)(nil)).Elem(), which works for interface types too.
+	ptr, err := valast.AST(reflect.Zero(reflect.PointerTo(t)), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	expr := call(&ast.SelectorExpr{X: call(sel("reflect", "TypeOf"), ptr.AST), Sel: ast.NewIdent("Elem")})
+	return expr, append(ptr.Packages, "reflect"), nil
+}
+
+func embedFSAST(fsys embed.FS) (ast.Expr, []string, error) {
+	// Directories need not be written, as fstest.MapFS synthesizes the parents of its files.
+	m := fstest.MapFS{}
+	err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return err
+		}
+		m[path] = &fstest.MapFile{Data: data}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return mapFSAST(m)
+}
+
+func mapFSAST(m fstest.MapFS) (ast.Expr, []string, error) {
+	if m == nil {
+		return conversion("fstest", "MapFS", ast.NewIdent("nil")), []string{"testing/fstest"}, nil
+	}
+	paths := make([]string, 0, len(m))
+	for path := range m {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	lit := &ast.CompositeLit{Type: sel("fstest", "MapFS")}
+	packages := []string{"testing/fstest"}
+	for _, path := range paths {
+		f := m[path]
+		if f == nil {
+			lit.Elts = append(lit.Elts, &ast.KeyValueExpr{Key: strLit(path), Value: ast.NewIdent("nil")})
+			continue
+		}
+		file := &ast.CompositeLit{}
+		field := func(name string, value ast.Expr) {
+			file.Elts = append(file.Elts, &ast.KeyValueExpr{Key: ast.NewIdent(name), Value: value})
+		}
+		if f.Data != nil {
+			field("Data", call(&ast.ArrayType{Elt: ast.NewIdent("byte")}, strLit(string(f.Data))))
+		}
+		if f.Mode != 0 {
+			mode, modePackages := fileModeAST(f.Mode)
+			field("Mode", mode)
+			packages = append(packages, modePackages...)
+		}
+		if !f.ModTime.IsZero() {
+			modTime, _, _ := timeAST(f.ModTime)
+			field("ModTime", modTime)
+			packages = append(packages, "time")
+		}
+		if f.Sys != nil {
+			sys, err := valast.AST(reflect.ValueOf(f.Sys), nil)
+			if err != nil {
+				return nil, nil, err
+			}
+			field("Sys", sys.AST)
+			packages = append(packages, sys.Packages...)
+		}
+		// The type of the elements is implied, e.g. `"a.txt": {Data: ...}`.
+		lit.Elts = append(lit.Elts, &ast.KeyValueExpr{Key: strLit(path), Value: file})
+	}
+	return lit, packages, nil
+}
+
+// fileModeNames are the names of the fs.FileMode type bits, in order.
+var fileModeNames = []struct {
+	mode fs.FileMode
+	name string
+}{
+	{fs.ModeDir, "ModeDir"},
+	{fs.ModeAppend, "ModeAppend"},
+	{fs.ModeExclusive, "ModeExclusive"},
+	{fs.ModeTemporary, "ModeTemporary"},
+	{fs.ModeSymlink, "ModeSymlink"},
+	{fs.ModeDevice, "ModeDevice"},
+	{fs.ModeNamedPipe, "ModeNamedPipe"},
+	{fs.ModeSocket, "ModeSocket"},
+	{fs.ModeSetuid, "ModeSetuid"},
+	{fs.ModeSetgid, "ModeSetgid"},
+	{fs.ModeCharDevice, "ModeCharDevice"},
+	{fs.ModeSticky, "ModeSticky"},
+	{fs.ModeIrregular, "ModeIrregular"},
+}
+
+// fileModeAST returns the file mode m for assignment to an fs.FileMode, e.g. `fs.ModeDir | 0o755`.
+func fileModeAST(m fs.FileMode) (ast.Expr, []string) {
+	var (
+		expr     ast.Expr
+		packages []string
+	)
+	or := func(x ast.Expr) {
+		if expr == nil {
+			expr = x
+			return
+		}
+		expr = &ast.BinaryExpr{X: expr, Op: token.OR, Y: x}
+	}
+	for _, bit := range fileModeNames {
+		if m&bit.mode != 0 {
+			or(sel("fs", bit.name))
+			packages = []string{"io/fs"}
+			m &^= bit.mode
+		}
+	}
+	if m != 0 {
+		or(&ast.BasicLit{Kind: token.INT, Value: "0o" + strconv.FormatUint(uint64(m), 8)})
+	}
+	return expr, packages
+}
+
+// kindNames maps each reflect.Kind to the name of its constant.
+var kindNames = map[reflect.Kind]string{
+	reflect.Invalid:       "Invalid",
+	reflect.Bool:          "Bool",
+	reflect.Int:           "Int",
+	reflect.Int8:          "Int8",
+	reflect.Int16:         "Int16",
+	reflect.Int32:         "Int32",
+	reflect.Int64:         "Int64",
+	reflect.Uint:          "Uint",
+	reflect.Uint8:         "Uint8",
+	reflect.Uint16:        "Uint16",
+	reflect.Uint32:        "Uint32",
+	reflect.Uint64:        "Uint64",
+	reflect.Uintptr:       "Uintptr",
+	reflect.Float32:       "Float32",
+	reflect.Float64:       "Float64",
+	reflect.Complex64:     "Complex64",
+	reflect.Complex128:    "Complex128",
+	reflect.Array:         "Array",
+	reflect.Chan:          "Chan",
+	reflect.Func:          "Func",
+	reflect.Interface:     "Interface",
+	reflect.Map:           "Map",
+	reflect.Pointer:       "Pointer",
+	reflect.Slice:         "Slice",
+	reflect.String:        "String",
+	reflect.Struct:        "Struct",
+	reflect.UnsafePointer: "UnsafePointer",
+}
+
+func sel(pkg, name string) ast.Expr {
+	return &ast.SelectorExpr{X: ast.NewIdent(pkg), Sel: ast.NewIdent(name)}
+}
+
+func call(fun ast.Expr, args ...ast.Expr) ast.Expr {
+	return &ast.CallExpr{Fun: fun, Args: args}
+}
+
+// conversion returns the conversion of x to the named type, e.g. `time.Month(13)`.
+func conversion(pkg, name string, x ast.Expr) ast.Expr {
+	return call(sel(pkg, name), x)
+}
+
+// composite returns an empty composite literal of the named type, e.g. `sync.Mutex{}`.
+func composite(pkg, name string) ast.Expr {
+	return &ast.CompositeLit{Type: sel(pkg, name)}
+}
+
+// nilPtr returns a nil pointer to the named type, e.g. `(*big.Int)(nil)`.
+func nilPtr(pkg, name string) ast.Expr {
+	return call(&ast.ParenExpr{X: &ast.StarExpr{X: sel(pkg, name)}}, ast.NewIdent("nil"))
+}
+
+func intLit(i int64) ast.Expr {
+	if i < 0 {
+		return &ast.UnaryExpr{Op: token.SUB, X: intLit(-i)}
+	}
+	return &ast.BasicLit{Kind: token.INT, Value: strconv.FormatInt(i, 10)}
+}
+
+func floatLit(f float64) ast.Expr {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if f < 0 {
+		return &ast.UnaryExpr{Op: token.SUB, X: &ast.BasicLit{Kind: token.FLOAT, Value: s[1:]}}
+	}
+	return &ast.BasicLit{Kind: token.FLOAT, Value: s}
+}
+
+func strLit(s string) ast.Expr {
+	return &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(s)}
+}
+
+// bytesLit returns the conversion of the bytes b to the given type, e.g. `net.IP("\x7f\x00")`.
+func bytesLit(typ ast.Expr, b []byte) ast.Expr {
+	var buf strings.Builder
+	buf.WriteByte('"')
+	for _, c := range b {
+		fmt.Fprintf(&buf, "\\x%02x", c)
+	}
+	buf.WriteByte('"')
+	return call(typ, &ast.BasicLit{Kind: token.STRING, Value: buf.String()})
+}
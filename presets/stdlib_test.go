@@ -0,0 +1,125 @@
+package presets
+
+import (
+	"context"
+	"embed"
+	"io/fs"
+	"math/big"
+	"net"
+	"net/netip"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/hexops/autogold"
+	"github.com/hexops/valast"
+)
+
+//go:embed testdata/fs
+var embedded embed.FS
+
+func TestStdlib(t *testing.T) {
+	hugeInt, _ := new(big.Int).SetString("-123456789012345678901234567890", 10)
+	tests := []struct {
+		name  string
+		input interface{}
+	}{
+		{
+			name: "time",
+			input: struct {
+				UTC      time.Time
+				Zoned    time.Time
+				Zero     time.Time
+				Duration time.Duration
+				Month    time.Month
+				Weekday  time.Weekday
+			}{
+				UTC:      time.Date(2020, time.January, 2, 3, 4, 5, 6, time.UTC),
+				Zoned:    time.Date(2021, time.March, 4, 5, 6, 7, 0, time.FixedZone("EST", -5*60*60)),
+				Duration: 90 * time.Minute,
+				Month:    time.July,
+				Weekday:  time.Friday,
+			},
+		},
+		{
+			name: "net",
+			input: struct {
+				IPv4     net.IP
+				IPv6     net.IP
+				Nil      net.IP
+				Mask     net.IPMask
+				Addr     netip.Addr
+				Prefix   netip.Prefix
+				AddrPort netip.AddrPort
+				ZeroAddr netip.Addr
+				User     *url.Userinfo
+				Password *url.Userinfo
+			}{
+				IPv4:     net.IPv4(10, 0, 0, 1).To4(),
+				IPv6:     net.ParseIP("2001:db8::1"),
+				Mask:     net.CIDRMask(24, 32),
+				Addr:     netip.MustParseAddr("192.168.0.1"),
+				Prefix:   netip.MustParsePrefix("10.0.0.0/8"),
+				AddrPort: netip.MustParseAddrPort("[::1]:8080"),
+				User:     url.User("alice"),
+				Password: url.UserPassword("bob", "secret"),
+			},
+		},
+		{
+			name: "big",
+			input: []interface{}{
+				big.NewInt(42),
+				hugeInt,
+				big.NewRat(1, 3),
+				big.NewFloat(1.5),
+				new(big.Float).SetInf(true),
+				new(big.Float).SetPrec(200).Quo(big.NewFloat(1), big.NewFloat(3)),
+				(*big.Int)(nil),
+			},
+		},
+		{
+			name: "misc",
+			input: struct {
+				Pattern *regexp.Regexp
+				Mu      sync.Mutex
+				Kind    reflect.Kind
+				Type    reflect.Type
+				Context context.Context
+				TODO    context.Context
+			}{
+				Pattern: regexp.MustCompile(`^[a-z]+\d*$`),
+				Kind:    reflect.Map,
+				Type:    reflect.TypeOf(netip.Addr{}),
+				Context: context.Background(),
+				TODO:    context.TODO(),
+			},
+		},
+		{
+			name: "fs",
+			input: struct {
+				Embedded embed.FS
+				Empty    embed.FS
+				Map      fstest.MapFS
+				Nil      fstest.MapFS
+			}{
+				Embedded: embedded,
+				Map: fstest.MapFS{
+					"bin/tool": {Data: []byte{0x7f, 'E', 'L', 'F'}, Mode: 0o755, ModTime: time.Date(2020, time.January, 2, 3, 4, 5, 0, time.UTC)},
+					"dir":      {Mode: fs.ModeDir | 0o700},
+					"empty":    {},
+				},
+			},
+		},
+	}
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.name, func(t *testing.T) {
+			got := valast.StringWithOptions(tst.input, (&valast.Options{}).Use(Stdlib()))
+			autogold.Equal(t, got)
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package valast
+
+import (
+	"go/ast"
+	"math"
+	"reflect"
+)
+
+var (
+	intSliceType     = reflect.TypeOf([]int(nil))
+	stringSliceType  = reflect.TypeOf([]string(nil))
+	float64SliceType = reflect.TypeOf([]float64(nil))
+	byteSliceType    = reflect.TypeOf([]byte(nil))
+)
+
+// primitiveSliceAST converts v if it is a slice of int, string, float64 or byte values whose
+// elements need no handling of their own, reporting if so. The elements are written directly
+// rather than converting each one via computeAST, which dominates the cost of large slices of
+// numbers. The result is identical.
+func primitiveSliceAST(v reflect.Value, opt *Options, s *state) (Result, bool, error) {
+	var sliceType reflect.Type
+	switch v.Type().Elem() {
+	case intSliceType.Elem():
+		sliceType = intSliceType
+	case stringSliceType.Elem():
+		if opt.Pseudonymize != nil || opt.ExtractFiles != nil {
+			return Result{}, false, nil
+		}
+		sliceType = stringSliceType
+	case float64SliceType.Elem():
+		sliceType = float64SliceType
+	case byteSliceType.Elem():
+		sliceType = byteSliceType
+	default:
+		return Result{}, false, nil
+	}
+	// Elements may be written with conversions, have custom renderings, or be recorded in the
+	// state, such as in Result.SourceMap.
+	if opt.Qualify != nil || hasCustomRendering(sliceType.Elem(), opt) {
+		return Result{}, false, nil
+	}
+	if s.sourceMap != nil || s.outputBytes != nil || s.profiler != nil || s.nesting >= opt.maxNesting() {
+		return Result{}, false, nil
+	}
+
+	n := opt.maxElements(v.Len())
+	var elts []ast.Expr
+	if n > 0 {
+		elts = make([]ast.Expr, n, n+1)
+	}
+	switch values := v.Convert(sliceType).Interface().(type) {
+	case []int:
+		base, prefix := intBase(sliceType.Elem(), opt)
+		for i, x := range values[:n] {
+			elts[i] = ast.NewIdent(formatInt(int64(x), base, prefix))
+		}
+	case []string:
+		for i, x := range values[:n] {
+			elts[i] = stringExpr(x, opt)
+		}
+	case []float64:
+		for i, x := range values[:n] {
+			if math.IsNaN(x) || math.IsInf(x, 0) {
+				s.packagesFound["math"] = true
+			}
+			elts[i] = ast.NewIdent(formatFloat(x, 64, opt))
+		}
+	case []byte:
+		base, prefix := intBase(sliceType.Elem(), opt)
+		for i, x := range values[:n] {
+			elts[i] = ast.NewIdent(formatInt(int64(x), base, prefix))
+		}
+	}
+	if n < v.Len() {
+		elts = append(elts, elementsElided(v.Len()-n))
+	}
+	t, err := typeExpr(v.Type(), opt, s.typeExprCache)
+	if err != nil {
+		return Result{}, true, err
+	}
+	return Result{
+		AST:                &ast.CompositeLit{Type: t.AST, Elts: elts},
+		RequiresUnexported: t.RequiresUnexported,
+	}, true, nil
+}
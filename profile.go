@@ -0,0 +1,63 @@
+package valast
+
+import (
+	"reflect"
+	"strconv"
+)
+
+// Profile is a built-in set of options describing the style of the output, see WithProfile. It
+// allows the style to be standardized by a single setting.
+type Profile int
+
+const (
+	// ProfileDefault indicates the default style, i.e. that of the zero Options.
+	ProfileDefault Profile = iota
+
+	// ProfileMinimal indicates the shortest output: zero struct fields are omitted, empty
+	// pointers, slices and maps are written as nil (see Options.PruneEmpty), arrays are written
+	// sparsely (see Options.SparseArrays), and conversions are only written where required (see
+	// QualifyNever).
+	ProfileMinimal
+
+	// ProfileExhaustive indicates the most explicit output: zero struct fields are written (see
+	// Options.IncludeZeroFields), arrays list every element, and conversions are always written
+	// (see QualifyAlways), e.g. `Foo{Name: string(""), Count: int(0)}`.
+	ProfileExhaustive
+)
+
+// String returns the name of the profile, e.g. "minimal".
+func (p Profile) String() string {
+	switch p {
+	case ProfileDefault:
+		return "default"
+	case ProfileMinimal:
+		return "minimal"
+	case ProfileExhaustive:
+		return "exhaustive"
+	}
+	return "Profile(" + strconv.Itoa(int(p)) + ")"
+}
+
+// WithProfile sets the options which make up the style described by the profile p, replacing any
+// previous values of those options, i.e. Options.IncludeZeroFields, Options.PruneEmpty,
+// Options.SparseArrays, Options.RepeatedElements and Options.Qualify. Other options are kept, and
+// options applied after the profile take precedence, e.g.:
+//
+//	opt := valast.NewOptions(valast.WithProfile(valast.ProfileMinimal), valast.WithMaxDepth(3))
+func WithProfile(p Profile) Option {
+	return func(o *Options) {
+		o.IncludeZeroFields, o.PruneEmpty, o.SparseArrays = false, false, false
+		o.RepeatedElements, o.Qualify = 0, nil
+		switch p {
+		case ProfileMinimal:
+			o.PruneEmpty, o.SparseArrays = true, true
+			o.Qualify = qualifyNever
+		case ProfileExhaustive:
+			o.IncludeZeroFields = true
+			o.Qualify = qualifyAlways
+		}
+	}
+}
+
+func qualifyNever(reflect.Type) QualifyPolicy  { return QualifyNever }
+func qualifyAlways(reflect.Type) QualifyPolicy { return QualifyAlways }
@@ -0,0 +1,62 @@
+package valast
+
+import "reflect"
+
+// pruned reports if the value v is a non-nil pointer, slice or map which should be written as nil
+// because it is empty, see Options.PruneEmpty.
+func pruned(v reflect.Value, opt *Options) bool {
+	if !opt.PruneEmpty {
+		return false
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map:
+		return !v.IsNil() && emptyValue(v, map[uintptr]bool{})
+	}
+	return false
+}
+
+// emptyValue reports if the value v is empty: it is zero, or an empty slice or map, or a pointer
+// to (or struct or array of) only empty values, such that it would be written as an empty
+// composite literal once the empty values within it are pruned, e.g. `&Foo{Bar: &Bar{}}`.
+//
+// Pointers to other values, e.g. a pointer to a zero int, are not empty, and neither are values
+// held by interfaces, whose dynamic type would be lost. visiting holds the pointers currently
+// being visited, such that cycles are not empty.
+func emptyValue(v reflect.Value, visiting map[uintptr]bool) bool {
+	v = unexported(v)
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return true
+		}
+		switch v.Elem().Kind() {
+		case reflect.Struct, reflect.Array, reflect.Ptr, reflect.Slice, reflect.Map:
+		default:
+			return false
+		}
+		ptr := v.Pointer()
+		if visiting[ptr] {
+			return false
+		}
+		visiting[ptr] = true
+		defer delete(visiting, ptr)
+		return emptyValue(v.Elem(), visiting)
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if !emptyValue(v.Field(i), visiting) {
+				return false
+			}
+		}
+		return true
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if !emptyValue(v.Index(i), visiting) {
+				return false
+			}
+		}
+		return true
+	}
+	return v.IsZero()
+}
@@ -0,0 +1,64 @@
+package valast
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// Pseudonymizer describes string values which should be replaced with deterministic pseudonyms,
+// such that fixtures remain realistic but contain no personally identifiable information.
+//
+// Pseudonyms are derived from a hash of the original value and Salt, so equal values always
+// receive equal pseudonyms. Their format resembles the original where possible: email addresses
+// become e.g. user-1a2b3c4d@example.com, and IP addresses become addresses in the 10.0.0.0/8 or
+// 2001:db8::/32 ranges. Other values become e.g. anon-1a2b3c4d.
+type Pseudonymizer struct {
+	// Fields is a list of regular expressions matched against the path (see Result.SourceMap) of
+	// each string value, e.g. `\.Email$`. Matching values are replaced entirely.
+	Fields []*regexp.Regexp
+
+	// Values is a list of regular expressions matched against the contents of every string value,
+	// e.g. one matching email addresses. Matching substrings are replaced.
+	Values []*regexp.Regexp
+
+	// Salt is mixed into the hash of each value. Changing it changes all pseudonyms.
+	Salt string
+}
+
+// pseudonymize returns s with pseudonyms substituted according to p, recording each substitution
+// in pseudonyms.
+func (p *Pseudonymizer) pseudonymize(path, s string, pseudonyms map[string]string) string {
+	replace := func(original string) string {
+		pseudonym := p.pseudonym(original)
+		pseudonyms[original] = pseudonym
+		return pseudonym
+	}
+	for _, field := range p.Fields {
+		if field.MatchString(path) {
+			return replace(s)
+		}
+	}
+	for _, value := range p.Values {
+		s = value.ReplaceAllStringFunc(s, replace)
+	}
+	return s
+}
+
+// pseudonym returns the pseudonym for the original value.
+func (p *Pseudonymizer) pseudonym(original string) string {
+	sum := sha256.Sum256([]byte(p.Salt + "\x00" + original))
+	if ip := net.ParseIP(original); ip != nil {
+		if ip.To4() != nil {
+			return fmt.Sprintf("10.%d.%d.%d", sum[0], sum[1], sum[2])
+		}
+		return fmt.Sprintf("2001:db8::%x:%x", binary.BigEndian.Uint16(sum[0:]), binary.BigEndian.Uint16(sum[2:]))
+	}
+	if at := strings.LastIndex(original, "@"); at > 0 && at < len(original)-1 {
+		return fmt.Sprintf("user-%x@example.com", sum[:4])
+	}
+	return fmt.Sprintf("anon-%x", sum[:4])
+}
@@ -0,0 +1,75 @@
+package valast
+
+import (
+	"math"
+	"reflect"
+)
+
+// QualifyPolicy describes when basic literals (booleans, numbers and strings) are written with a
+// conversion to their type, e.g. int32(7) instead of 7, see Options.Qualify.
+type QualifyPolicy int
+
+const (
+	// QualifyAuto indicates conversions are written only where the literal would otherwise be
+	// ambiguous: always for named types, and for predeclared types other than the literal's
+	// default type (e.g. int32 but not int) unless the type is implied by the context, e.g. a
+	// struct field.
+	QualifyAuto QualifyPolicy = iota
+
+	// QualifyAlways indicates conversions are always written, e.g. int(7) and string("foo"), even
+	// where the type is implied by the context. This is useful when the output is pasted into an
+	// interface{}-typed context.
+	QualifyAlways
+
+	// QualifyNever indicates conversions are never written, e.g. 7 instead of MyInt(7), except
+	// where the expression would otherwise not be valid or have a different type, e.g. the
+	// argument of valast.Ptr, values held by interfaces such as int64(7) in an interface{}, or
+	// math.NaN() of type float32.
+	QualifyNever
+)
+
+// qualifyLiteral reports if the basic literal of the value v should be written with a conversion
+// to its type according to Options.Qualify, given the decision of QualifyAuto.
+func (o *Options) qualifyLiteral(v reflect.Value, auto bool) bool {
+	if o.Qualify == nil {
+		return auto
+	}
+	switch o.Qualify(v.Type()) {
+	case QualifyAlways:
+		return true
+	case QualifyNever:
+		switch v.Kind() {
+		case reflect.Float32, reflect.Float64:
+			// Written as math.NaN() or math.Inf(), which are float64 values.
+			f := v.Float()
+			return auto && (math.IsNaN(f) || math.IsInf(f, 0))
+		}
+		return false
+	}
+	return auto
+}
+
+// withRequiredQualify returns the options for a value whose literal must be written with a
+// conversion for the expression to have the correct type, e.g. the argument of valast.Ptr, such
+// that QualifyNever does not apply.
+func (o *Options) withRequiredQualify() *Options {
+	q := o.withQualify()
+	if q.Qualify == nil {
+		return q
+	}
+	tmp := *q
+	tmp.Qualify = nil
+	tmp.qualified, tmp.unqualified = nil, nil
+	return &tmp
+}
+
+// withDynamicType returns the options for the value v held by an interface. Its literal is written
+// without a conversion only if its type is the default type of the untyped constant, e.g. 7 for an
+// int, such that the dynamic type is preserved, e.g. int64(7) rather than 7, regardless of
+// Options.Qualify.
+func (o *Options) withDynamicType(v reflect.Value) *Options {
+	if isConstant(v) && !isUntypedDefault(v, o) {
+		return o.withRequiredQualify()
+	}
+	return o.withQualify()
+}
@@ -0,0 +1,65 @@
+package valast
+
+import (
+	"path"
+	"reflect"
+	"strings"
+)
+
+// shouldRedact reports if the struct field found at path should be redacted, either due to a
+// `valast:"redact"` struct tag or Options.Redact.
+func shouldRedact(path string, field reflect.StructField, opt *Options) bool {
+	for _, tagOpt := range strings.Split(field.Tag.Get("valast"), ",") {
+		if tagOpt == "redact" {
+			return true
+		}
+	}
+	return opt.Redact != nil && opt.Redact(path, field)
+}
+
+// redactedValue returns the placeholder value for a redacted field of type t, and whether or not
+// one exists. Fields of string kinds are replaced with Options.RedactPlaceholder, all others are
+// omitted (i.e. replaced with their zero value.)
+func redactedValue(t reflect.Type, opt *Options) (reflect.Value, bool) {
+	if t.Kind() != reflect.String {
+		return reflect.Value{}, false
+	}
+	placeholder := opt.RedactPlaceholder
+	if placeholder == "" {
+		placeholder = "<redacted>"
+	}
+	return reflect.ValueOf(placeholder).Convert(t), true
+}
+
+// excludeField reports if the field of the named struct type t should be omitted due to
+// Options.IncludeFields or Options.ExcludeFields.
+func excludeField(t reflect.Type, field reflect.StructField, opt *Options) bool {
+	if (len(opt.IncludeFields) == 0 && len(opt.ExcludeFields) == 0) || t.Name() == "" {
+		return false
+	}
+	name := t.String() + "." + field.Name
+	selected := false
+	for _, pattern := range opt.IncludeFields {
+		i := strings.LastIndex(pattern, ".")
+		if i < 0 {
+			continue
+		}
+		if ok, _ := path.Match(pattern[:i], t.String()); !ok {
+			continue
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			selected = false
+			break
+		}
+		selected = true
+	}
+	if selected {
+		return true
+	}
+	for _, pattern := range opt.ExcludeFields {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
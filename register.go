@@ -0,0 +1,117 @@
+package valast
+
+import (
+	"go/ast"
+	"reflect"
+	"sync"
+)
+
+// handler converts a value of a registered type into its Go AST expression, and the list of
+// packages used by it.
+type handler func(v reflect.Value) (ast.Expr, []string, error)
+
+var (
+	handlersMu sync.RWMutex
+	handlers   = map[reflect.Type]handler{}
+)
+
+// Register registers fn to convert values of type T into their Go AST expression, along with the
+// list of package paths used by the expression. This allows packages to provide valast support
+// for their own types, similar to how fmt.Formatter works. e.g.:
+//
+//	func init() {
+//		valast.Register(func(v Color) (ast.Expr, []string, error) {
+//			return &ast.CallExpr{...}, []string{"example.com/color"}, nil
+//		})
+//	}
+//
+// Registered handlers apply to values whose type is exactly T, unless Options.IgnoreRegistered is
+// set. Registering a handler for a type which already has one replaces it.
+//
+// Register is safe for concurrent use.
+func Register[T any](fn func(v T) (ast.Expr, []string, error)) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+	handlers[t] = func(v reflect.Value) (ast.Expr, []string, error) {
+		return fn(v.Interface().(T))
+	}
+}
+
+// Preset is a set of handlers which convert values of particular types into Go syntax, like
+// those registered via Register, but which only apply to the Options it is used with (see
+// Options.Use). This allows libraries to provide conversions for many types at once, e.g. those of
+// the standard library (see the presets package), without affecting other users of valast.
+//
+// The zero value is an empty preset. A preset must not be modified once it is in use.
+type Preset struct {
+	handlers map[reflect.Type]handler
+	builders map[reflect.Type]*Builder // see HandleBuilder
+}
+
+// Handle adds fn to the preset p to convert values of type T into their Go AST expression, along
+// with the list of package paths used by the expression, and returns p. It replaces any handler p
+// already has for T.
+//
+// If T is an interface type, fn is used for struct fields and elements of that type, and is given
+// the nil interface for nil values.
+func Handle[T any](p *Preset, fn func(v T) (ast.Expr, []string, error)) *Preset {
+	return p.HandleType(reflect.TypeOf((*T)(nil)).Elem(), func(v reflect.Value) (ast.Expr, []string, error) {
+		value, _ := v.Interface().(T)
+		return fn(value)
+	})
+}
+
+// HandleType is like Handle, but adds fn to convert values of type t, which may be unexported,
+// e.g. the dynamic type of the context.Context returned by context.Background.
+func (p *Preset) HandleType(t reflect.Type, fn func(v reflect.Value) (ast.Expr, []string, error)) *Preset {
+	if p.handlers == nil {
+		p.handlers = map[reflect.Type]handler{}
+	}
+	p.handlers[t] = fn
+	return p
+}
+
+// Use adds the presets to Options.Presets, and returns o.
+func (o *Options) Use(presets ...*Preset) *Options {
+	o.Presets = append(o.Presets, presets...)
+	return o
+}
+
+// handler returns the handler for type t from Options.Presets, or else the one registered via
+// Register, if any.
+func (o *Options) handler(t reflect.Type) handler {
+	for i := len(o.Presets) - 1; i >= 0; i-- {
+		if h := o.Presets[i].handlers[t]; h != nil {
+			return h
+		}
+	}
+	if o.IgnoreRegistered {
+		return nil
+	}
+	return registeredHandler(t)
+}
+
+// registeredHandler returns the handler registered for type t, if any.
+func registeredHandler(t reflect.Type) handler {
+	handlersMu.RLock()
+	defer handlersMu.RUnlock()
+	return handlers[t]
+}
+
+// registeredAST converts v using the handler for its type, see Options.handler, reporting if one
+// exists.
+func registeredAST(v reflect.Value, opt *Options, packagesFound map[string]bool) (Result, bool, error) {
+	h := opt.handler(v.Type())
+	if h == nil {
+		return Result{}, false, nil
+	}
+	expr, pkgs, err := h(v)
+	if err != nil {
+		return Result{}, true, err
+	}
+	for _, pkg := range pkgs {
+		packagesFound[pkg] = true
+	}
+	return Result{AST: expr}, true, nil
+}
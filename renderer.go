@@ -0,0 +1,80 @@
+package valast
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"reflect"
+)
+
+// Renderer is implemented by types which control how their values are converted into Go syntax.
+// It is checked before any other conversion, including handlers registered via Register.
+type Renderer interface {
+	// RenderValast returns the Go AST expression for the value, produced with the given options.
+	RenderValast(opt *Options) (ast.Expr, error)
+}
+
+// StringRenderer is a simpler alternative to Renderer, implemented by types which control how
+// their values are converted into Go syntax without constructing go/ast nodes.
+type StringRenderer interface {
+	// ValastString returns the Go expression syntax for the value, e.g. `color.RGB(255, 0, 0)`.
+	ValastString() string
+}
+
+var (
+	rendererType       = reflect.TypeOf((*Renderer)(nil)).Elem()
+	stringRendererType = reflect.TypeOf((*StringRenderer)(nil)).Elem()
+)
+
+// implementsRenderer reports if v should be converted using its implementation of the renderer
+// interface type iface.
+func implementsRenderer(v reflect.Value, iface reflect.Type) bool {
+	if !v.Type().Implements(iface) {
+		return false
+	}
+	switch v.Kind() {
+	case reflect.Interface:
+		// The dynamic value is checked instead.
+		return false
+	case reflect.Ptr:
+		// Nil pointers are written as nil. Pointers whose element implements the interface (via a
+		// value receiver) are handled as pointers to the rendered value.
+		return !v.IsNil() && !v.Type().Elem().Implements(iface)
+	}
+	return true
+}
+
+// renderedAST converts v using its Renderer or StringRenderer implementation, reporting if it has
+// one.
+func renderedAST(v reflect.Value, opt *Options) (Result, bool, error) {
+	if implementsRenderer(v, rendererType) {
+		expr, err := v.Interface().(Renderer).RenderValast(opt)
+		return Result{AST: expr}, true, err
+	}
+	if implementsRenderer(v, stringRendererType) {
+		src := v.Interface().(StringRenderer).ValastString()
+		expr, err := parser.ParseExpr(src)
+		if err != nil {
+			return Result{}, true, fmt.Errorf("valast: parsing %T.ValastString() result %q: %w", v.Interface(), src, err)
+		}
+		return Result{AST: expr}, true, nil
+	}
+	return Result{}, false, nil
+}
+
+// hasCustomRendering reports if values of type t are converted by a Renderer or StringRenderer
+// implementation, a template (see Options.Templates), a handler (see Options.Presets and Register),
+// a builder (see HandleBuilder) or their driver.Valuer implementation (see Options.DriverValues),
+// and thus may not be addressable.
+func hasCustomRendering(t reflect.Type, opt *Options) bool {
+	if t.Kind() != reflect.Interface && (t.Implements(rendererType) || t.Implements(stringRendererType)) {
+		return true
+	}
+	if opt.DriverValues && t.Kind() != reflect.Interface && t.Implements(valuerType) {
+		return true
+	}
+	if _, ok := opt.Templates[t]; ok {
+		return true
+	}
+	return opt.handler(t) != nil || opt.builder(t) != nil
+}
@@ -0,0 +1,101 @@
+package valast
+
+import (
+	"go/ast"
+	"go/token"
+	"reflect"
+	"strconv"
+)
+
+// isRepeated reports if v is an array or slice of at least Options.RepeatedElements elements,
+// which are all identical.
+func isRepeated(v reflect.Value, opt *Options) bool {
+	if opt.RepeatedElements <= 0 || v.Len() < opt.RepeatedElements || v.Len() == 0 {
+		return false
+	}
+	first := unexported(v.Index(0)).Interface()
+	for i := 1; i < v.Len(); i++ {
+		if !reflect.DeepEqual(first, unexported(v.Index(i)).Interface()) {
+			return false
+		}
+	}
+	return true
+}
+
+// repeatedElementsAST converts the array or slice v, whose elements are all identical (see
+// isRepeated), into a call of a function literal which declares it and assigns each element in a
+// loop, e.g.:
+//
+//	func() [4096]byte {
+//		var a [4096]byte
+//		for i := range a {
+//			a[i] = 255
+//		}
+//		return a
+//	}()
+//
+// Zero elements need not be assigned, so are written as e.g. `[4096]byte{}` or
+// `make([]byte, 4096)` instead.
+func repeatedElementsAST(v reflect.Value, opt *Options, path string, s *state) (Result, error) {
+	t, err := typeExpr(v.Type(), opt, s.typeExprCache)
+	if err != nil {
+		return Result{}, err
+	}
+	var decl ast.Stmt
+	switch v.Kind() {
+	case reflect.Array:
+		if unexported(v.Index(0)).IsZero() {
+			return Result{AST: &ast.CompositeLit{Type: t.AST}, RequiresUnexported: t.RequiresUnexported}, nil
+		}
+		decl = &ast.DeclStmt{Decl: &ast.GenDecl{Tok: token.VAR, Specs: []ast.Spec{
+			&ast.ValueSpec{Names: []*ast.Ident{ast.NewIdent("a")}, Type: t.AST},
+		}}}
+	default:
+		makeCall := &ast.CallExpr{
+			Fun:  ast.NewIdent("make"),
+			Args: []ast.Expr{t.AST, &ast.BasicLit{Kind: token.INT, Value: strconv.Itoa(v.Len())}},
+		}
+		if unexported(v.Index(0)).IsZero() {
+			return Result{AST: makeCall, RequiresUnexported: t.RequiresUnexported}, nil
+		}
+		decl = &ast.AssignStmt{Lhs: []ast.Expr{ast.NewIdent("a")}, Tok: token.DEFINE, Rhs: []ast.Expr{makeCall}}
+	}
+
+	mark := len(s.omissions)
+	s.pushOpaque(opt, path, false) // e.g. `v[1].Parent` is not written out
+	elem, err := computeASTProfiled(v.Index(0), opt.withUnqualify(), s.indexPath(path, 0), s)
+	s.popOpaque(opt)
+	if err != nil {
+		return Result{}, err
+	}
+	if len(s.omissions) > mark {
+		s.prefixOmissions(mark, "[0]")
+	}
+	if elem.AST == nil {
+		return Result{RequiresUnexported: true}, nil
+	}
+	return Result{
+		AST: &ast.CallExpr{Fun: &ast.FuncLit{
+			Type: &ast.FuncType{
+				Params:  &ast.FieldList{},
+				Results: &ast.FieldList{List: []*ast.Field{{Type: t.AST}}},
+			},
+			Body: &ast.BlockStmt{List: []ast.Stmt{
+				decl,
+				&ast.RangeStmt{
+					Key: ast.NewIdent("i"),
+					Tok: token.DEFINE,
+					X:   ast.NewIdent("a"),
+					Body: &ast.BlockStmt{List: []ast.Stmt{&ast.AssignStmt{
+						Lhs: []ast.Expr{&ast.IndexExpr{X: ast.NewIdent("a"), Index: ast.NewIdent("i")}},
+						Tok: token.ASSIGN,
+						Rhs: []ast.Expr{elem.AST},
+					}}},
+				},
+				&ast.ReturnStmt{Results: []ast.Expr{ast.NewIdent("a")}},
+			}},
+		}},
+		RequiresUnexported: t.RequiresUnexported || elem.RequiresUnexported,
+		OmittedUnexported:  elem.OmittedUnexported,
+	}, nil
+}
@@ -0,0 +1,134 @@
+package valast
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// PackageResolver resolves Go package paths to the package names written in their source, see
+// Options.PackageResolver. Implementations must be safe for concurrent use.
+type PackageResolver interface {
+	// PackageName returns the name of the package with the given path, e.g. "bar" for
+	// "github.com/foo/go-bar".
+	PackageName(path string) (string, error)
+}
+
+// ResolverFunc adapts a function, such as Options.PackagePathToName, to a PackageResolver.
+type ResolverFunc func(path string) (string, error)
+
+// PackageName calls f(path).
+func (f ResolverFunc) PackageName(path string) (string, error) {
+	return f(path)
+}
+
+// StaticResolver is a PackageResolver which resolves package paths from a fixed map of paths to
+// names, and never loads packages. Paths which are not in the map fail to resolve.
+type StaticResolver map[string]string
+
+// PackageName returns the name of the package with the given path from the map.
+func (r StaticResolver) PackageName(path string) (string, error) {
+	name, ok := r[path]
+	if !ok {
+		return "", fmt.Errorf("valast: unknown package %q", path)
+	}
+	return name, nil
+}
+
+// PackagesResolver is a PackageResolver which loads packages from disk using go/packages, which
+// runs the go command, see DefaultPackagePathToName. It does not cache the names it resolves, see
+// NewCachingResolver.
+type PackagesResolver struct{}
+
+// PackageName loads the package with the given path to determine its name.
+func (PackagesResolver) PackageName(path string) (string, error) {
+	return loadPackageName(path)
+}
+
+// defaultResolver is the PackageResolver used if neither Options.PackagePathToName nor
+// Options.PackageResolver is set, which loads each package at most once an hour.
+var defaultResolver = NewCachingResolver(PackagesResolver{}, 1024, time.Hour)
+
+// CachingResolver is a PackageResolver which caches the names resolved by another, see
+// NewCachingResolver. It is safe for concurrent use.
+type CachingResolver struct {
+	resolver PackageResolver
+	size     int
+	ttl      time.Duration
+	now      func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element // of *resolvedName, by path
+	lru     *list.List               // of *resolvedName, most recently used first
+}
+
+// resolvedName is a package name cached by a CachingResolver.
+type resolvedName struct {
+	path, name string
+	expires    time.Time // or zero if it never expires
+}
+
+// NewCachingResolver returns a PackageResolver which caches the names resolved by r. At most
+// size names are cached, evicting the least recently used, and each for at most ttl. A size or
+// ttl of zero or less indicates no limit. Errors are not cached.
+func NewCachingResolver(r PackageResolver, size int, ttl time.Duration) *CachingResolver {
+	return &CachingResolver{
+		resolver: r,
+		size:     size,
+		ttl:      ttl,
+		now:      time.Now,
+		entries:  map[string]*list.Element{},
+		lru:      list.New(),
+	}
+}
+
+// PackageName returns the cached name of the package with the given path, resolving it if it is
+// not cached or has expired.
+func (c *CachingResolver) PackageName(path string) (string, error) {
+	c.mu.Lock()
+	if e, ok := c.entries[path]; ok {
+		cached := e.Value.(*resolvedName)
+		if cached.expires.IsZero() || c.now().Before(cached.expires) {
+			c.lru.MoveToFront(e)
+			c.mu.Unlock()
+			return cached.name, nil
+		}
+		c.lru.Remove(e)
+		delete(c.entries, path)
+	}
+	c.mu.Unlock()
+
+	// Resolved without holding the lock, as it may be slow. Concurrent calls for the same path
+	// may thus each resolve it.
+	name, err := c.resolver.PackageName(path)
+	if err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	resolved := &resolvedName{path: path, name: name}
+	if c.ttl > 0 {
+		resolved.expires = c.now().Add(c.ttl)
+	}
+	if e, ok := c.entries[path]; ok {
+		e.Value = resolved
+		c.lru.MoveToFront(e)
+		return name, nil
+	}
+	c.entries[path] = c.lru.PushFront(resolved)
+	if c.size > 0 && c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*resolvedName).path)
+	}
+	return name, nil
+}
+
+// Purge removes all cached names, such that they are resolved again.
+func (c *CachingResolver) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = map[string]*list.Element{}
+	c.lru.Init()
+}
@@ -0,0 +1,498 @@
+package valast
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"reflect"
+	"strings"
+)
+
+// constructor describes a function in the package defining a struct type which constructs values
+// of that type, e.g.:
+//
+//	func NewFoo(name string, size int) *Foo
+//
+// Each parameter must share its name with an unexported field of the struct.
+type constructor struct {
+	name   string
+	ptr    bool  // whether *T rather than T is returned
+	fields []int // struct field index of each parameter
+}
+
+// construction describes the functions and methods in the package defining a struct type which
+// construct its values and set their unexported fields.
+type construction struct {
+	constructors []constructor
+	setters      map[int]string // name of the setter method of each struct field index, see setterField
+}
+
+// constructors returns the constructors of the named struct type t, see construction.
+func (s *state) constructors(t reflect.Type) ([]constructor, error) {
+	c, err := s.construction(t)
+	if err != nil {
+		return nil, err
+	}
+	return c.constructors, nil
+}
+
+// construction returns the constructors and setter methods of the named struct type t, detected by
+// parsing the source files of its package (located via loadPackageFiles). Results are cached in
+// the state.
+func (s *state) construction(t reflect.Type) (*construction, error) {
+	if cached, ok := s.constructorCache[t]; ok {
+		return cached, nil
+	}
+	if s.constructorCache == nil {
+		s.constructorCache = map[reflect.Type]*construction{}
+	}
+	files, err := loadPackageFiles(t.PkgPath())
+	if err != nil {
+		return nil, err
+	}
+
+	fieldsByName := map[string]int{}
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); !f.IsExported() {
+			fieldsByName[strings.ToLower(f.Name)] = i
+		}
+	}
+
+	result := &construction{setters: map[int]string{}}
+	fset := token.NewFileSet()
+	for _, file := range files {
+		f, err := parser.ParseFile(fset, file, nil, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, err
+		}
+		for _, decl := range f.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Type.TypeParams != nil || !fn.Name.IsExported() {
+				continue
+			}
+			if fn.Recv != nil {
+				if field, ok := setterField(fn, t); ok {
+					if _, dup := result.setters[field]; !dup {
+						result.setters[field] = fn.Name.Name
+					}
+				}
+				continue
+			}
+			if fn.Type.Results == nil || len(fn.Type.Results.List) != 1 || len(fn.Type.Results.List[0].Names) > 1 {
+				continue
+			}
+			c := constructor{name: fn.Name.Name}
+			resultType := fn.Type.Results.List[0].Type
+			if star, ok := resultType.(*ast.StarExpr); ok {
+				c.ptr = true
+				resultType = star.X
+			}
+			if ident, ok := resultType.(*ast.Ident); !ok || ident.Name != t.Name() {
+				continue
+			}
+			valid := true
+			for _, param := range fn.Type.Params.List {
+				typ := sourceTypeString(param.Type, f.Name.Name)
+				for _, name := range param.Names {
+					field, ok := fieldsByName[strings.ToLower(name.Name)]
+					if !ok || typ == "" || typ != t.Field(field).Type.String() {
+						valid = false
+						break
+					}
+					c.fields = append(c.fields, field)
+				}
+				if len(param.Names) == 0 {
+					valid = false
+				}
+			}
+			if valid {
+				result.constructors = append(result.constructors, c)
+			}
+		}
+	}
+	s.constructorCache[t] = result
+	return result, nil
+}
+
+// sourceTypeString returns the string form of the type expression expr, found in the source of the
+// named package, as it would be returned by reflect.Type.String. It returns an empty string if
+// the type expression is not supported.
+func sourceTypeString(expr ast.Expr, pkgName string) string {
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		if types.Universe.Lookup(expr.Name) != nil {
+			return expr.Name
+		}
+		return pkgName + "." + expr.Name
+	case *ast.SelectorExpr:
+		if x, ok := expr.X.(*ast.Ident); ok {
+			return x.Name + "." + expr.Sel.Name
+		}
+	case *ast.StarExpr:
+		if elem := sourceTypeString(expr.X, pkgName); elem != "" {
+			return "*" + elem
+		}
+	case *ast.ArrayType:
+		elem := sourceTypeString(expr.Elt, pkgName)
+		if elem == "" {
+			return ""
+		}
+		if expr.Len == nil {
+			return "[]" + elem
+		}
+		if lit, ok := expr.Len.(*ast.BasicLit); ok && lit.Kind == token.INT {
+			return "[" + lit.Value + "]" + elem
+		}
+	case *ast.MapType:
+		key, value := sourceTypeString(expr.Key, pkgName), sourceTypeString(expr.Value, pkgName)
+		if key != "" && value != "" {
+			return "map[" + key + "]" + value
+		}
+	}
+	return ""
+}
+
+// setterField returns the struct field index of the unexported field of t which the method fn of
+// *t sets, if it is a setter method: one whose body only assigns its single parameter to the
+// field, regardless of the method's name, e.g.:
+//
+//	func (f *Foo) SetName(name string) {
+//		f.name = name
+//	}
+//
+// Methods which do anything else, e.g. also update other fields, are not considered setters, as
+// calling them would not reproduce the value. The method's parameter type must be that of the
+// field.
+func setterField(fn *ast.FuncDecl, t reflect.Type) (int, bool) {
+	if len(fn.Recv.List) != 1 || len(fn.Recv.List[0].Names) != 1 || fn.Body == nil || len(fn.Body.List) != 1 {
+		return 0, false
+	}
+	star, ok := fn.Recv.List[0].Type.(*ast.StarExpr)
+	if !ok {
+		return 0, false
+	}
+	if ident, ok := star.X.(*ast.Ident); !ok || ident.Name != t.Name() {
+		return 0, false
+	}
+	params := fn.Type.Params.List
+	if len(params) != 1 || len(params[0].Names) != 1 || (fn.Type.Results != nil && len(fn.Type.Results.List) > 0) {
+		return 0, false
+	}
+	assign, ok := fn.Body.List[0].(*ast.AssignStmt)
+	if !ok || assign.Tok != token.ASSIGN || len(assign.Lhs) != 1 || len(assign.Rhs) != 1 {
+		return 0, false
+	}
+	lhs, ok := assign.Lhs[0].(*ast.SelectorExpr)
+	if !ok {
+		return 0, false
+	}
+	if recv, ok := lhs.X.(*ast.Ident); !ok || recv.Name != fn.Recv.List[0].Names[0].Name {
+		return 0, false
+	}
+	if rhs, ok := assign.Rhs[0].(*ast.Ident); !ok || rhs.Name != params[0].Names[0].Name {
+		return 0, false
+	}
+	field, ok := t.FieldByName(lhs.Sel.Name)
+	if !ok || field.IsExported() || len(field.Index) != 1 {
+		return 0, false
+	}
+	m, ok := reflect.PointerTo(t).MethodByName(fn.Name.Name)
+	if !ok || m.Type.NumIn() != 2 || m.Type.IsVariadic() || m.Type.In(1) != field.Type {
+		return 0, false
+	}
+	return field.Index[0], true
+}
+
+// constructedAST computes the AST for the struct value v (or a pointer to it, if ptr is true) which
+// reproduces its unexported fields via constructors and setter methods, see Options.Setters. It
+// reports false if v has no unexported state that needs to be reproduced, or if it cannot be
+// reproduced.
+func constructedAST(v reflect.Value, ptr bool, opt *Options, path string, s *state) (Result, bool, error) {
+	t := v.Type()
+	if t.Name() == "" || t.PkgPath() == "" || t.PkgPath() == opt.PackagePath || !unexportedSupported || opt.NoUnsafe {
+		return Result{}, false, nil
+	}
+
+	// Determine which fields need to be set.
+	var exported, unexported []int
+	for i := 0; i < t.NumField(); i++ {
+		if v.Field(i).IsZero() || shouldRedact(path+"."+t.Field(i).Name, t.Field(i), opt) || excludeField(t, t.Field(i), opt) {
+			continue
+		}
+		if t.Field(i).IsExported() {
+			exported = append(exported, i)
+		} else {
+			unexported = append(unexported, i)
+		}
+	}
+	if len(unexported) == 0 {
+		return Result{}, false, nil
+	}
+
+	// Prefer the constructor which sets the most fields, and use setters for the remainder.
+	cons, err := s.construction(t)
+	if err != nil {
+		return Result{}, false, err
+	}
+	var (
+		ctor     *constructor
+		ctorSets int
+	)
+	for i, c := range cons.constructors {
+		sets := 0
+		for _, f := range c.fields {
+			if !v.Field(f).IsZero() {
+				sets++
+			}
+		}
+		if ctor == nil || sets > ctorSets {
+			ctor, ctorSets = &cons.constructors[i], sets
+		}
+	}
+	set := map[int]bool{}
+	if ctor != nil {
+		for _, f := range ctor.fields {
+			set[f] = true
+		}
+	}
+	for _, f := range unexported {
+		if _, ok := cons.setters[f]; !set[f] && !ok {
+			return Result{}, false, nil
+		}
+	}
+
+	structType, err := typeExpr(t, opt, s.typeExprCache)
+	if err != nil {
+		return Result{}, false, err
+	}
+	if opt.ExportedOnly && structType.RequiresUnexported {
+		return Result{RequiresUnexported: true}, true, nil
+	}
+	result := Result{RequiresUnexported: structType.RequiresUnexported}
+	fieldAST := func(f int) (ast.Expr, error) {
+		value, ok, err := structFieldAST(v, f, opt, path, s)
+		if err != nil || !ok {
+			return nil, err
+		}
+		result.RequiresUnexported = result.RequiresUnexported || value.RequiresUnexported
+		result.OmittedUnexported = result.OmittedUnexported || value.OmittedUnexported
+		return value.AST, nil
+	}
+
+	// Construct the initial value, either via the constructor or a composite literal with the
+	// exported fields.
+	var (
+		init       ast.Expr
+		stmts      []ast.Stmt
+		recv       = ast.NewIdent("v")
+		returnAddr bool // whether init is a T value, but *T is desired
+	)
+	if ctor != nil {
+		var args []ast.Expr
+		for _, f := range ctor.fields {
+			arg, err := fieldAST(f)
+			if err != nil {
+				return Result{}, false, err
+			}
+			if arg == nil {
+				zero, err := computeASTProfiled(reflect.Zero(t.Field(f).Type), opt.withUnqualify(), path+"."+t.Field(f).Name, s)
+				if err != nil {
+					return Result{}, false, err
+				}
+				arg = zero.AST
+			}
+			args = append(args, arg)
+		}
+		var fun ast.Expr = ast.NewIdent(ctor.name)
+		if sel, ok := structType.AST.(*ast.SelectorExpr); ok {
+			fun = &ast.SelectorExpr{X: sel.X, Sel: ast.NewIdent(ctor.name)}
+		}
+		init = &ast.CallExpr{Fun: fun, Args: args}
+		if ctor.ptr && !ptr {
+			init = &ast.StarExpr{X: init}
+		}
+		returnAddr = !ctor.ptr && ptr
+		for _, f := range exported {
+			value, err := fieldAST(f)
+			if err != nil {
+				return Result{}, false, err
+			}
+			if value == nil {
+				continue
+			}
+			stmts = append(stmts, &ast.AssignStmt{
+				Lhs: []ast.Expr{&ast.SelectorExpr{X: recv, Sel: ast.NewIdent(t.Field(f).Name)}},
+				Tok: token.ASSIGN,
+				Rhs: []ast.Expr{value},
+			})
+		}
+	} else {
+		lit := &ast.CompositeLit{Type: structType.AST}
+		for _, f := range exported {
+			value, err := fieldAST(f)
+			if err != nil {
+				return Result{}, false, err
+			}
+			if value == nil {
+				continue
+			}
+			lit.Elts = append(lit.Elts, &ast.KeyValueExpr{Key: ast.NewIdent(t.Field(f).Name), Value: value})
+		}
+		init = lit
+		if ptr {
+			init = &ast.UnaryExpr{Op: token.AND, X: lit}
+		}
+	}
+
+	// Set the remaining unexported fields via setters.
+	for _, f := range unexported {
+		if set[f] {
+			continue
+		}
+		value, err := fieldAST(f)
+		if err != nil {
+			return Result{}, false, err
+		}
+		if value == nil {
+			continue
+		}
+		stmts = append(stmts, &ast.ExprStmt{X: &ast.CallExpr{
+			Fun:  &ast.SelectorExpr{X: recv, Sel: ast.NewIdent(cons.setters[f])},
+			Args: []ast.Expr{value},
+		}})
+	}
+
+	if len(stmts) == 0 {
+		result.AST = init
+		if returnAddr {
+			result.AST = &ast.CallExpr{Fun: opt.helperFunc("Ptr", s.packagesFound), Args: []ast.Expr{init}}
+		}
+		return result, true, nil
+	}
+
+	// Wrap the statements in a function literal which is immediately called, e.g.:
+	//
+	// 	func() *foo.Bar {
+	// 		v := foo.NewBar("name")
+	// 		v.SetSize(3)
+	// 		return v
+	// 	}()
+	//
+	var resultType ast.Expr = structType.AST
+	if ptr {
+		resultType = &ast.StarExpr{X: structType.AST}
+	}
+	body := append([]ast.Stmt{&ast.AssignStmt{Lhs: []ast.Expr{recv}, Tok: token.DEFINE, Rhs: []ast.Expr{init}}}, stmts...)
+	var ret ast.Expr = recv
+	if returnAddr {
+		ret = &ast.UnaryExpr{Op: token.AND, X: recv}
+	}
+	body = append(body, &ast.ReturnStmt{Results: []ast.Expr{ret}})
+	result.AST = &ast.CallExpr{Fun: &ast.FuncLit{
+		Type: &ast.FuncType{
+			Params:  &ast.FieldList{},
+			Results: &ast.FieldList{List: []*ast.Field{{Type: resultType}}},
+		},
+		Body: &ast.BlockStmt{List: body},
+	}}
+	return result, true, nil
+}
+
+// exportedConstructorAST computes the AST for the value v of an unexported struct type declared in
+// another package (or a pointer to one), which cannot be written when Options.ExportedOnly is set,
+// as a call to an exported constructor of that package, e.g. `foo.NewBar("name")`. It reports
+// false if v is not such a value, or if no constructor sets all of its non-zero fields.
+//
+// This allows the dynamic value of an interface, e.g. a field of type foo.Greeter, to be written
+// rather than omitted. If the package source cannot be loaded, the value is omitted as before.
+func exportedConstructorAST(v reflect.Value, opt *Options, path string, s *state) (Result, bool, error) {
+	ptr := v.Kind() == reflect.Ptr
+	if ptr {
+		if v.IsNil() {
+			return Result{}, false, nil
+		}
+		v = unexported(v.Elem())
+	}
+	t := v.Type()
+	if t.Kind() != reflect.Struct || t.Name() == "" || ast.IsExported(t.Name()) || t.PkgPath() == "" || t.PkgPath() == opt.PackagePath {
+		return Result{}, false, nil
+	}
+	constructors, err := s.constructors(t)
+	if err != nil {
+		return Result{}, false, nil
+	}
+
+	// Use the constructor with the fewest parameters which sets all non-zero fields.
+	var ctor *constructor
+	for i, c := range constructors {
+		set := map[int]bool{}
+		for _, f := range c.fields {
+			set[f] = true
+		}
+		valid := true
+		for f := 0; f < t.NumField(); f++ {
+			if !set[f] && !v.Field(f).IsZero() {
+				valid = false
+				break
+			}
+		}
+		if valid && (ctor == nil || len(c.fields) < len(ctor.fields)) {
+			ctor = &constructors[i]
+		}
+	}
+	if ctor == nil {
+		return Result{}, false, nil
+	}
+
+	var (
+		args   []ast.Expr
+		result Result
+		mark   = len(s.omissions)
+	)
+	for _, f := range ctor.fields {
+		field := t.Field(f)
+		fieldValue := unexported(v.Field(f))
+		fieldPath := s.fieldPath(path, field.Name)
+		if !fieldValue.IsZero() && shouldRedact(fieldPath, field, opt) {
+			placeholder, ok := redactedValue(field.Type, opt)
+			if !ok {
+				placeholder = reflect.Zero(field.Type)
+			}
+			fieldValue = placeholder
+		}
+		if excludeField(t, field, opt) {
+			fieldValue = reflect.Zero(field.Type)
+		}
+		argMark := len(s.omissions)
+		arg, err := computeASTProfiled(fieldValue, opt.withUnqualify(), fieldPath, s)
+		if err != nil {
+			return Result{}, false, err
+		}
+		if arg.RequiresUnexported {
+			s.omissions = s.omissions[:mark]
+			return Result{}, false, nil
+		}
+		if len(s.omissions) > argMark {
+			s.prefixOmissions(argMark, "."+field.Name)
+		}
+		args = append(args, arg.AST)
+		result.OmittedUnexported = result.OmittedUnexported || arg.OmittedUnexported
+	}
+	pkgName, err := opt.packagePathToName(t.PkgPath())
+	if err != nil {
+		return Result{}, false, err
+	}
+	s.packagesFound[t.PkgPath()] = true
+	result.AST = &ast.CallExpr{
+		Fun:  &ast.SelectorExpr{X: ast.NewIdent(pkgName), Sel: ast.NewIdent(ctor.name)},
+		Args: args,
+	}
+	switch {
+	case ctor.ptr && !ptr:
+		result.AST = &ast.StarExpr{X: result.AST}
+	case !ctor.ptr && ptr:
+		result.AST = &ast.CallExpr{Fun: opt.helperFunc("Ptr", s.packagesFound), Args: []ast.Expr{result.AST}}
+	}
+	return result, true, nil
+}
@@ -0,0 +1,204 @@
+package valast
+
+import (
+	"go/ast"
+	"go/token"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// StringStyle describes how string values are written as Go string literals. Strings which are not
+// valid UTF-8, or contain bytes which a raw literal cannot represent (e.g. NUL bytes or carriage
+// returns), are written as quoted literals using escape sequences such as "\xff", which preserve
+// their contents byte-for-byte, unless StringStyleBytes is used.
+type StringStyle int
+
+const (
+	// StringStyleAuto uses a raw `string` literal for strings containing double quotes, or for
+	// multi-line strings longer than Options.RawStringThreshold. Otherwise, a quoted "string"
+	// literal is used.
+	StringStyleAuto StringStyle = iota
+
+	// StringStyleQuoted always uses quoted "string" literals.
+	StringStyleQuoted
+
+	// StringStylePreferRaw uses raw `string` literals for all strings that can be represented
+	// as one, and quoted "string" literals otherwise.
+	StringStylePreferRaw
+
+	// StringStyleBytes writes strings which are not valid UTF-8 or contain NUL bytes as an explicit
+	// conversion of their bytes, e.g. string([]byte{0x00, 0xff}), making their binary contents
+	// obvious. Other strings are written as with StringStyleAuto.
+	StringStyleBytes
+)
+
+// stringExpr returns the Go syntax for the string s: a conversion of its bytes according to
+// StringStyleBytes, e.g. string([]byte{0x00, 0xff}), or otherwise its string literal.
+func stringExpr(s string, opt *Options) ast.Expr {
+	if b, ok := stringBytesLiteral(s, opt); ok {
+		return &ast.CallExpr{Fun: ast.NewIdent("string"), Args: []ast.Expr{b}}
+	}
+	return &ast.BasicLit{Kind: token.STRING, Value: stringLiteral(s, opt)}
+}
+
+// stringLiteral returns the Go string literal for s, truncated according to Options.MaxStringLen.
+func stringLiteral(s string, opt *Options) string {
+	if opt.MaxStringLen > 0 && len(s) > opt.MaxStringLen {
+		// Truncated at a UTF-8 sequence boundary, e.g. `"abcdef…" /* +4096 bytes */`.
+		end := opt.MaxStringLen
+		for end > 0 && !utf8.RuneStart(s[end]) {
+			end--
+		}
+		return styledStringLiteral(s[:end]+"…", opt) + " /* +" + strconv.Itoa(len(s)-end) + " bytes */"
+	}
+	return styledStringLiteral(s, opt)
+}
+
+// styledStringLiteral returns the Go string literal for s, according to Options.StringStyle and
+// the options it depends on.
+func styledStringLiteral(s string, opt *Options) string {
+	var wantRaw bool
+	switch opt.StringStyle {
+	case StringStyleQuoted:
+		wantRaw = false
+	case StringStylePreferRaw:
+		wantRaw = true
+	default:
+		threshold := opt.RawStringThreshold
+		if threshold == 0 {
+			threshold = 40
+		}
+		wantRaw = len(s) > threshold && strings.Contains(s, "\n")
+		wantRaw = wantRaw || strings.Contains(s, `"`)
+	}
+	if wantRaw && canBeRawString(s) && (!opt.ASCIIOnly || isASCII(s)) {
+		return "`" + s + "`"
+	}
+	if opt.ChunkStrings && len(s) > opt.lineWidth() {
+		var chunks []string
+		for _, chunk := range chunkString(s, opt.lineWidth()) {
+			chunks = append(chunks, quote(chunk, opt))
+		}
+		return strings.Join(chunks, " + ")
+	}
+	return quote(s, opt)
+}
+
+// stringBytesLiteral returns the []byte composite literal for s if it is written as a conversion
+// of its bytes according to StringStyleBytes, e.g. []byte{0x00, 0xff}. Strings truncated by
+// Options.MaxStringLen are not, as their contents are not preserved anyway.
+func stringBytesLiteral(s string, opt *Options) (*ast.CompositeLit, bool) {
+	if opt.StringStyle != StringStyleBytes || (utf8.ValidString(s) && !strings.Contains(s, "\x00")) {
+		return nil, false
+	}
+	if opt.MaxStringLen > 0 && len(s) > opt.MaxStringLen {
+		return nil, false
+	}
+	elts := make([]ast.Expr, len(s))
+	for i := 0; i < len(s); i++ {
+		value := strconv.FormatUint(uint64(s[i]), 16)
+		if s[i] < 0x10 {
+			value = "0" + value
+		}
+		elts[i] = &ast.BasicLit{Kind: token.INT, Value: "0x" + value}
+	}
+	return &ast.CompositeLit{Type: &ast.ArrayType{Elt: ast.NewIdent("byte")}, Elts: elts}, true
+}
+
+// quote returns the quoted Go string literal for s, escaping non-ASCII characters if
+// Options.ASCIIOnly is set.
+func quote(s string, opt *Options) string {
+	if opt.ASCIIOnly {
+		return strconv.QuoteToASCII(s)
+	}
+	return strconv.Quote(s)
+}
+
+// quoteRune returns the Go character literal for r, escaping it if it is not ASCII and
+// Options.ASCIIOnly is set.
+func quoteRune(r rune, opt *Options) string {
+	if opt.ASCIIOnly {
+		return strconv.QuoteRuneToASCII(r)
+	}
+	return strconv.QuoteRune(r)
+}
+
+// isASCII reports if s consists of only ASCII characters.
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// chunkString splits s into chunks of at most size bytes, without splitting UTF-8 sequences.
+func chunkString(s string, size int) []string {
+	var chunks []string
+	for len(s) > 0 {
+		end := 0
+		for end < len(s) {
+			_, runeSize := utf8.DecodeRuneInString(s[end:])
+			if end > 0 && end+runeSize > size {
+				break
+			}
+			end += runeSize
+		}
+		chunks = append(chunks, s[:end])
+		s = s[end:]
+	}
+	return chunks
+}
+
+// canBeRawString reports if s can be represented exactly as a raw `string` literal. This is not
+// the case if s contains a backtick, or content which the compiler discards or rejects in source:
+// carriage returns, NUL bytes, byte order marks, and invalid UTF-8.
+func canBeRawString(s string) bool {
+	return !strings.ContainsAny(s, "`\r\x00\uFEFF") && utf8.ValidString(s)
+}
+
+// isRuneLiteral reports if r is best written as a character literal, i.e. it is a valid Unicode
+// code point that is printable or whitespace.
+func isRuneLiteral(r rune) bool {
+	return utf8.ValidRune(r) && (unicode.IsPrint(r) || unicode.IsSpace(r))
+}
+
+// runesString returns the string equivalent of the []int32 slice v, and whether or not all of its
+// runes are suitable for writing as a string literal.
+func runesString(v reflect.Value) (string, bool) {
+	var b strings.Builder
+	for i := 0; i < v.Len(); i++ {
+		r := rune(unexported(v.Index(i)).Int())
+		if !isRuneLiteral(r) {
+			return "", false
+		}
+		b.WriteRune(r)
+	}
+	return b.String(), true
+}
+
+// runesLit returns the string conversion expression for the []int32 slice v with string contents
+// s, e.g. []rune("hello").
+func runesLit(v reflect.Value, s string, opt *Options, cache typeExprCache) (Result, error) {
+	sliceType, err := typeExpr(v.Type(), opt, cache)
+	if err != nil {
+		return Result{}, err
+	}
+	if v.Type().Name() == "" && v.Type().Elem().Name() == "int32" && v.Type().Elem().PkgPath() == "" {
+		sliceType.AST = &ast.ArrayType{Elt: ast.NewIdent("rune")}
+	}
+	if opt.ExportedOnly && sliceType.RequiresUnexported {
+		return Result{RequiresUnexported: true}, nil
+	}
+	return Result{
+		AST: &ast.CallExpr{
+			Fun:  sliceType.AST,
+			Args: []ast.Expr{&ast.BasicLit{Kind: token.STRING, Value: quote(s, opt)}},
+		},
+		RequiresUnexported: sliceType.RequiresUnexported,
+	}, nil
+}
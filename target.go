@@ -0,0 +1,115 @@
+package valast
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"reflect"
+)
+
+// ErrNotAssignable describes that a value cannot be assigned to the target type given to ASTAs.
+type ErrNotAssignable struct {
+	// Value is the actual value that was being converted.
+	Value interface{}
+
+	// Type is the target type.
+	Type reflect.Type
+}
+
+// Error implements the error interface.
+func (e *ErrNotAssignable) Error() string {
+	return fmt.Sprintf("valast: value of type %T is not assignable to %v", e.Value, e.Type)
+}
+
+// StringAs converts the value v into the equivalent Go literal syntax, for assignment to a
+// destination of type t, e.g. a variable or struct field of that type.
+//
+// Knowing the target type, conversions and type names are only written where they are needed:
+// a value of type time.Duration assigned to a time.Duration is written as an untyped constant,
+// while the same value assigned to an interface{} keeps its conversion. Likewise nil pointers,
+// slices and maps are written as `nil` unless the target is an interface.
+//
+// If any error occurs, it will be returned as the string value. If handling errors is desired then
+// consider using the ASTAs function directly.
+func StringAs(v interface{}, t reflect.Type) string {
+	return StringAsWithOptions(v, t, nil)
+}
+
+// StringAsWithOptions is like StringAs, but with the specified options.
+func StringAsWithOptions(v interface{}, t reflect.Type, opt *Options) string {
+	if opt == nil {
+		opt = defaultOptions()
+	}
+	astOpt := *opt
+	astOpt.lineMarkers = true
+	result, err := ASTAs(reflect.ValueOf(v), t, &astOpt)
+	str, _, err := formatResult(v, result, err, opt)
+	if err != nil && str == "" {
+		return err.Error()
+	}
+	if opt.Colorize {
+		return colorize(str)
+	}
+	return str
+}
+
+// ASTAs is like AST, but converts the value v for assignment to a destination of type t, see
+// StringAs. An *ErrNotAssignable is returned if v is not assignable to t.
+//
+// An invalid value v (i.e. the nil interface) may be assigned to any type which has nil as its
+// zero value.
+func ASTAs(v reflect.Value, t reflect.Type, opt *Options) (Result, error) {
+	if !v.IsValid() {
+		if !hasNilZero(t) {
+			return Result{}, &ErrNotAssignable{Type: t}
+		}
+		return Result{AST: ast.NewIdent("nil")}, nil
+	}
+	if !v.Type().AssignableTo(t) {
+		return Result{}, &ErrNotAssignable{Value: unexported(v).Interface(), Type: t}
+	}
+	if t.Kind() != reflect.Interface && hasNilZero(t) && v.IsNil() {
+		// The type is implied by the destination, e.g. `(*Foo)(nil)` is just `nil`.
+		return Result{AST: ast.NewIdent("nil")}, nil
+	}
+	if opt == nil {
+		opt = defaultOptions()
+	}
+	if t.Kind() == reflect.Interface {
+		// The dynamic type must be preserved, unless the untyped constant defaults to it.
+		if v.Kind() == reflect.Interface {
+			v = v.Elem()
+		}
+		if v.IsValid() {
+			opt = opt.withDynamicType(v)
+		}
+		return ASTContext(context.Background(), v, opt)
+	}
+	if isConstant(v) {
+		// The destination is of the identical type, so the untyped constant converts implicitly.
+		tmp, qualify := *opt, opt.Qualify
+		tmp.Qualify = func(typ reflect.Type) QualifyPolicy {
+			if qualify != nil {
+				if policy := qualify(typ); policy != QualifyAuto {
+					return policy
+				}
+			}
+			if typ == t {
+				return QualifyNever
+			}
+			return QualifyAuto
+		}
+		opt = &tmp
+	}
+	return ASTContext(context.Background(), v, opt)
+}
+
+// hasNilZero reports if the zero value of type t is nil.
+func hasNilZero(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Chan, reflect.Func, reflect.Interface, reflect.Map, reflect.Ptr, reflect.Slice, reflect.UnsafePointer:
+		return true
+	default:
+		return false
+	}
+}
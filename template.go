@@ -0,0 +1,47 @@
+package valast
+
+import (
+	"fmt"
+	"go/parser"
+	"reflect"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// templates caches the parsed templates of Options.Templates by their source.
+var templates sync.Map // map[string]*template.Template
+
+// templateAST converts v using its template from Options.Templates, reporting if it has one.
+func templateAST(v reflect.Value, opt *Options) (Result, bool, error) {
+	src, ok := opt.Templates[v.Type()]
+	if !ok {
+		return Result{}, false, nil
+	}
+	tmpl, err := parseTemplate(src)
+	if err != nil {
+		return Result{}, true, fmt.Errorf("valast: parsing template for %v: %w", v.Type(), err)
+	}
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, v.Interface()); err != nil {
+		return Result{}, true, fmt.Errorf("valast: executing template for %v: %w", v.Type(), err)
+	}
+	expr, err := parser.ParseExpr(buf.String())
+	if err != nil {
+		return Result{}, true, fmt.Errorf("valast: parsing template for %v result %q: %w", v.Type(), buf.String(), err)
+	}
+	return Result{AST: expr}, true, nil
+}
+
+// parseTemplate returns the parsed template of src, see templates.
+func parseTemplate(src string) (*template.Template, error) {
+	if tmpl, ok := templates.Load(src); ok {
+		return tmpl.(*template.Template), nil
+	}
+	tmpl, err := template.New("valast").Option("missingkey=error").Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	templates.Store(src, tmpl)
+	return tmpl, nil
+}
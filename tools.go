@@ -0,0 +1,40 @@
+//go:build !js && !wasip1 && !tinygo
+// +build !js,!wasip1,!tinygo
+
+package valast
+
+import (
+	"fmt"
+
+	"golang.org/x/tools/go/packages"
+	gofumpt "mvdan.cc/gofumpt/format"
+)
+
+// formatSource formats the Go source file src with gofumpt.
+func formatSource(src []byte) ([]byte, error) {
+	return gofumpt.Source(src, gofumpt.Options{ExtraRules: true})
+}
+
+// loadPackageName loads the specified package from disk to determine the package name.
+func loadPackageName(path string) (string, error) {
+	pkgs, err := packages.Load(&packages.Config{Mode: packages.NeedName}, path)
+	if err != nil {
+		return "", err
+	}
+	return pkgs[0].Name, nil
+}
+
+// loadPackageFiles loads the specified package from disk to determine its Go source files.
+func loadPackageFiles(path string) ([]string, error) {
+	pkgs, err := packages.Load(&packages.Config{Mode: packages.NeedName | packages.NeedFiles}, path)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkgs) != 1 {
+		return nil, fmt.Errorf("valast: failed to load package %q", path)
+	}
+	if len(pkgs[0].Errors) > 0 {
+		return nil, pkgs[0].Errors[0]
+	}
+	return pkgs[0].GoFiles, nil
+}
@@ -0,0 +1,64 @@
+//go:build js || wasip1 || tinygo
+// +build js wasip1 tinygo
+
+package valast
+
+import (
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"sort"
+)
+
+// On js/wasm, WASI and TinyGo there is neither a go command to load packages with nor support for
+// gofumpt, so lightweight fallbacks are used instead.
+
+// formatSource formats the Go source file src with go/format, after applying the gofumpt rule
+// which valast output relies on most: a composite literal spanning multiple lines has a newline
+// after its opening brace and before its closing brace.
+func formatSource(src []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return nil, err
+	}
+	type insert struct {
+		offset int
+		text   string
+	}
+	var inserts []insert
+	line := func(pos token.Pos) int { return fset.Position(pos).Line }
+	ast.Inspect(f, func(n ast.Node) bool {
+		lit, ok := n.(*ast.CompositeLit)
+		if !ok || len(lit.Elts) == 0 || line(lit.Lbrace) == line(lit.Rbrace) {
+			return true
+		}
+		if line(lit.Elts[0].Pos()) == line(lit.Lbrace) {
+			inserts = append(inserts, insert{fset.Position(lit.Lbrace).Offset + 1, "\n"})
+		}
+		if line(lit.Elts[len(lit.Elts)-1].End()) == line(lit.Rbrace) {
+			inserts = append(inserts, insert{fset.Position(lit.Elts[len(lit.Elts)-1].End()).Offset, ",\n"})
+		}
+		return true
+	})
+	if len(inserts) > 0 {
+		sort.SliceStable(inserts, func(i, j int) bool { return inserts[i].offset > inserts[j].offset })
+		out := append([]byte(nil), src...)
+		for _, ins := range inserts {
+			out = append(out[:ins.offset], append([]byte(ins.text), out[ins.offset:]...)...)
+		}
+		src = out
+	}
+	return format.Source(src)
+}
+
+// loadPackageName guesses the package name from its path, see guessPackageName.
+func loadPackageName(path string) (string, error) {
+	return guessPackageName(path), nil
+}
+
+// loadPackageFiles reports no files, as packages cannot be loaded from disk.
+func loadPackageFiles(path string) ([]string, error) {
+	return nil, nil
+}
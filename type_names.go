@@ -0,0 +1,72 @@
+package valast
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"reflect"
+	"strings"
+)
+
+// splitTypeName splits the name of a type given by Options.TypeNames into its qualifier, i.e. a
+// package name or import path, and the name of the type, e.g. "example.com/foo" and "ID" for
+// "example.com/foo.ID". The qualifier is empty if the name is unqualified.
+func splitTypeName(name string) (qualifier, typeName string) {
+	base := name
+	if i := strings.IndexByte(name, '['); i >= 0 {
+		base = name[:i] // e.g. "foo.Set[bar.ID]"
+	}
+	i := strings.LastIndexByte(base, '.')
+	if i < 0 {
+		return "", name
+	}
+	return name[:i], name[i+1:]
+}
+
+// typePackage returns the import path of the package declaring the type t, or of the package
+// given by its name in Options.TypeNames if it is overridden. It returns "" if the type's name is
+// overridden by a name without an import path.
+func (o *Options) typePackage(t reflect.Type) string {
+	name, ok := o.TypeNames[t]
+	if !ok {
+		return t.PkgPath()
+	}
+	if qualifier, _ := splitTypeName(name); strings.Contains(qualifier, "/") {
+		return qualifier
+	}
+	return ""
+}
+
+// typeNameExpr returns the type expression for the type t whose name is overridden by
+// Options.TypeNames. The type is qualified by its package name, which is resolved if the name is
+// qualified by an import path, unless that is Options.PackagePath or Options.PackageName.
+func (o *Options) typeNameExpr(t reflect.Type, name string) (Result, error) {
+	qualifier, typeName := splitTypeName(name)
+	ident := typeName
+	if i := strings.IndexByte(typeName, '['); i >= 0 {
+		ident = typeName[:i]
+	}
+	if !token.IsIdentifier(ident) || (qualifier != "" && !strings.Contains(qualifier, "/") && !token.IsIdentifier(qualifier)) {
+		return Result{}, fmt.Errorf("valast: invalid name %q for type %v", name, t)
+	}
+	if qualifier == "" {
+		return Result{AST: ast.NewIdent(typeName)}, nil
+	}
+	pkgName := qualifier
+	if strings.Contains(qualifier, "/") {
+		if qualifier == o.PackagePath {
+			return Result{AST: ast.NewIdent(typeName)}, nil
+		}
+		var err error
+		if pkgName, err = o.packagePathToName(qualifier); err != nil {
+			return Result{}, err
+		}
+	}
+	if pkgName == o.PackageName {
+		return Result{AST: ast.NewIdent(typeName)}, nil
+	}
+	return Result{
+		AST:                &ast.SelectorExpr{X: ast.NewIdent(pkgName), Sel: ast.NewIdent(typeName)},
+		RequiresUnexported: !ast.IsExported(typeName),
+	}, nil
+}
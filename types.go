@@ -28,6 +28,8 @@ func newCacheKey(v reflect.Type, opt *Options) cacheKey {
 	}}
 }
 
+// typeExprCache memoizes type expressions by type and the options affecting them. It is shared by
+// all computeAST calls during a conversion, and across conversions by a Converter.
 type typeExprCache map[cacheKey]Result
 
 // typeExpr returns an AST type expression for the value v.
@@ -49,6 +51,9 @@ func typeExpr(v reflect.Type, opt *Options, cache typeExprCache) (Result, error)
 }
 
 func uncachedTypeExpr(v reflect.Type, opt *Options, cache typeExprCache) (Result, error) {
+	if name, ok := opt.TypeNames[v]; ok {
+		return opt.typeNameExpr(v, name)
+	}
 	if v.Kind() != reflect.UnsafePointer && v.Name() != "" {
 		pkgPath := v.PkgPath()
 		if pkgPath != "" && pkgPath != opt.PackagePath {
@@ -81,6 +86,27 @@ func uncachedTypeExpr(v reflect.Type, opt *Options, cache typeExprCache) (Result
 			},
 			RequiresUnexported: elemType.RequiresUnexported,
 		}, nil
+	case reflect.Chan:
+		elemType, err := typeExpr(v.Elem(), opt, cache)
+		if err != nil {
+			return Result{}, err
+		}
+		dir := ast.SEND | ast.RECV
+		switch v.ChanDir() {
+		case reflect.SendDir:
+			dir = ast.SEND
+		case reflect.RecvDir:
+			dir = ast.RECV
+		}
+		elem := elemType.AST
+		if c, ok := elem.(*ast.ChanType); ok && dir == ast.SEND|ast.RECV && c.Dir == ast.RECV {
+			// `chan <-chan T` would be parsed as `chan<- chan T`.
+			elem = &ast.ParenExpr{X: elem}
+		}
+		return Result{
+			AST:                &ast.ChanType{Dir: dir, Value: elem},
+			RequiresUnexported: elemType.RequiresUnexported,
+		}, nil
 	case reflect.Interface:
 		var methods []*ast.Field
 		var requiresUnexported bool
@@ -93,6 +119,10 @@ func uncachedTypeExpr(v reflect.Type, opt *Options, cache typeExprCache) (Result
 			if methodType.RequiresUnexported {
 				requiresUnexported = true
 			}
+			if method.PkgPath != "" && method.PkgPath != opt.PackagePath {
+				// Unexported methods cannot be declared outside of their package.
+				requiresUnexported = true
+			}
 			methods = append(methods, &ast.Field{
 				Names: []*ast.Ident{ast.NewIdent(method.Name)},
 				Type:  methodType.AST,
@@ -110,6 +140,10 @@ func uncachedTypeExpr(v reflect.Type, opt *Options, cache typeExprCache) (Result
 		)
 		for i := 0; i < v.NumIn(); i++ {
 			param := v.In(i)
+			variadic := v.IsVariadic() && i == v.NumIn()-1
+			if variadic {
+				param = param.Elem() // ...T is reported as []T
+			}
 			paramType, err := typeExpr(param, opt, cache)
 			if err != nil {
 				return Result{}, err
@@ -117,6 +151,9 @@ func uncachedTypeExpr(v reflect.Type, opt *Options, cache typeExprCache) (Result
 			if paramType.RequiresUnexported {
 				requiresUnexported = true
 			}
+			if variadic {
+				paramType.AST = &ast.Ellipsis{Elt: paramType.AST}
+			}
 			params = append(params, &ast.Field{
 				Type: paramType.AST,
 			})
@@ -196,6 +233,13 @@ func uncachedTypeExpr(v reflect.Type, opt *Options, cache typeExprCache) (Result
 			if fieldType.OmittedUnexported {
 				omittedUnexported = true
 			}
+			if field.PkgPath != "" && field.PkgPath != opt.PackagePath {
+				// Unexported fields cannot be declared outside of their package.
+				requiresUnexported = true
+				if opt.ExportedOnly {
+					return Result{RequiresUnexported: true}, nil
+				}
+			}
 			fields = append(fields, &ast.Field{
 				Names: []*ast.Ident{ast.NewIdent(field.Name)},
 				Type:  fieldType.AST,
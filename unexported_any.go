@@ -0,0 +1,52 @@
+package valast
+
+import (
+	"go/ast"
+	"reflect"
+)
+
+// nilable reports if values of the kind k may be written as nil.
+func nilable(k reflect.Kind) bool {
+	switch k {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan, reflect.Interface:
+		return true
+	}
+	return false
+}
+
+// unexportedAnyAST computes the AST for the value v whose type cannot be written because it is
+// (or contains) an unexported type of another package, see Options.UnexportedAsAny. It reports
+// false if v is not such a value, or cannot be written as nil.
+//
+// The value is written as a call to an exported constructor of its package where possible (see
+// exportedConstructorAST), e.g. `foo.NewBar("name")`, and otherwise as an annotated nil, e.g.
+// `nil /* unexported *foo.bar */`, which is recorded in Result.Omissions.
+func unexportedAnyAST(v reflect.Value, opt *Options, path string, s *state) (Result, bool, error) {
+	if !nilable(v.Kind()) {
+		return Result{}, false, nil
+	}
+	t, err := typeExpr(v.Type(), opt, s.typeExprCache)
+	if err != nil || !t.RequiresUnexported {
+		return Result{}, false, err
+	}
+	mark := len(s.omissions)
+	constructed, ok, err := exportedConstructorAST(v, opt, path, s)
+	if err != nil {
+		return Result{}, false, err
+	}
+	if ok && !constructed.RequiresUnexported {
+		return constructed, true, nil
+	}
+	s.omissions = s.omissions[:mark]
+	return unexportedNil(v, path, s, mark), true, nil
+}
+
+// unexportedNil returns an annotated nil in place of the value v, which requires unexported
+// access, and records its omission. mark is the number of omissions recorded before converting v.
+func unexportedNil(v reflect.Value, path string, s *state, mark int) Result {
+	s.omit(mark, path, v, OmissionUnexported)
+	return Result{
+		AST:               ast.NewIdent("nil /* unexported " + v.Type().String() + " */"),
+		OmittedUnexported: true,
+	}
+}
@@ -1,10 +1,14 @@
 package valast
 
-import "reflect"
+import (
+	"math"
+	"reflect"
+	"sort"
+)
 
 // isAddressableKind reports if v would be encoded as a Go literal which is addressable or not.
 // For example, &struct{}{}, &map[string]string{}, &[]string{} are all addressable - but &"string",
-// &5, &1.345, &myBool(true) are not.
+// &5, &1.345, &myBool(true), &strings.ToUpper are not.
 func isAddressableKind(v reflect.Kind) bool {
 	return v != reflect.Bool &&
 		v != reflect.Int &&
@@ -24,74 +28,207 @@ func isAddressableKind(v reflect.Kind) bool {
 		v != reflect.Complex128 &&
 		v != reflect.Ptr &&
 		v != reflect.String &&
-		v != reflect.UnsafePointer
+		v != reflect.UnsafePointer &&
+		v != reflect.Func &&
+		v != reflect.Chan
 }
 
-// valueLess tells if i is less than j, according to normal Go less-than < operator rules. Values
-// that are unsortable according to Go rules will always yield true.
+// isSparseArray reports if less than half of the elements of the array v are non-zero.
+func isSparseArray(v reflect.Value) bool {
+	nonZero := 0
+	for i := 0; i < v.Len(); i++ {
+		if !unexported(v.Index(i)).IsZero() {
+			nonZero++
+		}
+	}
+	return nonZero*2 < v.Len()
+}
+
+// valueLess tells if i is less than j. Values which are ordered according to Go less-than <
+// operator rules are compared as such, all other values are given a total deterministic order
+// (see valueCompare).
 //
-// The two values must be of the same kind or a panic will occur.
+// The two values must be of the same type or a panic will occur.
 func valueLess(i, j reflect.Value) bool {
-	ii := unexported(i)
+	return valueCompare(i, j) < 0
+}
+
+// valueCompare compares i and j, returning -1 if i < j, 0 if i == j, and +1 if i > j.
+//
+// Ordered values (integers, floats, strings, etc.) follow Go less-than < operator rules, with NaN
+// ordered before all other floats. Otherwise, the ordering is:
+//
+//	bool:             false before true
+//	complex:          by real part, then imaginary part
+//	array, struct:    lexicographically by element / field
+//	interface:        nil first, then by dynamic type name, then by dynamic value
+//	pointer, chan:    by address (stable within a single run only)
+//
+// Values which are not comparable in Go (slices, maps, funcs) compare as equal.
+//
+// The two values must be of the same type or a panic will occur.
+func valueCompare(i, j reflect.Value) int {
+	ii, jj := unexported(i), unexported(j)
 	switch ii.Kind() {
 	case reflect.Bool:
-		x := 0
-		if ii.Bool() {
-			x = 1
-		}
-		y := 0
-		if unexported(j).Bool() {
-			y = 1
+		return compareBool(ii.Bool(), jj.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return compareOrdered(ii.Int(), jj.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return compareOrdered(ii.Uint(), jj.Uint())
+	case reflect.Float32, reflect.Float64:
+		return compareFloat(ii.Float(), jj.Float())
+	case reflect.Complex64, reflect.Complex128:
+		x, y := ii.Complex(), jj.Complex()
+		if c := compareFloat(real(x), real(y)); c != 0 {
+			return c
 		}
-		return x < y
-	case reflect.Int:
-		return ii.Int() < unexported(j).Int()
-	case reflect.Int8:
-		return ii.Int() < unexported(j).Int()
-	case reflect.Int16:
-		return ii.Int() < unexported(j).Int()
-	case reflect.Int32:
-		return ii.Int() < unexported(j).Int()
-	case reflect.Int64:
-		return ii.Int() < unexported(j).Int()
-	case reflect.Uint:
-		return ii.Uint() < unexported(j).Uint()
-	case reflect.Uint8:
-		return ii.Uint() < unexported(j).Uint()
-	case reflect.Uint16:
-		return ii.Uint() < unexported(j).Uint()
-	case reflect.Uint32:
-		return ii.Uint() < unexported(j).Uint()
-	case reflect.Uint64:
-		return ii.Uint() < unexported(j).Uint()
-	case reflect.Uintptr:
-		return ii.Uint() < unexported(j).Uint()
-	case reflect.Float32:
-		return ii.Float() < unexported(j).Float()
-	case reflect.Float64:
-		return ii.Float() < unexported(j).Float()
-	case reflect.Ptr:
-		return ii.Pointer() < unexported(j).Pointer()
+		return compareFloat(imag(x), imag(y))
 	case reflect.String:
-		return ii.String() < unexported(j).String()
-	case reflect.UnsafePointer:
-		return ii.Pointer() < unexported(j).Pointer()
-	case reflect.Complex64:
-		return true
-	case reflect.Complex128:
-		return true
+		return compareOrdered(ii.String(), jj.String())
+	case reflect.Ptr, reflect.UnsafePointer, reflect.Chan:
+		return compareOrdered(ii.Pointer(), jj.Pointer())
 	case reflect.Array:
-		return true
-	case reflect.Map:
-		return true
-	case reflect.Interface:
-		return true
-	case reflect.Slice:
-		return true
+		for k := 0; k < ii.Len(); k++ {
+			if c := valueCompare(ii.Index(k), jj.Index(k)); c != 0 {
+				return c
+			}
+		}
+		return 0
 	case reflect.Struct:
-		return true
+		for k := 0; k < ii.NumField(); k++ {
+			if c := valueCompare(ii.Field(k), jj.Field(k)); c != 0 {
+				return c
+			}
+		}
+		return 0
+	case reflect.Interface:
+		if ii.IsNil() || jj.IsNil() {
+			return compareBool(!ii.IsNil(), !jj.IsNil())
+		}
+		it, jt := ii.Elem().Type(), jj.Elem().Type()
+		if it != jt {
+			if c := compareOrdered(it.String(), jt.String()); c != 0 {
+				return c
+			}
+			return compareOrdered(it.PkgPath(), jt.PkgPath())
+		}
+		return valueCompare(ii.Elem(), jj.Elem())
+	default:
+		return 0
+	}
+}
+
+func compareOrdered[T int64 | uint64 | uintptr | string](x, y T) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
 	default:
-		// never here
+		return 0
+	}
+}
+
+func compareBool(x, y bool) int {
+	switch {
+	case x == y:
+		return 0
+	case !x:
+		return -1
+	default:
+		return 1
+	}
+}
+
+func compareFloat(x, y float64) int {
+	xNaN, yNaN := math.IsNaN(x), math.IsNaN(y)
+	if xNaN || yNaN {
+		return compareBool(!xNaN, !yNaN)
+	}
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// isOrderedKind reports if values of kind k have a natural order which is stable across runs, per
+// the Go less-than < operator.
+func isOrderedKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64,
+		reflect.String:
 		return true
+	default:
+		return false
+	}
+}
+
+// sortKeysDeterministic sorts the map keys, and the map values at the same indices, such that
+// their order is identical across runs. Keys of ordered kinds are sorted using valueCompare, all
+// others (interfaces, structs, pointers, etc.) are sorted by their Go syntax as produced by the
+// render function.
+//
+// Keys which are equal in that order, e.g. NaN keys or pointers to equal values, are ordered by
+// the Go syntax of their values, and then by valueCompare.
+func sortKeysDeterministic(keys, values []reflect.Value, render func(v reflect.Value) (string, error)) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	ordered := isOrderedKind(unexported(keys[0]).Kind())
+	entries := make([]sortEntry, len(keys))
+	for i, key := range keys {
+		entries[i] = sortEntry{key: key, value: values[i]}
+		if ordered {
+			continue
+		}
+		s, err := render(key)
+		if err != nil {
+			return err
+		}
+		entries[i].keySyntax = s
+	}
+	var err error
+	valueSyntax := func(e *sortEntry) string {
+		if !e.rendered && err == nil {
+			e.valueSyntax, err = render(e.value)
+			e.rendered = true
+		}
+		return e.valueSyntax
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := &entries[i], &entries[j]
+		if ordered {
+			if c := valueCompare(a.key, b.key); c != 0 {
+				return c < 0
+			}
+		} else if a.keySyntax != b.keySyntax {
+			return a.keySyntax < b.keySyntax
+		}
+		if va, vb := valueSyntax(a), valueSyntax(b); va != vb {
+			return va < vb
+		}
+		return valueCompare(a.key, b.key) < 0
+	})
+	if err != nil {
+		return err
 	}
+	for i, e := range entries {
+		keys[i], values[i] = e.key, e.value
+	}
+	return nil
+}
+
+// sortEntry is a map entry being sorted by sortKeysDeterministic.
+type sortEntry struct {
+	key, value             reflect.Value
+	keySyntax, valueSyntax string
+	rendered               bool
 }
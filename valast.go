@@ -2,36 +2,46 @@ package valast
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"go/ast"
 	"go/format"
+	"go/scanner"
 	"go/token"
 	"io"
 	"math"
 	"os"
+	"path"
 	"reflect"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/hexops/valast/internal/bypass"
-	"golang.org/x/tools/go/packages"
-	gofumpt "mvdan.cc/gofumpt/format"
 )
 
 // Options describes options for the conversion process.
 type Options struct {
 	// Unqualify, if true, indicates that types should be unqualified. e.g.:
 	//
-	// 	int(8)           -> 8
+	// 	int8(8)          -> 8
 	// 	Bar{}            -> Bar{}
-	// 	string("foobar") -> "foobar"
+	// 	float32(1.5)     -> 1.5
 	//
 	// This is set to true automatically when operating within a context where type qualification
-	// is definitively not needed, e.g. when producing values for a struct or map.
+	// is definitively not needed, e.g. when producing values for a struct or map. It does not
+	// apply to values held by interfaces, whose dynamic type would otherwise change, e.g. int32(1)
+	// within an []interface{}.
 	Unqualify bool
 
+	// Qualify, if non-nil, is called to determine the QualifyPolicy for basic literals
+	// (booleans, numbers and strings) of the given type, e.g. to force int32(7) conversions
+	// everywhere, or strip them everywhere. The default is QualifyAuto.
+	Qualify func(t reflect.Type) QualifyPolicy
+
 	// PackagePath, if non-zero, describes that the literal is being produced within the described
 	// package path, and thus type selectors `pkg.Foo` should just be written `Foo` if the package
 	// path and name match.
@@ -45,41 +55,569 @@ type Options struct {
 	// ExportedOnly indicates if only exported fields and values should be included.
 	ExportedOnly bool
 
+	// NoUnsafe, if true, indicates that values obtained via unexported struct fields, which can
+	// only be read using package unsafe, should not be accessed. Unexported fields are then
+	// omitted, as by ExportedOnly, and only exported data is written. Building with the "safe" or
+	// "purego" build tags has the same effect for all conversions, and additionally ensures
+	// package unsafe is not imported by valast, e.g. for environments which forbid it.
+	NoUnsafe bool
+
 	// PackagePathToName, if non-nil, is called to convert a Go package path to the package name
-	// written in its source. The default is DefaultPackagePathToName
+	// written in its source. It takes precedence over PackageResolver.
 	PackagePathToName func(path string) (string, error)
+
+	// PackageResolver, if non-nil, converts Go package paths to the package names written in
+	// their source, e.g. a StaticResolver for servers which must not run the go command to load
+	// packages while handling requests. The default is a CachingResolver of a PackagesResolver,
+	// shared by all conversions, which caches up to 1024 names for an hour.
+	PackageResolver PackageResolver
+
+	// TypeNames, if non-nil, overrides the names written for types, e.g. to write the alias
+	// mypkg.ID preferred by the target codebase rather than uuid.UUID:
+	//
+	// 	TypeNames: map[reflect.Type]string{
+	// 		reflect.TypeOf(uuid.UUID{}): "example.com/mypkg.ID",
+	// 	}
+	//
+	// Names may be qualified by an import path, as above, in which case the package name is
+	// resolved (see PackageResolver) and the package is reported in Result.Packages, such that
+	// WriteGoFile imports it. Names qualified by a package name, e.g. "mypkg.ID", are written
+	// as-is, and the caller must import the package. The named type must have the same
+	// underlying type, such that the values written remain valid.
+	TypeNames map[reflect.Type]string
+
+	// LocalPrefix, if non-empty, is a comma-separated list of import path prefixes of local
+	// packages, which are imported in a separate group after other packages, as by the -local flag
+	// of goimports, e.g. "github.com/foo/bar". See Result.Imports and WriteGoFile.
+	LocalPrefix string
+
+	// HelperPackage, if non-zero, describes an alternative package providing the Ptr and
+	// AddrInterface helpers referenced by the output, e.g. when they are vendored under an
+	// internal path. The default is the valast package itself.
+	HelperPackage HelperPackage
+
+	// InterfacePointerStatements, if true, indicates that pointers to interfaces are written as
+	// statements declaring a variable of the interface type, within a function literal which is
+	// immediately called, instead of using the AddrInterface helper, e.g.:
+	//
+	// 	func() *io.Reader {
+	// 		var v io.Reader = &bytes.Buffer{}
+	// 		return &v
+	// 	}()
+	//
+	InterfacePointerStatements bool
+
+	// HelperFuncPrefix, if non-empty, indicates that function literals which are immediately
+	// called (e.g. due to InterfacePointerStatements, RepeatedElements or CyclePolicyVariables)
+	// are instead declared as functions in Result.Decls, named by the prefix followed by a
+	// number, and called by name, e.g. `newNode1()` with the prefix "newNode". This allows callers
+	// to place the helpers at file scope, keeping the expression itself short. Identical helpers
+	// are declared once.
+	//
+	// It is ignored by functions producing Go syntax as a string, such as StringWithOptions and
+	// WriteGoFile, as their output is a single expression.
+	HelperFuncPrefix string
+
+	// Deterministic, if true, guarantees byte-identical output for equal values across runs:
+	//
+	// 	- Map keys of all kinds are sorted, including interface, struct, array, and pointer keys
+	// 	  which otherwise have no stable order. Such keys are ordered by their Go syntax, and keys
+	// 	  which are otherwise equal (e.g. NaN keys, or pointers to equal values) by the Go syntax
+	// 	  of their values.
+	// 	- Floats are formatted stably: negative zero is written as 0, as they are equal, and all
+	// 	  NaN values are written as math.NaN().
+	// 	- Pointer addresses (e.g. unsafe.Pointer values) are emitted as zero.
+	//
+	// This is recommended when the output is used for golden tests.
+	Deterministic bool
+
+	// SortMapKeys, if non-nil, is called to sort the keys of each map value in-place, determining
+	// the order in which map entries are emitted. This allows ordering entries semantically, e.g.
+	// by a priority field, rather than by the default ordering.
+	SortMapKeys func(keys []reflect.Value)
+
+	// LineWidth, if non-zero, is the approximate line width (in characters) beyond which composite
+	// literals (structs, slices, maps, etc.) are split onto multiple lines by StringWithOptions.
+	// The default is 50.
+	LineWidth int
+
+	// SingleLine, if true, indicates that StringWithOptions should write the Go syntax on a single
+	// line, as Formatter does for the %v verb, instead of formatting it with gofumpt. The syntax is
+	// then written directly while traversing the value rather than by constructing and printing an
+	// AST, which roughly halves the time and garbage of the conversion. Values and options which
+	// require an AST, e.g. SourceMap or Renderer implementations, are still converted via AST.
+	SingleLine bool
+
+	// Indent and Prefix, if non-zero, control indentation of the output produced by
+	// StringWithOptions similar to json.MarshalIndent: each line after the first begins with
+	// Prefix followed by one copy of Indent per indentation level. The default indent is a tab.
+	//
+	// The contents of multi-line raw string literals are never modified.
+	Indent, Prefix string
+
+	// StringStyle controls whether strings are written as quoted "string" or raw `string`
+	// literals, or as conversions of their bytes. The default is StringStyleAuto.
+	StringStyle StringStyle
+
+	// RawStringThreshold, if non-zero, is the length beyond which multi-line strings are written
+	// as raw `string` literals when using StringStyleAuto. The default is 40.
+	RawStringThreshold int
+
+	// ChunkStrings, if true, indicates that quoted strings longer than LineWidth should be split
+	// into a concatenation of chunks ("abc" + "def") at most LineWidth bytes long, each of which is
+	// written on its own line by StringWithOptions. This greatly improves the readability of diffs
+	// for e.g. long base64 strings.
+	ChunkStrings bool
+
+	// ASCIIOnly, if true, indicates that non-ASCII characters in string and character literals
+	// should be written as escape sequences, e.g. "caf\u00e9" instead of "café", for tooling which
+	// does not handle them well. Strings containing them are then never written as raw literals.
+	ASCIIOnly bool
+
+	// Runes, if true, indicates that int32 (rune) values should be written as character literals,
+	// e.g. 'A' instead of int32(65), and []int32 ([]rune) values as string conversions, e.g.
+	// []rune("hello"), where their contents are printable.
+	Runes bool
+
+	// IntBase, if non-nil, is called to determine the base (2, 8, 10, or 16) in which integer
+	// values of the given type are written, e.g. so that file modes are written as 0o755 and
+	// masks or hashes as 0xdeadbeef. Returning zero indicates the default base 10.
+	IntBase func(t reflect.Type) int
+
+	// FloatFormat controls how floating-point values are written. The default is
+	// FloatFormatShortest.
+	FloatFormat FloatFormat
+
+	// Durations, if true, indicates that time.Duration values should be written as expressions of
+	// time package constants, e.g. 2*time.Hour + 30*time.Minute, instead of a nanosecond count.
+	// Values of named types declared as time.Duration are converted to their type, e.g.
+	// Timeout(2*time.Hour + 30*time.Minute); such types are found by reading the source of their
+	// package.
+	Durations bool
+
+	// DriverValues, if true, indicates that values of types implementing database/sql/driver.Valuer
+	// (including sql.NullString and friends) should be written as the value they are stored as in a
+	// database, e.g. a custom Money type as int64(1250) and an invalid sql.NullString as nil. This
+	// is useful for describing the rows written by a program, but the output is generally not
+	// assignable to the original type.
+	DriverValues bool
+
+	// ElideBytes, if non-nil, is called with the contents of each byte slice at least
+	// ElideBytesThreshold bytes long. If it returns true, the returned Result (its AST and
+	// Packages) replaces the byte slice literal in the output. This can be used to prevent large
+	// binary blobs, such as images, from bloating the output. See ElideRepeatedBytes and
+	// ElideBytesWithHash for some predefined policies.
+	ElideBytes func(b []byte) (Result, bool)
+
+	// ElideBytesThreshold is the minimum length of byte slices passed to ElideBytes. The default
+	// is 1024.
+	ElideBytesThreshold int
+
+	// ExtractFiles, if non-nil, describes that large string and []byte values should be written
+	// to separate files and read at runtime instead of being written as a literal.
+	ExtractFiles *ExtractFiles
+
+	// FuncPolicy controls how function values which cannot be referenced by name, such as
+	// closures, are written. Top-level functions are always referenced by name, e.g.
+	// strings.ToUpper. The default is FuncPolicyError.
+	FuncPolicy FuncPolicy
+
+	// OnCycle controls how values which (directly or indirectly) contain themselves, such as a
+	// node pointing to its parent, are written where they recur. The default is CyclePolicyNil.
+	OnCycle CyclePolicy
+
+	// OnInvalidMapKey controls how map keys which cannot be written faithfully are handled, i.e.
+	// keys which are or contain NaN (which cannot be looked up, as NaN is not equal to itself) or
+	// channels (which cannot be written). The default is MapKeyPolicyWrite.
+	OnInvalidMapKey MapKeyPolicy
+
+	// SparseArrays, if true, indicates that arrays where less than half of the elements are
+	// non-zero should be written using indexed elements, omitting zero values, e.g.
+	// [256]byte{10: 1, 200: 5}.
+	SparseArrays bool
+
+	// PruneEmpty, if true, indicates that pointers, slices and maps which would be written as
+	// empty composite literals, once zero struct fields are omitted, should be written as nil
+	// instead, and thus omitted from struct literals. This collapses chains of empty values, e.g.
+	// `&Foo{Bar: &Bar{Items: []string{}}}` is written as nil, producing minimal output at the cost
+	// of the distinction between nil and empty values. Pointers to other values, and values held
+	// by interfaces, are written as usual.
+	PruneEmpty bool
+
+	// IncludeZeroFields, if true, indicates that struct fields with zero values should be written
+	// rather than omitted, e.g. `Foo{Name: "", Count: 0, Bar: nil}`, such that the output lists
+	// every field of the struct. Fields which would otherwise be omitted for other reasons, e.g.
+	// unexported fields with ExportedOnly, are still omitted.
+	IncludeZeroFields bool
+
+	// RepeatedElements, if greater than zero, indicates that arrays and slices of at least this
+	// many elements which are all identical should be written as a function literal assigning the
+	// element in a loop rather than as a composite literal, e.g.:
+	//
+	// 	func() [4096]byte {
+	// 		var a [4096]byte
+	// 		for i := range a {
+	// 			a[i] = 255
+	// 		}
+	// 		return a
+	// 	}()
+	//
+	// If the elements are zero values, they are written as e.g. [4096]byte{} or make([]byte, 4096).
+	RepeatedElements int
+
+	// MultilineMaps, if true, indicates that map literals should always be written with one entry
+	// per line (and a trailing comma) by StringWithOptions, even for small maps. Values of
+	// consecutive entries are aligned by the formatter.
+	MultilineMaps bool
+
+	// GroupMapEntries, if non-nil, is called with the key of each map entry to determine its
+	// group. StringWithOptions separates consecutive entries of different groups with a blank
+	// line, which makes large lookup tables easier to review. Implies MultilineMaps.
+	GroupMapEntries func(key reflect.Value) string
+
+	// IncludeFields and ExcludeFields select the struct fields written, without writing a callback
+	// such as Redact, by matching patterns of the form `pkg.Type.Field` (see path.Match) against
+	// the fields of named struct types, e.g. `gorm.Model.*` or `*.CreatedAt`. If any pattern of
+	// IncludeFields matches the type of a struct (e.g. `http.Request.Method` matches the type
+	// http.Request), only the fields of the struct matched by such patterns are written. Fields
+	// matched by ExcludeFields are never written. Omitted fields are replaced with their zero
+	// value, and described by DescribeOmitted.
+	IncludeFields, ExcludeFields []string
+
+	// Redact, if non-nil, is called with each non-zero struct field and its path (see
+	// Result.SourceMap) to determine if its value should be redacted, e.g. because it contains a
+	// secret. Fields tagged `valast:"redact"` are always redacted.
+	//
+	// Redacted string fields are replaced with RedactPlaceholder, all other redacted fields are
+	// omitted (i.e. replaced with their zero value.)
+	Redact func(path string, field reflect.StructField) bool
+
+	// RedactPlaceholder is the value of redacted string fields. The default is "<redacted>".
+	RedactPlaceholder string
+
+	// MaxOutputBytes, if greater than zero, is the approximate maximum size in bytes of the Go
+	// syntax produced. Once exceeded, conversion stops and an *ErrOutputTooLarge error is returned,
+	// e.g. to protect services converting user-controlled values from excessive memory usage.
+	MaxOutputBytes int
+
+	// MaxDepth, if greater than zero, is the maximum nesting depth of composite values (structs,
+	// arrays, slices and maps) written. Values nested deeper are written as literals containing
+	// only a comment, e.g. `Foo{ /* ... */ }`. Pointers and interfaces do not count towards the
+	// depth. The output is then not equivalent to the input, so this is intended for debugging.
+	MaxDepth int
+
+	// MaxElements, if greater than zero, is the maximum number of elements of each array, slice
+	// and map written. Further elements are replaced by a comment, e.g. `/* 42 more */`. Like
+	// MaxDepth, this is intended for debugging.
+	MaxElements int
+
+	// MaxStringLen, if greater than zero, is the maximum number of bytes of each string written.
+	// Longer strings are truncated, and marked as such, e.g. `"abcdef…" /* +4096 bytes */`. Like
+	// MaxDepth, this is intended for debugging, as the output is then not equivalent to the input.
+	MaxStringLen int
+
+	// MaxNesting is the maximum number of values nested within each other (e.g. the nodes of a
+	// linked list, each of which counts twice: once for the pointer and once for the struct) which
+	// are converted, beyond which an *ErrTooDeep error is returned rather than exhausting the stack.
+	// The default is 10000, and a negative value removes the limit.
+	MaxNesting int
+
+	// Parallelism, if greater than one, is the maximum number of goroutines used to convert the
+	// elements of large slices and maps concurrently. The output is identical regardless. Note
+	// that Renderer implementations, registered handlers and option callbacks may then be called
+	// concurrently. It has no effect when ExtractFiles is set.
+	Parallelism int
+
+	// Partial, if true, indicates that values within the input which cannot be converted (e.g. a
+	// channel struct field) should be replaced with a placeholder (nil, or *new(T) for types which
+	// cannot be nil) followed by a comment describing the error, rather than failing the entire
+	// conversion. The errors are returned as an *ErrPartial along with the Result.
+	Partial bool
+
+	// Setters, if true, indicates that values of struct types declared in other packages whose
+	// unexported fields are set should be constructed via constructor functions (e.g. NewFoo) or
+	// setter methods (e.g. SetName) of the defining package where possible, such that the
+	// unexported state is reproduced by valid code. Constructors are detected by loading the
+	// defining package with go/packages, and must have parameters named after the unexported
+	// fields they set. Setter methods are detected by their source rather than their name: they
+	// must have a pointer receiver, and a body which only assigns their single parameter to the
+	// unexported field.
+	Setters bool
+
+	// Pseudonymize, if non-nil, describes string values which should be replaced with
+	// deterministic pseudonyms. The replacements made are reported in Result.Pseudonyms.
+	Pseudonymize *Pseudonymizer
+
+	// SourceMap, if true, indicates that Result.SourceMap should be produced.
+	SourceMap bool
+
+	// DescribeOmitted, if true, indicates that composite literals from which fields or entries were
+	// omitted should describe the omission with a trailing comment, e.g.:
+	//
+	// 	Foo{Name: "foo" /* 2 zero fields, 1 unexported field omitted */}
+	//
+	// This includes zero-valued, redacted and unexported (see ExportedOnly) struct fields, map
+	// entries omitted due to ExportedOnly, and values elided due to MaxDepth. It allows readers of
+	// e.g. generated fixtures to know that data was dropped.
+	DescribeOmitted bool
+
+	// Colorize, if true, indicates that the Go syntax produced by StringWithOptions, Formatter and
+	// the Converter String and Fprint methods should be highlighted with ANSI escape sequences,
+	// e.g. for printing to a terminal when debugging. It is ignored by functions producing code,
+	// such as WriteGoFile.
+	Colorize bool
+
+	// CommentField, if non-nil, is called with each non-zero struct field written, its path (see
+	// Result.SourceMap) and value. If it returns a non-empty string, the struct literal is written
+	// with one field per line and the string is attached to the field as a line comment, e.g.:
+	//
+	// 	CreatedAt: 1712345678, // 2024-04-05T12:34:38Z
+	//
+	// Comments are only written by functions producing Go syntax as a string, such as
+	// StringWithOptions, as the AST does not have the positions needed to represent them.
+	CommentField func(path string, field reflect.StructField, v reflect.Value) string
+
+	// Presets are sets of handlers which convert values of particular types, see Options.Use.
+	// Handlers of later presets take precedence over those of earlier ones, and all of them over
+	// handlers registered via Register.
+	Presets []*Preset
+
+	// Templates maps types to text/template templates which produce the Go expression syntax of
+	// their values, executed with the value as dot, e.g.:
+	//
+	// 	Templates: map[reflect.Type]string{
+	// 		reflect.TypeOf(uuid.UUID{}): `uuid.MustParse("{{.String}}")`,
+	// 	}
+	//
+	// This is a lighter-weight alternative to handlers (see Options.Presets) for types written as
+	// simple constructor calls. Templates take precedence over handlers, but not over Renderer and
+	// StringRenderer implementations. Only the package of the type itself is reported in
+	// Result.Packages, so expressions referring to other packages require a handler instead.
+	Templates map[reflect.Type]string
+
+	// AnonymousTypeAliases, if true, indicates that anonymous struct types written more than once
+	// in a file written by WriteGoFile should be declared once as type aliases, which are written
+	// in their place, e.g.:
+	//
+	// 	type anon1 = struct {
+	// 		Name string
+	// 		Tags []string
+	// 	}
+	//
+	// 	var Items = []struct {
+	// 		Key   string
+	// 		Value anon1
+	// 	}{{Key: "a", Value: anon1{Name: "foo"}}}
+	//
+	// Aliases are named anon1, anon2, etc. in the order in which their types first appear in the
+	// file, such that regenerating the file from the same values produces the same names. This
+	// can drastically shrink the output for e.g. slices of anonymous structs, whose fields are
+	// themselves anonymous structs. It is ignored by other functions.
+	AnonymousTypeAliases bool
+
+	// UnexportedFieldTypesAsInterface, if true, indicates that anonymous struct values held by
+	// interfaces (or pointers to them), whose fields have unexported types of other packages and
+	// thus require unexported access, should instead be written with the type interface{} for
+	// those fields. Their values are converted to the predeclared type of their kind where
+	// possible, e.g. `struct{ Level interface{} }{Level: 3}` for a value of type
+	// `struct{ Level foo.level }`. The output then compiles, but the dynamic type differs from the
+	// input. Values with unexported field names, or whose fields still require unexported access,
+	// are written as usual and reported in Result.RequiresUnexported.
+	UnexportedFieldTypesAsInterface bool
+
+	// UnexportedAsAny, if true, indicates that values whose types are unexported types of other
+	// packages (or contain them, e.g. []foo.bar) should be written such that the rest of the output
+	// still compiles, rather than being reported in Result.RequiresUnexported. Such values are
+	// written as a call to an exported constructor where possible (see Options.ExportedOnly),
+	// otherwise as an annotated nil if their kind permits, e.g. `nil /* unexported *foo.bar */`
+	// for a pointer or a value held by an interface, and are otherwise omitted from the struct
+	// literal holding them. Unlike ExportedOnly, values of exported types are written as usual,
+	// including their unexported fields within Options.PackagePath. Every value written as nil
+	// or omitted is recorded in Result.Omissions with the reason OmissionUnexported.
+	UnexportedAsAny bool
+
+	// MinDuplicateLen, if greater than zero, indicates that composite literals and string literals
+	// which appear more than once in the AST, and whose Go syntax is at least this many bytes on a
+	// single line, should be reported in Result.Duplicates. Literals which only appear within a
+	// larger duplicate are not reported. This can help find what bloats very large output.
+	MinDuplicateLen int
+
+	// HoistDuplicates, if true, indicates that the duplicates found due to MinDuplicateLen in a
+	// file written by WriteGoFile should be declared once as variables (or constants, for
+	// strings), which are written in their place, e.g.:
+	//
+	// 	var dup1 = &Address{City: "Berlin", Country: "Germany"}
+	//
+	// 	var Users = []*User{{Name: "a", Address: dup1}, {Name: "b", Address: dup1}}
+	//
+	// Variables are named dup1, dup2, etc. in the order in which their values first appear in the
+	// file. Note that values are then shared, so e.g. the pointers, slices and maps written in
+	// their place refer to the same memory. It is ignored by other functions.
+	HoistDuplicates bool
+
+	// IgnoreRegistered, if true, indicates that handlers registered via Register should not be
+	// used.
+	IgnoreRegistered bool
+
+	// qualified and unqualified are the precomputed variants of the options, see prepare.
+	qualified, unqualified *Options
+
+	// lineMarkers indicates that line markers may be placed in the AST, because it is only being
+	// used to produce a string. See layoutMapEntries.
+	lineMarkers bool
+}
+
+// HelperPackage describes a Go package which provides the helper functions (Ptr, AddrInterface)
+// that generated code may reference.
+type HelperPackage struct {
+	// Path is the import path of the package, e.g. "github.com/hexops/valast".
+	Path string
+
+	// Name is the name of the package, e.g. "valast". If empty, the last element of Path is used.
+	Name string
 }
 
 func (o *Options) withUnqualify() *Options {
+	if o.unqualified != nil {
+		return o.unqualified
+	}
 	tmp := *o
 	tmp.Unqualify = true
 	return &tmp
 }
 
+func (o *Options) withQualify() *Options {
+	if o.qualified != nil {
+		return o.qualified
+	}
+	tmp := *o
+	tmp.Unqualify = false
+	return &tmp
+}
+
+// prepare returns a copy of the options for use during a single conversion, which must not be
+// modified. Its qualified and unqualified variants are precomputed such that withUnqualify and
+// withQualify do not allocate.
+func (o *Options) prepare() *Options {
+	if o == nil {
+		o = defaultOptions()
+	}
+	qualified := *o
+	qualified.Unqualify = false
+	unqualified := qualified
+	unqualified.Unqualify = true
+	qualified.qualified, qualified.unqualified = &qualified, &unqualified
+	unqualified.qualified, unqualified.unqualified = &qualified, &unqualified
+	if o.Unqualify {
+		return &unqualified
+	}
+	return &qualified
+}
+
+// helperFunc returns an expression referencing the named helper function, e.g. `valast.Ptr`, and
+// records the helper package as being used.
+func (o *Options) helperFunc(name string, packagesFound map[string]bool) ast.Expr {
+	pkgPath, pkgName := o.HelperPackage.Path, o.HelperPackage.Name
+	if pkgPath == "" {
+		pkgPath = "github.com/hexops/valast"
+	}
+	if pkgName == "" {
+		pkgName = path.Base(pkgPath)
+	}
+	packagesFound[pkgPath] = true
+	return &ast.SelectorExpr{
+		X:   ast.NewIdent(pkgName),
+		Sel: ast.NewIdent(name),
+	}
+}
+
+func (o *Options) lineWidth() int {
+	if o.LineWidth > 0 {
+		return o.LineWidth
+	}
+	return 50
+}
+
+func (o *Options) elideBytesThreshold() int {
+	if o.ElideBytesThreshold > 0 {
+		return o.ElideBytesThreshold
+	}
+	return 1024
+}
+
+// packageResolver returns the resolver of package names according to Options.PackagePathToName
+// and Options.PackageResolver.
+func (o *Options) packageResolver() PackageResolver {
+	switch {
+	case o.PackagePathToName != nil:
+		return ResolverFunc(o.PackagePathToName)
+	case o.PackageResolver != nil:
+		return o.PackageResolver
+	}
+	return defaultResolver
+}
+
 func (o *Options) packagePathToName(path string) (string, error) {
-	if o.PackagePathToName != nil {
-		return o.PackagePathToName(path)
+	name, err := o.packageResolver().PackageName(path)
+	if err != nil {
+		return "", &ErrPackageName{Path: path, Err: err}
 	}
-	return DefaultPackagePathToName(path)
+	return name, nil
 }
 
 // DefaultPackagePathToName loads the specified package from disk to determine the package name.
+// Unlike the default Options.PackageResolver, it does not cache the names it resolves.
+//
+// On js/wasm, WASI and TinyGo, where packages cannot be loaded, the name is instead guessed from
+// the last element of the path, ignoring major version suffixes such as "/v2" and ".v2".
 func DefaultPackagePathToName(path string) (string, error) {
-	pkgs, err := packages.Load(&packages.Config{Mode: packages.NeedName}, path)
-	if err != nil {
-		return "", err
+	return loadPackageName(path)
+}
+
+// guessPackageName guesses the name of the package with the given path according to common
+// conventions, e.g. "github.com/foo/go-bar/v2" is assumed to be package bar.
+func guessPackageName(path string) string {
+	elems := strings.Split(path, "/")
+	name := elems[len(elems)-1]
+	if len(elems) > 1 && isMajorVersion(name) {
+		name = elems[len(elems)-2]
+	}
+	if i := strings.LastIndex(name, "."); i > 0 && isMajorVersion(name[i+1:]) {
+		name = name[:i]
 	}
-	return pkgs[0].Name, nil
+	name = strings.TrimPrefix(name, "go-")
+	name = strings.TrimSuffix(strings.TrimSuffix(name, "-go"), ".go")
+	return strings.Map(func(r rune) rune {
+		if r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, name)
 }
 
-// String converts the value v into the equivalent Go literal syntax.
+// isMajorVersion reports whether s is a major version path suffix such as "v2".
+func isMajorVersion(s string) bool {
+	if len(s) < 2 || s[0] != 'v' {
+		return false
+	}
+	_, err := strconv.Atoi(s[1:])
+	return err == nil
+}
+
+// String converts the value v into the equivalent Go literal syntax, configured by opts if any,
+// e.g.:
+//
+//	valast.String(v, valast.WithExportedOnly(), valast.WithMaxDepth(3))
 //
 // It is an opinionated helper for the more extensive AST function.
 //
 // If any error occurs, it will be returned as the string value. If handling errors is desired then
 // consider using the AST function directly.
-func String(v interface{}) string {
-	return StringWithOptions(v, nil)
+func String(v interface{}, opts ...Option) string {
+	if len(opts) == 0 {
+		return StringWithOptions(v, nil)
+	}
+	return StringWithOptions(v, defaultOptions().With(opts...))
 }
 
 // StringWithOptions converts the value v into the equivalent Go literal syntax, with the specified
@@ -91,36 +629,157 @@ func String(v interface{}) string {
 // consider using the AST function directly.
 func StringWithOptions(v interface{}, opt *Options) string {
 	if opt == nil {
-		opt = &Options{}
+		opt = defaultOptions()
 	}
-	var buf bytes.Buffer
-	result, err := AST(reflect.ValueOf(v), opt)
-	if err != nil {
+	var (
+		str string
+		err error
+	)
+	if opt.SingleLine {
+		str, err = emitValue(v, opt)
+	} else {
+		str, _, err = formatValue(v, opt)
+	}
+	if err != nil && str == "" {
 		return err.Error()
 	}
+	if opt.Colorize {
+		return colorize(str)
+	}
+	return str
+}
+
+// formatValue converts the value v into formatted Go literal syntax, returning it along with the
+// AST result. If Options.Partial is set, both the Go syntax and an *ErrPartial may be returned.
+func formatValue(v interface{}, opt *Options) (string, Result, error) {
+	if opt == nil {
+		opt = defaultOptions()
+	}
+	astOpt := *opt
+	astOpt.lineMarkers = true
+	result, err := AST(reflect.ValueOf(v), &astOpt)
+	return formatResult(v, result, err, opt)
+}
+
+// formatResult formats the result of converting the value v, as returned by AST along with err,
+// into Go literal syntax.
+func formatResult(v interface{}, result Result, err error, opt *Options) (string, Result, error) {
+	var buf bytes.Buffer
+	var partial *ErrPartial
+	if err != nil && !errors.As(err, &partial) {
+		return "", result, err
+	}
 	if opt.ExportedOnly && result.RequiresUnexported {
-		return fmt.Sprintf("valast: cannot convert unexported value %T", v)
+		return "", result, &ErrUnexported{Value: v}
 	}
-	if err := gofumptFormatExpr(&buf, token.NewFileSet(), result.AST, gofumpt.Options{
-		ExtraRules: true,
-	}); err != nil {
-		return fmt.Sprintf("valast: format: %v", err)
+	if err := FormatExpr(&buf, result.AST, opt); err != nil {
+		return "", result, err
 	}
-	return buf.String()
+	return buf.String(), result, err
 }
 
-// gofumptFormatExpr is a slight hack to get gofumpt to format an ast.Expr node, because the
-// gofumpt/format package does not expose node-level formatting currently.
-func gofumptFormatExpr(w io.Writer, fset *token.FileSet, expr ast.Expr, opt gofumpt.Options) error {
+// FormatExpr writes the Go syntax of expr to w, formatted the same as the output of
+// StringWithOptions with the given options, e.g. to format an expression composed of the ASTs of
+// several Results:
+//
+//	call := &ast.CallExpr{Fun: ast.NewIdent("run"), Args: []ast.Expr{a.AST, b.AST}}
+//	err := valast.FormatExpr(os.Stdout, call, opt)
+//
+// Composite literals are split onto multiple lines according to Options.LineWidth, and
+// Options.Indent, Options.Prefix and Options.SingleLine apply. opt may be nil. If expr cannot be
+// formatted, an *ErrFormat error is returned.
+func FormatExpr(w io.Writer, expr ast.Expr, opt *Options) error {
+	if opt == nil {
+		opt = defaultOptions()
+	}
+	var buf bytes.Buffer
+	if err := gofumptFormatExpr(&buf, token.NewFileSet(), expr, opt.lineWidth()); err != nil {
+		return &ErrFormat{Err: err}
+	}
+	src := buf.Bytes()
+	switch {
+	case opt.SingleLine:
+		src = []byte(singleLine(buf.String()))
+	case opt.Indent != "" || opt.Prefix != "":
+		indent := opt.Indent
+		if indent == "" {
+			indent = "\t"
+		}
+		src = reindent(src, opt.Prefix, indent)
+	}
+	_, err := w.Write(src)
+	return err
+}
+
+// rawStringOffsets returns a function which reports if the given byte offset in the Go syntax src
+// is within (not at the start of) a raw string literal.
+func rawStringOffsets(src []byte) func(offset int) bool {
+	type span struct{ start, end int }
+	var (
+		rawStrings []span
+		s          scanner.Scanner
+		fset       = token.NewFileSet()
+		file       = fset.AddFile("", fset.Base(), len(src))
+	)
+	s.Init(file, src, nil, 0)
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok == token.STRING && strings.HasPrefix(lit, "`") {
+			start := file.Offset(pos)
+			rawStrings = append(rawStrings, span{start: start, end: start + len(lit)})
+		}
+	}
+	return func(offset int) bool {
+		for _, r := range rawStrings {
+			if offset > r.start && offset < r.end {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// reindent replaces the leading tab indentation of each line in the Go syntax src with prefix
+// followed by indent per tab, except for the first line and lines within raw string literals.
+func reindent(src []byte, prefix, indent string) []byte {
+	inRawString := rawStringOffsets(src)
+	var (
+		out    bytes.Buffer
+		offset int
+	)
+	for i, line := range bytes.Split(src, []byte{'\n'}) {
+		lineStart := offset
+		offset += len(line) + 1
+		if i > 0 {
+			out.WriteByte('\n')
+			if len(line) > 0 && !inRawString(lineStart) {
+				trimmed := bytes.TrimLeft(line, "\t")
+				out.WriteString(prefix)
+				out.WriteString(strings.Repeat(indent, len(line)-len(trimmed)))
+				line = trimmed
+			}
+		}
+		out.Write(line)
+	}
+	return out.Bytes()
+}
+
+// gofumptFormatExpr is a slight hack to get gofumpt (or its fallback, see formatSource) to format
+// an ast.Expr node, because the gofumpt/format package does not expose node-level formatting
+// currently.
+func gofumptFormatExpr(w io.Writer, fset *token.FileSet, expr ast.Expr, lineWidth int) error {
 	// First use go/format to convert the expression to Go syntax.
 	var tmp bytes.Buffer
 	if err := format.Node(&tmp, fset, expr); err != nil {
 		return err
 	}
 
-	// HACK: Split composite literals onto multiple lines to avoid extra long struct values. We
-	// will defer this to gofumpt once it can perform this: https://github.com/mvdan/gofumpt/pull/70
-	tmpString := string(formatCompositeLiterals([]rune(tmp.String())))
+	// Split composite literals onto multiple lines to avoid extra long struct values, as gofumpt
+	// does not: https://github.com/mvdan/gofumpt/pull/70
+	tmpString := string(formatCompositeLiterals(replaceLineMarkers(tmp.Bytes()), lineWidth))
 
 	// Create a temporary file with our expression, run gofumpt on it, and extract the result.
 	fileStart := `package main
@@ -131,17 +790,22 @@ func main() {
 }
 `
 	tmpFile := []byte(fileStart + tmpString + fileEnd)
-	formattedFile, err := gofumpt.Source(tmpFile, opt)
+	formattedFile, err := formatSource(tmpFile)
 	if err != nil {
 		return err
 	}
 	formattedFile = bytes.TrimPrefix(formattedFile, []byte(fileStart))
 	formattedFile = bytes.TrimSuffix(formattedFile, []byte(fileEnd))
 
-	// Remove leading indention.
+	// Remove leading indention, except within raw string literals.
+	inRawString := rawStringOffsets(formattedFile)
 	lines := bytes.Split(formattedFile, []byte{'\n'})
+	offset := 0
 	for i, line := range lines {
-		lines[i] = bytes.TrimPrefix(line, []byte{'\t'})
+		if !inRawString(offset) {
+			lines[i] = bytes.TrimPrefix(line, []byte{'\t'})
+		}
+		offset += len(line) + 1
 	}
 	formattedExpr := bytes.Join(lines, []byte{'\n'})
 	_, err = w.Write(formattedExpr)
@@ -187,12 +851,35 @@ func AddrInterface(v, pointerToType interface{}) interface{} {
 	return slice.Index(0).Addr().Interface()
 }
 
+// interfacePointerStatements returns a call of a function literal returning a pointer to a
+// variable of the interface type, which holds the interface value v converted to elem, see
+// Options.InterfacePointerStatements.
+func interfacePointerStatements(ptrType, interfaceType ast.Expr, v reflect.Value, elem ast.Expr) ast.Expr {
+	spec := &ast.ValueSpec{Names: []*ast.Ident{ast.NewIdent("v")}, Type: interfaceType}
+	if !v.IsNil() {
+		spec.Values = []ast.Expr{elem}
+	}
+	return &ast.CallExpr{Fun: &ast.FuncLit{
+		Type: &ast.FuncType{
+			Params:  &ast.FieldList{},
+			Results: &ast.FieldList{List: []*ast.Field{{Type: ptrType}}},
+		},
+		Body: &ast.BlockStmt{List: []ast.Stmt{
+			&ast.DeclStmt{Decl: &ast.GenDecl{Tok: token.VAR, Specs: []ast.Spec{spec}}},
+			&ast.ReturnStmt{Results: []ast.Expr{&ast.UnaryExpr{Op: token.AND, X: ast.NewIdent("v")}}},
+		}},
+	}}
+}
+
 func basicLit(vv reflect.Value, kind token.Token, builtinType string, v interface{}, opt *Options, typeExprCache typeExprCache) (Result, error) {
 	typeExpr, err := typeExpr(vv.Type(), opt, typeExprCache)
 	if err != nil {
 		return Result{}, err
 	}
-	if opt.Unqualify && vv.Type().Name() == builtinType && vv.Type().PkgPath() == "" {
+	// The conversion is not needed if the type is implied by the context, or is the default type of
+	// the untyped constant literal, e.g. 1 for an int.
+	implied := opt.Unqualify || isUntypedDefault(vv, opt)
+	if !opt.qualifyLiteral(vv, !implied || vv.Type().Name() != builtinType || vv.Type().PkgPath() != "") {
 		return Result{AST: ast.NewIdent(fmt.Sprint(v))}, nil
 	}
 	if opt.ExportedOnly && typeExpr.RequiresUnexported {
@@ -207,6 +894,85 @@ func basicLit(vv reflect.Value, kind token.Token, builtinType string, v interfac
 	}, nil
 }
 
+// intLiteral returns the Go integer literal for the integer value v, in the base determined by
+// Options.IntBase.
+func intLiteral(v reflect.Value, opt *Options) string {
+	base, prefix := intBase(v.Type(), opt)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return formatInt(v.Int(), base, prefix)
+	default:
+		return prefix + strconv.FormatUint(v.Uint(), base)
+	}
+}
+
+// intBase returns the base in which integers of type t are written according to Options.IntBase,
+// and the prefix of their literals, e.g. "0x".
+func intBase(t reflect.Type, opt *Options) (base int, prefix string) {
+	base = 10
+	if opt.IntBase != nil {
+		base = opt.IntBase(t)
+	}
+	switch base {
+	case 2:
+		return base, "0b"
+	case 8:
+		return base, "0o"
+	case 16:
+		return base, "0x"
+	}
+	return 10, ""
+}
+
+// formatInt returns the Go integer literal for i in the given base, see intBase.
+func formatInt(i int64, base int, prefix string) string {
+	if i < 0 {
+		return "-" + prefix + strconv.FormatUint(uint64(-i), base)
+	}
+	return prefix + strconv.FormatInt(i, base)
+}
+
+// FloatFormat describes how floating-point values are written as Go literals.
+type FloatFormat int
+
+const (
+	// FloatFormatShortest writes the shortest decimal representation which parses back to the
+	// exact same value, using an exponent for large and small values, e.g. 1.5 or 1e+21.
+	FloatFormatShortest FloatFormat = iota
+
+	// FloatFormatDecimal writes the shortest decimal representation which parses back to the
+	// exact same value, never using an exponent, e.g. 1.5 or 1000000000000000000000.
+	FloatFormatDecimal
+)
+
+// floatLiteral returns the Go expression for the float value v, formatted according to
+// Options.FloatFormat at the precision of its type. NaN and infinite values are expressed using
+// the math package, e.g. math.NaN() or math.Inf(-1).
+func floatLiteral(v reflect.Value, opt *Options) string {
+	return formatFloat(v.Float(), v.Type().Bits(), opt)
+}
+
+// formatFloat returns the Go literal for the floating-point value f of the given bit size, see
+// floatLiteral.
+func formatFloat(f float64, bits int, opt *Options) string {
+	switch {
+	case math.IsNaN(f):
+		return "math.NaN()"
+	case math.IsInf(f, 1):
+		return "math.Inf(1)"
+	case math.IsInf(f, -1):
+		return "math.Inf(-1)"
+	}
+	if f == 0 && opt.Deterministic {
+		f = 0 // -0, which equals 0 and cannot be written as a Go constant
+	}
+	format := byte('g')
+	if opt.FloatFormat == FloatFormatDecimal {
+		format = 'f'
+	}
+	return strconv.FormatFloat(f, format, -1, bits)
+}
+
 // ErrInvalidType describes that the value is of a type that cannot be converted to an AST.
 type ErrInvalidType struct {
 	// Value is the actual value that was being converted.
@@ -218,6 +984,73 @@ func (e *ErrInvalidType) Error() string {
 	return fmt.Sprintf("valast: cannot convert value of type %T", e.Value)
 }
 
+// ErrUnexported describes that the value requires access to unexported types or values of another
+// package, which is not permitted by Options.ExportedOnly, or that the input value was obtained via
+// unexported struct fields, which is not permitted by Options.NoUnsafe or supported on the platform
+// (js/wasm and appengine, or with the "safe" or "purego" build tags).
+type ErrUnexported struct {
+	// Value is the actual value that was being converted.
+	Value interface{}
+}
+
+// Error implements the error interface.
+func (e *ErrUnexported) Error() string {
+	return fmt.Sprintf("valast: cannot convert unexported value %T", e.Value)
+}
+
+// ErrFormat describes that the AST produced for a value could not be formatted as Go syntax, e.g.
+// because a Renderer produced an invalid AST.
+type ErrFormat struct {
+	// Err is the underlying formatting error.
+	Err error
+}
+
+// Error implements the error interface.
+func (e *ErrFormat) Error() string {
+	return fmt.Sprintf("valast: format: %v", e.Err)
+}
+
+// Unwrap returns the underlying formatting error.
+func (e *ErrFormat) Unwrap() error { return e.Err }
+
+// ErrPackageName describes that the name of a package could not be determined, see
+// Options.PackagePathToName.
+type ErrPackageName struct {
+	// Path is the package path, e.g. "github.com/hexops/valast".
+	Path string
+
+	// Err is the error returned by Options.PackagePathToName.
+	Err error
+}
+
+// Error implements the error interface.
+func (e *ErrPackageName) Error() string {
+	return fmt.Sprintf("valast: package name of %q: %v", e.Path, e.Err)
+}
+
+// Unwrap returns the error returned by Options.PackagePathToName.
+func (e *ErrPackageName) Unwrap() error { return e.Err }
+
+// ErrPartial describes the errors encountered converting parts of the input value, which were
+// replaced by placeholders due to Options.Partial.
+type ErrPartial struct {
+	// Errors are the errors encountered, each prefixed with the path at which the value was found
+	// in the input (see Result.SourceMap).
+	Errors []error
+}
+
+// Error implements the error interface.
+func (e *ErrPartial) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("valast: %d values could not be converted: %s", len(e.Errors), strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the errors encountered, for use with errors.Is and errors.As.
+func (e *ErrPartial) Unwrap() []error { return e.Errors }
+
 // Result is a result from converting a Go value into its AST.
 type Result struct {
 	// AST is the actual Go AST expression for the value.
@@ -235,6 +1068,48 @@ type Result struct {
 
 	// Packages is the list of packages that are used in the AST.
 	Packages []string
+
+	// Imports are the imports of Packages, other than Options.PackagePath, classified into the
+	// groups written by goimports (see Options.ImportGroup), ordered by group and then path. They
+	// allow callers declaring the AST, and Decls, in a file to write an import declaration which
+	// requires no further formatting.
+	Imports []Import
+
+	// Decls are the declarations of the helper functions called by the AST, if
+	// Options.HelperFuncPrefix is set, which must be placed at file scope, e.g.:
+	//
+	// 	func newNode1() *Node {
+	// 		v := &Node{Name: "root"}
+	// 		v.Parent = v
+	// 		return v
+	// 	}
+	//
+	// Packages includes the packages used by the declarations.
+	Decls []ast.Decl
+
+	// Duplicates describes the literals which appear more than once in the AST, if
+	// Options.MinDuplicateLen is set, in the order they first appear.
+	Duplicates []Duplicate
+
+	// SourceMap, if Options.SourceMap is set, maps each AST node produced from a value to the path
+	// at which the value was found in the input. Paths are written in Go selector and index
+	// syntax relative to the input value, e.g. `.Users[3].Tags["admin"]` for a map entry or ""
+	// for the input value itself. Pointers and interfaces are transparent. Map keys share the
+	// path of their entry.
+	SourceMap map[ast.Expr]string
+
+	// ExtractedFiles is the list of files written due to Options.ExtractFiles, in the order they
+	// are referenced by the AST.
+	ExtractedFiles []string
+
+	// Pseudonyms maps each original string replaced due to Options.Pseudonymize to its pseudonym.
+	Pseudonyms map[string]string
+
+	// Omissions describes each value which was omitted from the AST (e.g. due to
+	// Options.ExportedOnly), or which requires access to unexported types or values, in the order
+	// they were found. Unlike OmittedUnexported and RequiresUnexported, this describes exactly
+	// what was lost, e.g. for logging.
+	Omissions []Omission
 }
 
 // AST converts the given value into its equivalent Go AST expression.
@@ -255,47 +1130,230 @@ type Result struct {
 //	string
 //	struct
 //	unsafe pointer
+//	func (see Options.FuncPolicy)
+//	chan (nil only)
 //
 // The input type is reflect.Value instead of interface{}, specifically to allow converting
 // interfaces derived from struct fields or other reflection which would otherwise be lost if the
 // input type is interface{}.
 //
-// Cyclic data structures will have their cyclic pointer values emitted twice, followed by a nil
-// value. e.g. for a structure `foo` with field `bar` which points to the original `foo`:
+// Values which (directly or indirectly) contain themselves are written once, with the first
+// recurrence written as nil (see Options.OnCycle), e.g. for a structure `foo` with field `bar`
+// which points to the original `foo`:
+//
+//	&foo{id: 123, bar: nil}
 //
-//	&foo{id: 123, bar: &foo{id: 123, bar: nil}}
+// This includes cycles through maps and slices, e.g. a map[string]interface{} holding itself is
+// written as `map[string]interface{}{"self": nil}`.
 func AST(v reflect.Value, opt *Options) (Result, error) {
+	return ASTContext(context.Background(), v, opt)
+}
+
+// ASTContext is like AST, but stops converting and returns the context's error once ctx is done,
+// e.g. to time-box the conversion of very large values.
+func ASTContext(ctx context.Context, v reflect.Value, opt *Options) (Result, error) {
+	return convert(ctx, v, opt.prepare(), typeExprCache{}, nil)
+}
+
+// convert converts the value v using the prepared options opt, and the given caches which may be
+// shared across conversions by a Converter.
+func convert(ctx context.Context, v reflect.Value, opt *Options, cache typeExprCache, constructorCache map[reflect.Type]*construction) (Result, error) {
 	var prof *profiler
 	wantProfile, _ := strconv.ParseBool(os.Getenv("VALAST_PROFILE"))
 	if wantProfile {
 		prof = &profiler{}
 	}
-	packagesFound := make(map[string]bool)
-	r, err := computeASTProfiled(v, opt, &cycleDetector{}, prof, typeExprCache{}, packagesFound)
+	s := &state{
+		ctx:              ctx,
+		cycleDetector:    &cycleDetector{},
+		profiler:         prof,
+		typeExprCache:    cache,
+		constructorCache: constructorCache,
+		packagesFound:    make(map[string]bool),
+		paths:            opt.SourceMap || opt.Redact != nil || opt.Pseudonymize != nil || opt.Partial || opt.CommentField != nil || opt.OnCycle == CyclePolicyVariables || opt.OnInvalidMapKey == MapKeyPolicyError,
+	}
+	if opt.SourceMap {
+		s.sourceMap = make(map[ast.Expr]string)
+	}
+	if opt.Parallelism > 1 {
+		s.workers = make(chan struct{}, opt.Parallelism-1)
+	}
+	if opt.MaxOutputBytes > 0 {
+		s.outputBytes = new(int64)
+	}
+	if v.IsValid() && !v.CanInterface() && (!unexportedSupported || opt.NoUnsafe) {
+		return Result{}, &ErrUnexported{Value: reflect.Zero(v.Type()).Interface()}
+	}
+	r, err := computeASTProfiled(v, opt, "", s)
 	prof.dump()
+	if err == nil && len(s.cycles) > 0 {
+		var t Result
+		if t, err = typeExpr(v.Type(), opt, s.typeExprCache); err == nil {
+			r.AST, err = cycleStatements(t.AST, r.AST, s.cycles)
+			r.RequiresUnexported = r.RequiresUnexported || t.RequiresUnexported
+		}
+	}
+	if err == nil && r.AST != nil && opt.HelperFuncPrefix != "" && !opt.lineMarkers {
+		r.AST, r.Decls = helperDecls(r.AST, opt.HelperFuncPrefix)
+	}
+	if err == nil && r.AST != nil && opt.MinDuplicateLen > 0 {
+		r.Duplicates = findDuplicates([]ast.Expr{r.AST}, opt.MinDuplicateLen).list
+	}
+	if err == nil && r.RequiresUnexported {
+		reason := OmissionRequiresUnexported
+		if opt.ExportedOnly {
+			reason = OmissionUnexported
+		}
+		s.omit(0, "", v, reason)
+	}
 
-	for k := range packagesFound {
+	for k := range s.packagesFound {
 		if k != "" {
 			r.Packages = append(r.Packages, k)
 		}
 	}
 	sort.Strings(r.Packages)
+	r.Imports = opt.imports(r.Packages)
+	r.ExtractedFiles = s.extractedFiles
+	r.SourceMap = s.sourceMap
+	r.Pseudonyms = s.pseudonyms
+	r.Omissions = s.omissions
 
+	if err == nil && len(s.errors) > 0 {
+		err = &ErrPartial{Errors: s.errors}
+	}
 	return r, err
 }
 
-func computeASTProfiled(v reflect.Value, opt *Options, cycleDetector *cycleDetector, profiler *profiler, typeExprCache typeExprCache, packagesFound map[string]bool) (Result, error) {
-	profiler.push(v)
+// state is the state shared by all computeAST calls during a single conversion.
+type state struct {
+	ctx            context.Context
+	workers        chan struct{} // see forEach
+	paths          bool          // whether paths are needed, see fieldPath
+	outputBytes    *int64        // see addOutput
+	depth          int           // nesting depth of composite values, see Options.MaxDepth
+	nesting        int           // nesting depth of all values, see Options.MaxNesting
+	cycleDetector  *cycleDetector
+	profiler       *profiler
+	typeExprCache  typeExprCache
+	packagesFound  map[string]bool
+	extractedFiles []string
+
+	// constructorCache caches the constructors and setter methods of struct types, if
+	// Options.Setters is set.
+	constructorCache map[reflect.Type]*construction
+
+	// errors are the errors replaced by placeholders, if Options.Partial is set.
+	errors []error
+
+	// pseudonyms maps original strings to their pseudonyms, if Options.Pseudonymize is set.
+	pseudonyms map[string]string
+
+	// sourceMap maps produced AST nodes to their path, if Options.SourceMap is set.
+	sourceMap map[ast.Expr]string
+
+	// omissions are the values omitted or requiring unexported access, see Result.Omissions.
+	omissions []Omission
+
+	// dynamic indicates the value being converted is held by an interface, and so is not pruned
+	// if Options.PruneEmpty is set.
+	dynamic bool
+
+	// cycles are the recurring values to assign, and opaque the paths of the values being
+	// converted which cannot be assigned, if Options.OnCycle is CyclePolicyVariables.
+	cycles []cycleRef
+	opaque []opaquePath
+}
+
+// fieldPath returns the path of the named field of the struct found at path, or path itself if
+// no options require paths (to avoid allocating them.)
+func (s *state) fieldPath(path, name string) string {
+	if !s.paths {
+		return path
+	}
+	return path + "." + name
+}
+
+// indexPath returns the path of the i'th element of the slice or array found at path, or path
+// itself if no options require paths (to avoid allocating them.)
+func (s *state) indexPath(path string, i int) string {
+	if !s.paths {
+		return path
+	}
+	return path + "[" + strconv.Itoa(i) + "]"
+}
+
+// keyPath returns the path of the entry with the given key of the map found at path, e.g.
+// `.Users["admin"]`. Unlike fieldPath and indexPath it is costly, so is only used where needed.
+func (s *state) keyPath(path string, key reflect.Value, opt *Options) (string, error) {
+	keyOpt := *opt
+	keyOpt.ExtractFiles = nil // never written out
+	keyOpt.ExportedOnly, keyOpt.UnexportedAsAny = false, false
+	keyOpt.qualified, keyOpt.unqualified = nil, nil
+	k, err := computeAST(key, &keyOpt, path, &state{
+		ctx:           s.ctx,
+		cycleDetector: &cycleDetector{},
+		typeExprCache: typeExprCache{},
+		packagesFound: map[string]bool{},
+	})
+	if err != nil || k.AST == nil {
+		return path, err
+	}
+	keySyntax, err := printExpr(k.AST)
+	if err != nil {
+		return path, err
+	}
+	return path + "[" + keySyntax + "]", nil
+}
+
+// computeASTProfiled computes the AST for the value v, found at the given path in the input
+// value (see Result.SourceMap.)
+func computeASTProfiled(v reflect.Value, opt *Options, path string, s *state) (Result, error) {
+	if err := s.ctx.Err(); err != nil {
+		return Result{}, err
+	}
+	s.profiler.push(v)
 	start := time.Now()
-	r, err := computeAST(v, opt, cycleDetector, profiler, typeExprCache, packagesFound)
-	profiler.pop(start)
+	var (
+		r      Result
+		err    error
+		nested = opt != nil && opt.MaxDepth > 0 && isNested(v, opt)
+	)
+	switch {
+	case opt != nil && s.nesting >= opt.maxNesting():
+		err = &ErrTooDeep{Limit: opt.maxNesting()}
+	case nested && s.depth >= opt.MaxDepth:
+		r, err = depthElided(v, opt, s.typeExprCache)
+	case nested:
+		s.depth++
+		s.nesting++
+		r, err = computeAST(v, opt, path, s)
+		s.nesting--
+		s.depth--
+	default:
+		s.nesting++
+		r, err = computeAST(v, opt, path, s)
+		s.nesting--
+	}
+	s.profiler.pop(start)
+	if err != nil && opt != nil && opt.Partial && path != "" && s.ctx.Err() == nil && !s.outputExceeded(opt) {
+		s.errors = append(s.errors, fmt.Errorf("%s: %w", path, err))
+		r, err = partialPlaceholder(v, opt, s.typeExprCache, err), nil
+	}
+	if err == nil {
+		err = s.addOutput(v, r, opt)
+	}
+	if s.sourceMap != nil && r.AST != nil {
+		s.sourceMap[r.AST] = path
+	}
 	return r, err
 }
 
-func computeAST(v reflect.Value, opt *Options, cycleDetector *cycleDetector, profiler *profiler, typeExprCache typeExprCache, packagesFound map[string]bool) (Result, error) {
+func computeAST(v reflect.Value, opt *Options, path string, s *state) (Result, error) {
 	if opt == nil {
 		opt = &Options{}
 	}
+	cycleDetector, typeExprCache, packagesFound := s.cycleDetector, s.typeExprCache, s.packagesFound
 	if v == (reflect.Value{}) {
 		// Technically this is an invalid reflect.Value, but we handle it to be gracious in the
 		// case of:
@@ -309,14 +1367,47 @@ func computeAST(v reflect.Value, opt *Options, cycleDetector *cycleDetector, pro
 	}
 
 	vv := unexported(v)
-	packagesFound[vv.Type().PkgPath()] = true
+	packagesFound[opt.typePackage(vv.Type())] = true
+	if pruned(vv, opt) && !s.dynamic {
+		// e.g. `&Foo{Bar: &Bar{}}`, which is written as nil.
+		vv = reflect.Zero(vv.Type())
+	}
+	s.dynamic = false
+	if r, ok, err := renderedAST(vv, opt); ok {
+		return r, err
+	}
+	if r, ok, err := templateAST(vv, opt); ok {
+		return r, err
+	}
+	if r, ok, err := registeredAST(vv, opt, packagesFound); ok {
+		return r, err
+	}
+	if r, ok, err := valuerAST(vv, opt, path, s); ok {
+		return r, err
+	}
+	if r, ok, err := errorAST(vv, opt, path, s); ok {
+		return r, err
+	}
+	if opt.UnexportedAsAny {
+		if r, ok, err := unexportedAnyAST(vv, opt, path, s); ok || err != nil {
+			return r, err
+		}
+	}
+	if (vv.Kind() == reflect.Map || vv.Kind() == reflect.Slice) && vv.Len() > 0 && mayContainCycle(vv.Type()) {
+		// e.g. a slice of interfaces containing itself, which unlike one containing a pointer to
+		// itself is not detected by the reflect.Ptr case.
+		if target, cyclic := cycleDetector.push(vv, path); cyclic {
+			return s.cycle(vv, opt, path, target)
+		}
+		defer cycleDetector.pop(vv)
+	}
 	switch vv.Kind() {
 	case reflect.Bool:
 		boolType, err := typeExpr(vv.Type(), opt, typeExprCache)
 		if err != nil {
 			return Result{}, err
 		}
-		if vv.Type().Name() == "bool" && vv.Type().PkgPath() == "" {
+		if !opt.qualifyLiteral(vv, vv.Type().Name() != "bool" || vv.Type().PkgPath() != "") {
 			return Result{AST: ast.NewIdent(fmt.Sprint(v))}, nil
 		}
 		if opt.ExportedOnly && boolType.RequiresUnexported {
@@ -330,50 +1421,82 @@ func computeAST(v reflect.Value, opt *Options, cycleDetector *cycleDetector, pro
 			RequiresUnexported: boolType.RequiresUnexported,
 		}, nil
 	case reflect.Int:
-		return basicLit(vv, token.INT, "int", v, opt, typeExprCache)
+		return basicLit(vv, token.INT, "int", intLiteral(vv, opt), opt, typeExprCache)
 	case reflect.Int8:
-		return basicLit(vv, token.INT, "int8", v, opt, typeExprCache)
+		return basicLit(vv, token.INT, "int8", intLiteral(vv, opt), opt, typeExprCache)
 	case reflect.Int16:
-		return basicLit(vv, token.INT, "int16", v, opt, typeExprCache)
+		return basicLit(vv, token.INT, "int16", intLiteral(vv, opt), opt, typeExprCache)
 	case reflect.Int32:
-		return basicLit(vv, token.INT, "int32", v, opt, typeExprCache)
+		if opt.Runes && isRuneLiteral(rune(vv.Int())) {
+			return basicLit(vv, token.CHAR, "int32", quoteRune(rune(vv.Int()), opt), opt, typeExprCache)
+		}
+		return basicLit(vv, token.INT, "int32", intLiteral(vv, opt), opt, typeExprCache)
 	case reflect.Int64:
-		return basicLit(vv, token.INT, "int64", v, opt, typeExprCache)
+		if opt.Durations && vv.Int() != 0 && isDurationType(vv.Type()) {
+			return durationAST(vv, opt, s)
+		}
+		return basicLit(vv, token.INT, "int64", intLiteral(vv, opt), opt, typeExprCache)
 	case reflect.Uint:
-		return basicLit(vv, token.INT, "uint", v, opt, typeExprCache)
+		return basicLit(vv, token.INT, "uint", intLiteral(vv, opt), opt, typeExprCache)
 	case reflect.Uint8:
-		return basicLit(vv, token.INT, "uint8", v, opt, typeExprCache)
+		return basicLit(vv, token.INT, "uint8", intLiteral(vv, opt), opt, typeExprCache)
 	case reflect.Uint16:
-		return basicLit(vv, token.INT, "uint16", v, opt, typeExprCache)
+		return basicLit(vv, token.INT, "uint16", intLiteral(vv, opt), opt, typeExprCache)
 	case reflect.Uint32:
-		return basicLit(vv, token.INT, "uint32", v, opt, typeExprCache)
+		return basicLit(vv, token.INT, "uint32", intLiteral(vv, opt), opt, typeExprCache)
 	case reflect.Uint64:
-		return basicLit(vv, token.INT, "uint64", v, opt, typeExprCache)
+		return basicLit(vv, token.INT, "uint64", intLiteral(vv, opt), opt, typeExprCache)
 	case reflect.Uintptr:
-		return basicLit(vv, token.INT, "uintptr", v, opt, typeExprCache)
-	case reflect.Float32:
-		return basicLit(vv, token.FLOAT, "float32", v, opt, typeExprCache)
-	case reflect.Float64:
-		return basicLit(vv, token.FLOAT, "float64", v, opt, typeExprCache)
+		return basicLit(vv, token.INT, "uintptr", intLiteral(vv, opt), opt, typeExprCache)
+	case reflect.Float32, reflect.Float64:
+		builtinType := vv.Kind().String()
+		if f := vv.Float(); math.IsNaN(f) || math.IsInf(f, 0) {
+			// math.NaN() and math.Inf() are float64 values, so all other types must be qualified.
+			builtinType = "float64"
+			packagesFound["math"] = true
+		}
+		return basicLit(vv, token.FLOAT, builtinType, floatLiteral(vv, opt), opt, typeExprCache)
 	case reflect.Complex64:
-		return basicLit(vv, token.FLOAT, "complex64", v, opt, typeExprCache)
+		return basicLit(vv, token.FLOAT, "complex64", strconv.FormatComplex(vv.Complex(), 'g', -1, 64), opt, typeExprCache)
 	case reflect.Complex128:
-		return basicLit(vv, token.FLOAT, "complex128", v, opt, typeExprCache)
+		return basicLit(vv, token.FLOAT, "complex128", strconv.FormatComplex(vv.Complex(), 'g', -1, 128), opt, typeExprCache)
 	case reflect.Array:
+		if isRepeated(vv, opt) {
+			return repeatedElementsAST(vv, opt, path, s)
+		}
 		var (
 			elts               []ast.Expr
 			requiresUnexported bool
+			sparse             = opt.SparseArrays && isSparseArray(vv)
+			n                  = opt.maxElements(vv.Len())
 		)
-		for i := 0; i < vv.Len(); i++ {
-			elem, err := computeASTProfiled(vv.Index(i), opt.withUnqualify(), cycleDetector, profiler, typeExprCache, packagesFound)
+		for i := 0; i < n; i++ {
+			if sparse && unexported(vv.Index(i)).IsZero() {
+				continue
+			}
+			mark := len(s.omissions)
+			elem, err := computeASTProfiled(vv.Index(i), opt.withUnqualify(), s.indexPath(path, i), s)
 			if err != nil {
 				return Result{}, err
 			}
+			if len(s.omissions) > mark {
+				s.prefixOmissions(mark, "["+strconv.Itoa(i)+"]")
+			}
 			if elem.RequiresUnexported {
 				requiresUnexported = true
 			}
+			if sparse {
+				elts = append(elts, &ast.KeyValueExpr{
+					Key:   &ast.BasicLit{Kind: token.INT, Value: strconv.Itoa(i)},
+					Value: elem.AST,
+				})
+				continue
+			}
 			elts = append(elts, elem.AST)
 		}
+		if n < vv.Len() {
+			elts = append(elts, elementsElided(vv.Len()-n))
+		}
 		arrayType, err := typeExpr(vv.Type(), opt, typeExprCache)
 		if err != nil {
 			return Result{}, err
@@ -392,67 +1515,257 @@ func computeAST(v reflect.Value, opt *Options, cycleDetector *cycleDetector, pro
 				RequiresUnexported: true,
 			}, nil
 		}
-		if opt.Unqualify {
-			return computeASTProfiled(unexported(vv.Elem()), opt.withUnqualify(), cycleDetector, profiler, typeExprCache, packagesFound)
+		// The dynamic value is assignable to the interface, so is written as-is where the
+		// interface type is implied (e.g. by a struct field), and converted otherwise, e.g.
+		// `io.Reader(&bytes.Buffer{})`.
+		elem := unexported(vv.Elem())
+		if !elem.IsValid() {
+			return computeASTProfiled(elem, opt, path, s)
 		}
-		v, err := computeASTProfiled(unexported(vv.Elem()), opt, cycleDetector, profiler, typeExprCache, packagesFound)
+		elemOpt := opt.withDynamicType(elem)
+		mark := len(s.omissions)
+		s.pushOpaque(opt, path, false) // e.g. `v.Foo.Bar` is invalid for an interface field Foo
+		s.dynamic = opt.PruneEmpty
+		v, err := computeASTProfiled(elem, elemOpt, path, s)
+		s.dynamic = false
+		s.popOpaque(opt)
 		if err != nil {
 			return Result{}, err
 		}
+		if opt.ExportedOnly && v.RequiresUnexported {
+			// e.g. `foo.NewBar("name")` for a value of the unexported type *foo.bar.
+			constructed, ok, err := exportedConstructorAST(elem, elemOpt, path, s)
+			if err != nil {
+				return Result{}, err
+			}
+			if ok {
+				v = constructed
+			}
+		}
+		if opt.UnexportedFieldTypesAsInterface && v.RequiresUnexported {
+			// e.g. `struct{ Level interface{} }{Level: 3}` for a value of type
+			// `struct{ Level foo.level }`.
+			erasedMark := len(s.omissions)
+			s.pushOpaque(opt, path, false)
+			erased, ok, err := interfaceFieldsAST(elem, elemOpt, path, s)
+			s.popOpaque(opt)
+			if err != nil {
+				return Result{}, err
+			}
+			if ok {
+				v = erased
+				s.omissions = append(s.omissions[:mark], s.omissions[erasedMark:]...)
+			}
+		}
+		if opt.UnexportedAsAny && v.RequiresUnexported {
+			// e.g. `nil /* unexported foo.level */` for a value of the unexported type foo.level.
+			v = unexportedNil(elem, path, s, mark)
+		}
+		if opt.Unqualify || v.AST == nil {
+			return v, nil
+		}
 		interfaceType, err := typeExpr(vv.Type(), opt, typeExprCache)
 		if err != nil {
 			return Result{}, err
 		}
 		return Result{
-			AST: &ast.CompositeLit{
-				Type: interfaceType.AST,
-				Elts: []ast.Expr{v.AST},
+			AST: &ast.CallExpr{
+				Fun:  interfaceType.AST,
+				Args: []ast.Expr{v.AST},
 			},
 			RequiresUnexported: interfaceType.RequiresUnexported || v.RequiresUnexported,
+			OmittedUnexported:  v.OmittedUnexported,
 		}, nil
 	case reflect.Map:
 		var (
 			keyValueExprs                         []ast.Expr
+			entryKeys                             []reflect.Value
 			requiresUnexported, omittedUnexported bool
 			keys                                  = vv.MapKeys()
+			omitted                               omissions
 		)
-		sort.Slice(keys, func(i, j int) bool {
-			return valueLess(keys[i], keys[j])
-		})
-		for _, key := range keys {
-			value := vv.MapIndex(key)
-			k, err := computeASTProfiled(key, opt.withUnqualify(), cycleDetector, profiler, typeExprCache, packagesFound)
-			if err != nil {
+		elemOpt := opt.withUnqualify() // not opt, which would then escape for every call
+		if opt.OnInvalidMapKey != MapKeyPolicyWrite {
+			valid := keys[:0]
+			for _, key := range keys {
+				reason := invalidMapKey(key)
+				if reason == "" {
+					valid = append(valid, key)
+					continue
+				}
+				keyPath, _ := s.keyPath(path, key, elemOpt)
+				if opt.OnInvalidMapKey == MapKeyPolicyError {
+					err := &ErrInvalidMapKey{Path: keyPath, Reason: reason}
+					if key := unexported(key); key.CanInterface() {
+						err.Key = key.Interface()
+					}
+					return Result{}, err
+				}
+				omitted.invalidKey++
+				s.omit(len(s.omissions), keyPath, key, OmissionInvalidMapKey)
+			}
+			keys = valid
+		}
+		// renderKey returns the Go syntax of a key, e.g. for ordering keys or describing paths.
+		renderKey := func(key reflect.Value) (string, error) {
+			keyOpt := *elemOpt
+			keyOpt.ExtractFiles = nil // never written out
+			keyOpt.qualified, keyOpt.unqualified = nil, nil
+			k, err := computeAST(key, &keyOpt, path, &state{
+				ctx:           s.ctx,
+				cycleDetector: cycleDetector,
+				typeExprCache: typeExprCache,
+				packagesFound: map[string]bool{},
+			})
+			if err != nil || k.AST == nil {
+				return "", err
+			}
+			return printExpr(k.AST)
+		}
+		var (
+			values []reflect.Value
+			err    error
+		)
+		if opt.SortMapKeys != nil {
+			opt.SortMapKeys(keys)
+		} else if opt.Deterministic {
+			// Values are needed to order keys which are equal, e.g. pointers to equal values.
+			if values, err = mapValues(vv, keys, renderKey); err != nil {
+				return Result{}, err
+			}
+			if err := sortKeysDeterministic(keys, values, renderKey); err != nil {
 				return Result{}, err
 			}
-			if k.RequiresUnexported {
+		} else {
+			sort.Slice(keys, func(i, j int) bool {
+				return valueLess(keys[i], keys[j])
+			})
+		}
+		elided := len(keys) - opt.maxElements(len(keys))
+		keys = keys[:len(keys)-elided]
+		if values == nil {
+			if values, err = mapValues(vv, keys, renderKey); err != nil {
+				return Result{}, err
+			}
+		}
+		values = values[:len(keys)]
+		var entryPaths []string
+		if s.paths {
+			entryPaths = make([]string, len(keys))
+			for i, key := range keys {
+				keySyntax, err := renderKey(key)
+				if err != nil {
+					return Result{}, err
+				}
+				entryPaths[i] = fmt.Sprintf("%s[%s]", path, keySyntax)
+			}
+		}
+		type entry struct {
+			key, value                                   ast.Expr
+			keyRequiresUnexported                        bool
+			valueRequiresUnexported                      bool
+			keyOmittedUnexported, valueOmittedUnexported bool
+		}
+		entries := make([]entry, len(keys))
+		err = s.forEach(len(keys), opt, func(i int, s *state) error {
+			entryPath := path
+			if entryPaths != nil {
+				entryPath = entryPaths[i]
+			}
+			mark := len(s.omissions)
+			s.pushOpaque(elemOpt, path, false)
+			k, err := computeASTProfiled(keys[i], elemOpt, entryPath, s)
+			s.popOpaque(elemOpt)
+			if err != nil {
+				return err
+			}
+			value := values[i]
+			// Map entries are not addressable, e.g. `v["foo"].Bar` is invalid for a struct value.
+			opaque := value.Kind() != reflect.Ptr && value.Kind() != reflect.Map && value.Kind() != reflect.Slice
+			if opaque {
+				s.pushOpaque(elemOpt, entryPath, false)
+			}
+			v, err := computeASTProfiled(value, elemOpt, entryPath, s)
+			if opaque {
+				s.popOpaque(elemOpt)
+			}
+			if err != nil {
+				return err
+			}
+			if len(s.omissions) > mark || k.RequiresUnexported || v.RequiresUnexported {
+				// Map keys share the path of their entry, see Result.SourceMap.
+				omittedPath := entryPath
+				if entryPaths == nil {
+					if omittedPath, err = s.keyPath(path, keys[i], elemOpt); err != nil {
+						return err
+					}
+				}
+				s.prefixOmissions(mark, omittedPath)
+				omittedValue := value
+				if k.RequiresUnexported {
+					omittedValue = keys[i]
+				}
+				switch {
+				case elemOpt.ExportedOnly && (k.RequiresUnexported || v.RequiresUnexported):
+					s.omit(mark, omittedPath, omittedValue, OmissionUnexported)
+				case k.RequiresUnexported || v.RequiresUnexported:
+					s.omit(mark, omittedPath, omittedValue, OmissionRequiresUnexported)
+				}
+			}
+			entries[i] = entry{
+				key:                     k.AST,
+				value:                   v.AST,
+				keyRequiresUnexported:   k.RequiresUnexported,
+				valueRequiresUnexported: v.RequiresUnexported,
+				keyOmittedUnexported:    k.OmittedUnexported,
+				valueOmittedUnexported:  v.OmittedUnexported,
+			}
+			return nil
+		})
+		if err != nil {
+			return Result{}, err
+		}
+		keyValueExprs = make([]ast.Expr, 0, len(keys))
+		for i, key := range keys {
+			e := entries[i]
+			if e.keyRequiresUnexported {
 				if opt.ExportedOnly {
 					omittedUnexported = true
+					omitted.unexported++
 					continue
 				}
 				requiresUnexported = true
 			}
-			if k.OmittedUnexported {
+			if e.keyOmittedUnexported {
 				omittedUnexported = true
 			}
-			v, err := computeASTProfiled(value, opt.withUnqualify(), cycleDetector, profiler, typeExprCache, packagesFound)
-			if err != nil {
-				return Result{}, err
-			}
-			if v.RequiresUnexported {
+			if e.valueRequiresUnexported {
 				if opt.ExportedOnly {
 					omittedUnexported = true
+					omitted.unexported++
 					continue
 				}
 				requiresUnexported = true
 			}
-			if v.OmittedUnexported {
+			if e.valueOmittedUnexported {
 				omittedUnexported = true
 			}
 			keyValueExprs = append(keyValueExprs, &ast.KeyValueExpr{
-				Key:   k.AST,
-				Value: v.AST,
+				Key:   e.key,
+				Value: e.value,
 			})
+			entryKeys = append(entryKeys, key)
+		}
+		if opt.lineMarkers && (opt.MultilineMaps || opt.GroupMapEntries != nil) && len(keyValueExprs) > 0 {
+			if err := layoutMapEntries(keyValueExprs, entryKeys, opt); err != nil {
+				return Result{}, err
+			}
+		}
+		if comment := omitted.comment("entry"); comment != nil && opt.DescribeOmitted {
+			keyValueExprs = append(keyValueExprs, comment)
+		}
+		if elided > 0 {
+			keyValueExprs = append(keyValueExprs, elementsElided(elided))
 		}
 		mapType, err := typeExpr(vv.Type(), opt, typeExprCache)
 		if err != nil {
@@ -487,29 +1800,43 @@ func computeAST(v reflect.Value, opt *Options, cycleDetector *cycleDetector, pro
 		if opt.ExportedOnly && ptrType.RequiresUnexported {
 			return Result{RequiresUnexported: true}, nil
 		}
-		if cycleDetector.push(vv.Interface()) {
-			// cyclic data structure detected
-			return Result{AST: ast.NewIdent("nil")}, nil
+		if target, cyclic := cycleDetector.push(vv, path); cyclic {
+			return s.cycle(vv, opt, path, target)
+		}
+		defer cycleDetector.pop(vv)
+		if k := vv.Elem().Kind(); k != reflect.Struct && k != reflect.Array {
+			// e.g. `v.Foo[0]` is invalid for a pointer to a slice Foo.
+			s.pushOpaque(opt, path, true)
+			defer s.popOpaque(opt)
 		}
 
-		if !isPtrToInterface && !isAddressableKind(vv.Elem().Kind()) {
-			if opt.Unqualify && literalNeedsQualification(vv.Elem()) {
-				opt.Unqualify = false // the value must have qualification
+		if vv.Elem().Kind() == reflect.Struct {
+			if b := opt.builder(vv.Elem().Type()); b != nil {
+				return builderAST(vv.Elem(), true, b, opt, path, s)
 			}
-			elem, err := computeASTProfiled(vv.Elem(), opt, cycleDetector, profiler, typeExprCache, packagesFound)
+		}
+		if opt.Setters && vv.Elem().Kind() == reflect.Struct {
+			r, ok, err := constructedAST(vv.Elem(), true, opt, path, s)
+			if ok || err != nil {
+				return r, err
+			}
+		}
+
+		// Values produced by Renderer implementations and registered handlers (e.g. function calls)
+		// may not be addressable.
+		if !isPtrToInterface && (!isAddressableKind(vv.Elem().Kind()) || hasCustomRendering(vv.Elem().Type(), opt)) {
+			if (opt.Unqualify || opt.Qualify != nil) && literalNeedsQualification(vv.Elem()) {
+				opt = opt.withRequiredQualify() // the value must have qualification
+			}
+			elem, err := computeASTProfiled(vv.Elem(), opt, path, s)
 			if err != nil {
 				return Result{}, err
 			}
-			cycleDetector.pop(vv.Interface())
 
-			// Pointers to unaddressable values can be created with help from valast.Addr.
-			packagesFound["github.com/hexops/valast"] = true
+			// Pointers to unaddressable values can be created with help from valast.Ptr.
 			return Result{
 				AST: &ast.CallExpr{
-					Fun: &ast.SelectorExpr{
-						X:   ast.NewIdent("valast"),
-						Sel: ast.NewIdent("Ptr"),
-					},
+					Fun:  opt.helperFunc("Ptr", packagesFound),
 					Args: []ast.Expr{elem.AST},
 				},
 				RequiresUnexported: ptrType.RequiresUnexported || elem.RequiresUnexported,
@@ -517,20 +1844,31 @@ func computeAST(v reflect.Value, opt *Options, cycleDetector *cycleDetector, pro
 			}, nil
 		}
 
-		elem, err := computeASTProfiled(vv.Elem(), opt, cycleDetector, profiler, typeExprCache, packagesFound)
+		elemOpt := opt
+		if isPtrToInterface {
+			elemOpt = opt.withUnqualify() // the interface type is given to AddrInterface
+		}
+		elem, err := computeASTProfiled(vv.Elem(), elemOpt, path, s)
 		if err != nil {
 			return Result{}, err
 		}
-		cycleDetector.pop(vv.Interface())
+		if isPtrToInterface && opt.InterfacePointerStatements {
+			interfaceType, err := typeExpr(vv.Elem().Type(), opt, typeExprCache)
+			if err != nil {
+				return Result{}, err
+			}
+			return Result{
+				AST:                interfacePointerStatements(ptrType.AST, interfaceType.AST, vv.Elem(), elem.AST),
+				RequiresUnexported: ptrType.RequiresUnexported || elem.RequiresUnexported,
+				OmittedUnexported:  elem.OmittedUnexported,
+			}, nil
+		}
 		if isPtrToInterface {
 			// Pointers to interfaces can be created with help from valast.AddrInterface.
 			return Result{
 				AST: &ast.TypeAssertExpr{
 					X: &ast.CallExpr{
-						Fun: &ast.SelectorExpr{
-							X:   ast.NewIdent("valast"),
-							Sel: ast.NewIdent("AddrInterface"),
-						},
+						Fun: opt.helperFunc("AddrInterface", packagesFound),
 						Args: []ast.Expr{
 							elem.AST,
 							&ast.CallExpr{
@@ -546,13 +1884,10 @@ func computeAST(v reflect.Value, opt *Options, cycleDetector *cycleDetector, pro
 			}, nil
 		}
 		if vv.Elem().Kind() == reflect.Ptr {
-			// Pointers to pointers can be created with help from valast.Addr.
+			// Pointers to pointers can be created with help from valast.Ptr.
 			return Result{
 				AST: &ast.CallExpr{
-					Fun: &ast.SelectorExpr{
-						X:   ast.NewIdent("valast"),
-						Sel: ast.NewIdent("Ptr"),
-					},
+					Fun:  opt.helperFunc("Ptr", packagesFound),
 					Args: []ast.Expr{elem.AST},
 				},
 				RequiresUnexported: ptrType.RequiresUnexported || elem.RequiresUnexported,
@@ -562,7 +1897,7 @@ func computeAST(v reflect.Value, opt *Options, cycleDetector *cycleDetector, pro
 		switch vv.Elem().Type() {
 		case reflect.TypeOf(time.Time{}):
 			return Result{
-				AST: pointifyASTExpr(elem.AST),
+				AST: pointifyASTExpr(opt.helperFunc("Ptr", packagesFound), elem.AST),
 			}, nil
 		}
 		return Result{
@@ -574,19 +1909,54 @@ func computeAST(v reflect.Value, opt *Options, cycleDetector *cycleDetector, pro
 			OmittedUnexported:  elem.OmittedUnexported,
 		}, nil
 	case reflect.Slice:
+		if opt.ExtractFiles != nil && vv.Type().Elem() == reflect.TypeOf(byte(0)) && vv.Len() >= opt.ExtractFiles.threshold() {
+			return extractFile(vv, vv.Bytes(), opt, typeExprCache, &s.extractedFiles)
+		}
+		if opt.ElideBytes != nil && vv.Type().Elem() == reflect.TypeOf(byte(0)) && vv.Len() >= opt.elideBytesThreshold() {
+			r, elided, err := elideBytes(vv, opt, typeExprCache, packagesFound)
+			if err != nil || elided {
+				return r, err
+			}
+		}
+		if opt.Runes && vv.Type().Elem().Kind() == reflect.Int32 && !vv.IsNil() && vv.Len() > 0 {
+			if s, ok := runesString(vv); ok {
+				return runesLit(vv, s, opt, typeExprCache)
+			}
+		}
+		if isRepeated(vv, opt) {
+			return repeatedElementsAST(vv, opt, path, s)
+		}
+		if r, ok, err := primitiveSliceAST(vv, opt, s); ok {
+			return r, err
+		}
 		var (
 			elts               []ast.Expr
 			requiresUnexported bool
+			n                  = opt.maxElements(vv.Len())
 		)
-		for i := 0; i < vv.Len(); i++ {
-			elem, err := computeASTProfiled(vv.Index(i), opt.withUnqualify(), cycleDetector, profiler, typeExprCache, packagesFound)
-			if err != nil {
-				return Result{}, err
-			}
-			if elem.RequiresUnexported {
-				requiresUnexported = true
+		var elemsRequireUnexported []bool
+		if n > 0 {
+			elts = make([]ast.Expr, n, n+1)
+			elemsRequireUnexported = make([]bool, n)
+		}
+		elemOpt := opt.withUnqualify() // not opt, which would then escape for every call
+		err := s.forEach(n, opt, func(i int, s *state) error {
+			mark := len(s.omissions)
+			elem, err := computeASTProfiled(vv.Index(i), elemOpt, s.indexPath(path, i), s)
+			elts[i], elemsRequireUnexported[i] = elem.AST, elem.RequiresUnexported
+			if len(s.omissions) > mark {
+				s.prefixOmissions(mark, "["+strconv.Itoa(i)+"]")
 			}
-			elts = append(elts, elem.AST)
+			return err
+		})
+		if err != nil {
+			return Result{}, err
+		}
+		for _, r := range elemsRequireUnexported {
+			requiresUnexported = requiresUnexported || r
+		}
+		if n < vv.Len() {
+			elts = append(elts, elementsElided(vv.Len()-n))
 		}
 		sliceType, err := typeExpr(vv.Type(), opt, typeExprCache)
 		if err != nil {
@@ -600,50 +1970,131 @@ func computeAST(v reflect.Value, opt *Options, cycleDetector *cycleDetector, pro
 			RequiresUnexported: requiresUnexported || sliceType.RequiresUnexported,
 		}, nil
 	case reflect.String:
-		s := v.String()
-		wantRawStringLiteral := len(s) > 40 && strings.Contains(s, "\n")
-		wantRawStringLiteral = wantRawStringLiteral || strings.Contains(s, `"`)
-		if wantRawStringLiteral && !strings.Contains(s, "`") {
-			return basicLit(vv, token.STRING, "string", "`"+s+"`", opt.withUnqualify(), typeExprCache)
+		if opt.ExtractFiles != nil && vv.Len() >= opt.ExtractFiles.threshold() {
+			return extractFile(vv, []byte(vv.String()), opt, typeExprCache, &s.extractedFiles)
+		}
+		str := vv.String()
+		if opt.Pseudonymize != nil {
+			if s.pseudonyms == nil {
+				s.pseudonyms = map[string]string{}
+			}
+			str = opt.Pseudonymize.pseudonymize(path, str, s.pseudonyms)
 		}
-		return basicLit(vv, token.STRING, "string", strconv.Quote(v.String()), opt.withUnqualify(), typeExprCache)
+		if b, ok := stringBytesLiteral(str, opt); ok {
+			if vv.Type().Name() == "string" && vv.Type().PkgPath() == "" {
+				return Result{AST: stringExpr(str, opt)}, nil
+			}
+			// e.g. binaryString([]byte{0x00, 0xff}) rather than binaryString(string([]byte{...}))
+			typ, err := typeExpr(vv.Type(), opt, typeExprCache)
+			if err != nil {
+				return Result{}, err
+			}
+			if opt.ExportedOnly && typ.RequiresUnexported {
+				return Result{RequiresUnexported: true}, nil
+			}
+			return Result{
+				AST:                &ast.CallExpr{Fun: typ.AST, Args: []ast.Expr{b}},
+				RequiresUnexported: typ.RequiresUnexported,
+			}, nil
+		}
+		return basicLit(vv, token.STRING, "string", stringLiteral(str, opt), opt, typeExprCache)
 	case reflect.Struct:
 		// special handling for common structs from stdlib
 		// that only contain unexported fields
 		switch v.Type() {
 		case reflect.TypeOf(time.Time{}):
 			return Result{
-				AST: timeTypeASTExpr(v.Interface().(time.Time)),
+				AST: timeTypeASTExpr(vv.Interface().(time.Time)),
 			}, nil
 		}
 
+		if b := opt.builder(vv.Type()); b != nil {
+			return builderAST(vv, false, b, opt, path, s)
+		}
+		if opt.Setters {
+			if r, ok, err := constructedAST(vv, false, opt, path, s); ok || err != nil {
+				return r, err
+			}
+		}
+
 		var (
-			structValue                           []ast.Expr
+			structValue                           = make([]ast.Expr, 0, v.NumField())
 			requiresUnexported, omittedUnexported bool
+			comments                              []string
+			omitted                               omissions
+			structMark                            = len(s.omissions)
 		)
 		for i := 0; i < v.NumField(); i++ {
-			if unexported(v.Field(i)).IsZero() {
+			field, mark := v.Type().Field(i), len(s.omissions)
+			if !accessible(field, opt) {
+				if v.Field(i).IsZero() {
+					omitted.zero++
+				} else {
+					omittedUnexported = true
+					omitted.unexported++
+					s.omit(mark, path+"."+field.Name, v.Field(i), OmissionUnexported)
+				}
+				continue
+			}
+			if excludeField(v.Type(), field, opt) {
+				if unexported(v.Field(i)).IsZero() {
+					omitted.zero++
+				} else {
+					omitted.excluded++
+					s.omit(mark, path+"."+field.Name, v.Field(i), OmissionExcluded)
+				}
 				continue
 			}
-			value, err := computeASTProfiled(unexported(v.Field(i)), opt.withUnqualify(), cycleDetector, profiler, typeExprCache, packagesFound)
+			value, ok, err := structFieldAST(v, i, opt, path, s)
 			if err != nil {
 				return Result{}, err
 			}
+			if !ok {
+				if fieldValue := unexported(v.Field(i)); fieldValue.IsZero() || pruned(fieldValue, opt) {
+					omitted.zero++
+				} else {
+					omitted.redacted++
+					s.omit(mark, path+"."+field.Name, v.Field(i), OmissionRedacted)
+				}
+				continue
+			}
 			if value.RequiresUnexported {
-				if opt.ExportedOnly {
+				if opt.ExportedOnly || opt.UnexportedAsAny {
 					omittedUnexported = true
+					omitted.unexported++
+					s.omit(mark, path+"."+field.Name, v.Field(i), OmissionUnexported)
 					continue
 				}
 				requiresUnexported = true
+				s.omit(mark, path+"."+field.Name, v.Field(i), OmissionRequiresUnexported)
 			}
 			if value.OmittedUnexported {
 				omittedUnexported = true
 			}
+			if opt.CommentField != nil && opt.lineMarkers {
+				comment := opt.CommentField(s.fieldPath(path, field.Name), field, unexported(v.Field(i)))
+				if comment != "" && comments == nil {
+					comments = make([]string, len(structValue), v.NumField())
+				}
+				if comments != nil {
+					comments = append(comments, comment)
+				}
+			}
 			structValue = append(structValue, &ast.KeyValueExpr{
-				Key:   ast.NewIdent(v.Type().Field(i).Name),
+				Key:   ast.NewIdent(field.Name),
 				Value: value.AST,
 			})
 		}
+		if opt.DescribeOmitted {
+			if comment := omitted.comment("field"); comment != nil {
+				structValue = append(structValue, comment)
+			}
+		}
+		if comments != nil {
+			if err := layoutCommentedFields(structValue, comments); err != nil {
+				return Result{}, err
+			}
+		}
 		structType, err := typeExpr(vv.Type(), opt, typeExprCache)
 		if err != nil {
 			return Result{}, err
@@ -651,6 +2102,10 @@ func computeAST(v reflect.Value, opt *Options, cycleDetector *cycleDetector, pro
 		if opt.ExportedOnly && structType.RequiresUnexported {
 			return Result{RequiresUnexported: true}, nil
 		}
+		if structType.RequiresUnexported && vv.Type().Name() == "" {
+			// e.g. an anonymous struct type with unexported fields declared in another package.
+			s.omit(structMark, path, v, OmissionRequiresUnexported)
+		}
 		return Result{
 			AST: &ast.CompositeLit{
 				Type: structType.AST,
@@ -659,18 +2114,46 @@ func computeAST(v reflect.Value, opt *Options, cycleDetector *cycleDetector, pro
 			RequiresUnexported: structType.RequiresUnexported || requiresUnexported,
 			OmittedUnexported:  omittedUnexported,
 		}, nil
+	case reflect.Func:
+		return funcAST(vv, opt, typeExprCache, packagesFound)
+	case reflect.Chan:
+		// Only nil channels can be expressed, e.g. as the zero value of a field.
+		if !vv.IsNil() {
+			return Result{AST: nil}, &ErrInvalidType{Value: vv.Interface()}
+		}
+		chanType, err := typeExpr(vv.Type(), opt, typeExprCache)
+		if err != nil {
+			return Result{}, err
+		}
+		if opt.ExportedOnly && chanType.RequiresUnexported {
+			return Result{RequiresUnexported: true}, nil
+		}
+		if opt.Unqualify {
+			return Result{AST: ast.NewIdent("nil")}, nil
+		}
+		return Result{
+			AST: &ast.CallExpr{
+				Fun:  &ast.ParenExpr{X: chanType.AST},
+				Args: []ast.Expr{ast.NewIdent("nil")},
+			},
+			RequiresUnexported: chanType.RequiresUnexported,
+		}, nil
 	case reflect.UnsafePointer:
 		unsafePointerType, err := typeExpr(vv.Type(), opt, typeExprCache)
 		if err != nil {
 			return Result{}, err
 		}
+		ptr := v.Pointer()
+		if opt.Deterministic {
+			ptr = 0
+		}
 		return Result{
 			AST: &ast.CallExpr{
 				Fun: unsafePointerType.AST,
 				Args: []ast.Expr{
 					&ast.CallExpr{
 						Fun:  ast.NewIdent("uintptr"),
-						Args: []ast.Expr{&ast.BasicLit{Kind: token.INT, Value: fmt.Sprintf("0x%x", v.Pointer())}},
+						Args: []ast.Expr{&ast.BasicLit{Kind: token.INT, Value: fmt.Sprintf("0x%x", ptr)}},
 					},
 				},
 			},
@@ -678,10 +2161,59 @@ func computeAST(v reflect.Value, opt *Options, cycleDetector *cycleDetector, pro
 			OmittedUnexported:  unsafePointerType.OmittedUnexported,
 		}, nil
 	default:
-		return Result{AST: nil}, &ErrInvalidType{Value: v.Interface()}
+		return Result{AST: nil}, &ErrInvalidType{Value: vv.Interface()}
 	}
 }
 
+// structFieldAST computes the AST for the i'th field of the struct value v, found at the given path
+// in the input. It reports false if the field should be omitted, i.e. it is zero (see also
+// Options.PruneEmpty and Options.IncludeZeroFields) or redacted.
+func structFieldAST(v reflect.Value, i int, opt *Options, path string, s *state) (Result, bool, error) {
+	fieldValue := unexported(v.Field(i))
+	zero := fieldValue.IsZero() || pruned(fieldValue, opt)
+	if zero && !opt.IncludeZeroFields {
+		return Result{}, false, nil
+	}
+	field := v.Type().Field(i)
+	if zero && nilable(field.Type.Kind()) {
+		// e.g. a nil map, which would otherwise be written as an empty map literal.
+		return Result{AST: ast.NewIdent("nil")}, true, nil
+	}
+	fieldPath := s.fieldPath(path, field.Name)
+	if !zero && shouldRedact(fieldPath, field, opt) {
+		placeholder, ok := redactedValue(field.Type, opt)
+		if !ok {
+			return Result{}, false, nil
+		}
+		fieldValue = placeholder
+	}
+	mark := len(s.omissions)
+	value, err := computeASTProfiled(fieldValue, opt.withUnqualify(), fieldPath, s)
+	if err != nil {
+		return Result{}, false, err
+	}
+	if len(s.omissions) > mark {
+		s.prefixOmissions(mark, "."+field.Name)
+	}
+	return value, true, nil
+}
+
+// partialPlaceholder returns the placeholder for the value v which could not be converted due to
+// err, see Options.Partial.
+func partialPlaceholder(v reflect.Value, opt *Options, cache typeExprCache, err error) Result {
+	expr := "nil"
+	switch v.Kind() {
+	case reflect.Invalid, reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map, reflect.Func, reflect.Chan, reflect.UnsafePointer:
+	default:
+		if t, err := typeExpr(v.Type(), opt, cache); err == nil {
+			if typ, err := printExpr(t.AST); err == nil {
+				expr = "*new(" + typ + ")"
+			}
+		}
+	}
+	return Result{AST: ast.NewIdent(expr + " /* " + strings.ReplaceAll(err.Error(), "*/", "* /") + " */")}
+}
+
 // literalNeedsQualification tells if a literal value needs qualification or not when initializing
 // a value of type `interface{}`, e.g. being passed into the valast.Addr() helper function.
 func literalNeedsQualification(v reflect.Value) bool {
@@ -692,8 +2224,6 @@ func literalNeedsQualification(v reflect.Value) bool {
 		k == reflect.String ||
 		k == reflect.Int ||
 		k == reflect.Array ||
-		k == reflect.Chan ||
-		k == reflect.Func ||
 		k == reflect.Interface ||
 		k == reflect.Map ||
 		k == reflect.Ptr ||
@@ -703,6 +2233,19 @@ func literalNeedsQualification(v reflect.Value) bool {
 		return false
 	}
 
+	// Nil functions and channels are written as `nil`, which has no type of its own.
+	if (k == reflect.Func || k == reflect.Chan) && v.IsNil() {
+		return true
+	}
+	if k == reflect.Chan {
+		return false
+	}
+
+	// Functions are referenced by name and thus have the unnamed signature type.
+	if k == reflect.Func {
+		return v.Type().Name() != ""
+	}
+
 	// Floats. If passed to a function accepting an `interface{}` value:
 	//
 	// * A whole number `1234` would be considered an integer.
@@ -714,16 +2257,30 @@ func literalNeedsQualification(v reflect.Value) bool {
 	return true // needs qualification
 }
 
+// unexported returns v, or if it was obtained via unexported struct fields (and thus cannot be
+// used with Interface, Set, etc.) an equivalent value without that restriction. If this is not
+// supported (see bypass.Supported), such values are not converted, see accessible.
 func unexported(v reflect.Value) reflect.Value {
-	if v == (reflect.Value{}) {
+	if v == (reflect.Value{}) || v.CanInterface() || !unexportedSupported {
 		return v
 	}
 	return bypass.UnsafeReflectValue(v)
 }
 
+// unexportedSupported reports if values obtained via unexported struct fields can be accessed,
+// see bypass.Supported. It is a variable for testing.
+var unexportedSupported = bypass.Supported
+
+// accessible reports if the struct field can be accessed, i.e. it is exported or values obtained
+// via unexported struct fields are supported (see bypass.Supported) and permitted (see
+// Options.NoUnsafe). Inaccessible fields are omitted as if due to Options.ExportedOnly.
+func accessible(field reflect.StructField, opt *Options) bool {
+	return field.IsExported() || (unexportedSupported && !opt.NoUnsafe)
+}
+
 // timeTypeASTExpr returns the AST expression equivalent of
 //
-// 	time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+//	time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
 func timeTypeASTExpr(t time.Time) ast.Expr {
 	return &ast.CallExpr{
 		Fun: &ast.SelectorExpr{
@@ -746,15 +2303,71 @@ func timeTypeASTExpr(t time.Time) ast.Expr {
 	}
 }
 
-// pointifyASTExpr wraps an expression in a call to the `Ptr` helper function.
+// durationASTExpr returns the AST expression equivalent of d as a sum of time package constants,
+// e.g.
+//
+//	2*time.Hour + 30*time.Minute
+func durationASTExpr(d time.Duration) ast.Expr {
+	units := []struct {
+		name string
+		d    uint64
+	}{
+		{"Hour", uint64(time.Hour)},
+		{"Minute", uint64(time.Minute)},
+		{"Second", uint64(time.Second)},
+		{"Millisecond", uint64(time.Millisecond)},
+		{"Microsecond", uint64(time.Microsecond)},
+		{"Nanosecond", uint64(time.Nanosecond)},
+	}
+	negative := d < 0
+	remaining := uint64(d)
+	if negative {
+		remaining = uint64(-d)
+	}
+	// Negative durations are written as a difference, e.g. -2*time.Hour - 30*time.Minute, so that
+	// math.MinInt64 can be represented without overflow.
+	var expr ast.Expr
+	for _, unit := range units {
+		n := remaining / unit.d
+		if n == 0 {
+			continue
+		}
+		remaining -= n * unit.d
+		var term ast.Expr = &ast.SelectorExpr{
+			X:   ast.NewIdent("time"),
+			Sel: ast.NewIdent(unit.name),
+		}
+		coefficient := strconv.FormatUint(n, 10)
+		if negative && expr == nil {
+			coefficient = "-" + coefficient
+		}
+		if coefficient == "-1" {
+			term = &ast.UnaryExpr{Op: token.SUB, X: term}
+		} else if coefficient != "1" {
+			term = &ast.BinaryExpr{
+				X:  &ast.BasicLit{Kind: token.INT, Value: coefficient},
+				Op: token.MUL,
+				Y:  term,
+			}
+		}
+		switch {
+		case expr == nil:
+			expr = term
+		case negative:
+			expr = &ast.BinaryExpr{X: expr, Op: token.SUB, Y: term}
+		default:
+			expr = &ast.BinaryExpr{X: expr, Op: token.ADD, Y: term}
+		}
+	}
+	return expr
+}
+
+// pointifyASTExpr wraps an expression in a call to the `Ptr` helper function ptrFunc.
 //
 //	valast.Ptr(//...)
-func pointifyASTExpr(e ast.Expr) ast.Expr {
+func pointifyASTExpr(ptrFunc, e ast.Expr) ast.Expr {
 	return &ast.CallExpr{
-		Fun: &ast.SelectorExpr{
-			X:   ast.NewIdent("valast"),
-			Sel: ast.NewIdent("Ptr"),
-		},
+		Fun:  ptrFunc,
 		Args: []ast.Expr{e},
 	}
 }
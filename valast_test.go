@@ -1,12 +1,31 @@
 package valast
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"math"
+	"os"
+	"path/filepath"
 	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 	"unsafe"
 
 	"github.com/hexops/autogold"
+	"github.com/hexops/gotextdiff"
 	"github.com/hexops/valast/internal/test"
 )
 
@@ -28,9 +47,10 @@ type ExportedBaz struct {
 
 func TestString(t *testing.T) {
 	tests := []struct {
-		name  string
-		input interface{}
-		opt   *Options
+		name       string
+		unexported bool
+		input      interface{}
+		opt        *Options
 	}{
 		{
 			name:  "bool",
@@ -41,6 +61,10 @@ func TestString(t *testing.T) {
 			input: false,
 			opt:   &Options{Unqualify: true},
 		},
+		{
+			name:  "int",
+			input: 1234,
+		},
 		{
 			name:  "int32",
 			input: int32(1234),
@@ -68,10 +92,18 @@ func TestString(t *testing.T) {
 			input: float64(1.234),
 			opt:   &Options{Unqualify: true},
 		},
+		{
+			name:  "float64_integral",
+			input: float64(2),
+		},
 		{
 			name:  "complex64",
 			input: complex64(1.234),
 		},
+		{
+			name:  "complex128",
+			input: complex128(1 + 2i),
+		},
 		{
 			name:  "complex64_unqualify",
 			input: complex64(1.234),
@@ -89,14 +121,16 @@ three`),
 			opt: &Options{Unqualify: true},
 		},
 		{
-			name: "struct_anonymous",
+			name:       "struct_anonymous",
+			unexported: true,
 			input: struct {
 				a, b int
 				V    string
 			}{a: 1, b: 2, V: "efg"},
 		},
 		{
-			name: "struct_same_package",
+			name:       "struct_same_package",
+			unexported: true,
 			input: baz{
 				Bam: 1.34,
 				zeta: foo{
@@ -106,9 +140,10 @@ three`),
 			opt: &Options{PackageName: "valast", PackagePath: "github.com/hexops/valast"},
 		},
 		{
-			name:  "struct_external_package",
-			input: test.NewBaz(),
-			opt:   &Options{PackageName: "valast", PackagePath: "github.com/hexops/valast"},
+			name:       "struct_external_package",
+			unexported: true,
+			input:      test.NewBaz(),
+			opt:        &Options{PackageName: "valast", PackagePath: "github.com/hexops/valast"},
 		},
 		{
 			name: "array",
@@ -138,7 +173,8 @@ three`),
 			}(nil),
 		},
 		{
-			name: "interface_anonymous",
+			name:       "interface_anonymous",
+			unexported: true,
 			input: &struct {
 				v interface {
 					String() string
@@ -146,6 +182,72 @@ three`),
 				}
 			}{v: test.NewBaz()},
 		},
+		{
+			name: "interface_anonymous_signatures",
+			input: &struct {
+				v interface {
+					Printf(format string, args ...interface{})
+					Split(s, sep string) (before, after string, found bool)
+					Close() error
+					Run()
+				}
+			}{},
+		},
+		{
+			name:  "func_variadic",
+			input: (func(int, ...string) (int, error))(nil),
+		},
+		{
+			name: "chan_types",
+			input: struct {
+				Both     chan int
+				Send     chan<- string
+				Recv     <-chan []byte
+				ChanRecv chan (<-chan int)
+				SendChan chan<- chan int
+				Funcs    chan func() error
+				N        int
+			}{N: 1},
+		},
+		{
+			name:  "chan_nil",
+			input: (chan<- int)(nil),
+		},
+		{
+			name:  "chan_nil_unqualify",
+			input: (chan int)(nil),
+			opt:   &Options{Unqualify: true},
+		},
+		{
+			name:  "chan",
+			input: make(chan int),
+		},
+		{
+			name: "chan_func_nil_elements",
+			input: struct {
+				Chans  []chan int
+				Funcs  map[string]func() error
+				Any    []interface{}
+				ChanP  *chan int
+				FuncP  *func()
+				Nested struct {
+					C chan string
+					F func()
+					N int
+				}
+			}{
+				Chans: []chan int{nil},
+				Funcs: map[string]func() error{"a": nil},
+				Any:   []interface{}{(chan int)(nil), (func())(nil), 1},
+				ChanP: new(chan int),
+				FuncP: new(func()),
+				Nested: struct {
+					C chan string
+					F func()
+					N int
+				}{N: 1},
+			},
+		},
 		{
 			name: "interface_builtin",
 			input: &struct {
@@ -153,7 +255,8 @@ three`),
 			}{v: nil},
 		},
 		{
-			name: "interface",
+			name:       "interface",
+			unexported: true,
 			input: &struct {
 				v test.Bazer
 			}{v: test.NewBaz()},
@@ -169,6 +272,25 @@ three`),
 				"bar": 64,
 			},
 		},
+		{
+			name: "map_struct_keys",
+			input: map[struct{ A, B int }]string{
+				{A: 2, B: 1}: "c",
+				{A: 1, B: 2}: "b",
+				{A: 1, B: 1}: "a",
+			},
+		},
+		{
+			name: "map_interface_keys",
+			input: map[interface{}]int{
+				"b":           1,
+				"a":           2,
+				int32(2):      3,
+				int32(1):      4,
+				nil:           5,
+				complex(1, 2): 6,
+			},
+		},
 		{
 			name:  "time_utc",
 			input: time.Date(2016, 1, 2, 15, 4, 5, 0, time.UTC),
@@ -181,6 +303,9 @@ three`),
 	for _, tst := range tests {
 		tst := tst
 		t.Run(tst.name, func(t *testing.T) {
+			if tst.unexported {
+				requireUnexported(t)
+			}
 			got := StringWithOptions(tst.input, tst.opt)
 			autogold.Equal(t, got)
 		})
@@ -195,13 +320,29 @@ func TestRecursion(t *testing.T) {
 	}
 	cyclic := &foo{name: "one"}
 	cyclic.bar = cyclic
+
+	cyclicMap := map[string]interface{}{"name": "one"}
+	cyclicMap["self"] = cyclicMap
+	cyclicSlice := []interface{}{"one", nil}
+	cyclicSlice[1] = cyclicSlice
+	shared := []*foo{{name: "one"}}
+
+	siblings := &test.ComplexNode{}
+	siblings.Child = &test.ComplexNodeChild{Parent: siblings}
+	siblings.Child.Siblings = []*test.ComplexNode{siblings, {Right: siblings}}
+
+	type holder struct{ v interface{} }
+	withinInterface := &foo{name: "one"}
+	withinInterface.bar = withinInterface
 	tests := []struct {
-		name  string
-		input interface{}
-		opt   *Options
+		name       string
+		unexported bool
+		input      interface{}
+		opt        *Options
 	}{
 		{
-			name: "basic",
+			name:       "basic",
+			unexported: true,
 			input: &foo{
 				name: "one",
 				bar: &foo{
@@ -219,13 +360,85 @@ func TestRecursion(t *testing.T) {
 			},
 		},
 		{
-			name:  "struct_cyclic",
-			input: cyclic,
+			name:       "struct_cyclic",
+			unexported: true,
+			input:      cyclic,
+		},
+		{
+			name:  "map_cyclic",
+			input: cyclicMap,
+		},
+		{
+			name:  "slice_cyclic",
+			input: cyclicSlice,
+		},
+		{
+			name:       "slice_shared",
+			unexported: true,
+			input:      [][]*foo{shared, shared},
+		},
+		{
+			name:  "complex_node_siblings",
+			input: siblings,
+		},
+		{
+			name:       "struct_cyclic_comment",
+			unexported: true,
+			input:      cyclic,
+			opt:        &Options{OnCycle: CyclePolicyComment},
+		},
+		{
+			name:       "struct_cyclic_error",
+			unexported: true,
+			input:      cyclic,
+			opt:        &Options{OnCycle: CyclePolicyError},
+		},
+		{
+			name:       "struct_cyclic_error_partial",
+			unexported: true,
+			input:      cyclic,
+			opt:        &Options{OnCycle: CyclePolicyError, Partial: true},
+		},
+		{
+			name:       "struct_cyclic_variables",
+			unexported: true,
+			input:      cyclic,
+			opt:        &Options{OnCycle: CyclePolicyVariables},
+		},
+		{
+			name:  "map_cyclic_variables",
+			input: cyclicMap,
+			opt:   &Options{OnCycle: CyclePolicyVariables},
+		},
+		{
+			name:  "slice_cyclic_variables",
+			input: cyclicSlice,
+			opt:   &Options{OnCycle: CyclePolicyVariables},
+		},
+		{
+			name:  "complex_node_siblings_variables",
+			input: siblings,
+			opt:   &Options{OnCycle: CyclePolicyVariables},
+		},
+		{
+			name:       "interface_cyclic_variables",
+			unexported: true,
+			input:      holder{v: withinInterface},
+			opt:        &Options{OnCycle: CyclePolicyVariables},
+		},
+		{
+			name:       "slice_shared_variables",
+			unexported: true,
+			input:      [][]*foo{shared, shared},
+			opt:        &Options{OnCycle: CyclePolicyVariables},
 		},
 	}
 	for _, tst := range tests {
 		tst := tst
 		t.Run(tst.name, func(t *testing.T) {
+			if tst.unexported {
+				requireUnexported(t)
+			}
 			got := StringWithOptions(tst.input, tst.opt)
 			autogold.Equal(t, got)
 		})
@@ -243,36 +456,42 @@ func TestEdgeCases(t *testing.T) {
 		bazerPointer                          = &bazer
 	)
 	tests := []struct {
-		name  string
-		input interface{}
-		opt   *Options
+		name       string
+		unexported bool
+		input      interface{}
+		opt        *Options
 	}{
 		{
-			name: "ptr_to_interface",
+			name:       "ptr_to_interface",
+			unexported: true,
 			input: &struct {
 				v *test.Bazer
 			}{v: &bazer},
 		},
 		{
-			name: "ptr_to_ptr_to_interface",
+			name:       "ptr_to_ptr_to_interface",
+			unexported: true,
 			input: &struct {
 				v **test.Bazer
 			}{v: &bazerPointer},
 		},
 		{
-			name: "ptr_to_nil_interface",
+			name:       "ptr_to_nil_interface",
+			unexported: true,
 			input: &struct {
 				v *test.Bazer
 			}{v: &nilInterface},
 		},
 		{
-			name: "ptr2_to_nil_interface",
+			name:       "ptr2_to_nil_interface",
+			unexported: true,
 			input: &struct {
 				v **test.Bazer
 			}{v: &nilInterfacePointer},
 		},
 		{
-			name: "ptr3_to_nil_interface",
+			name:       "ptr3_to_nil_interface",
+			unexported: true,
 			input: &struct {
 				v ***test.Bazer
 			}{v: &nilInterfacePointerPointer},
@@ -283,10 +502,37 @@ func TestEdgeCases(t *testing.T) {
 				v *test.Bazer
 			}{v: nil},
 		},
+		{
+			name:       "ptr_to_interface_statements",
+			unexported: true,
+			input: &struct {
+				v *test.Bazer
+			}{v: &bazer},
+			opt: &Options{InterfacePointerStatements: true},
+		},
+		{
+			name:       "ptr_to_ptr_to_interface_statements",
+			unexported: true,
+			input: &struct {
+				v **test.Bazer
+			}{v: &bazerPointer},
+			opt: &Options{InterfacePointerStatements: true},
+		},
+		{
+			name:       "ptr_to_nil_interface_statements",
+			unexported: true,
+			input: &struct {
+				v *test.Bazer
+			}{v: &nilInterface},
+			opt: &Options{InterfacePointerStatements: true},
+		},
 	}
 	for _, tst := range tests {
 		tst := tst
 		t.Run(tst.name, func(t *testing.T) {
+			if tst.unexported {
+				requireUnexported(t)
+			}
 			got := StringWithOptions(tst.input, tst.opt)
 			autogold.Equal(t, got)
 		})
@@ -322,12 +568,14 @@ func TestExportedOnly_input(t *testing.T) {
 		unexportedUnsafePointer unsafe.Pointer
 	)
 	tests := []struct {
-		name  string
-		input interface{}
-		opt   *Options
+		name       string
+		unexported bool
+		input      interface{}
+		opt        *Options
 	}{
 		{
-			name: "struct_same_package",
+			name:       "struct_same_package",
+			unexported: true,
 			input: baz{
 				Bam: 1.34,
 				zeta: foo{
@@ -428,6 +676,19 @@ func TestExportedOnly_input(t *testing.T) {
 			}{V: nil},
 			opt: &Options{PackageName: "other", PackagePath: "github.com/other/other", ExportedOnly: true},
 		},
+		{
+			name: "interface_unexported_dynamic_type",
+			input: struct {
+				Greeter  test.Greeter
+				Greeters []test.Greeter
+				Foo      interface{ String() string }
+			}{
+				Greeter:  test.NewGreeter("gopher", true),
+				Greeters: []test.Greeter{test.NewGreeter("", false), nil},
+				Foo:      test.NewFoo(),
+			},
+			opt: &Options{PackageName: "other", PackagePath: "github.com/other/other", ExportedOnly: true},
+		},
 		{
 			name: "map",
 			input: unexportedMap{
@@ -488,6 +749,9 @@ func TestExportedOnly_input(t *testing.T) {
 	for _, tst := range tests {
 		tst := tst
 		t.Run(tst.name, func(t *testing.T) {
+			if tst.unexported {
+				requireUnexported(t)
+			}
 			got := StringWithOptions(tst.input, tst.opt)
 			autogold.Equal(t, got)
 		})
@@ -702,6 +966,111 @@ func TestUnexportedInputs(t *testing.T) {
 }
 
 // TestPointers tests to ensure valast.Addr and & are used when appropriate.
+type reflectInner struct {
+	n       int
+	created time.Time
+	arr     [3]int
+	ifc     interface{}
+	ptr     *string
+}
+
+type reflectOuter struct {
+	m map[string]reflectInner
+	k map[reflectKey]bool
+}
+
+type reflectKey struct{ id int }
+
+func TestUnexportedReflectValues(t *testing.T) {
+	requireUnexported(t)
+	name := "foo"
+	inner := reflectInner{n: 1, created: time.Date(2024, 4, 5, 12, 0, 0, 0, time.UTC), arr: [3]int{1, 2, 3}, ifc: int8(4), ptr: &name}
+	outer := reflect.ValueOf(reflectOuter{
+		m: map[string]reflectInner{"a": inner},
+		k: map[reflectKey]bool{{id: 7}: true},
+	})
+	iter := outer.Field(0).MapRange()
+	iter.Next()
+	call := reflect.ValueOf(func() reflectInner { return inner }).Call(nil)[0]
+	tests := []struct {
+		name  string
+		input reflect.Value
+	}{
+		{name: "map_index", input: outer.Field(0).MapIndex(reflect.ValueOf("a"))},
+		{name: "map_index_time", input: outer.Field(0).MapIndex(reflect.ValueOf("a")).Field(1)},
+		{name: "map_index_array", input: outer.Field(0).MapIndex(reflect.ValueOf("a")).Field(2)},
+		{name: "map_index_interface", input: outer.Field(0).MapIndex(reflect.ValueOf("a")).Field(3)},
+		{name: "map_range_value", input: iter.Value()},
+		{name: "map_keys", input: outer.Field(1).MapKeys()[0]},
+		{name: "call_result_time", input: call.Field(1)},
+		{name: "call_result_pointer", input: call.Field(4)},
+	}
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.name, func(t *testing.T) {
+			r, err := AST(tst.input, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := FormatExpr(&buf, r.AST, nil); err != nil {
+				t.Fatal(err)
+			}
+			autogold.Equal(t, buf.String())
+		})
+	}
+}
+
+// requireUnexported skips the test if values of unexported struct fields cannot be accessed, as
+// is the case when built with the purego or safe build tags.
+func requireUnexported(t *testing.T) {
+	t.Helper()
+	if !unexportedSupported {
+		t.Skip("unexported struct fields are not supported in this build")
+	}
+}
+
+func TestUnexportedUnsupported(t *testing.T) {
+	supported := unexportedSupported
+	unexportedSupported = false
+	t.Cleanup(func() { unexportedSupported = supported })
+
+	input := test.NewBaz()
+	input.Beta = 42
+	t.Run("fields", func(t *testing.T) {
+		autogold.Equal(t, String(input))
+	})
+	t.Run("single_line", func(t *testing.T) {
+		autogold.Equal(t, StringWithOptions(input, &Options{SingleLine: true}))
+	})
+	t.Run("omissions", func(t *testing.T) {
+		r, err := AST(reflect.ValueOf(input), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		autogold.Equal(t, fmt.Sprint(r.OmittedUnexported, r.Omissions))
+	})
+	t.Run("input", func(t *testing.T) {
+		_, err := AST(reflect.ValueOf(*input).FieldByName("zeta"), nil)
+		autogold.Equal(t, fmt.Sprint(err))
+	})
+}
+
+func TestNoUnsafe(t *testing.T) {
+	input := test.NewBaz()
+	input.Beta = 42
+	opt := &Options{NoUnsafe: true}
+	autogold.Equal(t, StringWithOptions(input, opt))
+	if got, want := StringWithOptions(input, opt), StringWithOptions(input, &Options{NoUnsafe: true, SingleLine: true}); got != want {
+		t.Fatalf("single line: got %q, want %q", got, want)
+	}
+
+	_, err := AST(reflect.ValueOf(*input).FieldByName("zeta"), opt)
+	if _, ok := err.(*ErrUnexported); !ok {
+		t.Fatalf("expected *ErrUnexported, got %v", err)
+	}
+}
+
 func TestPointers(t *testing.T) {
 	var (
 		boolValue                            = true
@@ -742,9 +1111,10 @@ func TestPointers(t *testing.T) {
 		timeLocalValue                       = time.Date(2016, 1, 2, 15, 4, 5, 0, time.Local)
 	)
 	tests := []struct {
-		name  string
-		input interface{}
-		opt   *Options
+		name       string
+		unexported bool
+		input      interface{}
+		opt        *Options
 	}{
 		{
 			name:  "bool",
@@ -853,14 +1223,16 @@ func TestPointers(t *testing.T) {
 			opt:   &Options{PackageName: "valast", PackagePath: "github.com/hexops/valast"},
 		},
 		{
-			name:  "interface",
-			input: &interfaceValue,
-			opt:   &Options{PackageName: "valast", PackagePath: "github.com/hexops/valast"},
+			name:       "interface",
+			unexported: true,
+			input:      &interfaceValue,
+			opt:        &Options{PackageName: "valast", PackagePath: "github.com/hexops/valast"},
 		},
 		{
-			name:  "interface2",
-			input: &interfaceValuePointer,
-			opt:   &Options{PackageName: "valast", PackagePath: "github.com/hexops/valast"},
+			name:       "interface2",
+			unexported: true,
+			input:      &interfaceValuePointer,
+			opt:        &Options{PackageName: "valast", PackagePath: "github.com/hexops/valast"},
 		},
 		{
 			name:  "map",
@@ -931,6 +1303,9 @@ func TestPointers(t *testing.T) {
 	for _, tst := range tests {
 		tst := tst
 		t.Run(tst.name, func(t *testing.T) {
+			if tst.unexported {
+				requireUnexported(t)
+			}
 			got := StringWithOptions(tst.input, tst.opt)
 			autogold.Equal(t, got)
 		})
@@ -967,6 +1342,18 @@ hello world hello world hello world hello world hello world hello world hello wo
 			name:  "short_quotes",
 			input: `"hello" "world"`,
 		},
+		{
+			name:  "long_multi_line_with_carriage_returns",
+			input: "hello world hello world hello world hello world\r\nhello world hello world hello world\r\n",
+		},
+		{
+			name:  "short_quotes_with_carriage_return",
+			input: "\"hello\"\r\n\"world\"",
+		},
+		{
+			name:  "short_quotes_invalid_utf8",
+			input: "\"hello\" \xff",
+		},
 		{
 			name: "long_multi_line_with_quotes",
 			input: `"hello world"! "hello world" hello world hello world hello world hello world hello world hello world
@@ -982,59 +1369,2157 @@ hello world hello world hello world hello world "hello" world hello world hello
 	}
 }
 
-func TestAddrInterface(t *testing.T) {
-	var bazer test.Bazer = test.NewBaz()
-	got := AddrInterface(bazer, (*test.Bazer)(nil)).(*test.Bazer)
-	if *got != bazer {
-		t.Fatal("*got != v")
+func TestCompositeLiteralFormatting(t *testing.T) {
+	type text struct {
+		A, B string
+		C    []string
 	}
-}
-
-func TestAddrInterface_golden(t *testing.T) {
-	// Confirms the AddrInterface calls in testdata/TestEdgeCases/ptr_to_* are valid.
-	_ = AddrInterface(&test.Baz{
-		Bam: (1.34 + 0i),
-	}, (*test.Bazer)(nil)).(*test.Bazer)
-
-	_ = AddrInterface(nil, (*test.Bazer)(nil)).(*test.Bazer)
-
-	_ = Addr(AddrInterface(&test.Baz{
-		Bam: (1.34 + 0i),
-	}, (*test.Bazer)(nil)).(*test.Bazer)).(**test.Bazer)
-
-	_ = Addr(AddrInterface(nil, (*test.Bazer)(nil)).(*test.Bazer)).(**test.Bazer)
-
-	_ = Addr(Addr(AddrInterface(nil,
-		(*test.Bazer)(nil)).(*test.Bazer)).(**test.Bazer)).(***test.Bazer)
-}
-
-func TestAddr_AddrInterface(t *testing.T) {
-	var bazer test.Bazer = test.NewBaz()
-	got := Addr(AddrInterface(bazer, (*test.Bazer)(nil)).(*test.Bazer)).(**test.Bazer)
-	if **got != bazer {
-		t.Fatal("*got != v")
+	type runes struct {
+		Open, Close rune
+		Nested      []runes
+	}
+	tests := []struct {
+		name  string
+		input interface{}
+		opt   *Options
+	}{
+		{
+			name: "braces_in_strings",
+			input: []text{
+				{A: "{{{{{{ some text with braces", B: "}}}}}} and more text with braces", C: []string{"{", "}"}},
+				{A: "}", B: "{"},
+			},
+		},
+		{
+			name: "string_ending_in_backslash",
+			input: []text{
+				{A: "a\\", B: "{{{{{{ some text with braces }}}", C: []string{"x"}},
+				{A: "\\", B: "\\\"}\\"},
+			},
+		},
+		{
+			name:  "raw_strings_with_braces",
+			input: []text{{A: "{\\", B: "\\}", C: []string{"{{ \\ }}"}}},
+			opt:   &Options{StringStyle: StringStylePreferRaw},
+		},
+		{
+			name:  "rune_braces",
+			input: runes{Open: '{', Close: '}', Nested: []runes{{Open: '"', Close: '\\'}, {Open: '}', Close: '{'}}},
+			opt:   &Options{Runes: true},
+		},
+		{
+			name:  "wide_single_element",
+			input: []text{{A: "a single element is not split however wide its line is"}},
+		},
+		{
+			name:  "wide_elements",
+			input: text{A: "{ elements are each written", B: "on their own line }"},
+		},
+		{
+			name:  "comment_with_braces",
+			input: []text{{A: "a", B: "b"}, {A: "c"}},
+			opt: &Options{CommentField: func(path string, field reflect.StructField, v reflect.Value) string {
+				if field.Name == "A" {
+					return "{ not a literal } \"or a string"
+				}
+				return ""
+			}},
+		},
+	}
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.name, func(t *testing.T) {
+			got := StringWithOptions(tst.input, tst.opt)
+			autogold.Equal(t, got)
+		})
 	}
 }
 
-func TestAddr_string(t *testing.T) {
-	got := Addr("hello").(*string)
-	if *got != "hello" {
-		t.Fatal("*got != v")
+func TestStringStyle(t *testing.T) {
+	tests := []struct {
+		name  string
+		input interface{}
+		opt   *Options
+	}{
+		{
+			name:  "quoted_with_quotes",
+			input: `"hello" "world"`,
+			opt:   &Options{StringStyle: StringStyleQuoted},
+		},
+		{
+			name:  "quoted_long_multi_line",
+			input: "hello world hello world hello world hello world\nhello world hello world",
+			opt:   &Options{StringStyle: StringStyleQuoted},
+		},
+		{
+			name:  "prefer_raw_short",
+			input: "hello\\world",
+			opt:   &Options{StringStyle: StringStylePreferRaw},
+		},
+		{
+			name:  "prefer_raw_with_backticks",
+			input: "hello `world`",
+			opt:   &Options{StringStyle: StringStylePreferRaw},
+		},
+		{
+			name:  "chunked",
+			input: "aGVsbG8gd29ybGQgaGVsbG8gd29ybGQgaGVsbG8gd29ybGQgaGVsbG8gd29ybGQgaGVsbG8gd29ybGQgaGVsbG8gd29ybGQ=",
+			opt:   &Options{ChunkStrings: true, LineWidth: 32},
+		},
+		{
+			name:  "chunked_unicode",
+			input: "héllo wörld héllo wörld héllo wörld",
+			opt:   &Options{ChunkStrings: true, LineWidth: 10},
+		},
+		{
+			name: "chunked_in_struct",
+			input: struct {
+				Data string
+			}{Data: "aGVsbG8gd29ybGQgaGVsbG8gd29ybGQgaGVsbG8gd29ybGQgaGVsbG8gd29ybGQ="},
+			opt: &Options{ChunkStrings: true, LineWidth: 32},
+		},
+		{
+			name:  "auto_threshold",
+			input: "hello\nworld",
+			opt:   &Options{RawStringThreshold: 5},
+		},
+		{
+			name:  "prefer_raw_binary",
+			input: binaryString("\x00\xffhello\nworld\xe2\x82"),
+			opt:   &Options{StringStyle: StringStylePreferRaw},
+		},
+		{
+			name:  "bytes_binary",
+			input: []interface{}{binaryString("\x00\xffhi"), "a\x00b", "valid \"text\""},
+			opt:   &Options{StringStyle: StringStyleBytes},
+		},
+		{
+			name:  "bytes_unnamed",
+			input: "\x00\xff",
+			opt:   &Options{StringStyle: StringStyleBytes},
+		},
+		{
+			name:  "bytes_named",
+			input: binaryString("\x00\xff"),
+			opt:   &Options{StringStyle: StringStyleBytes},
+		},
+		{
+			name: "bytes_in_struct",
+			input: struct {
+				A string
+				B binaryString
+			}{A: "\x00\x01\x02\x03\x04\x05\x06\x07\x08\x09", B: "\x00\x01\x02\x03\x04\x05\x06\x07\x08\x09"},
+			opt: &Options{StringStyle: StringStyleBytes},
+		},
+	}
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.name, func(t *testing.T) {
+			got := StringWithOptions(tst.input, tst.opt)
+			autogold.Equal(t, got)
+		})
 	}
 }
 
-func TestAddr_int(t *testing.T) {
-	got := Addr(5).(*int)
-	if *got != 5 {
-		t.Fatal("*got != v")
+func TestStringStyleBytesAST(t *testing.T) {
+	opt := &Options{StringStyle: StringStyleBytes}
+	for _, input := range []interface{}{"\x00\xff", binaryString("\x00\xff")} {
+		r, err := AST(reflect.ValueOf(input), opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		call, ok := r.AST.(*ast.CallExpr)
+		if !ok || len(call.Args) != 1 {
+			t.Fatalf("%T: expected conversion, got %T", input, r.AST)
+		}
+		lit, ok := call.Args[0].(*ast.CompositeLit)
+		if !ok || len(lit.Elts) != 2 {
+			t.Fatalf("%T: expected []byte composite literal, got %T", input, call.Args[0])
+		}
+		for _, elt := range lit.Elts {
+			if b, ok := elt.(*ast.BasicLit); !ok || b.Kind != token.INT {
+				t.Fatalf("%T: expected integer literal, got %T", input, elt)
+			}
+		}
 	}
 }
 
-func TestAddr_pointer(t *testing.T) {
-	x := 5
-	got := Addr(&x).(**int)
-	if **got != 5 {
-		t.Fatal("*got != v")
+type binaryString string
+
+func TestStringRoundTrip(t *testing.T) {
+	// Strings which are not valid UTF-8, or contain bytes which source files cannot, must be
+	// written such that they evaluate to the exact same bytes.
+	inputs := []interface{}{
+		"\x00\xff",
+		binaryString("a\x00b\xfe"),
+		strings.Repeat("line \xff\n", 20),
+		"\uFEFFbom\r\n",
+		[]binaryString{"\x80", "ok"},
+		map[string]interface{}{"k\xff": "\x00"},
+		strings.Repeat("€", 30) + "\xe2\x82",
+	}
+	styles := []*Options{
+		{},
+		{StringStyle: StringStylePreferRaw},
+		{StringStyle: StringStyleBytes},
+		{StringStyle: StringStyleBytes, SingleLine: true},
+		{ChunkStrings: true, LineWidth: 10},
+		{SingleLine: true},
+	}
+	for _, opt := range styles {
+		for _, input := range inputs {
+			str := StringWithOptions(input, opt)
+			got, err := Eval(str, reflect.TypeOf(input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got.Interface(), input) {
+				t.Errorf("round trip mismatch\ninput: %q\ngot:   %q\nsource: %s", input, got.Interface(), str)
+			}
+		}
+	}
+}
+
+func TestASCIIOnly(t *testing.T) {
+	tests := []struct {
+		name  string
+		input interface{}
+		opt   *Options
+	}{
+		{name: "string", input: "café 😀"},
+		{name: "raw", input: `"naïve" quotes`},
+		{name: "ascii_raw", input: `"plain" quotes`},
+		{name: "chunked", input: "héllo wörld héllo wörld", opt: &Options{ChunkStrings: true, LineWidth: 10}},
+		{name: "map", input: map[string]string{"clé": "valeur", "key": "value"}},
+		{name: "rune", input: 'é', opt: &Options{Runes: true}},
+		{name: "runes", input: []rune("世界"), opt: &Options{Runes: true}},
+	}
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.name, func(t *testing.T) {
+			opt := Options{}
+			if tst.opt != nil {
+				opt = *tst.opt
+			}
+			opt.ASCIIOnly = true
+			got := StringWithOptions(tst.input, &opt)
+			autogold.Equal(t, got)
+		})
+	}
+}
+
+func TestRunes(t *testing.T) {
+	type char rune
+	type runes []rune
+	r := 'x'
+	tests := []struct {
+		name  string
+		input interface{}
+	}{
+		{name: "rune", input: 'A'},
+		{name: "rune_escaped", input: '\n'},
+		{name: "rune_unprintable", input: rune(0x7)},
+		{name: "rune_named", input: char('B')},
+		{name: "rune_pointer", input: &r},
+		{name: "runes", input: []rune("hello, 世界")},
+		{name: "runes_named", input: runes("hello")},
+		{name: "runes_named_elem", input: []char{'a', 'b'}},
+		{name: "runes_unprintable", input: []rune{'a', 0x7}},
+		{
+			name: "struct",
+			input: struct {
+				Sep    rune
+				Quotes []rune
+			}{Sep: ',', Quotes: []rune(`"'`)},
+		},
+	}
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.name, func(t *testing.T) {
+			got := StringWithOptions(tst.input, &Options{Runes: true})
+			autogold.Equal(t, got)
+		})
+	}
+}
+
+func TestIntBase(t *testing.T) {
+	type mask uint32
+	input := struct {
+		Mode   os.FileMode
+		Mask   mask
+		Hash   uint64
+		Offset int
+		Min    int64
+		Flags  []uint8
+	}{
+		Mode:   0o755,
+		Mask:   0xdeadbeef,
+		Hash:   0xcbf29ce484222325,
+		Offset: -16,
+		Min:    math.MinInt64,
+		Flags:  []uint8{0b101, 0b11},
+	}
+	got := StringWithOptions(input, &Options{
+		IntBase: func(t reflect.Type) int {
+			switch t {
+			case reflect.TypeOf(os.FileMode(0)):
+				return 8
+			case reflect.TypeOf(mask(0)), reflect.TypeOf(uint64(0)), reflect.TypeOf(int64(0)):
+				return 16
+			case reflect.TypeOf(uint8(0)):
+				return 2
+			}
+			return 0
+		},
+	})
+	autogold.Equal(t, got)
+}
+
+func TestFloatFormat(t *testing.T) {
+	type celsius float64
+	input := struct {
+		A float32
+		B float64
+		C float64
+		D float64
+		E float32
+		F float64
+		G celsius
+		H []float64
+	}{
+		A: 0.1,
+		B: 1e21,
+		C: 1.5e-7,
+		D: math.Inf(-1),
+		E: float32(math.NaN()),
+		F: math.NaN(),
+		G: celsius(math.Inf(1)),
+		H: []float64{math.MaxFloat64, math.SmallestNonzeroFloat64},
+	}
+	tests := []struct {
+		name string
+		opt  *Options
+	}{
+		{name: "shortest", opt: &Options{FloatFormat: FloatFormatShortest}},
+		{name: "decimal", opt: &Options{FloatFormat: FloatFormatDecimal, LineWidth: 1000}},
+	}
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.name, func(t *testing.T) {
+			got := StringWithOptions(input, tst.opt)
+			autogold.Equal(t, got)
+		})
+	}
+}
+
+func TestDurations(t *testing.T) {
+	d := 90 * time.Second
+	tests := []struct {
+		name  string
+		input interface{}
+	}{
+		{name: "zero", input: time.Duration(0)},
+		{name: "second", input: time.Second},
+		{name: "compound", input: 2*time.Hour + 30*time.Minute + 15*time.Millisecond + 3},
+		{name: "negative", input: -5 * time.Minute},
+		{name: "negative_compound", input: -(time.Minute + 30*time.Second)},
+		{name: "min", input: time.Duration(math.MinInt64)},
+		{name: "pointer", input: &d},
+		{name: "named", input: test.Timeout(2*time.Hour + 30*time.Minute)},
+		{name: "named_zero", input: test.Timeout(0)},
+		{
+			name: "struct",
+			input: struct {
+				Timeout, Interval time.Duration
+			}{Timeout: 30 * time.Second, Interval: 500 * time.Millisecond},
+		},
+	}
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.name, func(t *testing.T) {
+			got := StringWithOptions(tst.input, &Options{Durations: true})
+			autogold.Equal(t, got)
+		})
+	}
+}
+
+func TestElideBytes(t *testing.T) {
+	type blob []byte
+	input := struct {
+		Zeros  []byte
+		Image  []byte
+		Named  blob
+		Small  []byte
+		Random []byte
+	}{
+		Zeros:  make([]byte, 1<<20),
+		Image:  bytes.Repeat([]byte{0xff}, 2048),
+		Named:  blob(bytes.Repeat([]byte{'a'}, 16)),
+		Small:  []byte{1, 1},
+		Random: []byte("not all the same bytes"),
+	}
+	tests := []struct {
+		name string
+		opt  *Options
+	}{
+		{
+			name: "repeated",
+			opt:  &Options{ElideBytes: ElideRepeatedBytes, ElideBytesThreshold: 8},
+		},
+		{
+			name: "hash",
+			opt:  &Options{ElideBytes: ElideBytesWithHash, ElideBytesThreshold: 8},
+		},
+		{
+			name: "default_threshold",
+			opt:  &Options{ElideBytes: ElideBytesWithHash},
+		},
+	}
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.name, func(t *testing.T) {
+			got := StringWithOptions(input, tst.opt)
+			autogold.Equal(t, got)
+		})
+	}
+
+	res, err := AST(reflect.ValueOf(input.Zeros), &Options{ElideBytes: ElideRepeatedBytes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(res.Packages, []string{"bytes"}) {
+		t.Fatalf("unexpected packages %q", res.Packages)
+	}
+}
+
+func TestExtractFiles(t *testing.T) {
+	type asset string
+	input := struct {
+		Name  string
+		Image []byte
+		Text  asset
+		Small []byte
+	}{
+		Name:  "example",
+		Image: bytes.Repeat([]byte{0x89, 'P', 'N', 'G'}, 64),
+		Text:  asset(strings.Repeat("hello world\n", 32)),
+		Small: []byte{1, 2, 3},
+	}
+	dir := t.TempDir()
+	opt := &Options{ExtractFiles: &ExtractFiles{
+		Dir:       dir,
+		Threshold: 128,
+		FuncName:  "testutil.MustReadFile",
+	}}
+	got := StringWithOptions(input, opt)
+	got = strings.ReplaceAll(got, filepath.ToSlash(dir), "$DIR")
+	autogold.Equal(t, got)
+
+	res, err := AST(reflect.ValueOf(input), opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(dir, "blob_01.bin"), filepath.Join(dir, "blob_02.bin")}
+	if !reflect.DeepEqual(res.ExtractedFiles, want) {
+		t.Fatalf("unexpected extracted files %q", res.ExtractedFiles)
+	}
+	for i, wantData := range [][]byte{input.Image, []byte(input.Text)} {
+		data, err := os.ReadFile(res.ExtractedFiles[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, wantData) {
+			t.Fatalf("unexpected contents of %s", res.ExtractedFiles[i])
+		}
+	}
+}
+
+func exampleFunc(s string) string { return s }
+
+func TestFuncs(t *testing.T) {
+	type handler func(s string) string
+	closure := func(s string) string { return s }
+	upper := strings.ToUpper
+	tests := []struct {
+		name  string
+		input interface{}
+		opt   *Options
+	}{
+		{name: "nil", input: (func())(nil)},
+		{name: "stdlib", input: strings.ToUpper},
+		{name: "external_package", input: test.NewFoo},
+		{
+			name:  "same_package",
+			input: exampleFunc,
+			opt:   &Options{PackageName: "valast", PackagePath: "github.com/hexops/valast"},
+		},
+		{name: "unexported", input: exampleFunc},
+		{name: "unexported_exported_only", input: exampleFunc, opt: &Options{ExportedOnly: true}},
+		{name: "named_type", input: handler(strings.ToUpper)},
+		{name: "pointer", input: &upper},
+		{
+			name: "struct",
+			input: struct {
+				A, B handler
+				C    func(string) string
+			}{A: strings.ToLower, C: strings.TrimSpace},
+		},
+		{name: "closure", input: closure},
+		{name: "closure_nil", input: closure, opt: &Options{FuncPolicy: FuncPolicyNil}},
+		{name: "closure_stub", input: closure, opt: &Options{FuncPolicy: FuncPolicyStub}},
+		{name: "closure_stub_named", input: handler(closure), opt: &Options{FuncPolicy: FuncPolicyStub}},
+		{name: "method_value", input: time.Time{}.String, opt: &Options{FuncPolicy: FuncPolicyNil}},
+	}
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.name, func(t *testing.T) {
+			got := StringWithOptions(tst.input, tst.opt)
+			autogold.Equal(t, got)
+		})
+	}
+}
+
+func TestSparseArrays(t *testing.T) {
+	var table [256]byte
+	table['\t'], table['\n'], table[' '] = 1, 1, 1
+	tests := []struct {
+		name  string
+		input interface{}
+	}{
+		{name: "lookup_table", input: table},
+		{name: "dense", input: [4]int{1, 0, 2, 3}},
+		{name: "zero", input: [8]string{}},
+		{name: "structs", input: [6]struct{ A, B int }{2: {A: 1}, 5: {B: 2}}},
+	}
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.name, func(t *testing.T) {
+			got := StringWithOptions(tst.input, &Options{SparseArrays: true})
+			autogold.Equal(t, got)
+		})
+	}
+}
+
+func TestRepeatedElements(t *testing.T) {
+	var ones [4096]byte
+	for i := range ones {
+		ones[i] = 0xff
+	}
+	type point struct{ X, Y int }
+	type points []point
+	tests := []struct {
+		name  string
+		input interface{}
+		opt   *Options
+	}{
+		{name: "array", input: ones, opt: &Options{RepeatedElements: 64}},
+		{name: "zero_array", input: [4096]byte{}, opt: &Options{RepeatedElements: 64}},
+		{name: "slice", input: points{{X: 1, Y: 2}, {X: 1, Y: 2}, {X: 1, Y: 2}}, opt: &Options{RepeatedElements: 3}},
+		{name: "zero_slice", input: make([]string, 100), opt: &Options{RepeatedElements: 64}},
+		{name: "pointers", input: []*point{{X: 1}, {X: 1}, {X: 1}}, opt: &Options{RepeatedElements: 2}},
+		{name: "nested", input: struct{ Rows [][4]int }{Rows: [][4]int{{7, 7, 7, 7}, {7, 7, 7, 7}}}, opt: &Options{RepeatedElements: 2}},
+		{name: "too_short", input: []int{1, 1}, opt: &Options{RepeatedElements: 3}},
+		{name: "different", input: []int{1, 1, 2}, opt: &Options{RepeatedElements: 2}},
+		{name: "single_line", input: [3]int{5, 5, 5}, opt: &Options{RepeatedElements: 2, SingleLine: true}},
+	}
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.name, func(t *testing.T) {
+			got := StringWithOptions(tst.input, tst.opt)
+			autogold.Equal(t, got)
+		})
+	}
+}
+
+func TestMapLayout(t *testing.T) {
+	input := map[string]int{
+		"apple":   1,
+		"avocado": 2,
+		"banana":  30,
+		"cherry":  400,
+		"coconut": 5000,
+	}
+	tests := []struct {
+		name  string
+		input interface{}
+		opt   *Options
+	}{
+		{
+			name:  "multiline_small",
+			input: map[string]int{"a": 1, "bb": 2},
+			opt:   &Options{MultilineMaps: true},
+		},
+		{
+			name:  "multiline_nested",
+			input: map[string][]int{"a": {1, 2}, "bb": nil},
+			opt:   &Options{MultilineMaps: true},
+		},
+		{
+			name:  "grouped",
+			input: input,
+			opt: &Options{GroupMapEntries: func(key reflect.Value) string {
+				return key.String()[:1]
+			}},
+		},
+		{
+			name:  "empty",
+			input: map[string]int{},
+			opt:   &Options{MultilineMaps: true},
+		},
+		{
+			name:  "marker_in_string",
+			input: map[string]string{"/*valast:newline*/": "/*valast:blankline*/"},
+		},
+	}
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.name, func(t *testing.T) {
+			got := StringWithOptions(tst.input, tst.opt)
+			autogold.Equal(t, got)
+		})
+	}
+}
+
+type registeredColor struct {
+	r, g, b uint8
+}
+
+func TestRegister(t *testing.T) {
+	Register(func(v registeredColor) (ast.Expr, []string, error) {
+		return &ast.CallExpr{
+			Fun: &ast.SelectorExpr{X: ast.NewIdent("color"), Sel: ast.NewIdent("RGB")},
+			Args: []ast.Expr{
+				ast.NewIdent(fmt.Sprint(v.r)),
+				ast.NewIdent(fmt.Sprint(v.g)),
+				ast.NewIdent(fmt.Sprint(v.b)),
+			},
+		}, []string{"example.com/color"}, nil
+	})
+	input := struct {
+		Foreground registeredColor
+		Background *registeredColor
+		Palette    []registeredColor
+	}{
+		Foreground: registeredColor{r: 255},
+		Background: &registeredColor{g: 128, b: 64},
+		Palette:    []registeredColor{{r: 1}, {g: 2}},
+	}
+	tests := []struct {
+		name       string
+		unexported bool
+		opt        *Options
+	}{
+		{name: "registered", opt: &Options{}},
+		{name: "ignore_registered", unexported: true, opt: &Options{IgnoreRegistered: true}},
+	}
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.name, func(t *testing.T) {
+			if tst.unexported {
+				requireUnexported(t)
+			}
+			got := StringWithOptions(input, tst.opt)
+			autogold.Equal(t, got)
+		})
+	}
+
+	res, err := AST(reflect.ValueOf(input.Foreground), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(res.Packages, []string{"example.com/color", "github.com/hexops/valast"}) {
+		t.Fatalf("unexpected packages %q", res.Packages)
+	}
+}
+
+type presetID int
+
+func TestPreset(t *testing.T) {
+	Register(func(v registeredColor) (ast.Expr, []string, error) {
+		return ast.NewIdent("registered"), nil, nil
+	})
+	preset := Handle(&Preset{}, func(v registeredColor) (ast.Expr, []string, error) {
+		return &ast.CallExpr{
+			Fun:  &ast.SelectorExpr{X: ast.NewIdent("color"), Sel: ast.NewIdent("Gray")},
+			Args: []ast.Expr{ast.NewIdent(fmt.Sprint(v.r))},
+		}, []string{"example.com/color"}, nil
+	})
+	preset.HandleType(reflect.TypeOf(presetID(0)), func(v reflect.Value) (ast.Expr, []string, error) {
+		return ast.NewIdent(fmt.Sprintf("id%d", v.Int())), nil, nil
+	})
+	input := struct {
+		Color registeredColor
+		ID    presetID
+	}{
+		Color: registeredColor{r: 128},
+		ID:    7,
+	}
+	tests := []struct {
+		name string
+		opt  *Options
+	}{
+		{name: "registered", opt: &Options{}},
+		{name: "preset", opt: (&Options{}).Use(preset)},
+		{name: "preset_ignore_registered", opt: (&Options{IgnoreRegistered: true}).Use(preset)},
+		{name: "later_preset_wins", opt: (&Options{}).Use(preset, Handle(&Preset{}, func(v registeredColor) (ast.Expr, []string, error) {
+			return ast.NewIdent("later"), nil, nil
+		}))},
+	}
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.name, func(t *testing.T) {
+			got := StringWithOptions(input, tst.opt)
+			autogold.Equal(t, got)
+		})
+	}
+}
+
+func TestOptions(t *testing.T) {
+	requireUnexported(t)
+	preset := &Preset{}
+	defaults := NewOptions(WithPackage("test", "github.com/hexops/valast/internal/test"), WithMaxDepth(3)).Use(preset)
+	if defaults.PackageName != "test" || defaults.PackagePath != "github.com/hexops/valast/internal/test" || defaults.MaxDepth != 3 {
+		t.Fatalf("unexpected options %+v", defaults)
+	}
+
+	merged := defaults.Merge(&Options{MaxDepth: 5, LineWidth: 80}).With(WithExportedOnly())
+	if merged.PackageName != "test" || merged.MaxDepth != 5 || merged.LineWidth != 80 || !merged.ExportedOnly {
+		t.Fatalf("unexpected merged options %+v", merged)
+	}
+	if defaults.MaxDepth != 3 || defaults.LineWidth != 0 || defaults.ExportedOnly {
+		t.Fatal("Merge modified the receiver")
+	}
+
+	clone := defaults.Clone().Use(&Preset{})
+	if len(defaults.Presets) != 1 || len(clone.Presets) != 2 || clone.Presets[0] != preset {
+		t.Fatal("Clone shares Presets with the receiver")
+	}
+	if got := (*Options)(nil).Merge(nil); !reflect.DeepEqual(got, &Options{}) {
+		t.Fatalf("unexpected options %+v", got)
+	}
+
+	autogold.Equal(t, StringWithOptions(test.NewBaz(), merged))
+
+	if got, want := String(test.NewBaz(), WithPackage("test", "github.com/hexops/valast/internal/test"), WithMaxDepth(5), WithExportedOnly()), StringWithOptions(test.NewBaz(), merged); got != want {
+		t.Fatalf("String with options: got %q, want %q", got, want)
+	}
+}
+
+func TestDefaultOptions(t *testing.T) {
+	t.Cleanup(func() { SetDefaultOptions(nil) })
+	input := []int{1, 2, 3, 4, 5}
+	opt := &Options{MaxElements: 2}
+	SetDefaultOptions(opt)
+	opt.MaxElements = 3
+	if got := DefaultOptions(); got.MaxElements != 2 {
+		t.Fatalf("SetDefaultOptions did not copy the options, got %+v", got)
+	}
+	DefaultOptions().MaxElements = 4
+	if got := DefaultOptions(); got.MaxElements != 2 {
+		t.Fatalf("DefaultOptions did not copy the options, got %+v", got)
+	}
+
+	want := StringWithOptions(input, &Options{MaxElements: 2})
+	for name, got := range map[string]string{
+		"String":                 String(input),
+		"StringWithOptions(nil)": StringWithOptions(input, nil),
+		"Formatter":              fmt.Sprintf("%+v", Formatter(input)),
+	} {
+		if got != want {
+			t.Errorf("%s: got %q, want %q", name, got, want)
+		}
+	}
+	if got, want := String(input, WithExportedOnly()), StringWithOptions(input, &Options{MaxElements: 2, ExportedOnly: true}); got != want {
+		t.Errorf("String with options: got %q, want %q", got, want)
+	}
+	if got, want := StringWithOptions(input, &Options{}), "[]int{1, 2, 3, 4, 5}"; got != want {
+		t.Errorf("StringWithOptions: got %q, want %q", got, want)
+	}
+
+	SetDefaultOptions(nil)
+	if got, want := String(input), "[]int{1, 2, 3, 4, 5}"; got != want {
+		t.Errorf("String after reset: got %q, want %q", got, want)
+	}
+}
+
+func TestHelperDecls(t *testing.T) {
+	siblings := &test.ComplexNode{}
+	siblings.Child = &test.ComplexNodeChild{Parent: siblings}
+	siblings.Child.Siblings = []*test.ComplexNode{siblings, {Right: siblings}}
+
+	ones := [8]byte{1, 1, 1, 1, 1, 1, 1, 1}
+	tests := []struct {
+		name  string
+		input interface{}
+		opt   *Options
+	}{
+		{name: "cycle", input: siblings, opt: &Options{OnCycle: CyclePolicyVariables}},
+		{name: "identical", input: struct{ A, B [8]byte }{A: ones, B: ones}, opt: &Options{RepeatedElements: 4}},
+		{name: "nested", input: [4][8]byte{ones, ones, ones, ones}, opt: &Options{RepeatedElements: 4}},
+		{name: "none", input: []int{1, 2}, opt: &Options{RepeatedElements: 4}},
+	}
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.name, func(t *testing.T) {
+			opt := tst.opt.With(func(o *Options) { o.HelperFuncPrefix = "helper" })
+			r, err := AST(reflect.ValueOf(tst.input), opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := FormatExpr(&buf, r.AST, nil); err != nil {
+				t.Fatal(err)
+			}
+			for _, decl := range r.Decls {
+				buf.WriteString("\n\n")
+				if err := format.Node(&buf, token.NewFileSet(), decl); err != nil {
+					t.Fatal(err)
+				}
+			}
+			autogold.Equal(t, buf.String())
+
+			if got, want := StringWithOptions(tst.input, opt), StringWithOptions(tst.input, tst.opt); got != want {
+				t.Fatalf("StringWithOptions: got %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+type builderRequest struct {
+	Method  string
+	URL     string
+	Headers map[string]string
+	timeout time.Duration
+	Retries int
+}
+
+func TestBuilder(t *testing.T) {
+	request := builderRequest{
+		Method:  "GET",
+		URL:     "https://example.com",
+		Headers: map[string]string{"Accept": "text/plain"},
+		timeout: 5 * time.Second,
+	}
+	tests := []struct {
+		name       string
+		unexported bool
+		input      interface{}
+		builder    Builder
+	}{
+		{
+			name:       "value",
+			unexported: true,
+			input:      request,
+			builder:    Builder{New: "NewRequest", Args: []string{"Method"}, Build: "Build"},
+		},
+		{
+			name:       "pointer",
+			unexported: true,
+			input:      []*builderRequest{&request, {Method: "POST", Retries: 3}, nil},
+			builder: Builder{
+				New:     "NewRequest",
+				Args:    []string{"Method", "URL"},
+				Methods: map[string]string{"Retries": "MaxRetries"},
+				Prefix:  "Set",
+				Ptr:     true,
+			},
+		},
+		{
+			name:    "pointer_from_value",
+			input:   &builderRequest{},
+			builder: Builder{New: "NewRequest", Build: "Build"},
+		},
+		{
+			name:    "value_from_pointer",
+			input:   builderRequest{Retries: 1},
+			builder: Builder{New: "NewRequest", Ptr: true},
+		},
+	}
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.name, func(t *testing.T) {
+			if tst.unexported {
+				requireUnexported(t)
+			}
+			opt := (&Options{}).Use(HandleBuilder[builderRequest](&Preset{}, tst.builder))
+			autogold.Equal(t, StringWithOptions(tst.input, opt))
+		})
+	}
+}
+
+type renderedID int
+
+func (id renderedID) RenderValast(opt *Options) (ast.Expr, error) {
+	return &ast.CallExpr{
+		Fun:  &ast.SelectorExpr{X: ast.NewIdent("ids"), Sel: ast.NewIdent("MustParse")},
+		Args: []ast.Expr{ast.NewIdent(strconv.Quote(fmt.Sprintf("id-%04d", int(id))))},
+	}, nil
+}
+
+type renderedPtr struct{ name string }
+
+func (p *renderedPtr) RenderValast(opt *Options) (ast.Expr, error) {
+	return &ast.CallExpr{
+		Fun:  ast.NewIdent("newRenderedPtr"),
+		Args: []ast.Expr{ast.NewIdent(strconv.Quote(p.name))},
+	}, nil
+}
+
+type invalidRendered struct{}
+
+func (invalidRendered) RenderValast(opt *Options) (ast.Expr, error) {
+	return ast.NewIdent("1 +"), nil
+}
+
+type stringRenderedPoint struct{ x, y int }
+
+func (p stringRenderedPoint) ValastString() string {
+	return fmt.Sprintf("geom.Pt(%d, %d)", p.x, p.y)
+}
+
+type stringRenderedInvalid struct{}
+
+func (stringRenderedInvalid) ValastString() string { return "geom.Pt(" }
+
+func TestRenderer(t *testing.T) {
+	id := renderedID(7)
+	tests := []struct {
+		name       string
+		unexported bool
+		input      interface{}
+	}{
+		{name: "value", input: renderedID(42)},
+		{name: "pointer_to_value", input: &id},
+		{name: "pointer_receiver", input: &renderedPtr{name: "foo"}},
+		{name: "pointer_receiver_nil", input: (*renderedPtr)(nil)},
+		{name: "pointer_receiver_value", unexported: true, input: renderedPtr{name: "foo"}},
+		{name: "string_renderer", input: []stringRenderedPoint{{x: 1, y: 2}, {x: 3}}},
+		{name: "string_renderer_pointer", input: &stringRenderedPoint{x: 1, y: 2}},
+		{name: "string_renderer_invalid", input: stringRenderedInvalid{}},
+		{
+			name: "struct",
+			input: struct {
+				IDs   []renderedID
+				Owner interface{}
+			}{IDs: []renderedID{1, 2}, Owner: &renderedPtr{name: "bar"}},
+		},
+	}
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.name, func(t *testing.T) {
+			if tst.unexported {
+				requireUnexported(t)
+			}
+			got := String(tst.input)
+			autogold.Equal(t, got)
+		})
+	}
+}
+
+type templatePoint struct{ X, Y int }
+
+func TestTemplates(t *testing.T) {
+	point := reflect.TypeOf(templatePoint{})
+	tests := []struct {
+		name      string
+		input     interface{}
+		templates map[reflect.Type]string
+	}{
+		{
+			name:      "value",
+			input:     templatePoint{X: 1, Y: 2},
+			templates: map[reflect.Type]string{point: `geom.Pt({{.X}}, {{.Y}})`},
+		},
+		{
+			name:      "nested",
+			input:     map[string][]templatePoint{"a": {{X: 1}, {Y: 2}}},
+			templates: map[reflect.Type]string{point: `geom.Pt({{.X}}, {{.Y}})`},
+		},
+		{
+			name:      "pointer",
+			input:     &templatePoint{X: 1, Y: 2},
+			templates: map[reflect.Type]string{point: `geom.Pt({{.X}}, {{.Y}})`},
+		},
+		{
+			name:      "quoted",
+			input:     []time.Duration{time.Second, 90 * time.Minute},
+			templates: map[reflect.Type]string{reflect.TypeOf(time.Duration(0)): `mustParseDuration({{printf "%q" .String}})`},
+		},
+		{
+			name:      "renderer_wins",
+			input:     renderedID(42),
+			templates: map[reflect.Type]string{reflect.TypeOf(renderedID(0)): `id({{.}})`},
+		},
+		{
+			name:      "invalid_template",
+			input:     templatePoint{},
+			templates: map[reflect.Type]string{point: `geom.Pt({{.X}`},
+		},
+		{
+			name:      "missing_field",
+			input:     templatePoint{},
+			templates: map[reflect.Type]string{point: `geom.Pt({{.Z}})`},
+		},
+		{
+			name:      "invalid_expression",
+			input:     templatePoint{},
+			templates: map[reflect.Type]string{point: `geom.Pt({{.X}}`},
+		},
+	}
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.name, func(t *testing.T) {
+			got := StringWithOptions(tst.input, &Options{Templates: tst.templates})
+			autogold.Equal(t, got)
+		})
+	}
+}
+
+func TestSourceMap(t *testing.T) {
+	type user struct {
+		Name  string
+		Tags  map[string]bool
+		Roles []string
+	}
+	input := struct {
+		Users []*user
+		Owner interface{}
+	}{
+		Users: []*user{
+			{Name: "alice", Tags: map[string]bool{"admin": true}},
+			{Name: "bob", Roles: []string{"dev", "ops"}},
+		},
+		Owner: "alice",
+	}
+	res, err := AST(reflect.ValueOf(input), &Options{SourceMap: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []string
+	for node, path := range res.SourceMap {
+		var buf bytes.Buffer
+		if err := format.Node(&buf, token.NewFileSet(), node); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, fmt.Sprintf("%q: %s", path, buf.String()))
+	}
+	sort.Strings(entries)
+	autogold.Equal(t, strings.Join(entries, "\n"))
+
+	res, err = AST(reflect.ValueOf(input), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.SourceMap != nil {
+		t.Fatal("expected no source map")
+	}
+}
+
+func TestRedact(t *testing.T) {
+	type token string
+	type credentials struct {
+		User     string
+		Password string `valast:"redact"`
+		APIKey   token
+		Salt     []byte
+	}
+	type request struct {
+		URL         string
+		Credentials *credentials
+		Headers     map[string]string
+		Session     struct{ ID int }
+	}
+	input := request{
+		URL: "https://example.com",
+		Credentials: &credentials{
+			User:     "alice",
+			Password: "hunter2",
+			APIKey:   "sk-123",
+			Salt:     []byte{1, 2, 3},
+		},
+		Headers: map[string]string{"Accept": "text/html"},
+		Session: struct{ ID int }{ID: 42},
+	}
+	tests := []struct {
+		name string
+		opt  *Options
+	}{
+		{name: "tag_only", opt: &Options{}},
+		{
+			name: "func",
+			opt: &Options{
+				Redact: func(path string, field reflect.StructField) bool {
+					return path == ".Credentials.APIKey" || field.Name == "Salt" || field.Name == "Session"
+				},
+				RedactPlaceholder: "REDACTED",
+			},
+		},
+	}
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.name, func(t *testing.T) {
+			got := StringWithOptions(input, tst.opt)
+			autogold.Equal(t, got)
+		})
+	}
+}
+
+type selectModel struct {
+	ID                   int
+	CreatedAt, UpdatedAt int64
+}
+
+type selectUser struct {
+	selectModel
+	Name, Email string
+}
+
+func TestFieldSelection(t *testing.T) {
+	requireUnexported(t)
+	input := []selectUser{{
+		selectModel: selectModel{ID: 1, CreatedAt: 1712345678, UpdatedAt: 1712345679},
+		Name:        "alice",
+		Email:       "alice@example.com",
+	}}
+	tests := []struct {
+		name string
+		opt  *Options
+	}{
+		{name: "exclude", opt: &Options{ExcludeFields: []string{"valast.selectModel.*At"}}},
+		{name: "exclude_any_type", opt: &Options{ExcludeFields: []string{"*.Email", "*.UpdatedAt"}}},
+		{name: "include", opt: &Options{IncludeFields: []string{"valast.selectUser.selectModel", "valast.selectUser.Name", "valast.selectModel.ID"}}},
+		{name: "include_and_exclude", opt: &Options{IncludeFields: []string{"valast.selectUser.*"}, ExcludeFields: []string{"valast.selectUser.Email"}}},
+		{name: "describe_omitted", opt: &Options{ExcludeFields: []string{"valast.selectModel.*At"}, DescribeOmitted: true}},
+		{name: "single_line", opt: &Options{ExcludeFields: []string{"valast.selectModel.*At"}, SingleLine: true}},
+	}
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.name, func(t *testing.T) {
+			got := StringWithOptions(input, tst.opt)
+			autogold.Equal(t, got)
+		})
+	}
+}
+
+func TestDecl(t *testing.T) {
+	type level int
+	values := map[string]interface{}{
+		"MaxRetries": 3,
+		"Name":       "example",
+		"Ratio":      1.5,
+		"Whole":      2.0,
+		"Small":      int8(-4),
+		"Debug":      true,
+		"Level":      level(2),
+		"Timeout":    3 * time.Second,
+	}
+	tests := []struct {
+		name    string
+		values  map[string]interface{}
+		declOpt *DeclOptions
+	}{
+		{name: "var", values: values},
+		{name: "const", values: values, declOpt: &DeclOptions{Const: true}},
+		{name: "explicit", values: values, declOpt: &DeclOptions{ExplicitTypes: true}},
+		{name: "const_explicit", values: values, declOpt: &DeclOptions{Const: true, ExplicitTypes: true}},
+		{
+			name: "var_composite",
+			values: map[string]interface{}{
+				"Names": []string{"a", "b"},
+				"Baz":   &test.Baz{Bam: 1.34, Beta: 42},
+			},
+		},
+		{
+			name:    "const_invalid",
+			values:  map[string]interface{}{"Names": []string{"a", "b"}},
+			declOpt: &DeclOptions{Const: true},
+		},
+		{
+			name:    "const_nan",
+			values:  map[string]interface{}{"NaN": math.NaN()},
+			declOpt: &DeclOptions{Const: true},
+		},
+	}
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			autogold.Equal(t, DeclString(tst.values, tst.declOpt, nil))
+		})
+	}
+}
+
+func TestEval(t *testing.T) {
+	type level int8
+	type record struct {
+		Name    string
+		Level   level
+		Tags    []string
+		Scores  map[string]float32
+		Parent  *record
+		Any     interface{}
+		When    time.Time
+		Timeout time.Duration
+		Data    []byte
+		Grid    [4]int
+		secret  string
+	}
+	roundTrip := []struct {
+		name       string
+		unexported bool
+		input      interface{}
+		opt        *Options
+	}{
+		{name: "int", input: 42},
+		{name: "negative_int8", input: int8(-128)},
+		{name: "uint64_max", input: uint64(math.MaxUint64)},
+		{name: "float", input: 1.25},
+		{name: "float_inf", input: math.Inf(-1)},
+		{name: "complex", input: complex64(1 + 2i)},
+		{name: "string", input: "hello\nworld"},
+		{name: "string_chunked", input: strings.Repeat("abcdefgh ", 20), opt: &Options{ChunkStrings: true, LineWidth: 40}},
+		{name: "rune", input: 'x'},
+		{name: "runes", input: []rune("héllo"), opt: &Options{Runes: true}},
+		{name: "bool", input: true},
+		{name: "nil_ptr", input: (*int)(nil)},
+		{name: "ptr", input: Ptr(3)},
+		{name: "ptr_ptr", input: Ptr(Ptr("x"))},
+		{name: "slice_of_ptrs", unexported: true, input: []*foo{{bar: "a"}, nil}},
+		{name: "map", input: map[string][]int{"a": {1, 2}, "b": {}}},
+		{name: "sparse_array", input: [8]int{1: 5, 7: 2}, opt: &Options{SparseArrays: true}},
+		{name: "repeated_elements", input: [][2]int{{1, 1}, {1, 1}}, opt: &Options{RepeatedElements: 2}},
+		{name: "repeated_zero_elements", input: make([]string, 3), opt: &Options{RepeatedElements: 2}},
+		{name: "interfaces", input: []interface{}{1, "a", 2.5, []string{"b"}, map[string]interface{}{"c": true}, nil}},
+		{name: "duration", input: -(90*time.Minute + 5*time.Millisecond), opt: &Options{Durations: true}},
+		{name: "interface_pointers", input: []*interface{}{Ptr[interface{}]("x"), new(interface{}), nil}, opt: &Options{InterfacePointerStatements: true}},
+		{name: "struct", unexported: true, input: record{
+			Name:    "root",
+			Level:   3,
+			Tags:    []string{"a", "b"},
+			Scores:  map[string]float32{"x": 0.5},
+			Parent:  &record{Name: "parent", secret: "s"},
+			Any:     "any",
+			When:    time.Date(2020, 5, 17, 13, 4, 5, 6, time.UTC),
+			Timeout: 3 * time.Second,
+			Data:    []byte("data"),
+			Grid:    [4]int{1, 2},
+			secret:  "hidden",
+		}},
+	}
+	for _, tst := range roundTrip {
+		t.Run(tst.name, func(t *testing.T) {
+			if tst.unexported {
+				requireUnexported(t)
+			}
+			str := StringWithOptions(tst.input, tst.opt)
+			got, err := Eval(str, reflect.TypeOf(tst.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got.Interface(), tst.input) {
+				t.Fatalf("round trip mismatch\ninput: %#v\ngot:   %#v\nsource: %s", tst.input, got.Interface(), str)
+			}
+		})
+	}
+
+	errors := []struct {
+		name       string
+		unexported bool
+		expr       string
+		typ        reflect.Type
+	}{
+		{name: "overflow", expr: "int8(300)", typ: reflect.TypeOf(int8(0))},
+		{name: "mismatch", expr: `"foo"`, typ: reflect.TypeOf(0)},
+		{name: "unknown_field", expr: "foo{baz: 1}", typ: reflect.TypeOf(foo{})},
+		{name: "function_call", expr: `mustReadFile("blob.bin")`, typ: reflect.TypeOf("")},
+		{name: "named_type_in_interface", expr: `valast.foo{bar: "x"}`, typ: reflect.TypeOf((*interface{})(nil)).Elem()},
+		{name: "syntax", expr: "[]int{", typ: reflect.TypeOf([]int{})},
+		{name: "negate_string", expr: `-"a"`, typ: reflect.TypeOf("")},
+		{name: "not_int", expr: "!1", typ: reflect.TypeOf(false)},
+		{name: "complement_float", expr: "^1.5", typ: reflect.TypeOf(0.0)},
+		{name: "multiply_strings", expr: `"a" * "b"`, typ: reflect.TypeOf("")},
+		{name: "add_bool", expr: "1 + true", typ: reflect.TypeOf(0)},
+		{name: "remainder_float", expr: "1 % 2.5", typ: reflect.TypeOf(0.0)},
+		{name: "and_float", expr: "1.5 & 2", typ: reflect.TypeOf(0)},
+		{name: "huge_slice_index", expr: "[]int{100000000000: 1}", typ: reflect.TypeOf([]int{})},
+		{name: "huge_make", expr: "make([]int, 100000000000)", typ: reflect.TypeOf([]int{})},
+		{name: "huge_array", expr: "[99999999999999999]byte{}", typ: reflect.TypeOf((*interface{})(nil)).Elem()},
+		{name: "slice_map_key", expr: "map[[]int]int{}", typ: reflect.TypeOf((*interface{})(nil)).Elem()},
+		{name: "unhashable_map_key", expr: "map[interface{}]int{[]int{1}: 1}", typ: reflect.TypeOf(map[interface{}]int{})},
+		{name: "duplicate_struct_type_field", expr: "struct{A int; A int}{}", typ: reflect.TypeOf((*interface{})(nil)).Elem()},
+		{name: "duplicate_field", unexported: true, expr: "foo{bar: \"a\", bar: \"b\"}", typ: reflect.TypeOf(foo{})},
+		{name: "duplicate_index", expr: "[]int{1, 0: 2}", typ: reflect.TypeOf([]int{})},
+		{name: "duplicate_map_key", expr: `map[string]int{"a": 1, "a": 2}`, typ: reflect.TypeOf(map[string]int{})},
+	}
+	for _, tst := range errors {
+		t.Run("error_"+tst.name, func(t *testing.T) {
+			if tst.unexported {
+				requireUnexported(t)
+			}
+			_, err := Eval(tst.expr, tst.typ)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			autogold.Equal(t, err.Error())
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	type config struct {
+		Name    string
+		Limits  map[string][]int
+		Value   interface{}
+		Handler func(string) string
+		secret  string
+	}
+	tests := []struct {
+		name       string
+		unexported bool
+		input      interface{}
+		opt        *Options
+	}{
+		{name: "equivalent", input: config{Name: "a", Limits: map[string][]int{"x": {1}}, Value: 2.5}},
+		{name: "nan", input: []float64{math.NaN()}},
+		{name: "nil", input: nil},
+		{
+			name:       "omitted_unexported",
+			unexported: true,
+			input:      ExportedBaz{Bam: 1, zeta: foo{bar: "x"}},
+			opt:        &Options{ExportedOnly: true},
+		},
+		{
+			name:  "nil_func",
+			input: config{Name: "a", Handler: func(s string) string { return s }},
+			opt:   &Options{FuncPolicy: FuncPolicyNil},
+		},
+		{
+			name:       "multiple",
+			unexported: true,
+			input:      config{Name: "a", secret: "s", Value: 1.5},
+			opt: &Options{Redact: func(path string, field reflect.StructField) bool {
+				return path == ".Name" || path == ".secret"
+			}},
+		},
+	}
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			if tst.unexported {
+				requireUnexported(t)
+			}
+			src, err := Verify(tst.input, tst.opt)
+			got := src
+			if err != nil {
+				got += "\n\n" + err.Error()
+			}
+			autogold.Equal(t, got)
+		})
+	}
+}
+
+func TestErrors(t *testing.T) {
+	t.Run("invalid_type", func(t *testing.T) {
+		_, err := AST(reflect.ValueOf(make(chan int)), nil)
+		var target *ErrInvalidType
+		if !errors.As(err, &target) {
+			t.Fatalf("expected *ErrInvalidType, got %v", err)
+		}
+	})
+	t.Run("package_name", func(t *testing.T) {
+		errNotFound := errors.New("not found")
+		_, err := AST(reflect.ValueOf(test.Baz{}), &Options{
+			PackagePathToName: func(path string) (string, error) { return "", errNotFound },
+		})
+		var target *ErrPackageName
+		if !errors.As(err, &target) || target.Path != "github.com/hexops/valast/internal/test" {
+			t.Fatalf("expected *ErrPackageName, got %v", err)
+		}
+		if !errors.Is(err, errNotFound) {
+			t.Fatalf("expected wrapped error, got %v", err)
+		}
+		autogold.Equal(t, err.Error())
+	})
+	t.Run("unexported", func(t *testing.T) {
+		_, err := Verify(test.NewFoo(), &Options{ExportedOnly: true})
+		var target *ErrUnexported
+		if !errors.As(err, &target) {
+			t.Fatalf("expected *ErrUnexported, got %v", err)
+		}
+	})
+	t.Run("format", func(t *testing.T) {
+		_, err := Verify(invalidRendered{}, nil)
+		var target *ErrFormat
+		if !errors.As(err, &target) || target.Unwrap() == nil {
+			t.Fatalf("expected *ErrFormat, got %v", err)
+		}
+	})
+}
+
+func TestHash(t *testing.T) {
+	type secret struct {
+		User     string
+		Password string `valast:"redact"`
+		Note     string
+	}
+	hash := func(t *testing.T, v interface{}, opt *Options) string {
+		t.Helper()
+		h, err := Hash(v, opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	t.Run("rendered", func(t *testing.T) {
+		v := secret{User: "alice", Password: "hunter2"}
+		sum := sha256.Sum256([]byte(String(v)))
+		if got, want := hash(t, v, nil), hex.EncodeToString(sum[:]); got != want {
+			t.Fatalf("got %s, want hash of String %s", got, want)
+		}
+	})
+	t.Run("redacted", func(t *testing.T) {
+		a := hash(t, secret{User: "alice", Password: "hunter2"}, nil)
+		b := hash(t, secret{User: "alice", Password: "letmein"}, nil)
+		if a != b {
+			t.Fatal("expected values differing only in redacted fields to hash equally")
+		}
+	})
+	t.Run("truncated", func(t *testing.T) {
+		opt := &Options{MaxStringLen: 4}
+		a := hash(t, secret{User: "alice", Note: "abcdefgh"}, opt)
+		b := hash(t, secret{User: "alice", Note: "abcdxyzw"}, opt)
+		if a != b {
+			t.Fatal("expected values differing only after truncation to hash equally")
+		}
+		if a == hash(t, secret{User: "alice", Note: "abcdefgh"}, nil) {
+			t.Fatal("expected options to change the hash")
+		}
+	})
+	t.Run("changed", func(t *testing.T) {
+		if hash(t, secret{User: "alice"}, nil) == hash(t, secret{User: "bob"}, nil) {
+			t.Fatal("expected different values to hash differently")
+		}
+	})
+	t.Run("deterministic", func(t *testing.T) {
+		v := map[interface{}]int{"a": 1, 2: 2, true: 3, 4.5: 4}
+		want := hash(t, v, nil)
+		for i := 0; i < 20; i++ {
+			if got := hash(t, v, nil); got != want {
+				t.Fatalf("got %s, want %s", got, want)
+			}
+		}
+	})
+	t.Run("single_line", func(t *testing.T) {
+		v := secret{User: "alice"}
+		sum := sha256.Sum256([]byte(StringWithOptions(v, &Options{SingleLine: true})))
+		if got, want := hash(t, v, &Options{SingleLine: true}), hex.EncodeToString(sum[:]); got != want {
+			t.Fatalf("got %s, want %s", got, want)
+		}
+	})
+	t.Run("error", func(t *testing.T) {
+		if _, err := Hash(make(chan int), nil); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
+
+func TestPartial(t *testing.T) {
+	type job struct {
+		Name    string
+		Done    chan struct{}
+		Retries int
+		Hooks   []func()
+	}
+	input := []job{
+		{Name: "a", Done: make(chan struct{}), Retries: 3},
+		{Name: "b", Hooks: []func(){func() {}}},
+	}
+	t.Run("string", func(t *testing.T) {
+		autogold.Equal(t, StringWithOptions(input, &Options{Partial: true}))
+	})
+	t.Run("error", func(t *testing.T) {
+		res, err := AST(reflect.ValueOf(input), &Options{Partial: true})
+		var partial *ErrPartial
+		if !errors.As(err, &partial) || res.AST == nil {
+			t.Fatalf("expected *ErrPartial and partial result, got %v", err)
+		}
+		var invalidType *ErrInvalidType
+		if !errors.As(err, &invalidType) {
+			t.Fatalf("expected wrapped *ErrInvalidType, got %v", err)
+		}
+		autogold.Equal(t, err.Error())
+	})
+	t.Run("disabled", func(t *testing.T) {
+		if _, err := AST(reflect.ValueOf(input), nil); err == nil {
+			t.Fatal("expected error without Options.Partial")
+		}
+	})
+}
+
+func TestASTContext(t *testing.T) {
+	input := make([][]int, 100)
+	for i := range input {
+		input[i] = make([]int, 100)
+	}
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := ASTContext(ctx, reflect.ValueOf(input), &Options{Partial: true})
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+	})
+	t.Run("deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+		defer cancel()
+		<-ctx.Done()
+		_, err := ASTContext(ctx, reflect.ValueOf(input), nil)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+		}
+	})
+	t.Run("background", func(t *testing.T) {
+		res, err := ASTContext(context.Background(), reflect.ValueOf(input[:1]), nil)
+		if err != nil || res.AST == nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+	})
+}
+
+func TestConverter(t *testing.T) {
+	var lookups int
+	opt := &Options{
+		PackagePathToName: func(path string) (string, error) {
+			lookups++
+			return DefaultPackagePathToName(path)
+		},
+	}
+	c := NewConverter(opt)
+	values := []interface{}{
+		test.NewBaz(),
+		[]*test.Baz{test.NewBaz(), {Bam: 2}},
+		map[string]test.Baz{"a": {Bam: 3}},
+	}
+	var got []string
+	for _, v := range values {
+		got = append(got, c.String(v))
+	}
+	if lookups != 1 {
+		t.Fatalf("expected the converter to look up the package name once, got %v lookups", lookups)
+	}
+	for i, v := range values {
+		if want := StringWithOptions(v, opt); got[i] != want {
+			t.Fatalf("got %q, want %q", got[i], want)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := c.Fprint(&buf, []int{1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "[]int{1, 2}\n"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	err := NewConverter(&Options{ExportedOnly: true}).Fprint(&buf, test.NewFoo())
+	var unexported *ErrUnexported
+	if !errors.As(err, &unexported) {
+		t.Fatalf("expected *ErrUnexported, got %v", err)
+	}
+}
+
+func TestTypeNames(t *testing.T) {
+	input := map[string][]*test.Baz{"a": {{Bam: 1}, nil}}
+	bazType := reflect.TypeOf(test.Baz{})
+	resolver := StaticResolver{"example.com/fixtures": "fixtures"}
+	tests := []struct {
+		name string
+		opt  *Options
+	}{
+		{name: "import_path", opt: &Options{TypeNames: map[reflect.Type]string{bazType: "example.com/fixtures.Thing"}, PackageResolver: resolver}},
+		{name: "package_name", opt: &Options{TypeNames: map[reflect.Type]string{bazType: "mypkg.Thing"}}},
+		{name: "unqualified", opt: &Options{TypeNames: map[reflect.Type]string{bazType: "Thing"}}},
+		{name: "own_package", opt: &Options{TypeNames: map[reflect.Type]string{bazType: "example.com/fixtures.Thing"}, PackagePath: "example.com/fixtures", PackageName: "fixtures"}},
+		{name: "invalid", opt: &Options{TypeNames: map[reflect.Type]string{bazType: "example.com/"}}},
+	}
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.name, func(t *testing.T) {
+			res, err := AST(reflect.ValueOf(input), tst.opt)
+			if err != nil {
+				autogold.Equal(t, err.Error())
+				return
+			}
+			autogold.Equal(t, StringWithOptions(input, tst.opt)+"\n\n"+strings.Join(res.Packages, "\n"))
+		})
+	}
+}
+
+func TestPackageResolver(t *testing.T) {
+	const testPath = "github.com/hexops/valast/internal/test"
+	t.Run("static", func(t *testing.T) {
+		opt := &Options{PackageResolver: StaticResolver{testPath: "fixtures"}}
+		if got, want := StringWithOptions(test.Baz{Bam: 1}, opt), "fixtures.Baz{Bam: (1 + 0i)}"; got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+		_, err := AST(reflect.ValueOf(test.Baz{}), &Options{PackageResolver: StaticResolver{}})
+		var target *ErrPackageName
+		if !errors.As(err, &target) || target.Path != testPath {
+			t.Fatalf("expected *ErrPackageName, got %v", err)
+		}
+	})
+	t.Run("precedence", func(t *testing.T) {
+		opt := &Options{
+			PackagePathToName: func(path string) (string, error) { return "byfunc", nil },
+			PackageResolver:   StaticResolver{testPath: "byresolver"},
+		}
+		if got, want := StringWithOptions(test.Baz{}, opt), "byfunc.Baz{}"; got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	})
+	t.Run("caching", func(t *testing.T) {
+		var lookups []string
+		now := time.Unix(0, 0)
+		c := NewCachingResolver(ResolverFunc(func(path string) (string, error) {
+			lookups = append(lookups, path)
+			if path == "invalid" {
+				return "", errors.New("not found")
+			}
+			return guessPackageName(path), nil
+		}), 2, time.Minute)
+		c.now = func() time.Time { return now }
+		resolve := func(path string) {
+			t.Helper()
+			if name, err := c.PackageName(path); err != nil && path != "invalid" {
+				t.Fatal(err)
+			} else if err == nil && name != guessPackageName(path) {
+				t.Fatalf("got %q for %q", name, path)
+			}
+		}
+		resolve("example.com/a")
+		resolve("example.com/b")
+		resolve("example.com/a")
+		resolve("example.com/c") // evicts b, the least recently used
+		resolve("example.com/a")
+		resolve("example.com/b")
+		resolve("invalid")
+		resolve("invalid")
+		now = now.Add(time.Minute)
+		resolve("example.com/b") // expired
+		c.Purge()
+		resolve("example.com/b")
+		autogold.Equal(t, lookups)
+	})
+	t.Run("converter", func(t *testing.T) {
+		c := NewConverter(&Options{PackageResolver: StaticResolver{testPath: "fixtures"}})
+		if got, want := c.String(test.Baz{}), "fixtures.Baz{}"; got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	})
+}
+
+func TestModuleResolver(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":                                "module example.com/app\n\nrequire (\n\texample.com/lib v1.2.0\n\texample.com/Cached v1.0.0\n)\n\nreplace example.com/lib => ./third_party/lib\n",
+		"go-widgets/w.go":                       "package widgets\n",
+		"go-widgets/w_test.go":                  "package widgets_test\n",
+		"constrained/a_test.go":                 "package constrained_test\n",
+		"constrained/b_gen.go":                  "//go:build ignore\n\npackage main\n",
+		"constrained/c.go":                      "package constrained\n",
+		"cmd/tool/main.go":                      "package main\n",
+		"vendor/example.com/vendored/v2/v.go":   "package vend\n",
+		"third_party/lib/sub/s.go":              "package libsub\n",
+		"cache/example.com/!cached@v1.0.0/c.go": "package cachedpkg\n",
+		"nested/dir/.keep":                      "",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("GOMODCACHE", filepath.Join(dir, "cache"))
+	r, err := NewModuleResolver(filepath.Join(dir, "nested", "dir"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, path := range []string{
+		"example.com/app/go-widgets",
+		"example.com/app/constrained",
+		"example.com/app/cmd/tool",
+		"example.com/vendored/v2",
+		"example.com/app/vendor/example.com/vendored/v2",
+		"example.com/lib/sub",
+		"example.com/Cached",
+		"example.com/missing/go-thing/v3",
+		"gopkg.in/yaml.v3",
+	} {
+		name, err := r.PackageName(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, path+": "+name)
+	}
+	autogold.Equal(t, got)
+
+	if _, err := NewModuleResolver(t.TempDir()); err == nil {
+		t.Fatal("expected error for a directory outside of a module")
+	}
+}
+
+func TestTypeExprCache(t *testing.T) {
+	c := NewConverter(&Options{Parallelism: 4})
+	input := make([]interface{}, 2000)
+	for i := range input {
+		input[i] = test.Baz{Bam: complex(float32(i), 0)}
+	}
+	first, err := c.AST(reflect.ValueOf(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached := 0
+	for k := range c.typeExprCache {
+		if k.v == reflect.TypeOf(test.Baz{}) {
+			cached++
+		}
+	}
+	if cached == 0 {
+		t.Fatal("expected the element type to be cached by the parallel conversion")
+	}
+
+	second, err := c.AST(reflect.ValueOf(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	elemType := func(r Result) ast.Expr {
+		return r.AST.(*ast.CompositeLit).Elts[0].(*ast.CompositeLit).Type
+	}
+	if elemType(first) != elemType(second) {
+		t.Fatal("expected the element type expression to be reused across conversions")
+	}
+}
+
+func TestParallelism(t *testing.T) {
+	type row struct {
+		ID    int
+		Name  string
+		Attrs map[string]interface{}
+		Next  *row
+		Done  chan bool
+	}
+	rows := make([]*row, 3000)
+	for i := range rows {
+		rows[i] = &row{ID: i, Name: fmt.Sprint("row-", i), Attrs: map[string]interface{}{"even": i%2 == 0}}
+		if i%1000 == 999 {
+			rows[i].Done = make(chan bool) // cannot be converted
+		}
+	}
+	rows[1].Next = rows[2]
+	index := make(map[int]*row, len(rows))
+	for _, r := range rows {
+		index[r.ID] = r
+	}
+	for _, input := range []interface{}{rows, index} {
+		want, wantErr := AST(reflect.ValueOf(input), &Options{Partial: true, SourceMap: true})
+		got, gotErr := AST(reflect.ValueOf(input), &Options{Partial: true, SourceMap: true, Parallelism: 8})
+		if wantErr.Error() != gotErr.Error() {
+			t.Fatalf("errors differ:\nwant: %v\ngot:  %v", wantErr, gotErr)
+		}
+		wantStr, _ := printExpr(want.AST)
+		gotStr, _ := printExpr(got.AST)
+		if wantStr != gotStr {
+			t.Fatal("output differs")
+		}
+		if len(want.SourceMap) != len(got.SourceMap) || !reflect.DeepEqual(want.Packages, got.Packages) {
+			t.Fatal("source map or packages differ")
+		}
+	}
+}
+
+func TestMaxOutputBytes(t *testing.T) {
+	type entry struct {
+		Key    string
+		Values []int
+		Meta   map[string]*float64
+	}
+	input := make([]entry, 200)
+	for i := range input {
+		input[i] = entry{Key: fmt.Sprint("key-", i), Values: []int{i, i * 2}, Meta: map[string]*float64{"x": Ptr(1.5)}}
+	}
+	size := len(String(input))
+
+	if _, err := AST(reflect.ValueOf(input), &Options{MaxOutputBytes: size * 2}); err != nil {
+		t.Fatalf("unexpected error within budget: %v", err)
+	}
+	for _, opt := range []*Options{
+		{MaxOutputBytes: size / 2},
+		{MaxOutputBytes: size / 2, Partial: true},
+		{MaxOutputBytes: size / 2, Parallelism: 4},
+	} {
+		_, err := AST(reflect.ValueOf(input), opt)
+		var tooLarge *ErrOutputTooLarge
+		if !errors.As(err, &tooLarge) || tooLarge.Limit != size/2 {
+			t.Fatalf("expected *ErrOutputTooLarge, got %v", err)
+		}
+	}
+}
+
+func TestFromJSON(t *testing.T) {
+	type user struct {
+		Name  string   `json:"name"`
+		Age   int      `json:"age"`
+		Tags  []string `json:"tags"`
+		Admin bool     `json:"admin"`
+	}
+	data := []byte(`[{"name": "alice", "age": 31, "tags": ["a", "b"], "admin": true}, {"name": "bob"}]`)
+	tests := []struct {
+		name   string
+		data   []byte
+		target interface{}
+	}{
+		{name: "typed", data: data, target: &[]user{}},
+		{name: "generic", data: data},
+		{name: "invalid_target", data: data, target: []user{}},
+		{name: "invalid_json", data: []byte(`{`), target: &user{}},
+	}
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			got, err := FromJSON(tst.data, tst.target, nil)
+			if err != nil {
+				got = "error: " + err.Error()
+			}
+			autogold.Equal(t, got)
+		})
+	}
+}
+
+func TestWriteGoFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data_gen.go")
+	err := WriteGoFile(path, "data", map[string]interface{}{
+		"Timeout": 3 * time.Second,
+		"Baz":     &test.Baz{Bam: 1.34, Beta: 42},
+		"Names":   []string{"a", "b"},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	autogold.Equal(t, string(got))
+
+	err = WriteGoFile(path, "data", map[string]interface{}{"Bad": make(chan int)}, nil)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if after, _ := os.ReadFile(path); !bytes.Equal(after, got) {
+		t.Fatal("file modified after error")
+	}
+}
+
+func TestWriteGoFile_localPrefix(t *testing.T) {
+	vars := map[string]interface{}{
+		"Timeout": 3 * time.Second,
+		"Baz":     test.Baz{Bam: 1.34},
+		"Edit":    gotextdiff.TextEdit{NewText: "x"},
+	}
+	opt := &Options{LocalPrefix: "example.com/other, github.com/hexops/valast/internal"}
+	path := filepath.Join(t.TempDir(), "data_gen.go")
+	if err := WriteGoFile(path, "data", vars, opt); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	autogold.Equal(t, string(got))
+
+	res, err := AST(reflect.ValueOf([]interface{}{vars["Timeout"], vars["Baz"], vars["Edit"]}), opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var imports []string
+	for _, imp := range res.Imports {
+		imports = append(imports, imp.Group.String()+": "+imp.Path)
+	}
+	autogold.Equal(t, imports, autogold.Name("TestWriteGoFile_localPrefix_imports"))
+}
+
+func TestWriteGoFile_anonymousTypeAliases(t *testing.T) {
+	type point = struct{ X, Y int }
+	items := []struct {
+		Name  string
+		Point point
+		Tags  []struct{ Key, Value string }
+	}{
+		{Name: "a", Point: point{X: 1}, Tags: []struct{ Key, Value string }{{Key: "k", Value: "v"}}},
+		{Name: "b", Point: point{Y: 2}},
+	}
+	src, err := goFile("data", map[string]interface{}{
+		"Items":  items,
+		"Origin": point{},
+		"anon1":  []interface{}{struct{}{}, struct{}{}},
+	}, &Options{AnonymousTypeAliases: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	autogold.Equal(t, string(src))
+}
+
+type dupAddress struct {
+	City, Country string
+}
+
+type dupUser struct {
+	Name    string
+	Home    *dupAddress
+	Work    dupAddress
+	Country string
+}
+
+func dupUsers() []dupUser {
+	return []dupUser{
+		{Name: "a", Home: &dupAddress{City: "Berlin", Country: "Germany"}, Work: dupAddress{City: "Hamburg", Country: "Germany"}, Country: "Germany"},
+		{Name: "b", Home: &dupAddress{City: "Berlin", Country: "Germany"}, Work: dupAddress{City: "Hamburg", Country: "Germany"}, Country: "Germany"},
+		{Name: "c", Home: &dupAddress{City: "Paris", Country: "France"}, Work: dupAddress{City: "Hamburg", Country: "Germany"}},
+	}
+}
+
+func TestDuplicates(t *testing.T) {
+	tests := []struct {
+		name   string
+		minLen int
+	}{
+		{name: "all", minLen: 1},
+		{name: "min_len", minLen: 20},
+		{name: "disabled", minLen: 0},
+	}
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.name, func(t *testing.T) {
+			res, err := AST(reflect.ValueOf(dupUsers()), &Options{PackagePath: "github.com/hexops/valast", MinDuplicateLen: tst.minLen})
+			if err != nil {
+				t.Fatal(err)
+			}
+			autogold.Equal(t, res.Duplicates)
+		})
+	}
+}
+
+func TestWriteGoFile_hoistDuplicates(t *testing.T) {
+	src, err := goFile("valast", map[string]interface{}{
+		"Users":   dupUsers(),
+		"Default": dupAddress{City: "Hamburg", Country: "Germany"},
+		"dup1":    "Germany",
+	}, &Options{PackagePath: "github.com/hexops/valast", MinDuplicateLen: 1, HoistDuplicates: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	autogold.Equal(t, string(src))
+}
+
+func TestUnexportedFieldTypesAsInterface(t *testing.T) {
+	requireUnexported(t)
+	input := []interface{}{test.Anonymous(), test.AnonymousSlice(), test.AnonymousUnexported()}
+	tests := []struct {
+		name string
+		opt  *Options
+	}{
+		{name: "default", opt: &Options{}},
+		{name: "enabled", opt: &Options{UnexportedFieldTypesAsInterface: true}},
+	}
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.name, func(t *testing.T) {
+			res, err := AST(reflect.ValueOf(input), tst.opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var omissions []string
+			for _, o := range res.Omissions {
+				omissions = append(omissions, fmt.Sprintf("%s: %s", o.Path, o.Reason))
+			}
+			autogold.Equal(t, StringWithOptions(input, tst.opt)+"\n\n"+strings.Join(omissions, "\n"))
+		})
+	}
+}
+
+func TestUnexportedAsAny(t *testing.T) {
+	input := []interface{}{
+		test.NewGreeter("a", true),
+		test.NewFoo(),
+		test.Anonymous(),
+		test.NewLeveled("b", 2),
+		&test.Baz{Bam: 1, Beta: test.NewFoo()},
+	}
+	tests := []struct {
+		name       string
+		unexported bool
+		opt        *Options
+	}{
+		{name: "default", unexported: true, opt: &Options{}},
+		{name: "enabled", opt: &Options{UnexportedAsAny: true}},
+	}
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.name, func(t *testing.T) {
+			if tst.unexported {
+				requireUnexported(t)
+			}
+			res, err := AST(reflect.ValueOf(input), tst.opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			omissions := []string{fmt.Sprintf("RequiresUnexported: %v", res.RequiresUnexported)}
+			for _, o := range res.Omissions {
+				omissions = append(omissions, fmt.Sprintf("%s: %s", o.Path, o.Reason))
+			}
+			autogold.Equal(t, StringWithOptions(input, tst.opt)+"\n\n"+strings.Join(omissions, "\n"))
+		})
+	}
+}
+
+func TestSetters(t *testing.T) {
+	settings := &test.Settings{Name: "prod"}
+	settings.SetVerbose(true)
+	account := test.NewAccount(42, "alice")
+	span := &test.Span{}
+	span.SetFrom(2)
+	span.SetEnd(5)
+	tests := []struct {
+		name       string
+		unexported bool
+		input      interface{}
+	}{
+		{name: "constructor", unexported: true, input: test.NewAccount(42, "alice")},
+		{name: "constructor_value", unexported: true, input: *test.NewAccount(42, "alice")},
+		{name: "constructor_zero_arg", unexported: true, input: test.NewAccount(42, "")},
+		{name: "constructor_exported", unexported: true, input: func() *test.Account {
+			v := test.NewAccount(42, "alice")
+			v.Label = "primary"
+			v.SetTags([]string{"admin"})
+			return v
+		}()},
+		{name: "setter", unexported: true, input: settings},
+		{name: "setter_value", unexported: true, input: *settings},
+		{name: "setter_field", unexported: true, input: span},
+		{name: "value_constructor", unexported: true, input: test.NewOpaque("s3cr3t")},
+		{name: "value_constructor_ptr", unexported: true, input: func() *test.Opaque {
+			v := test.NewOpaque("s3cr3t")
+			return &v
+		}()},
+		{name: "nested", unexported: true, input: []*test.Account{account, nil}},
+		{name: "exported_only", input: test.Settings{Name: "prod"}},
+		{name: "unsupported", unexported: true, input: test.NewBaz()},
+	}
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			if tst.unexported {
+				requireUnexported(t)
+			}
+			autogold.Equal(t, StringWithOptions(tst.input, &Options{Setters: true}))
+		})
+	}
+}
+
+func TestPseudonymize(t *testing.T) {
+	type contact struct {
+		Name    string
+		Email   string
+		Notes   string
+		Friends []string
+	}
+	input := []contact{
+		{
+			Name:    "Alice",
+			Email:   "alice@corp.example",
+			Notes:   "last login from 203.0.113.7, then 2001:db8:85a3::8a2e:370:7334",
+			Friends: []string{"Bob"},
+		},
+		{
+			Name:  "Bob",
+			Email: "bob@corp.example",
+			Notes: "cc alice@corp.example",
+		},
+	}
+	opt := &Options{Pseudonymize: &Pseudonymizer{
+		Fields: []*regexp.Regexp{regexp.MustCompile(`\.(Name|Friends\[\d+\])$`)},
+		Values: []*regexp.Regexp{
+			regexp.MustCompile(`[\w.]+@[\w.]+`),
+			regexp.MustCompile(`\d+\.\d+\.\d+\.\d+|[0-9a-f]+:[0-9a-f:]+`),
+		},
+		Salt: "test",
+	}}
+	autogold.Equal(t, StringWithOptions(input, opt))
+
+	res, err := AST(reflect.ValueOf(input), opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Pseudonyms) != 6 {
+		t.Fatalf("expected 6 pseudonyms, got %v", res.Pseudonyms)
+	}
+	if res.Pseudonyms["Bob"] == "" || res.Pseudonyms["Bob"] == "Bob" {
+		t.Fatalf("expected pseudonym for Bob, got %v", res.Pseudonyms)
+	}
+}
+
+func TestAddrInterface(t *testing.T) {
+	var bazer test.Bazer = test.NewBaz()
+	got := AddrInterface(bazer, (*test.Bazer)(nil)).(*test.Bazer)
+	if *got != bazer {
+		t.Fatal("*got != v")
+	}
+}
+
+func TestAddrInterface_golden(t *testing.T) {
+	// Confirms the AddrInterface calls in testdata/TestEdgeCases/ptr_to_* are valid.
+	_ = AddrInterface(&test.Baz{
+		Bam: (1.34 + 0i),
+	}, (*test.Bazer)(nil)).(*test.Bazer)
+
+	_ = AddrInterface(nil, (*test.Bazer)(nil)).(*test.Bazer)
+
+	_ = Addr(AddrInterface(&test.Baz{
+		Bam: (1.34 + 0i),
+	}, (*test.Bazer)(nil)).(*test.Bazer)).(**test.Bazer)
+
+	_ = Addr(AddrInterface(nil, (*test.Bazer)(nil)).(*test.Bazer)).(**test.Bazer)
+
+	_ = Addr(Addr(AddrInterface(nil,
+		(*test.Bazer)(nil)).(*test.Bazer)).(**test.Bazer)).(***test.Bazer)
+}
+
+func TestAddr_AddrInterface(t *testing.T) {
+	var bazer test.Bazer = test.NewBaz()
+	got := Addr(AddrInterface(bazer, (*test.Bazer)(nil)).(*test.Bazer)).(**test.Bazer)
+	if **got != bazer {
+		t.Fatal("*got != v")
+	}
+}
+
+func TestAddr_string(t *testing.T) {
+	got := Addr("hello").(*string)
+	if *got != "hello" {
+		t.Fatal("*got != v")
+	}
+}
+
+func TestAddr_int(t *testing.T) {
+	got := Addr(5).(*int)
+	if *got != 5 {
+		t.Fatal("*got != v")
+	}
+}
+
+func TestAddr_pointer(t *testing.T) {
+	x := 5
+	got := Addr(&x).(**int)
+	if **got != 5 {
+		t.Fatal("*got != v")
 	}
 }
 
@@ -1042,17 +3527,1039 @@ func TestPackages(t *testing.T) {
 	foo := test.NewFoo()
 	res, err := AST(reflect.ValueOf(foo), nil)
 	if err != nil {
-		t.Fatal("error parsing foo for packages", err)
+		t.Fatal("error parsing foo for packages", err)
+	}
+	if len(res.Packages) != 1 {
+		t.Fatal("number of expected packages is 1")
+	}
+	if res.Packages[0] != "github.com/hexops/valast/internal/test" {
+		t.Fatal("unexpected package name detected")
+	}
+}
+
+func TestGuessPackageName(t *testing.T) {
+	for path, want := range map[string]string{
+		"fmt":                           "fmt",
+		"net/http":                      "http",
+		"github.com/hexops/valast":      "valast",
+		"github.com/hexops/autogold/v2": "autogold",
+		"gopkg.in/yaml.v3":              "yaml",
+		"github.com/mattn/go-isatty":    "isatty",
+		"github.com/foo/bar-go":         "bar",
+		"example.com/foo-bar":           "foo_bar",
+		"v2":                            "v2",
+	} {
+		if got := guessPackageName(path); got != want {
+			t.Errorf("guessPackageName(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestHelperPackage(t *testing.T) {
+	requireUnexported(t)
+	str := "hello"
+	input := struct {
+		a *string
+		b *int
+	}{a: &str}
+	tests := []struct {
+		name string
+		opt  *Options
+	}{
+		{
+			name: "default",
+			opt:  &Options{},
+		},
+		{
+			name: "alternative",
+			opt:  &Options{HelperPackage: HelperPackage{Path: "example.com/internal/ptrutil"}},
+		},
+		{
+			name: "alternative_named",
+			opt:  &Options{HelperPackage: HelperPackage{Path: "example.com/internal/ptrutil/v2", Name: "ptrutil"}},
+		},
+	}
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.name, func(t *testing.T) {
+			got := StringWithOptions(input, tst.opt)
+			autogold.Equal(t, got)
+		})
+	}
+
+	res, err := AST(reflect.ValueOf(&str), &Options{HelperPackage: HelperPackage{Path: "example.com/internal/ptrutil"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(res.Packages, []string{"example.com/internal/ptrutil"}) {
+		t.Fatalf("unexpected packages %q", res.Packages)
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	type point struct {
+		X, Y int
+	}
+	a, b := "a", "b"
+	tests := []struct {
+		name  string
+		input interface{}
+	}{
+		{
+			name: "map_interface_keys",
+			input: map[interface{}]string{
+				"foo":       "string",
+				int32(5):    "int32",
+				1.5:         "float64",
+				true:        "bool",
+				point{1, 2}: "struct",
+			},
+		},
+		{
+			name: "map_struct_keys",
+			input: map[point]string{
+				{X: 3, Y: 1}: "c",
+				{X: 1, Y: 2}: "a",
+				{X: 2, Y: 0}: "b",
+				{X: 1, Y: 1}: "d",
+			},
+		},
+		{
+			name: "map_array_keys",
+			input: map[[2]int]bool{
+				{2, 1}: true,
+				{1, 2}: false,
+				{1, 1}: true,
+			},
+		},
+		{
+			name: "map_pointer_keys",
+			input: map[*string]int{
+				&b: 2,
+				&a: 1,
+			},
+		},
+		{
+			name: "map_equal_pointer_keys",
+			input: func() map[*string]string {
+				m := map[*string]string{}
+				for _, v := range []string{"a", "b", "c", "d", "e"} {
+					x := "x"
+					m[&x] = v
+				}
+				return m
+			}(),
+		},
+		{
+			name: "map_nan_keys",
+			input: map[float64]string{
+				math.NaN(): "b",
+				math.NaN(): "a",
+				math.NaN(): "c",
+				1:          "d",
+			},
+		},
+		{
+			name:  "negative_zero",
+			input: []float64{math.Copysign(0, -1), 0},
+		},
+		{
+			name:  "unsafe_pointer",
+			input: unsafe.Pointer(&a),
+		},
+	}
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.name, func(t *testing.T) {
+			opt := &Options{Deterministic: true}
+			got := StringWithOptions(tst.input, opt)
+			for i := 0; i < 10; i++ {
+				if again := StringWithOptions(tst.input, opt); again != got {
+					t.Fatalf("output not deterministic:\n%s\n%s", got, again)
+				}
+			}
+			autogold.Equal(t, got)
+		})
+	}
+}
+
+func TestSortMapKeys(t *testing.T) {
+	input := map[string]int{
+		"low":    1,
+		"high":   3,
+		"medium": 2,
+	}
+	got := StringWithOptions(input, &Options{
+		SortMapKeys: func(keys []reflect.Value) {
+			sort.Slice(keys, func(i, j int) bool {
+				return input[keys[i].String()] > input[keys[j].String()]
+			})
+		},
+	})
+	autogold.Equal(t, got)
+}
+
+func TestInvalidMapKeys(t *testing.T) {
+	type point struct {
+		X, Y float64
+	}
+	type keyed struct {
+		Ch   chan int
+		Name string
+	}
+	tests := []struct {
+		name  string
+		input interface{}
+		opt   *Options
+	}{
+		{name: "nan", input: map[float64]string{math.NaN(): "a", math.NaN(): "b", 1: "c"}},
+		{name: "nan_struct", input: map[point]int{{X: math.NaN(), Y: 1}: 1, {X: math.NaN(), Y: 2}: 2, {X: 1}: 3}},
+		{name: "nan_interface", input: map[interface{}]int{math.NaN(): 1, "a": 2}, opt: &Options{Deterministic: true}},
+		{name: "nan_single_line", input: map[float64]string{math.NaN(): "a", 1: "c"}, opt: &Options{SingleLine: true}},
+		{name: "omit", input: map[float64]string{math.NaN(): "a", 1: "c"}, opt: &Options{OnInvalidMapKey: MapKeyPolicyOmit}},
+		{name: "omit_describe", input: map[float64]string{math.NaN(): "a", math.NaN(): "b", 1: "c"}, opt: &Options{OnInvalidMapKey: MapKeyPolicyOmit, DescribeOmitted: true}},
+		{name: "omit_channel", input: map[keyed]int{{Ch: make(chan int)}: 1, {Name: "a"}: 2}, opt: &Options{OnInvalidMapKey: MapKeyPolicyOmit}},
+		{name: "error", input: map[string]map[float32]int{"a": {float32(math.NaN()): 1}}, opt: &Options{OnInvalidMapKey: MapKeyPolicyError}},
+		{name: "error_channel", input: map[keyed]int{{Ch: make(chan int)}: 1}, opt: &Options{OnInvalidMapKey: MapKeyPolicyError}},
+	}
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.name, func(t *testing.T) {
+			autogold.Equal(t, StringWithOptions(tst.input, tst.opt))
+		})
+	}
+	t.Run("omissions", func(t *testing.T) {
+		res, err := AST(reflect.ValueOf(map[string]map[float64]int{"a": {math.NaN(): 1, 2: 2}}), &Options{OnInvalidMapKey: MapKeyPolicyOmit})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Omissions) != 1 || res.Omissions[0].Path != `["a"][math.NaN()]` || res.Omissions[0].Reason != OmissionInvalidMapKey {
+			t.Fatalf("unexpected omissions %v", res.Omissions)
+		}
+	})
+	t.Run("error_type", func(t *testing.T) {
+		_, err := AST(reflect.ValueOf(map[float64]int{math.NaN(): 1}), &Options{OnInvalidMapKey: MapKeyPolicyError})
+		var invalidKey *ErrInvalidMapKey
+		if !errors.As(err, &invalidKey) || invalidKey.Path != "[math.NaN()]" || !math.IsNaN(invalidKey.Key.(float64)) {
+			t.Fatalf("expected *ErrInvalidMapKey, got %#v", err)
+		}
+	})
+}
+
+func TestPruneEmpty(t *testing.T) {
+	type leaf struct {
+		Tags  []string
+		Attrs map[string]int
+	}
+	type node struct {
+		Name     string
+		Leaf     *leaf
+		Children []*node
+		Parent   *node
+		Count    *int
+		Value    interface{}
+	}
+	cyclic := &node{}
+	cyclic.Parent = cyclic
+	tests := []struct {
+		name  string
+		input interface{}
+	}{
+		{name: "chain", input: &node{Name: "a", Leaf: &leaf{Tags: []string{}, Attrs: map[string]int{}}, Children: []*node{{Leaf: &leaf{}}}}},
+		{name: "nested", input: []*node{{Children: []*node{{Leaf: &leaf{}}}}, {Name: "b"}}},
+		{name: "kept", input: &node{Leaf: &leaf{Tags: []string{""}}, Count: new(int), Value: &leaf{}}},
+		{name: "top_level", input: &node{Leaf: &leaf{}}},
+		{name: "cycle", input: cyclic},
+	}
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.name, func(t *testing.T) {
+			autogold.Equal(t, StringWithOptions(tst.input, &Options{PruneEmpty: true}))
+		})
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	type leaf struct {
+		Tags []string
+	}
+	type record struct {
+		Name   string
+		Count  int32
+		Leaf   *leaf
+		Flags  [8]bool
+		Labels map[string]string
+	}
+	input := []record{{Name: "a", Leaf: &leaf{Tags: []string{}}, Flags: [8]bool{1: true}}, {Count: 2}}
+	for _, profile := range []Profile{ProfileDefault, ProfileMinimal, ProfileExhaustive} {
+		profile := profile
+		t.Run(profile.String(), func(t *testing.T) {
+			autogold.Equal(t, String(input, WithProfile(profile)))
+		})
+	}
+	t.Run("override", func(t *testing.T) {
+		opt := NewOptions(WithProfile(ProfileExhaustive), WithProfile(ProfileMinimal))
+		if opt.IncludeZeroFields || !opt.PruneEmpty || opt.Qualify(reflect.TypeOf(0)) != QualifyNever {
+			t.Fatalf("expected minimal options, got %+v", opt)
+		}
+	})
+}
+
+func TestLineWidth(t *testing.T) {
+	input := []string{"alpha", "beta", "gamma", "delta", "epsilon", "zeta", "eta", "theta", "iota"}
+	tests := []struct {
+		name      string
+		lineWidth int
+	}{
+		{name: "default", lineWidth: 0},
+		{name: "narrow", lineWidth: 20},
+		{name: "wide", lineWidth: 120},
+	}
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.name, func(t *testing.T) {
+			got := StringWithOptions(input, &Options{LineWidth: tst.lineWidth})
+			autogold.Equal(t, got)
+		})
+	}
+}
+
+func TestLineWidth_callArguments(t *testing.T) {
+	// Only the elements of composite literals are split onto multiple lines, not the arguments of
+	// calls within them such as time.Date(...).
+	input := []struct {
+		Name string
+		At   time.Time
+	}{{Name: "launch", At: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)}}
+	autogold.Equal(t, String(input))
+}
+
+func TestIndent(t *testing.T) {
+	type config struct {
+		Name  string
+		Tags  []string
+		Notes string
+	}
+	input := config{
+		Name: "example",
+		Tags: []string{"one", "two", "three", "four", "five", "six", "seven"},
+		Notes: `first line of the notes
+	indented line which must be preserved
+last line`,
+	}
+	tests := []struct {
+		name string
+		opt  *Options
+	}{
+		{name: "spaces", opt: &Options{Indent: "  "}},
+		{name: "prefix", opt: &Options{Prefix: "//"}},
+		{name: "prefix_and_spaces", opt: &Options{Prefix: "    ", Indent: "    "}},
+	}
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.name, func(t *testing.T) {
+			got := StringWithOptions(input, tst.opt)
+			autogold.Equal(t, got)
+		})
+	}
+}
+
+func TestFormatExpr(t *testing.T) {
+	type config struct {
+		Name string
+		Tags []string
+	}
+	input := config{Name: "example", Tags: []string{"one", "two", "three", "four", "five"}}
+	for _, opt := range []*Options{nil, {LineWidth: 20, Indent: "  "}, {SingleLine: true}} {
+		r, err := AST(reflect.ValueOf(input), opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := FormatExpr(&buf, r.AST, opt); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := buf.String(), StringWithOptions(input, opt); got != want {
+			t.Errorf("got %s, want %s", got, want)
+		}
+	}
+
+	a, err := AST(reflect.ValueOf(input), nil)
+	if err != nil {
+		t.Fatal(err)
 	}
-	if len(res.Packages) != 1 {
-		t.Fatal("number of expected packages is 1")
+	b, err := AST(reflect.ValueOf(map[string]int{"retries": 3}), nil)
+	if err != nil {
+		t.Fatal(err)
 	}
-	if res.Packages[0] != "github.com/hexops/valast/internal/test" {
-		t.Fatal("unexpected package name detected")
+	var buf bytes.Buffer
+	call := &ast.CallExpr{Fun: ast.NewIdent("run"), Args: []ast.Expr{a.AST, b.AST}}
+	if err := FormatExpr(&buf, call, nil); err != nil {
+		t.Fatal(err)
+	}
+	autogold.Equal(t, buf.String())
+
+	var formatErr *ErrFormat
+	if err := FormatExpr(&buf, ast.NewIdent("1 +"), nil); !errors.As(err, &formatErr) {
+		t.Fatalf("expected *ErrFormat, got %v", err)
+	}
+}
+
+func TestFormatter(t *testing.T) {
+	type config struct {
+		Name   string
+		Tags   []string
+		Limits map[string]int
+		Owner  struct{ ID, Name string }
+		Notes  string
+	}
+	input := config{
+		Name:   "example",
+		Tags:   []string{"one", "two", "three", "four", "five", "six", "seven"},
+		Limits: map[string]int{"cpu": 2, "memory": 512},
+		Owner:  struct{ ID, Name string }{ID: "u1"},
+		Notes: `first line of the notes
+last line`,
+	}
+	tests := []struct {
+		name   string
+		format string
+		opt    *Options
+	}{
+		{name: "v", format: "%v"},
+		{name: "plus_v", format: "%+v"},
+		{name: "s", format: "%s"},
+		{name: "q", format: "%q"},
+		{name: "bad_verb", format: "%d"},
+		{name: "indent", format: "%v", opt: &Options{Indent: "  "}},
+	}
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.name, func(t *testing.T) {
+			got := fmt.Sprintf(tst.format, FormatterWithOptions(input, tst.opt))
+			autogold.Equal(t, got)
+		})
+	}
+}
+
+// TestSingleLine tests that values written directly by the emitter, see Options.SingleLine, are
+// written the same as the formatted syntax joined onto a single line.
+func TestSingleLine(t *testing.T) {
+	type (
+		point struct{ X, Y int }
+		named string
+		node  struct {
+			Name     string
+			Children []*node
+			Parent   *node
+		}
+	)
+	root := &node{Name: "root"}
+	root.Children = []*node{{Name: "child", Parent: root}}
+	inputs := []interface{}{
+		1,
+		int8(-2),
+		"hello",
+		named("named"),
+		3.5,
+		float32(1.25),
+		math.NaN(),
+		true,
+		nil,
+		[]int{1, 2, 3},
+		[3]string{"a", "", `"quoted"`},
+		[]byte("bytes"),
+		[][]float64{{1}, nil, {2.5, 3}},
+		map[string]int{"b": 2, "a": 1},
+		map[point]string{{X: 1}: "x", {Y: 1}: "y"},
+		map[interface{}]interface{}{1: "one", "two": 2.0, nil: []int{}},
+		point{X: 1},
+		&point{Y: 2},
+		[]*point{nil, {X: 3}},
+		struct {
+			A interface{}
+			B *int
+			C []interface{}
+			D time.Time
+			E error
+			F *time.Duration
+		}{
+			A: int32(4),
+			B: Ptr(5),
+			C: []interface{}{1, "s", uint(2), 2.5, 2.0, point{}, []int(nil)},
+			D: time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC),
+			E: errors.New("failed"),
+			F: Ptr(time.Second),
+		},
+		struct{ Inner struct{ ID, Name string } }{Inner: struct{ ID, Name string }{ID: "u1"}},
+		root,
+		test.NewBaz(),
+		[]test.Bazer{test.NewBaz(), nil},
+		"first line\nsecond line which is long enough to be written as a raw string",
+	}
+	for _, input := range inputs {
+		want := singleLine(StringWithOptions(input, nil))
+		if got := StringWithOptions(input, &Options{SingleLine: true}); got != want {
+			t.Errorf("%#v:\ngot  %s\nwant %s", input, got, want)
+		}
+	}
+}
+
+// TestSingleLine_structType tests that anonymous struct and interface types are written on a single
+// line as gofmt writes them, both by the emitter and when formatting an AST. gofmt only keeps types
+// with a single field on one line.
+func TestSingleLine_structType(t *testing.T) {
+	inputs := []interface{}{
+		struct{ Q string }{Q: "x"},
+		[]struct{ Q string }{{Q: "x"}},
+		map[struct{ Q int }]struct{}{{Q: 1}: {}},
+		struct{ A struct{ Q string } }{},
+		struct{ F interface{ M() } }{},
+	}
+	for _, input := range inputs {
+		emitted := StringWithOptions(input, &Options{SingleLine: true})
+		r, err := AST(reflect.ValueOf(input), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := FormatExpr(&buf, r.AST, &Options{SingleLine: true}); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != emitted {
+			t.Errorf("%#v:\nemitted %s\nAST     %s", input, emitted, buf.String())
+		}
+		src := "package p\n\nvar _ = " + emitted + "\n"
+		if formatted, err := format.Source([]byte(src)); err != nil || string(formatted) != src {
+			t.Errorf("%#v: not as formatted by gofmt: %s", input, emitted)
+		}
+	}
+}
+
+func TestColorize(t *testing.T) {
+	input := struct {
+		Name  string
+		Count int
+		Ratio *float64
+		Tags  map[string]bool
+	}{
+		Name:  "example",
+		Count: 42,
+		Tags:  map[string]bool{"a": true},
+	}
+	opt := &Options{Colorize: true}
+	autogold.Equal(t, StringWithOptions(input, opt))
+	t.Run("formatter", func(t *testing.T) {
+		autogold.Equal(t, fmt.Sprintf("%v %q", FormatterWithOptions(input, opt), FormatterWithOptions(input, opt)))
+	})
+	t.Run("converter", func(t *testing.T) {
+		if got, want := NewConverter(opt).String(input), StringWithOptions(input, opt); got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	})
+}
+
+func TestHTML(t *testing.T) {
+	input := map[string]interface{}{
+		"name":   "<b>example</b>",
+		"count":  42,
+		"ratio":  0.5,
+		"nested": []*int{nil},
+	}
+	got, err := HTML(input, &Options{MaxElements: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	autogold.Equal(t, got)
+}
+
+func TestCommentField(t *testing.T) {
+	type event struct {
+		Name      string
+		CreatedAt int64
+		Labels    map[string]string
+		Note      string
+	}
+	input := []event{
+		{Name: "created", CreatedAt: 1712345678, Labels: map[string]string{"a": "b"}},
+		{Name: "deleted", Note: "quote \" and brace {"},
+	}
+	opt := &Options{
+		CommentField: func(path string, field reflect.StructField, v reflect.Value) string {
+			switch field.Name {
+			case "CreatedAt":
+				return time.Unix(v.Int(), 0).UTC().Format(time.RFC3339)
+			case "Note":
+				return path + ": " + v.String()
+			}
+			return ""
+		},
+	}
+	autogold.Equal(t, StringWithOptions(input, opt))
+	t.Run("single_line", func(t *testing.T) {
+		autogold.Equal(t, fmt.Sprint(FormatterWithOptions(input, opt)))
+	})
+}
+
+func TestDescribeOmitted(t *testing.T) {
+	type Inner struct {
+		Values []int
+	}
+	type secret struct {
+		Value int
+	}
+	type Item struct {
+		Name     string
+		Password string `valast:"redact"`
+		Count    int
+		Ratio    float64
+		Inner    Inner
+		Nested   []Inner
+		Secret   secret
+	}
+	input := []Item{
+		{Name: "a", Password: "hunter2", Count: 1, Secret: secret{Value: 1}, Nested: []Inner{{Values: []int{1}}, {}}},
+		{},
+	}
+	tests := []struct {
+		name string
+		opt  *Options
+	}{
+		{name: "zero", opt: &Options{DescribeOmitted: true}},
+		{name: "exported_only", opt: &Options{DescribeOmitted: true, ExportedOnly: true}},
+		{name: "max_depth", opt: &Options{DescribeOmitted: true, MaxDepth: 2}},
+		{name: "comment_field", opt: &Options{
+			DescribeOmitted: true,
+			CommentField: func(path string, field reflect.StructField, v reflect.Value) string {
+				return field.Type.String()
+			},
+		}},
+	}
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.name, func(t *testing.T) {
+			autogold.Equal(t, StringWithOptions(input, tst.opt))
+		})
+	}
+}
+
+func TestOmissions(t *testing.T) {
+	type secret struct {
+		Value int
+	}
+	type Item struct {
+		Name     string
+		Password string `valast:"redact"`
+		Token    []byte `valast:"redact"`
+		Secret   secret
+		Values   map[string]interface{}
+		Errors   []error
+	}
+	input := []Item{
+		{
+			Name:   "a",
+			Token:  []byte("token"),
+			Secret: secret{Value: 1},
+			Values: map[string]interface{}{"s": secret{Value: 2}, "i": 3},
+			Errors: []error{fmt.Errorf("wrapped: %w", errors.New("cause")), nil},
+		},
+		{Values: map[string]interface{}{"inner": Item{Secret: secret{Value: 4}}}},
+	}
+	tests := []struct {
+		name string
+		opt  *Options
+	}{
+		{name: "requires_unexported", opt: &Options{PackageName: "other", PackagePath: "github.com/other/other"}},
+		{name: "exported_only", opt: &Options{PackageName: "other", PackagePath: "github.com/other/other", ExportedOnly: true}},
+		{name: "same_package", opt: &Options{PackageName: "valast", PackagePath: "github.com/hexops/valast"}},
+	}
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.name, func(t *testing.T) {
+			result, err := AST(reflect.ValueOf(input), tst.opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var omissions []string
+			for _, o := range result.Omissions {
+				omissions = append(omissions, fmt.Sprintf("%s: %v (%s)", o.Path, o.Type, o.Reason))
+			}
+			autogold.Equal(t, omissions)
+
+			// Paths are tracked differently for options which use them, with the same result.
+			opt := *tst.opt
+			opt.SourceMap = true
+			withPaths, err := AST(reflect.ValueOf(input), &opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(withPaths.Omissions, result.Omissions) {
+				t.Fatalf("omissions differ when tracking paths:\n%v\n%v", withPaths.Omissions, result.Omissions)
+			}
+		})
+	}
+}
+
+func TestQualify(t *testing.T) {
+	type MyInt int
+	input := struct {
+		Int     int
+		Int32   int32
+		Named   MyInt
+		Float   float64
+		Bool    bool
+		String  string
+		Ptr     *int32
+		Any     interface{}
+		NaN32   float32
+		Numbers []uint8
+	}{
+		Int:     1,
+		Int32:   2,
+		Named:   3,
+		Float:   4.5,
+		Bool:    true,
+		String:  "foo",
+		Ptr:     Ptr(int32(6)),
+		Any:     int64(7),
+		NaN32:   float32(math.NaN()),
+		Numbers: []uint8{8, 9},
+	}
+	policies := []struct {
+		name   string
+		policy QualifyPolicy
+	}{
+		{name: "auto", policy: QualifyAuto},
+		{name: "always", policy: QualifyAlways},
+		{name: "never", policy: QualifyNever},
+	}
+	for _, tst := range policies {
+		tst := tst
+		t.Run(tst.name, func(t *testing.T) {
+			autogold.Equal(t, StringWithOptions(input, &Options{
+				Qualify: func(t reflect.Type) QualifyPolicy { return tst.policy },
+			}))
+		})
+	}
+	t.Run("per_kind", func(t *testing.T) {
+		autogold.Equal(t, StringWithOptions(input, &Options{
+			Qualify: func(t reflect.Type) QualifyPolicy {
+				if t.Kind() == reflect.Int32 || t.Kind() == reflect.Int64 {
+					return QualifyAlways
+				}
+				return QualifyNever
+			},
+		}))
+	})
+	t.Run("top_level_never", func(t *testing.T) {
+		autogold.Equal(t, StringWithOptions(MyInt(3), &Options{
+			Qualify: func(t reflect.Type) QualifyPolicy { return QualifyNever },
+		}))
+	})
+	t.Run("interface_values", func(t *testing.T) {
+		// Values held by interfaces keep their dynamic types under every policy.
+		values := map[string]interface{}{
+			"int": 1, "int64": int64(2), "uint8": uint8(3), "float64": 4.5, "float32": float32(5.5),
+			"integral": 6.0, "rune": 'x', "string": "s", "bool": true,
+			"nested": []interface{}{int16(7), map[interface{}]interface{}{uint(8): float32(9)}},
+		}
+		for _, tst := range policies {
+			str := StringWithOptions(values, &Options{
+				Unqualify: true,
+				Qualify:   func(t reflect.Type) QualifyPolicy { return tst.policy },
+			})
+			got, err := Eval(str, reflect.TypeOf(values))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got.Interface(), values) {
+				t.Fatalf("%s: dynamic types not preserved\nwant: %#v\ngot:  %#v\nsource: %s", tst.name, values, got.Interface(), str)
+			}
+		}
+	})
+}
+
+func TestStringAs(t *testing.T) {
+	type MyInt int
+	type MySlice []int
+	var (
+		anyType      = reflect.TypeOf((*interface{})(nil)).Elem()
+		durationType = reflect.TypeOf(time.Duration(0))
+	)
+	tests := []struct {
+		name  string
+		input interface{}
+		t     reflect.Type
+		opt   *Options
+	}{
+		{name: "named_int", input: MyInt(3), t: reflect.TypeOf(MyInt(0))},
+		{name: "named_int_interface", input: MyInt(3), t: anyType},
+		{name: "duration", input: 2 * time.Second, t: durationType},
+		{name: "int8", input: int8(3), t: reflect.TypeOf(int8(0))},
+		{name: "float64_interface", input: 2.5, t: anyType},
+		{name: "float64_integral_interface", input: 2.0, t: anyType},
+		{name: "float32_nan", input: float32(math.NaN()), t: reflect.TypeOf(float32(0))},
+		{name: "unnamed_slice", input: []int{1, 2}, t: reflect.TypeOf(MySlice(nil))},
+		{name: "nil_pointer", input: (*int)(nil), t: reflect.TypeOf((*int)(nil))},
+		{name: "nil_pointer_interface", input: (*int)(nil), t: anyType},
+		{name: "nil_map", input: map[string]int(nil), t: reflect.TypeOf(map[string]int(nil))},
+		{name: "nil", input: nil, t: anyType},
+		{name: "nil_int", input: nil, t: reflect.TypeOf(0)},
+		{name: "not_assignable", input: int64(3), t: reflect.TypeOf(0)},
+		{name: "int32_interface_unqualify", input: int32(1), t: anyType, opt: &Options{Unqualify: true}},
+		{name: "int32_interface_qualify_never", input: int32(1), t: anyType, opt: &Options{
+			Qualify: func(t reflect.Type) QualifyPolicy { return QualifyNever },
+		}},
+		{name: "interfaces_unqualify", input: []interface{}{int32(1), float32(2)}, t: anyType, opt: &Options{Unqualify: true}},
+	}
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			autogold.Equal(t, StringAsWithOptions(tst.input, tst.t, tst.opt))
+		})
+	}
+}
+
+func TestInterface(t *testing.T) {
+	var (
+		named     test.Bazer = test.NewBaz()
+		anonymous interface {
+			String() string
+		} = test.NewBaz()
+		empty      interface{} = int64(7)
+		emptyInt   interface{} = 7
+		nilError   error
+		unexported interface{ a() string }
+	)
+	tests := []struct {
+		name       string
+		unexported bool
+		input      reflect.Value
+		opt        *Options
+	}{
+		{name: "named", unexported: true, input: reflect.ValueOf(&named).Elem()},
+		{name: "named_unqualify", unexported: true, input: reflect.ValueOf(&named).Elem(), opt: &Options{Unqualify: true}},
+		{name: "anonymous", unexported: true, input: reflect.ValueOf(&anonymous).Elem()},
+		{name: "empty", input: reflect.ValueOf(&empty).Elem()},
+		{name: "empty_unqualify", input: reflect.ValueOf(&empty).Elem(), opt: &Options{Unqualify: true}},
+		{name: "empty_untyped_default", input: reflect.ValueOf(&emptyInt).Elem()},
+		{name: "nil", input: reflect.ValueOf(&nilError).Elem()},
+		{name: "nil_anonymous", input: reflect.ValueOf(&unexported).Elem()},
+	}
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.name, func(t *testing.T) {
+			if tst.unexported {
+				requireUnexported(t)
+			}
+			opt := tst.opt
+			if opt == nil {
+				opt = &Options{}
+			}
+			res, err := AST(tst.input, opt)
+			got, _, err := formatResult(tst.input.Interface(), res, err, opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			autogold.Equal(t, got)
+		})
+	}
+}
+
+func TestErrorValues(t *testing.T) {
+	notFound := errors.New("not found")
+	tests := []struct {
+		name  string
+		input interface{}
+		opt   *Options
+	}{
+		{name: "new", input: errors.New("boom")},
+		{name: "errorf", input: fmt.Errorf("code %d", 42)},
+		{name: "wrapped", input: fmt.Errorf("loading config: %w", notFound)},
+		{name: "wrapped_twice", input: fmt.Errorf("100%% failed: %w (retrying)", fmt.Errorf("open: %w", notFound))},
+		{
+			name: "field",
+			input: struct {
+				Err  error
+				Errs []error
+			}{
+				Err:  fmt.Errorf("request: %w", notFound),
+				Errs: []error{notFound, nil},
+			},
+		},
+		{name: "exported_only", input: fmt.Errorf("x: %w", notFound), opt: &Options{ExportedOnly: true}},
+		{name: "join", input: errors.Join(notFound, nil, errors.New("denied"))},
+		{name: "join_wrapped", input: fmt.Errorf("saving: %w", errors.Join(notFound, fmt.Errorf("retry: %w", notFound)))},
+		{name: "wrapped_multiple", input: fmt.Errorf("%w, then %w", notFound, errors.New("denied"))},
+	}
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.name, func(t *testing.T) {
+			autogold.Equal(t, StringWithOptions(tst.input, tst.opt))
+		})
+	}
+}
+
+type money int64
+
+func (m money) Value() (driver.Value, error) { return int64(m), nil }
+
+func TestSQL(t *testing.T) {
+	type row struct {
+		Name    sql.NullString
+		Age     sql.NullInt64
+		Deleted sql.NullTime
+		Score   sql.NullFloat64
+		Admin   sql.NullBool
+		Balance money
+		Limit   *money
+		Nothing *money
+	}
+	input := row{
+		Name:    sql.NullString{String: "alice", Valid: true},
+		Age:     sql.NullInt64{Int64: 31},
+		Deleted: sql.NullTime{Time: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), Valid: true},
+		Admin:   sql.NullBool{Bool: true, Valid: true},
+		Balance: 1250,
+		Limit:   Ptr(money(5000)),
+	}
+	t.Run("default", func(t *testing.T) {
+		autogold.Equal(t, String(input))
+	})
+	t.Run("driver_values", func(t *testing.T) {
+		autogold.Equal(t, StringWithOptions(input, &Options{DriverValues: true}))
+	})
+}
+
+func TestMaxDepth(t *testing.T) {
+	type inner struct {
+		Values []int
+		Labels map[string]string
+	}
+	type outer struct {
+		Name  string
+		Inner inner
+		Ptr   *inner
+		List  []inner
+		Empty []inner
+	}
+	input := outer{
+		Name:  "example",
+		Inner: inner{Values: []int{1, 2}, Labels: map[string]string{"a": "b"}},
+		Ptr:   &inner{Values: []int{3}},
+		List:  []inner{{Values: []int{4}}},
+	}
+	for _, depth := range []int{1, 2, 3} {
+		depth := depth
+		t.Run(fmt.Sprint(depth), func(t *testing.T) {
+			autogold.Equal(t, StringWithOptions(input, &Options{MaxDepth: depth}))
+		})
+	}
+}
+
+func TestMaxElements(t *testing.T) {
+	input := struct {
+		Slice []int
+		Array [5]string
+		Map   map[string]int
+	}{
+		Slice: []int{1, 2, 3, 4, 5},
+		Array: [5]string{"a", "b", "c", "d", "e"},
+		Map:   map[string]int{"a": 1, "b": 2, "c": 3},
+	}
+	autogold.Equal(t, StringWithOptions(input, &Options{MaxElements: 2}))
+	t.Run("single_line", func(t *testing.T) {
+		autogold.Equal(t, fmt.Sprint(FormatterWithOptions(input, &Options{MaxElements: 2})))
+	})
+}
+
+func TestMaxStringLen(t *testing.T) {
+	type name string
+	input := struct {
+		Short   string
+		Long    string
+		Unicode string
+		Named   name
+		Slice   []string
+	}{
+		Short:   "abc",
+		Long:    strings.Repeat("abcdef", 700),
+		Unicode: "héllo wörld",
+		Named:   "abcdefgh",
+		Slice:   []string{"abcdefgh", "abc"},
 	}
+	autogold.Equal(t, StringWithOptions(input, &Options{MaxStringLen: 6}))
+	t.Run("single_line", func(t *testing.T) {
+		autogold.Equal(t, fmt.Sprint(FormatterWithOptions(input, &Options{MaxStringLen: 6})))
+	})
+	t.Run("disabled", func(t *testing.T) {
+		long := strings.Repeat("a", 10000)
+		if got := String(long); got != strconv.Quote(long) {
+			t.Fatal("expected the string not to be truncated by default")
+		}
+	})
+}
+
+func TestMaxNesting(t *testing.T) {
+	type node struct {
+		Value int
+		Next  *node
+	}
+	list := func(n int) *node {
+		var head *node
+		for i := n; i > 0; i-- {
+			head = &node{Value: i, Next: head}
+		}
+		return head
+	}
+
+	// Converting a list of a million nodes would otherwise overflow the stack.
+	_, err := AST(reflect.ValueOf(list(1000000)), nil)
+	var tooDeep *ErrTooDeep
+	if !errors.As(err, &tooDeep) || tooDeep.Limit != 10000 {
+		t.Fatalf("expected *ErrTooDeep, got %v", err)
+	}
+	if _, err := AST(reflect.ValueOf(list(1000)), nil); err != nil {
+		t.Fatalf("unexpected error within limit: %v", err)
+	}
+	t.Run("partial", func(t *testing.T) {
+		autogold.Equal(t, StringWithOptions(list(5), &Options{MaxNesting: 4, Partial: true}))
+	})
+}
+
+// TestPrimitiveSlices tests that slices of primitives converted via the fast path of
+// primitiveSliceAST are written the same as via computeAST, which is used when Options.SourceMap
+// is set.
+func TestPrimitiveSlices(t *testing.T) {
+	type ids []int
+	inputs := []interface{}{
+		[]int{1, -2, 300},
+		ids{4, 5},
+		[]string{"a", "b\nc", `"quoted"`},
+		[]float64{1.5, 1e21, math.NaN(), math.Inf(-1)},
+		[]byte("hello"),
+		[]int(nil),
+		struct{ Values []int }{Values: []int{1, 2, 3}},
+	}
+	opts := []*Options{
+		{},
+		{IntBase: func(reflect.Type) int { return 16 }},
+		{FloatFormat: FloatFormatDecimal, StringStyle: StringStylePreferRaw},
+		{MaxElements: 2},
+	}
+	for _, input := range inputs {
+		for _, opt := range opts {
+			want := *opt
+			want.SourceMap = true
+			if got, want := StringWithOptions(input, opt), StringWithOptions(input, &want); got != want {
+				t.Errorf("%#v: got %s, want %s", input, got, want)
+			}
+		}
+	}
+	autogold.Equal(t, StringWithOptions([]interface{}{[]int{1, 2}, []float64{math.NaN()}}, nil))
 }
 
 func TestIssue15_addr_values_must_be_qualified(t *testing.T) {
+	requireUnexported(t)
 	f32 := float32(3607)
 	i32 := int32(3607)
 	i64 := int64(3607)
@@ -1090,3 +4597,71 @@ func BenchmarkComplexType(b *testing.B) {
 		_ = String(v)
 	}
 }
+
+type benchmarkRow struct {
+	ID      int
+	Name    string
+	Score   float64
+	Tags    []string
+	Attrs   map[string]int
+	Enabled bool
+}
+
+func benchmarkRows(n int) []benchmarkRow {
+	rows := make([]benchmarkRow, n)
+	for i := range rows {
+		rows[i] = benchmarkRow{
+			ID:      i,
+			Name:    fmt.Sprint("row-", i),
+			Score:   float64(i) / 3,
+			Tags:    []string{"a", "b"},
+			Attrs:   map[string]int{"x": i, "y": i * 2},
+			Enabled: i%2 == 0,
+		}
+	}
+	return rows
+}
+
+func BenchmarkAST(b *testing.B) {
+	v := reflect.ValueOf(benchmarkRows(1000))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := AST(v, &Options{PackagePath: "github.com/hexops/valast"}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPrimitiveSlices(b *testing.B) {
+	ints, strs, floats, bytes := make([]int, 10000), make([]string, 10000), make([]float64, 10000), make([]byte, 10000)
+	for i := range ints {
+		ints[i], strs[i], floats[i], bytes[i] = i, fmt.Sprint(i), float64(i)/3, byte(i)
+	}
+	for _, v := range []interface{}{ints, strs, floats, bytes} {
+		v := reflect.ValueOf(v)
+		b.Run(v.Type().String(), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := AST(v, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkString(b *testing.B) {
+	rows := benchmarkRows(100)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		StringWithOptions(rows, &Options{PackagePath: "github.com/hexops/valast"})
+	}
+}
+
+func BenchmarkStringSingleLine(b *testing.B) {
+	rows := benchmarkRows(100)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		StringWithOptions(rows, &Options{PackagePath: "github.com/hexops/valast", SingleLine: true})
+	}
+}
@@ -0,0 +1,91 @@
+// Package valasthttp provides an HTTP handler which renders a value as syntax-highlighted Go
+// code, e.g. as a "dump current config/state" endpoint during development.
+package valasthttp
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/hexops/valast"
+)
+
+// Handler returns an HTTP handler which calls get for each request and responds with the returned
+// value rendered as syntax-highlighted Go code in an HTML page, or as plain text if the request
+// has the query parameter format=text:
+//
+//	http.Handle("/debug/config", valasthttp.Handler(func() interface{} { return cfg }))
+//
+// Values are rendered with Options.Partial set and the default depth and element limits, see
+// HandlerWithOptions.
+func Handler(get func() interface{}) http.Handler {
+	return HandlerWithOptions(get, nil)
+}
+
+// HandlerWithOptions is like Handler, but renders values with the specified options.
+//
+// Options.MaxDepth and Options.MaxElements are always enforced, such that large object graphs do
+// not produce unbounded responses: if zero, they default to DefaultMaxDepth and
+// DefaultMaxElements respectively. Options.Colorize is ignored.
+func HandlerWithOptions(get func() interface{}, opt *valast.Options) http.Handler {
+	var o valast.Options
+	if opt != nil {
+		o = *opt
+	} else {
+		o.Partial = true
+	}
+	o.Colorize = false
+	if o.MaxDepth <= 0 {
+		o.MaxDepth = DefaultMaxDepth
+	}
+	if o.MaxElements <= 0 {
+		o.MaxElements = DefaultMaxElements
+	}
+	return &handler{get: get, converter: valast.NewConverter(&o)}
+}
+
+const (
+	// DefaultMaxDepth is the default Options.MaxDepth of handlers.
+	DefaultMaxDepth = 16
+
+	// DefaultMaxElements is the default Options.MaxElements of handlers.
+	DefaultMaxElements = 1000
+)
+
+type handler struct {
+	get       func() interface{}
+	converter *valast.Converter
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	if err := h.converter.Fprint(&buf, h.get()); err != nil && buf.Len() == 0 {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	if r.URL.Query().Get("format") == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(buf.Bytes())
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(page(buf.String()))
+}
+
+// page returns an HTML page displaying the Go syntax src with syntax highlighting.
+func page(src string) []byte {
+	return []byte(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>valast</title>
+<style>
+` + valast.HTMLStyle + `</style>
+</head>
+<body>
+` + valast.HighlightHTML(src) + `
+</body>
+</html>
+`)
+}
@@ -0,0 +1,61 @@
+package valasthttp
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hexops/autogold"
+	"github.com/hexops/valast"
+)
+
+type config struct {
+	Name    string
+	Debug   bool
+	Workers int
+	Hosts   []string
+	Limits  map[string]float64
+	Err     chan error
+}
+
+func TestHandler(t *testing.T) {
+	cfg := &config{
+		Name:    "<example>",
+		Debug:   true,
+		Workers: 4,
+		Hosts:   []string{"a.example", "b.example", "c.example"},
+		Limits:  map[string]float64{"cpu": 0.5},
+		Err:     make(chan error),
+	}
+	tests := []struct {
+		name  string
+		query string
+		opt   *valast.Options
+	}{
+		{name: "html"},
+		{name: "text", query: "?format=text"},
+		{name: "max_elements", query: "?format=text", opt: &valast.Options{MaxElements: 2, Partial: true}},
+	}
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.name, func(t *testing.T) {
+			h := HandlerWithOptions(func() interface{} { return cfg }, tst.opt)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest("GET", "/"+tst.query, nil))
+			body, err := io.ReadAll(rec.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			autogold.Equal(t, string(body))
+		})
+	}
+
+	t.Run("error", func(t *testing.T) {
+		h := Handler(func() interface{} { return make(chan int) })
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		if rec.Code != 500 {
+			t.Fatalf("expected status 500, got %d", rec.Code)
+		}
+	})
+}
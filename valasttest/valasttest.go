@@ -0,0 +1,90 @@
+// Package valasttest provides golden testing of values, rendered as Go syntax by valast.
+package valasttest
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hexops/gotextdiff"
+	"github.com/hexops/gotextdiff/myers"
+	"github.com/hexops/gotextdiff/span"
+	"github.com/hexops/valast"
+
+	// Registers the -update flag, which is shared such that both packages may be used together.
+	_ "github.com/hexops/autogold"
+)
+
+// Equal checks if got, rendered as Go syntax, is equal to the golden file testdata/<test name>.go.
+// If it is not, t.Fatal is called with a diff of the Go syntax.
+//
+// If the go test -update flag is specified, the golden file is created or updated instead.
+//
+// Values are rendered with Options.Deterministic set, such that the golden file is stable across
+// runs.
+func Equal(t testing.TB, got interface{}) {
+	t.Helper()
+	EqualWithOptions(t, got, nil)
+}
+
+// EqualWithOptions is like Equal, but renders got with the specified options. Options.Deterministic
+// is always set.
+func EqualWithOptions(t testing.TB, got interface{}, opt *valast.Options) {
+	t.Helper()
+	var o valast.Options
+	if opt != nil {
+		o = *opt
+	}
+	o.Deterministic = true
+
+	gotSrc, err := render(t, got, &o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden := filepath.Join("testdata", strings.ReplaceAll(t.Name(), "/", "__")+".go")
+	want, err := os.ReadFile(golden)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	if string(want) == gotSrc {
+		return
+	}
+	if update() {
+		if err := os.MkdirAll(filepath.Dir(golden), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(golden, []byte(gotSrc), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	edits := myers.ComputeEdits(span.URIFromPath(golden), string(want), gotSrc)
+	t.Fatalf("mismatch (-want +got):\n%s", gotextdiff.ToUnified("want", "got", string(want), edits))
+}
+
+// render returns the Go file declaring the value v as a golden file.
+func render(t testing.TB, v interface{}, opt *valast.Options) (string, error) {
+	tmp := filepath.Join(t.TempDir(), "golden.go")
+	if err := valast.WriteGoFile(tmp, "testdata", map[string]interface{}{"Golden": v}, opt); err != nil {
+		return "", fmt.Errorf("valasttest: %w", err)
+	}
+	src, err := os.ReadFile(tmp)
+	return string(src), err
+}
+
+// update reports if the go test -update flag was specified.
+func update() bool {
+	f := flag.Lookup("update")
+	if f == nil {
+		return false
+	}
+	getter, ok := f.Value.(flag.Getter)
+	if !ok {
+		return false
+	}
+	v, _ := getter.Get().(bool)
+	return v
+}
@@ -0,0 +1,56 @@
+package valasttest
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hexops/valast"
+	"github.com/hexops/valast/internal/test"
+)
+
+type config struct {
+	Name    string
+	Ports   []int
+	Labels  map[string]string
+	Backend *test.Baz
+}
+
+func TestEqual(t *testing.T) {
+	Equal(t, config{
+		Name:    "api",
+		Ports:   []int{80, 443},
+		Labels:  map[string]string{"zone": "b", "env": "prod"},
+		Backend: &test.Baz{Bam: 1},
+	})
+}
+
+func TestEqualWithOptions(t *testing.T) {
+	EqualWithOptions(t, []int{255, 16}, &valast.Options{
+		IntBase: func(t reflect.Type) int { return 16 },
+	})
+}
+
+// recorder records the failure of a test named name.
+type recorder struct {
+	testing.TB
+	name, failure string
+}
+
+func (r *recorder) Name() string { return r.name }
+
+func (r *recorder) Fatalf(format string, args ...interface{}) {
+	r.failure = fmt.Sprintf(format, args...)
+}
+
+func TestEqual_mismatch(t *testing.T) {
+	if update() {
+		t.Skip("would update the golden file of TestEqual")
+	}
+	r := &recorder{TB: t, name: "TestEqual"}
+	Equal(r, config{Name: "web", Ports: []int{80, 443}})
+	if !strings.Contains(r.failure, `-	Name: "api",`) || !strings.Contains(r.failure, `+	Name: "web",`) {
+		t.Fatalf("expected a diff of the Go syntax, got:\n%s", r.failure)
+	}
+}
@@ -0,0 +1,37 @@
+// Package valastulid registers a valast handler for github.com/oklog/ulid/v2.ULID values, such
+// that they are written as `ulid.MustParse("…")` instead of an array of 16 bytes. It is used for
+// its side effect:
+//
+//	import _ "github.com/hexops/valast/valastulid"
+//
+// It is a separate module so that users of valast do not depend on the ulid package.
+package valastulid
+
+import (
+	"go/ast"
+	"go/token"
+	"strconv"
+
+	"github.com/hexops/valast"
+	"github.com/oklog/ulid/v2"
+)
+
+const pkgPath = "github.com/oklog/ulid/v2"
+
+func init() {
+	valast.Register(func(v ulid.ULID) (ast.Expr, []string, error) {
+		return AST(v), []string{pkgPath}, nil
+	})
+}
+
+// AST returns the Go syntax for the ULID v, `ulid.ULID{}` if it is zero and
+// `ulid.MustParse("…")` otherwise.
+func AST(v ulid.ULID) ast.Expr {
+	if v == (ulid.ULID{}) {
+		return &ast.CompositeLit{Type: &ast.SelectorExpr{X: ast.NewIdent("ulid"), Sel: ast.NewIdent("ULID")}}
+	}
+	return &ast.CallExpr{
+		Fun:  &ast.SelectorExpr{X: ast.NewIdent("ulid"), Sel: ast.NewIdent("MustParse")},
+		Args: []ast.Expr{&ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(v.String())}},
+	}
+}
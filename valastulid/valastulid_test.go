@@ -0,0 +1,23 @@
+package valastulid
+
+import (
+	"testing"
+
+	"github.com/hexops/autogold"
+	"github.com/hexops/valast"
+	"github.com/oklog/ulid/v2"
+)
+
+type event struct {
+	ID     ulid.ULID
+	Parent ulid.ULID
+	Causes []ulid.ULID
+}
+
+func TestRegister(t *testing.T) {
+	id := ulid.MustParse("01ARZ3NDEKTSV4RRFFQ69G5FAV")
+	autogold.Equal(t, valast.String(event{
+		ID:     id,
+		Causes: []ulid.ULID{id, {}},
+	}))
+}
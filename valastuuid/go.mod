@@ -0,0 +1,20 @@
+module github.com/hexops/valast/valastuuid
+
+go 1.20
+
+require (
+	github.com/google/uuid v1.6.0
+	github.com/hexops/autogold v0.8.1
+	github.com/hexops/valast v1.4.4
+)
+
+require (
+	github.com/google/go-cmp v0.5.9 // indirect
+	github.com/hexops/gotextdiff v1.0.3 // indirect
+	golang.org/x/mod v0.7.0 // indirect
+	golang.org/x/sys v0.3.0 // indirect
+	golang.org/x/tools v0.4.0 // indirect
+	mvdan.cc/gofumpt v0.4.0 // indirect
+)
+
+replace github.com/hexops/valast => ../
@@ -0,0 +1,37 @@
+// Package valastuuid registers a valast handler for github.com/google/uuid.UUID values, such that
+// they are written as `uuid.MustParse("…")` instead of an array of 16 bytes. It is used for its
+// side effect:
+//
+//	import _ "github.com/hexops/valast/valastuuid"
+//
+// It is a separate module so that users of valast do not depend on the uuid package.
+package valastuuid
+
+import (
+	"go/ast"
+	"go/token"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/hexops/valast"
+)
+
+const pkgPath = "github.com/google/uuid"
+
+func init() {
+	valast.Register(func(v uuid.UUID) (ast.Expr, []string, error) {
+		return AST(v), []string{pkgPath}, nil
+	})
+}
+
+// AST returns the Go syntax for the UUID v, `uuid.Nil` if it is zero and `uuid.MustParse("…")`
+// otherwise.
+func AST(v uuid.UUID) ast.Expr {
+	if v == uuid.Nil {
+		return &ast.SelectorExpr{X: ast.NewIdent("uuid"), Sel: ast.NewIdent("Nil")}
+	}
+	return &ast.CallExpr{
+		Fun:  &ast.SelectorExpr{X: ast.NewIdent("uuid"), Sel: ast.NewIdent("MustParse")},
+		Args: []ast.Expr{&ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(v.String())}},
+	}
+}
@@ -0,0 +1,25 @@
+package valastuuid
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/hexops/autogold"
+	"github.com/hexops/valast"
+)
+
+type user struct {
+	ID      uuid.UUID
+	Parent  uuid.UUID
+	Friends []uuid.UUID
+	Invite  *uuid.UUID
+}
+
+func TestRegister(t *testing.T) {
+	id := uuid.MustParse("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	autogold.Equal(t, valast.String(user{
+		ID:      id,
+		Friends: []uuid.UUID{id, uuid.Nil},
+		Invite:  &id,
+	}))
+}
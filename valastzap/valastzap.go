@@ -0,0 +1,53 @@
+// Package valastzap provides zap integration for valast, lazily rendering values as Go syntax in
+// structured logs.
+//
+// It is a separate module so that users of valast do not depend on zap.
+package valastzap
+
+import (
+	"fmt"
+
+	"github.com/hexops/valast"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Any returns a zap field with the given key whose value is v rendered as Go syntax, see
+// Marshaler.
+func Any(key string, v interface{}) zap.Field {
+	return zap.Object(key, Marshaler(v))
+}
+
+// Marshaler returns a zapcore.ObjectMarshaler which renders v as Go syntax on a single line (see
+// valast.Formatter) when it is encoded, e.g. for debug-level diagnostics of config and request
+// objects:
+//
+//	logger.Debug("handling request", valastzap.Any("req", req))
+//
+// The object has two fields: "type", the Go type of v, and "value", its Go syntax. The value is
+// only converted if the entry is actually written. It is rendered with valast.LogOptions, which
+// limit the depth and size of the output.
+func Marshaler(v interface{}) zapcore.ObjectMarshaler {
+	return MarshalerWithOptions(v, nil)
+}
+
+// MarshalerWithOptions is like Marshaler, but renders v with the specified options instead of
+// valast.LogOptions.
+func MarshalerWithOptions(v interface{}, opt *valast.Options) zapcore.ObjectMarshaler {
+	if opt == nil {
+		opt = valast.LogOptions()
+	}
+	return marshaler{v: v, opt: opt}
+}
+
+type marshaler struct {
+	v   interface{}
+	opt *valast.Options
+}
+
+// MarshalLogObject implements the zapcore.ObjectMarshaler interface.
+func (m marshaler) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("type", fmt.Sprintf("%T", m.v))
+	enc.AddString("value", fmt.Sprint(valast.FormatterWithOptions(m.v, m.opt)))
+	return nil
+}
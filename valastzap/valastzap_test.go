@@ -0,0 +1,39 @@
+package valastzap
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/hexops/autogold"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type request struct {
+	Method string
+	Path   string
+	Query  map[string][]string
+}
+
+func TestAny(t *testing.T) {
+	var buf bytes.Buffer
+	logger := zap.New(zapcore.NewCore(
+		zapcore.NewJSONEncoder(zapcore.EncoderConfig{MessageKey: "msg"}),
+		zapcore.AddSync(&buf),
+		zapcore.InfoLevel,
+	))
+	logger.Info("handling request", Any("req", request{
+		Method: "GET",
+		Path:   "/search",
+		Query:  map[string][]string{"q": {"valast"}},
+	}))
+	autogold.Equal(t, buf.String())
+
+	t.Run("discarded", func(t *testing.T) {
+		logger.Debug("discarded", Any("value", make(chan int)))
+		if strings.Contains(buf.String(), "discarded") {
+			t.Fatal("expected debug entry to be discarded")
+		}
+	})
+}
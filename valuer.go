@@ -0,0 +1,29 @@
+package valast
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+)
+
+var valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+
+// valuerAST converts v into the value returned by its driver.Valuer implementation, if
+// Options.DriverValues is set, reporting if so.
+func valuerAST(v reflect.Value, opt *Options, path string, s *state) (Result, bool, error) {
+	if !opt.DriverValues || !implementsRenderer(v, valuerType) {
+		return Result{}, false, nil
+	}
+	value, err := v.Interface().(driver.Valuer).Value()
+	if err != nil {
+		return Result{}, true, fmt.Errorf("valast: %T.Value(): %w", v.Interface(), err)
+	}
+	mark := len(s.omissions)
+	s.pushOpaque(opt, path, false)
+	r, err := computeASTProfiled(reflect.ValueOf(value), opt.withQualify(), s.fieldPath(path, "Value()"), s)
+	s.popOpaque(opt)
+	if len(s.omissions) > mark {
+		s.prefixOmissions(mark, ".Value()")
+	}
+	return r, true, err
+}
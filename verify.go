@@ -0,0 +1,158 @@
+package valast
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ErrNotEquivalent describes that the Go syntax produced for a value does not evaluate to an equal
+// value, e.g. because unexported fields were omitted or a function was stubbed.
+type ErrNotEquivalent struct {
+	// Source is the Go syntax produced for the value.
+	Source string
+
+	// Diffs describes each difference between the value and the result of evaluating Source, e.g.
+	// `.Tags[1]: "b" != "c"`.
+	Diffs []string
+}
+
+// Error implements the error interface.
+func (e *ErrNotEquivalent) Error() string {
+	return fmt.Sprintf("valast: output is not equivalent to input:\n\t%s", strings.Join(e.Diffs, "\n\t"))
+}
+
+// Verify converts the value v into Go syntax as StringWithOptions does, then evaluates the result
+// via Eval and compares it to v. It returns the Go syntax, and an *ErrNotEquivalent error if the
+// evaluated value differs from v.
+//
+// Verify is limited to values which Eval supports.
+func Verify(v interface{}, opt *Options) (string, error) {
+	src, _, err := formatValue(v, opt)
+	if err != nil {
+		return "", err
+	}
+	if v == nil {
+		if src != "nil" {
+			return src, &ErrNotEquivalent{Source: src, Diffs: []string{fmt.Sprintf("nil != %s", src)}}
+		}
+		return src, nil
+	}
+	got, err := Eval(src, reflect.TypeOf(v))
+	if err != nil {
+		return src, err
+	}
+	var diffs []string
+	valueDiff("", reflect.ValueOf(v), got, &diffs)
+	if len(diffs) > 0 {
+		return src, &ErrNotEquivalent{Source: src, Diffs: diffs}
+	}
+	return src, nil
+}
+
+// valueDiff appends a description of each difference between the values want and got, found at
+// the given path, to diffs. NaN values are considered equal to each other.
+func valueDiff(path string, want, got reflect.Value, diffs *[]string) {
+	name := path
+	if name == "" {
+		name = "value"
+	}
+	if want.IsValid() != got.IsValid() {
+		*diffs = append(*diffs, fmt.Sprintf("%s: %s != %s", name, describeValue(want), describeValue(got)))
+		return
+	}
+	if !want.IsValid() {
+		return
+	}
+	if want.Type() != got.Type() {
+		*diffs = append(*diffs, fmt.Sprintf("%s: type %s != %s", name, want.Type(), got.Type()))
+		return
+	}
+	want, got = unexported(want), unexported(got)
+	if !want.CanInterface() || !got.CanInterface() {
+		// Unexported values cannot be compared without package unsafe, and are omitted anyway.
+		return
+	}
+	switch want.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if want.IsNil() || got.IsNil() {
+			if want.IsNil() != got.IsNil() {
+				*diffs = append(*diffs, fmt.Sprintf("%s: %s != %s", name, describeValue(want), describeValue(got)))
+			}
+			return
+		}
+		valueDiff(path, want.Elem(), got.Elem(), diffs)
+	case reflect.Struct:
+		for i := 0; i < want.NumField(); i++ {
+			valueDiff(path+"."+want.Type().Field(i).Name, want.Field(i), got.Field(i), diffs)
+		}
+	case reflect.Slice, reflect.Array:
+		if want.Kind() == reflect.Slice && want.IsNil() != got.IsNil() {
+			*diffs = append(*diffs, fmt.Sprintf("%s: %s != %s", name, describeValue(want), describeValue(got)))
+			return
+		}
+		if want.Len() != got.Len() {
+			*diffs = append(*diffs, fmt.Sprintf("%s: length %d != %d", name, want.Len(), got.Len()))
+			return
+		}
+		for i := 0; i < want.Len(); i++ {
+			valueDiff(fmt.Sprintf("%s[%d]", path, i), want.Index(i), got.Index(i), diffs)
+		}
+	case reflect.Map:
+		if want.IsNil() != got.IsNil() {
+			*diffs = append(*diffs, fmt.Sprintf("%s: %s != %s", name, describeValue(want), describeValue(got)))
+			return
+		}
+		keys := want.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return valueLess(keys[i], keys[j]) })
+		for _, key := range keys {
+			keyPath := fmt.Sprintf("%s[%s]", path, describeValue(key))
+			gotValue := got.MapIndex(key)
+			if !gotValue.IsValid() {
+				*diffs = append(*diffs, fmt.Sprintf("%s: missing", keyPath))
+				continue
+			}
+			valueDiff(keyPath, want.MapIndex(key), gotValue, diffs)
+		}
+		for _, key := range got.MapKeys() {
+			if !want.MapIndex(key).IsValid() {
+				*diffs = append(*diffs, fmt.Sprintf("%s[%s]: unexpected", path, describeValue(key)))
+			}
+		}
+	case reflect.Float32, reflect.Float64:
+		a, b := want.Float(), got.Float()
+		if a != b && !(math.IsNaN(a) && math.IsNaN(b)) {
+			*diffs = append(*diffs, fmt.Sprintf("%s: %s != %s", name, describeValue(want), describeValue(got)))
+		}
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		if want.Pointer() != got.Pointer() {
+			*diffs = append(*diffs, fmt.Sprintf("%s: %s != %s", name, describeValue(want), describeValue(got)))
+		}
+	default:
+		if want.Interface() != got.Interface() {
+			*diffs = append(*diffs, fmt.Sprintf("%s: %s != %s", name, describeValue(want), describeValue(got)))
+		}
+	}
+}
+
+// describeValue returns a short description of v for use in a diff.
+func describeValue(v reflect.Value) string {
+	if !v.IsValid() {
+		return "nil"
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map, reflect.Func, reflect.Chan:
+		if v.IsNil() {
+			return "nil"
+		}
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Struct, reflect.Array, reflect.Func, reflect.Chan:
+		return v.Type().String()
+	case reflect.String:
+		return fmt.Sprintf("%q", v.String())
+	}
+	return fmt.Sprint(unexported(v).Interface())
+}